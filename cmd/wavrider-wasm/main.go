@@ -0,0 +1,97 @@
+//go:build js && wasm
+
+// Command wavrider-wasm exposes the decoder to JavaScript so tape captures
+// can be decoded entirely in the browser. Build it with
+//
+//	GOOS=js GOARCH=wasm go build -o wavrider.wasm ./cmd/wavrider-wasm
+//
+// and load it alongside wasm_exec.js from the Go distribution. It defines
+// a global wavrider.decode(arrayBuffer, options) that returns a Promise
+// resolving to {data, sampleRate, duration, programs} where data is a
+// Uint8Array of the decoded bytes.
+package main
+
+import (
+	"bytes"
+	"syscall/js"
+	"wavrider/internal/decoder"
+)
+
+func main() {
+	js.Global().Set("wavrider", js.ValueOf(map[string]any{
+		"decode": js.FuncOf(decode),
+	}))
+
+	// Keep the exported functions alive
+	select {}
+}
+
+// decode(arrayBuffer, options) -> Promise
+//
+// options is an optional object; options.jobs sets how many goroutines
+// decode the segments of a long capture.
+func decode(this js.Value, args []js.Value) any {
+	if len(args) < 1 {
+		return rejected("decode: expected an ArrayBuffer or Uint8Array")
+	}
+
+	src := js.Global().Get("Uint8Array").New(args[0])
+	wav := make([]byte, src.Get("length").Int())
+	js.CopyBytesToGo(wav, src)
+
+	var opts decoder.Options
+	if len(args) > 1 && args[1].Type() == js.TypeObject {
+		if jobs := args[1].Get("jobs"); jobs.Type() == js.TypeNumber {
+			opts.Workers = jobs.Int()
+		}
+	}
+
+	return js.Global().Get("Promise").New(js.FuncOf(func(this js.Value, p []js.Value) any {
+		resolve, reject := p[0], p[1]
+		go func() {
+			data, catalog, err := decoder.DecodeReader(bytes.NewReader(wav), opts)
+			if err != nil {
+				reject.Invoke(js.Global().Get("Error").New(err.Error()))
+				return
+			}
+			resolve.Invoke(result(data, catalog))
+		}()
+		return nil
+	}))
+}
+
+func result(data []byte, c *decoder.Catalog) js.Value {
+	out := js.Global().Get("Uint8Array").New(len(data))
+	js.CopyBytesToJS(out, data)
+
+	var programs []any
+	for _, r := range c.Regions {
+		if r.Kind != decoder.RegionData {
+			continue
+		}
+		start, end, _ := c.ProgramSpan(r.Program)
+		program := map[string]any{
+			"program":    r.Program,
+			"start":      start,
+			"end":        end,
+			"bytes":      r.Bytes,
+			"checksumOK": r.ChecksumOK,
+			"confidence": r.Confidence,
+		}
+		if v := r.Verified; v.Algorithm != "" {
+			program["checksum"] = v.String()
+		}
+		programs = append(programs, program)
+	}
+
+	return js.ValueOf(map[string]any{
+		"data":       out,
+		"sampleRate": int(c.SampleRate),
+		"duration":   c.Duration,
+		"programs":   programs,
+	})
+}
+
+func rejected(msg string) js.Value {
+	return js.Global().Get("Promise").Call("reject", js.Global().Get("Error").New(msg))
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"runtime"
+	"wavrider/internal/decoder"
+)
+
+// runAlign reports how a second capture of a tape lines up with a first:
+// how far it is shifted and how much faster or slower it played
+func runAlign(args []string) int {
+	fs := flag.NewFlagSet("align", flag.ContinueOnError)
+	jobs := fs.Int("jobs", runtime.GOMAXPROCS(0), "number of segments of a long capture to decode concurrently")
+	decodeOptions := decodeFlags(fs)
+	applyProfile := profileFlags(fs)
+	if code, ok := parseFlags(fs, args); !ok {
+		return code
+	}
+	if err := applyProfile(); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return exitError
+	}
+	if fs.NArg() != 2 {
+		usage()
+		return exitError
+	}
+	opts, err := decodeOptions()
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return exitError
+	}
+	opts.Workers = *jobs
+
+	var catalogs [2]*decoder.Catalog
+	for i, name := range fs.Args() {
+		fmt.Printf("Processing %s...\n", name)
+		_, catalogs[i], err = decoder.DecodeFileRecords(name, opts)
+		if err != nil {
+			fmt.Printf("Error: %s: %v\n", name, err)
+			return decodeOutcome(nil, err)
+		}
+	}
+	al, err := decoder.Align(catalogs[0], catalogs[1])
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return exitError
+	}
+
+	first, second := fs.Arg(0), fs.Arg(1)
+	fmt.Printf("The start of %s is at %ss in %s, which plays %s times as long (%s speed)\n", first, signed(al.Offset, 3), second, fixed(al.Ratio, 4), change(1/al.Ratio))
+	fmt.Printf("Header tones line up at %d moments, %s RMS from the fit:\n", len(al.Pairs), seconds(al.RMS, 3))
+	for _, p := range al.Pairs {
+		edge := "ends"
+		if p.Start {
+			edge = "starts"
+		}
+		fmt.Printf("  program %d header %-6s %s  %s  %ss\n", p.Program, edge, clockMillis(p.A), clockMillis(p.B), signed(p.B-al.At(p.A), 3))
+	}
+	return exitOK
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+	"slices"
+	"strings"
+	"wavrider/internal/decoder"
+)
+
+// runAnalyze grades how well each tape was recorded, so that those
+// needing another transfer can be told from those the decoder failed
+func runAnalyze(args []string) int {
+	fs := flag.NewFlagSet("analyze", flag.ContinueOnError)
+	jobs := fs.Int("jobs", runtime.GOMAXPROCS(0), "number of segments of a long capture to decode concurrently")
+	histogram := fs.Bool("histogram", false, "draw how the half-cycles' lengths spread about the thresholds")
+	decodeOptions := decodeFlags(fs)
+	applyProfile := profileFlags(fs)
+	if code, ok := parseFlags(fs, args); !ok {
+		return code
+	}
+	if err := applyProfile(); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return exitError
+	}
+	if fs.NArg() < 1 {
+		usage()
+		return exitError
+	}
+	opts, err := decodeOptions()
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return exitError
+	}
+	opts.Workers = *jobs
+
+	code := exitOK
+	for _, filename := range fs.Args() {
+		_, catalog, err := decoder.DecodeWithCatalog(filename, opts)
+		if err != nil {
+			fmt.Printf("Error: %s: %v\n", filename, err)
+			code = exitError
+			continue
+		}
+		printQuality(os.Stdout, filename, catalog.Quality())
+		if catalog.Eye != nil {
+			printEye(os.Stdout, catalog.Eye, *histogram)
+		}
+	}
+	return code
+}
+
+// printQuality writes the grade and each measurement behind it, e.g.
+// "  speed            +1.4%       B"
+func printQuality(w io.Writer, filename string, q decoder.Quality) {
+	if q.Grade == 0 {
+		fmt.Fprintf(w, "%s: no header tone found to grade; is it the right system?\n", filename)
+	} else {
+		fmt.Fprintf(w, "%s: grade %c\n", filename, q.Grade)
+	}
+	for _, g := range q.Grades {
+		var value string
+		switch g.Name {
+		case "signal to noise":
+			value = decibels(q.SNR)
+		case "speed":
+			value = change(q.Speed)
+		case "jitter":
+			value = percent(q.Jitter, 1)
+		case "dropouts":
+			value = fmt.Sprint(q.Dropouts)
+		case "clipping":
+			value = percent(q.Clipped, 2)
+		}
+		fmt.Fprintf(w, "  %-16s %-11s %c\n", g.Name, value, g.Grade)
+	}
+}
+
+// eyeRows is the most rows the histogram is drawn in
+const eyeRows = 30
+
+// printEye writes how clear of each threshold the half-cycles kept, e.g.
+// "  350 us threshold: shorter reach 290 us, longer start at 430 us, 57% open",
+// and with histogram a bar chart of their lengths
+func printEye(w io.Writer, eye *decoder.Eye, histogram bool) {
+	for _, o := range eye.Openings {
+		fmt.Fprintf(w, "  %s threshold: shorter reach %s, longer start at %s, %s open\n",
+			micros(o.Threshold), micros(o.Below), micros(o.Above), percent(o.Opening, 0))
+	}
+	if !histogram {
+		return
+	}
+
+	// Only the bins from the shortest half-cycle to the longest are drawn
+	first, last := -1, 0
+	for i, n := range eye.Counts {
+		if n > 0 {
+			if first < 0 {
+				first = i
+			}
+			last = i
+		}
+	}
+	group := (last - first + eyeRows) / eyeRows
+	var rows []int
+	for i := first; i <= last; i += group {
+		n := 0
+		for _, c := range eye.Counts[i:min(i+group, len(eye.Counts))] {
+			n += c
+		}
+		rows = append(rows, n)
+	}
+	peak := slices.Max(rows)
+	next := 0
+	for r, n := range rows {
+		start := float64(first+r*group) * eye.BinWidth
+		end := start + float64(group)*eye.BinWidth
+		for next < len(eye.Openings) && eye.Openings[next].Threshold < end {
+			fmt.Fprintf(w, "  %17s +%s\n", micros(eye.Openings[next].Threshold), strings.Repeat("-", 50))
+			next++
+		}
+		bar := strings.Repeat("#", (n*50+peak-1)/peak)
+		fmt.Fprintf(w, "  %7s–%-7s |%s\n", micros(start), micros(end), bar)
+	}
+}
+
+// micros formats seconds as whole microseconds
+func micros(seconds float64) string {
+	return fixed(seconds*1e6, 0) + " us"
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"math"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"wavrider/internal/decoder"
+)
+
+// Audio goes to the sound card through the tools every desktop has for
+// it: aplay from ALSA on Linux, afplay on macOS and the .NET SoundPlayer
+// through PowerShell on Windows, each playing on the default device.
+// Those that cannot read a WAV from a pipe are given a temporary file.
+// It comes from the sound card through arecord on Linux and SoX on macOS.
+
+// playLevel is the fraction of full scale the loudest sample is played
+// at. Line inputs such as the Apple ]['s cassette port want a hot signal,
+// but not one that clips.
+const playLevel = 0.9
+
+// playAudio plays samples at rate on the default sound device, scaled so
+// the loudest is at level of full scale, and returns once they are played
+func playAudio(samples []float64, rate uint32, level float64) error {
+	peak := 0.0
+	for _, v := range samples {
+		peak = max(peak, math.Abs(v))
+	}
+	scaled := make([]float64, len(samples))
+	if peak > 0 {
+		for i, v := range samples {
+			scaled[i] = v * level / peak
+		}
+	}
+	var wav bytes.Buffer
+	if err := decoder.WriteWAV(&wav, scaled, rate); err != nil {
+		return err
+	}
+
+	if runtime.GOOS == "linux" {
+		cmd := exec.Command("aplay", "-q", "-t", "wav", "-")
+		cmd.Stdin = &wav
+		return runAudioTool(cmd)
+	}
+	dir, err := os.MkdirTemp("", "wavrider-play-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "tape.wav")
+	if err := os.WriteFile(path, wav.Bytes(), 0644); err != nil {
+		return err
+	}
+	switch runtime.GOOS {
+	case "darwin":
+		return runAudioTool(exec.Command("afplay", path))
+	case "windows":
+		return runAudioTool(exec.Command("powershell", "-NoProfile", "-Command", "(New-Object Media.SoundPlayer "+shellQuote(path)+").PlaySync()"))
+	}
+	return fmt.Errorf("playing audio is not supported on %s", runtime.GOOS)
+}
+
+// runAudioTool runs a tool playing or recording audio, saying which if it
+// fails
+func runAudioTool(cmd *exec.Cmd) error {
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("%s: %w", filepath.Base(cmd.Path), err)
+	}
+	return nil
+}
+
+// recordAudio returns the command recording mono 16-bit audio at rate
+// from the default input device, as a WAV on its stdout, for seconds or,
+// if 0, until ctx is done, when it is interrupted to end the WAV cleanly
+func recordAudio(ctx context.Context, rate uint32, seconds int) (*exec.Cmd, error) {
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "linux":
+		args := []string{"-q", "-t", "wav", "-f", "S16_LE", "-c", "1", "-r", strconv.Itoa(int(rate))}
+		if seconds > 0 {
+			args = append(args, "-d", strconv.Itoa(seconds))
+		}
+		cmd = exec.CommandContext(ctx, "arecord", args...)
+	case "darwin":
+		// CoreAudio has no recorder of its own to hand, so SoX's is used
+		args := []string{"-q", "-d", "-t", "wav", "-b", "16", "-e", "signed-integer", "-c", "1", "-r", strconv.Itoa(int(rate)), "-"}
+		if seconds > 0 {
+			args = append(args, "trim", "0", strconv.Itoa(seconds))
+		}
+		cmd = exec.CommandContext(ctx, "sox", args...)
+	default:
+		return nil, fmt.Errorf("recording audio is not supported on %s", runtime.GOOS)
+	}
+	cmd.Cancel = func() error { return cmd.Process.Signal(os.Interrupt) }
+	cmd.Stderr = os.Stderr
+	return cmd, nil
+}
+
+// tone returns seconds of a sine wave at hz, at rate
+func tone(hz, seconds float64, rate uint32) []float64 {
+	samples := make([]float64, int(seconds*float64(rate)))
+	for i := range samples {
+		samples[i] = math.Sin(2 * math.Pi * hz * float64(i) / float64(rate))
+	}
+	return samples
+}
@@ -0,0 +1,348 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"flag"
+	"fmt"
+	"hash"
+	"io"
+	"log/slog"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+	"wavrider/internal/decoder"
+)
+
+// batchResult holds everything a worker produced for one input so that
+// results can be reported in input order regardless of completion order
+type batchResult struct {
+	input   string
+	outputs []batchOutput
+	records []decoder.Record
+	log     bytes.Buffer
+	decoded int
+	catalog *decoder.Catalog
+	err     error
+	begun   bool // false if the batch was interrupted first
+
+	// source, if not nil, hashes the input as it is decoded, to
+	// sourceHash
+	source     hash.Hash
+	sourceHash string
+}
+
+// batchOutput is a file written for an input
+type batchOutput struct {
+	name   string
+	size   int
+	sha256 string
+}
+
+func runBatch(args []string) int {
+	fs := flag.NewFlagSet("batch", flag.ContinueOnError)
+	jobs := fs.Int("jobs", runtime.GOMAXPROCS(0), "number of files to decode concurrently")
+	outDir := fs.String("out-dir", "", "directory for decoded files (default: next to each input)")
+	checkpoint := fs.Bool("checkpoint", false, "save the progress of each long capture to a .checkpoint file beside its output as it decodes")
+	resume := fs.Bool("resume", false, "take up decodes that were interrupted from their .checkpoint files, checkpointing as they go")
+	timeout := fs.Duration("timeout", 0, "give up on a file that takes longer than this to decode, 0 for no limit")
+	dbPath := fs.String("db", "", "record each decode in the SQLite `file`, for the catalog command to list and search")
+	decodeOptions := decodeFlags(fs)
+	outputOpts := outputFlags(fs)
+	newLogger := logFlags(fs)
+	applyProfile := profileFlags(fs)
+	if code, ok := parseFlags(fs, args); !ok {
+		return code
+	}
+	if err := applyProfile(); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return exitError
+	}
+	opts, err := decodeOptions()
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return exitError
+	}
+
+	opts.Resume = *resume
+
+	files, err := expandArchives(fs.Args())
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return exitError
+	}
+	if len(files) == 0 {
+		usage()
+		return exitError
+	}
+
+	if err := batchCollision(files, *outDir, outputOpts, opts.System, *checkpoint || *resume); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return exitError
+	}
+
+	workers := *jobs
+	if workers < 1 {
+		workers = 1
+	}
+	if workers > len(files) {
+		workers = len(files)
+	}
+
+	// An interrupt stops the batch gracefully: no more files are begun,
+	// and those under way stop where they have got to and write what they
+	// read, keeping their checkpoints
+	ctx, stop := interruptContext()
+	defer stop()
+	fmt.Printf("Decoding %d files on %d workers\n", len(files), workers)
+
+	started := time.Now()
+	results := make([]batchResult, len(files))
+	next := make(chan int)
+	var wg sync.WaitGroup
+	for range workers {
+		wg.Go(func() {
+			for i := range next {
+				fileOpts := opts
+				if *checkpoint || *resume {
+					fileOpts.Checkpoint = checkpointName(files[i], *outDir)
+				}
+				if *dbPath != "" {
+					results[i].source = sha256.New()
+				}
+				decodeBatchFile(ctx, *timeout, &results[i], files[i], *outDir, fileOpts, outputOpts, newLogger)
+			}
+		})
+	}
+	for i := range files {
+		if ctx.Err() != nil {
+			break
+		}
+		select {
+		case next <- i:
+		case <-ctx.Done():
+		}
+	}
+	close(next)
+	wg.Wait()
+
+	failed := 0
+	total := 0
+	var notBegun []string
+	status := runStatus{code: exitOK}
+	for i := range results {
+		r := &results[i]
+		if !r.begun {
+			notBegun = append(notBegun, files[i])
+			continue
+		}
+		fmt.Printf("Processing %s...\n", r.input)
+		os.Stdout.Write(r.log.Bytes())
+		status.add(r.catalog, r.decoded)
+		status.code = worse(status.code, decodeOutcome(r.catalog, r.err))
+		if r.err != nil {
+			fmt.Printf("Error: %v\n", r.err)
+			failed++
+			continue
+		}
+		if err := outputOpts.addToDisk(os.Stdout, r.input, r.records); err != nil {
+			fmt.Printf("Error writing disk image: %v\n", err)
+			status.code = worse(status.code, exitError)
+			failed++
+			continue
+		}
+		total += r.decoded
+		for _, m := range outputOpts.known.identify(r.records, outputOpts.names) {
+			fmt.Printf("File %d is %s, %s\n", m.file, m.title, m.how)
+		}
+		if len(r.outputs) == 0 && outputOpts.dsk == "" {
+			fmt.Println("No data decoded. No files written")
+		}
+		var written []dbOutput
+		for _, o := range r.outputs {
+			if o.size > 0 {
+				fmt.Printf("Decoded %s. Written to %s\n", byteCount(o.size), o.name)
+			} else {
+				fmt.Printf("No data decoded. Created empty file %s\n", o.name)
+			}
+			written = append(written, dbOutput{o.name, o.size, o.sha256})
+		}
+		if *dbPath != "" {
+			dups, err := recordDecode(*dbPath, r.input, r.sourceHash, opts.System, r.catalog, r.records, written, decodeOutcome(r.catalog, nil))
+			if err != nil {
+				fmt.Printf("Error recording the decode: %v\n", err)
+				status.code = worse(status.code, exitError)
+			}
+			for _, d := range dups {
+				fmt.Println(d)
+			}
+		}
+	}
+
+	fmt.Printf("Processed %d files (%d failed), %s decoded\n", len(files)-len(notBegun), failed, size(int64(total)))
+	if len(notBegun) > 0 {
+		fmt.Printf("Interrupted before %d files were begun:\n", len(notBegun))
+		for _, name := range notBegun {
+			fmt.Printf("  %s\n", name)
+		}
+		status.code = worse(status.code, exitInterrupted)
+	}
+	status.finish(time.Since(started))
+	printSummary(os.Stdout, status.decodeStats)
+	writeStatusLine(os.Stderr, status)
+	return status.code
+}
+
+// decodeBatchFile decodes one input into r, writing the output next to the
+// input (or into outDir) with the extension replaced by the output
+// format's, such as .bin or .cas, or as named by the output template. A
+// decode interrupted through ctx writes what it read; one that takes
+// longer than timeout, if above 0, fails.
+func decodeBatchFile(ctx context.Context, timeout time.Duration, r *batchResult, input, outDir string, opts decoder.Options, outputOpts *outputOptions, newLogger func(io.Writer) *slog.Logger) {
+	r.input = input
+	r.begun = true
+
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	opts.Context = ctx
+	opts.Log = newLogger(&r.log)
+	if r.source != nil {
+		opts.Source = r.source
+	}
+	records, catalog, err := decoder.DecodeFileRecords(input, opts)
+	if err == nil && catalog.Interrupted && ctx.Err() == context.DeadlineExceeded {
+		err = fmt.Errorf("timed out after %s, at %s of %s", timeout, clock(catalog.StoppedAt), clock(catalog.Duration))
+	}
+	if err == nil && r.source != nil {
+		r.sourceHash, err = hashSource(r.source, input, ctx.Err() != nil)
+	}
+	if err != nil {
+		r.err = err
+		return
+	}
+	r.catalog = catalog
+	r.records = records
+	name := batchOutputName(input, outDir, outputOpts.ext(opts.System))
+	if outputOpts.dsk != "" {
+		// The disk image is the output, added to in input order
+		name = ""
+	}
+	outputs, err := outputOpts.write(name, input, records, catalog, opts.System)
+	if err != nil {
+		r.err = err
+		return
+	}
+	for _, o := range outputs {
+		if outputOpts.template != "" {
+			o.name = filepath.Join(orDefault(outDir, inputDir(input)), o.name)
+		}
+		if err := os.WriteFile(o.name, o.data, 0644); err != nil {
+			r.err = fmt.Errorf("writing output: %w", err)
+			return
+		}
+		r.outputs = append(r.outputs, batchOutput{o.name, len(o.data), hashBytes(o.data)})
+		r.decoded += len(o.data)
+		if err := outputOpts.runExec(&r.log, o, input, opts.System); err != nil {
+			r.err = err
+			return
+		}
+	}
+}
+
+// batchCollision returns an error if the outputs or checkpoints of two
+// inputs would be written to the same file, as for captures of the same
+// name in different directories or archives, which workers decoding
+// them at once would overwrite each other's. A template is checked with
+// only the variables of the input filled in, the rest being the same
+// for every input.
+func batchCollision(files []string, outDir string, outputOpts *outputOptions, system *decoder.System, checkpoints bool) error {
+	ext := outputOpts.ext(system)
+	writer := map[string]string{} // the input each file is written for
+	for _, input := range files {
+		var names []string
+		switch {
+		case outputOpts.template != "":
+			name := expand(outputOpts.template, map[string]string{templateBase: inputBase(input), templateExt: ext})
+			names = append(names, filepath.Join(orDefault(outDir, inputDir(input)), name))
+		case outputOpts.dsk == "":
+			names = append(names, batchOutputName(input, outDir, ext))
+		}
+		if checkpoints {
+			names = append(names, checkpointName(input, outDir))
+		}
+		for _, name := range names {
+			if other, ok := writer[name]; ok {
+				return fmt.Errorf("%s and %s would both be written to %s; decode them in separate batches", other, input, name)
+			}
+			writer[name] = input
+		}
+	}
+	return nil
+}
+
+// batchOutputName names the default output of an input, with extension
+// ext in place of the input's
+func batchOutputName(input, outDir, ext string) string {
+	return filepath.Join(orDefault(outDir, inputDir(input)), inputBase(input)+ext)
+}
+
+// inputDir is where an input's outputs go without -out-dir: beside it,
+// or its archive, or for a URL in the current directory
+func inputDir(input string) string {
+	if decoder.IsURL(input) {
+		return "."
+	}
+	archive, _, _ := decoder.SplitArchive(input)
+	return filepath.Dir(archive)
+}
+
+// inputBase is an input's file name without its extensions, or for a URL
+// that of the file in its path, for a capture in an archive its own, and
+// for standard input "output"
+func inputBase(input string) string {
+	if input == decoder.Stdin {
+		return "output"
+	}
+	if _, member, ok := decoder.SplitArchive(input); ok {
+		input = member
+	} else if u, err := url.Parse(input); err == nil && decoder.IsURL(input) {
+		input = u.Path
+	}
+	input = decoder.TrimCompressed(filepath.Base(input))
+	return strings.TrimSuffix(input, filepath.Ext(input))
+}
+
+// expandArchives replaces each archive among inputs with the captures in
+// it
+func expandArchives(inputs []string) ([]string, error) {
+	var out []string
+	for _, input := range inputs {
+		if !decoder.IsArchive(input) {
+			out = append(out, input)
+			continue
+		}
+		members, err := decoder.ArchiveMembers(input)
+		if err != nil {
+			return nil, fmt.Errorf("listing %s: %w", input, err)
+		}
+		if len(members) == 0 {
+			return nil, fmt.Errorf("%s holds no WAV files", input)
+		}
+		out = append(out, members...)
+	}
+	return out, nil
+}
+
+// checkpointName names the checkpoint of an input's decode as the default
+// output is named
+func checkpointName(input, outDir string) string {
+	return batchOutputName(input, outDir, ".checkpoint")
+}
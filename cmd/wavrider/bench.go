@@ -0,0 +1,101 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"runtime"
+	"time"
+	"wavrider/internal/decoder"
+)
+
+// runBench times decoding a capture, or a synthetic tape, several times
+// over, so that the speed of the decoder can be compared between builds
+// and machines. The capture is read into memory first, so that only
+// decoding is timed.
+func runBench(args []string) int {
+	fs := flag.NewFlagSet("bench", flag.ContinueOnError)
+	jobs := fs.Int("jobs", runtime.GOMAXPROCS(0), "number of segments of a long capture to decode concurrently")
+	runs := fs.Int("n", 3, "number of times to decode the capture")
+	synthetic := fs.Float64("synthetic", 0, "decode a synthetic tape of the system's records lasting `minutes` instead of a capture")
+	decodeOptions := decodeFlags(fs)
+	applyProfile := profileFlags(fs)
+	if code, ok := parseFlags(fs, args); !ok {
+		return code
+	}
+	if err := applyProfile(); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return exitError
+	}
+	if (*synthetic > 0) == (fs.NArg() == 1) || fs.NArg() > 1 || *runs < 1 {
+		usage()
+		return exitError
+	}
+	opts, err := decodeOptions()
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return exitError
+	}
+	opts.Workers = *jobs
+
+	var wav []byte
+	if *synthetic > 0 {
+		fmt.Printf("Writing a synthetic tape of %s...\n", clock(60**synthetic))
+		samples, err := decoder.SyntheticTape(60**synthetic, opts)
+		if err == nil {
+			var buf bytes.Buffer
+			err = decoder.WriteWAV(&buf, samples, decoder.RelaminateRate)
+			wav = buf.Bytes()
+		}
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			return exitError
+		}
+	} else {
+		fmt.Printf("Reading %s...\n", fs.Arg(0))
+		if wav, err = readInput(fs.Arg(0)); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			return exitError
+		}
+	}
+
+	var total, fastest time.Duration
+	var audio float64
+	for i := range *runs {
+		started := time.Now()
+		_, catalog, err := decoder.DecodeReader(bytes.NewReader(wav), opts)
+		elapsed := time.Since(started)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			return decodeOutcome(nil, err)
+		}
+		audio = catalog.Duration
+		total += elapsed
+		if i == 0 || elapsed < fastest {
+			fastest = elapsed
+		}
+		fmt.Printf("Run %d: %d programs in %s, %s\n", i+1, catalog.Programs, elapsed.Round(time.Millisecond), throughput(len(wav), audio, elapsed))
+	}
+	mean := total / time.Duration(*runs)
+	fmt.Printf("%s of audio, %s of WAV, decoded %d times with %d jobs\n", clockMillis(audio), size(int64(len(wav))), *runs, *jobs)
+	fmt.Printf("Fastest: %s, %s\n", fastest.Round(time.Millisecond), throughput(len(wav), audio, fastest))
+	fmt.Printf("Mean:    %s, %s\n", mean.Round(time.Millisecond), throughput(len(wav), audio, mean))
+	return exitOK
+}
+
+// readInput reads the whole of a capture, however it is named
+func readInput(name string) ([]byte, error) {
+	f, err := decoder.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return io.ReadAll(f)
+}
+
+// throughput is how fast n bytes holding audio seconds long decoded, in
+// bytes a second and as a multiple of realtime
+func throughput(n int, audio float64, elapsed time.Duration) string {
+	return fmt.Sprintf("%s, %s realtime", rate(n, elapsed), times(audio/elapsed.Seconds(), 1))
+}
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"wavrider/internal/decoder"
+)
+
+// Prompt tones, played while capturing so that whoever is at the machine
+// can tell how the session is going without watching the screen: one
+// when recording starts, to type SAVE, and one as each record ends,
+// high if it checked out and low if it did not
+const (
+	promptStart = 1000 // Hz
+	promptGood  = 2000 // Hz
+	promptBad   = 250  // Hz
+	promptShort = 0.15 // seconds
+	promptLong  = 0.6  // seconds, for a bad record, to be noticed
+)
+
+// runCapture records a tape from the line-in, drawing the decode as it
+// goes, and writes both the capture and what was decoded from it
+func runCapture(args []string) int {
+	fs := flag.NewFlagSet("capture", flag.ContinueOnError)
+	outfile := fs.String("o", "", "file to write the decoded bytes to (default output and the format's extension, e.g. output.bin)")
+	rate := fs.Int("rate", decoder.RelaminateRate, "samples a second to record at")
+	seconds := fs.Int("duration", 0, "seconds to record for (default until interrupted)")
+	prompt := fs.Bool("prompt", false, "play a tone on the default output when recording starts and as each record ends, high if it checked out and low if not")
+	decodeOptions := decodeFlags(fs)
+	applyProfile := profileFlags(fs)
+	if code, ok := parseFlags(fs, args); !ok {
+		return code
+	}
+	if err := applyProfile(); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return exitError
+	}
+	if fs.NArg() != 1 {
+		usage()
+		return exitError
+	}
+	opts, err := decodeOptions()
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return exitError
+	}
+	if *rate <= 0 || *seconds < 0 {
+		fmt.Println("Error: -rate must be above 0 and -duration not below it")
+		return exitError
+	}
+	if *outfile == "" {
+		*outfile = "output" + opts.System.Ext()
+	}
+	wavName := fs.Arg(0)
+
+	ctx, stop := interruptContext()
+	defer stop()
+	recorder, err := recordAudio(ctx, uint32(*rate), *seconds)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return exitError
+	}
+	audio, err := recorder.StdoutPipe()
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return exitError
+	}
+	wav, err := os.Create(wavName)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return exitError
+	}
+	defer wav.Close()
+	out, err := os.Create(*outfile)
+	if err != nil {
+		fmt.Printf("Error writing output: %v\n", err)
+		return exitError
+	}
+	defer out.Close()
+
+	// Tones are played one after another as they come, so decoding never
+	// waits for them
+	tones := make(chan []float64, 16)
+	played := make(chan error, 1)
+	go func() {
+		var err error
+		for samples := range tones {
+			if err == nil {
+				err = playAudio(samples, uint32(*rate), playLevel)
+			}
+		}
+		played <- err
+	}()
+	if *prompt {
+		tones <- tone(promptStart, promptShort, uint32(*rate))
+	}
+
+	if err := recorder.Start(); err != nil {
+		fmt.Printf("Error: recording: %v\n", err)
+		return exitError
+	}
+	t := newTUI(os.Stdout, wavName)
+	opts.Progress = t.progress
+	opts.Output = out
+	good, bad := 0, 0
+	fmt.Print("\x1b[?25l")
+	err = decoder.DecodeStream(io.TeeReader(audio, wav), opts, func(e decoder.Event) {
+		if e.Kind != decoder.EventRecordEnd {
+			return
+		}
+		switch {
+		case e.ChecksumOK:
+			good++
+			if *prompt {
+				tones <- tone(promptGood, promptShort, uint32(*rate))
+			}
+		default:
+			bad++
+			if *prompt {
+				tones <- tone(promptBad, promptLong, uint32(*rate))
+			}
+		}
+	})
+	t.draw()
+	fmt.Print("\x1b[?25h")
+	// Whatever stopped the decode, the recorder is done with, and one
+	// interrupted may well say so by failing
+	interrupted := ctx.Err() != nil
+	stop()
+	recordErr := recorder.Wait()
+	close(tones)
+	if err == nil && recordErr != nil && !interrupted {
+		err = fmt.Errorf("recording: %w", recordErr)
+	}
+	if err == nil {
+		err = <-played
+	}
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return exitError
+	}
+
+	if err := finishWAV(wav); err != nil {
+		fmt.Printf("Error writing capture: %v\n", err)
+		return exitError
+	}
+	if err := out.Close(); err != nil {
+		fmt.Printf("Error writing output: %v\n", err)
+		return exitError
+	}
+	info, err := os.Stat(*outfile)
+	if err != nil {
+		fmt.Printf("Error writing output: %v\n", err)
+		return exitError
+	}
+	fmt.Printf("Captured %s to %s\n", clock(t.last.Time), wavName)
+	fmt.Printf("Decoded %s, %d records checking out of %d. Written to %s\n", byteCount(int(info.Size())), good, good+bad, *outfile)
+	switch {
+	case good+bad == 0:
+		return exitNoData
+	case bad > 0:
+		return exitPartial
+	}
+	return exitOK
+}
+
+// finishWAV sets the sizes in the header of a WAV that was written as a
+// stream, which recorders leave at 0 or as large as they go, to those of
+// what was written
+func finishWAV(f *os.File) error {
+	end, err := f.Seek(0, io.SeekEnd)
+	if err != nil {
+		return err
+	}
+	var chunk [8]byte
+	for at := int64(12); at+8 <= end; {
+		if _, err := f.ReadAt(chunk[:], at); err != nil {
+			return err
+		}
+		if bytes.Equal(chunk[:4], []byte("data")) {
+			if err := writeSize(f, at+4, end-at-8); err != nil {
+				return err
+			}
+			return writeSize(f, 4, end-8)
+		}
+		at += 8 + int64(binary.LittleEndian.Uint32(chunk[4:]))
+	}
+	return errors.New("no data in the recording")
+}
+
+// writeSize writes a chunk size at offset
+func writeSize(f *os.File, offset, size int64) error {
+	_, err := f.WriteAt(binary.LittleEndian.AppendUint32(nil, uint32(min(size, 0xFFFFFFFF))), offset)
+	return err
+}
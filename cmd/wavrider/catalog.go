@@ -0,0 +1,159 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+	"wavrider/internal/decoder"
+)
+
+// printCatalog writes one line per region, e.g.
+// "00:12–01:45 program 1, 2,314 bytes, checksum OK"
+func printCatalog(w io.Writer, c *decoder.Catalog) {
+	fmt.Fprintf(w, "Catalog (%s, %d programs", clock(c.Duration), c.Programs)
+	if c.Clipped > 0 {
+		fmt.Fprintf(w, ", %s clipped", percent(c.Clipped, 1))
+	}
+	fmt.Fprintln(w, "):")
+	for _, r := range c.Regions {
+		if r.Kind == decoder.RegionDropout {
+			// Dropouts last milliseconds, so give their exact position
+			fmt.Fprintf(w, "  %s dropout, %s", clockMillis(r.Start), milliseconds(r.End-r.Start))
+			if r.Program > 0 {
+				fmt.Fprintf(w, " in program %d", r.Program)
+			}
+			fmt.Fprintln(w)
+			continue
+		}
+		fmt.Fprintf(w, "  %s–%s %s", clock(r.Start), clock(r.End), r.Kind)
+		if r.Kind == decoder.RegionData {
+			status := "checksum OK"
+			if !r.ChecksumOK {
+				status = "checksum BAD"
+				if v := r.Verified; v.Algorithm != "" {
+					status += " (" + v.String() + ")"
+				}
+			}
+			fmt.Fprintf(w, " %d", r.Program)
+			if r.Name != "" {
+				fmt.Fprintf(w, " %q", r.Name)
+			}
+			fmt.Fprintf(w, ", %s, %s", byteCount(r.Bytes), status)
+			if r.Type != "" {
+				fmt.Fprintf(w, ", %s", r.Type)
+			}
+			if r.LoadAddress >= 0 {
+				fmt.Fprintf(w, " at 0x%04X", r.LoadAddress)
+			}
+			if r.Speed > 0 {
+				fmt.Fprintf(w, ", speed %s", change(r.Speed))
+			}
+			if r.Erasures > 0 {
+				fmt.Fprintf(w, ", %s erased", byteCount(r.Erasures))
+			}
+			if len(r.Misframed) > 0 {
+				fmt.Fprintf(w, ", %s misframed (%s)", byteCount(len(r.Misframed)), misframedAt(r.Misframed))
+			}
+			if len(r.Disputes) > 0 {
+				fmt.Fprintf(w, ", %s disputed (%s)", byteCount(len(r.Disputes)), disputeWinners(r.Disputes))
+			}
+			if r.Retry != "" {
+				fmt.Fprintf(w, ", read with %s", r.Retry)
+			}
+			if r.Note != "" {
+				fmt.Fprintf(w, "; %s", r.Note)
+			}
+		}
+		fmt.Fprintln(w)
+	}
+	if c.Interrupted {
+		fmt.Fprintf(w, "  %s–%s not decoded, the decode having been interrupted\n", clock(c.StoppedAt), clock(c.Duration))
+	}
+	printRetries(w, c)
+}
+
+// printRetries lists the options that read programs the given ones did
+// not, most programs first, e.g. "  -demod goertzel: programs 2, 5"
+func printRetries(w io.Writer, c *decoder.Catalog) {
+	programs := map[string][]string{}
+	var flags []string
+	for _, r := range c.Regions {
+		if r.Kind != decoder.RegionData || r.Retry == "" {
+			continue
+		}
+		if programs[r.Retry] == nil {
+			flags = append(flags, r.Retry)
+		}
+		programs[r.Retry] = append(programs[r.Retry], strconv.Itoa(r.Program))
+	}
+	if len(flags) == 0 {
+		return
+	}
+	slices.SortStableFunc(flags, func(a, b string) int {
+		return len(programs[b]) - len(programs[a])
+	})
+	fmt.Fprintln(w, "Read on retry, with options a profile for these tapes could use:")
+	for _, f := range flags {
+		noun := "programs"
+		if len(programs[f]) == 1 {
+			noun = "program"
+		}
+		fmt.Fprintf(w, "  %s: %s %s\n", f, noun, strings.Join(programs[f], ", "))
+	}
+}
+
+// disputeWinners summarizes which engine, or channel, won each disputed
+// byte, e.g. "goertzel won 3, matched won 1"
+func disputeWinners(disputes []decoder.Dispute) string {
+	var parts []string
+	if disputes[0].Channel > 0 {
+		for ch, name := range []string{"left", "right"} {
+			n := 0
+			for _, d := range disputes {
+				if d.Channel == ch+1 {
+					n++
+				}
+			}
+			if n > 0 {
+				parts = append(parts, fmt.Sprintf("%s won %d", name, n))
+			}
+		}
+		return strings.Join(parts, ", ")
+	}
+	for _, e := range decoder.Engines {
+		n := 0
+		for _, d := range disputes {
+			if d.Winner == e {
+				n++
+			}
+		}
+		if n > 0 {
+			parts = append(parts, fmt.Sprintf("%s won %d", e, n))
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+// misframedAt summarizes what was wrong with each misframed byte, e.g.
+// "2 bad parity, 1 missing stop bit"
+func misframedAt(errs []decoder.FrameError) string {
+	parity, stop := 0, 0
+	for _, e := range errs {
+		if e.Parity {
+			parity++
+		}
+		if e.Stop {
+			stop++
+		}
+	}
+	var parts []string
+	if parity > 0 {
+		parts = append(parts, fmt.Sprintf("%d bad parity", parity))
+	}
+	if stop > 0 {
+		parts = append(parts, fmt.Sprintf("%d missing stop bit", stop))
+	}
+	return strings.Join(parts, ", ")
+}
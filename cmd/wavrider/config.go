@@ -0,0 +1,101 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"github.com/BurntSushi/toml"
+)
+
+// config is the layout of config.toml. Each profile maps flag names to
+// the values to use when the flag is not given on the command line:
+//
+//	default_profile = "living-room"
+//
+//	[profiles.living-room]
+//	short-us = 380
+//	long-us = 650
+//	jobs = 4
+type config struct {
+	DefaultProfile string                    `toml:"default_profile"`
+	Profiles       map[string]map[string]any `toml:"profiles"`
+}
+
+// defaultConfigPath is ~/.config/wavrider/config.toml, or the platform's
+// equivalent user configuration directory
+func defaultConfigPath() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "wavrider", "config.toml")
+}
+
+// loadConfig reads a config file. A missing default config is not an
+// error, it just has no profiles.
+func loadConfig(path string, explicit bool) (*config, error) {
+	var c config
+	if path == "" {
+		return &c, nil
+	}
+	_, err := toml.DecodeFile(path, &c)
+	if errors.Is(err, fs.ErrNotExist) && !explicit {
+		return &c, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("config %s: %w", path, err)
+	}
+	return &c, nil
+}
+
+// profileFlags adds -profile and -config to the flag set and returns a
+// function to call after parsing that fills every flag not given on the
+// command line from the selected profile. Profile keys that are not flags
+// of this command are ignored, so one profile can serve several commands.
+func profileFlags(set *flag.FlagSet) func() error {
+	name := set.String("profile", "", "named profile from the config file supplying default flag values")
+	path := set.String("config", "", "config file (default "+defaultConfigPath()+")")
+
+	return func() error {
+		explicit := *path != ""
+		file := *path
+		if !explicit {
+			file = defaultConfigPath()
+		}
+		c, err := loadConfig(file, explicit)
+		if err != nil {
+			return err
+		}
+
+		profile := *name
+		if profile == "" {
+			profile = c.DefaultProfile
+		}
+		if profile == "" {
+			return nil
+		}
+		values, ok := c.Profiles[profile]
+		if !ok {
+			return fmt.Errorf("profile %q not found in %s", profile, file)
+		}
+
+		given := map[string]bool{}
+		set.Visit(func(f *flag.Flag) { given[f.Name] = true })
+		// In order, so the same bad profile always gives the same error
+		for _, key := range slices.Sorted(maps.Keys(values)) {
+			if given[key] || set.Lookup(key) == nil {
+				continue
+			}
+			if err := set.Set(key, fmt.Sprint(values[key])); err != nil {
+				return fmt.Errorf("profile %q: %s: %w", profile, key, err)
+			}
+		}
+		return nil
+	}
+}
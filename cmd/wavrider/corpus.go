@@ -0,0 +1,111 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"wavrider/internal/decoder"
+)
+
+// corpusExpected is the extension of the file beside each capture in a
+// corpus holding what it should decode to
+const corpusExpected = ".bin"
+
+// runCorpus decodes every capture in a directory that has the bytes it
+// should decode to beside it, and reports which decode them exactly and
+// how many of the bytes come out right across them all, so that a change
+// to the decoder can be checked against real tapes
+func runCorpus(args []string) int {
+	flags := flag.NewFlagSet("corpus", flag.ContinueOnError)
+	jobs := flags.Int("jobs", runtime.GOMAXPROCS(0), "number of segments of a long capture to decode concurrently")
+	decodeOptions := decodeFlags(flags)
+	applyProfile := profileFlags(flags)
+	if code, ok := parseFlags(flags, args); !ok {
+		return code
+	}
+	if err := applyProfile(); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return exitError
+	}
+	if flags.NArg() != 1 {
+		usage()
+		return exitError
+	}
+	opts, err := decodeOptions()
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return exitError
+	}
+	opts.Workers = *jobs
+
+	pairs, err := corpusPairs(flags.Arg(0))
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return exitError
+	}
+	if len(pairs) == 0 {
+		fmt.Printf("Error: %s holds no captures with a %s file beside them\n", flags.Arg(0), corpusExpected)
+		return exitError
+	}
+
+	passed, right, total := 0, 0, 0
+	for _, p := range pairs {
+		want, err := os.ReadFile(p[1])
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			return exitError
+		}
+		total += len(want)
+		got, _, err := decoder.DecodeWithCatalog(p[0], opts)
+		if err != nil {
+			fmt.Printf("FAIL %s: %v\n", p[0], err)
+			continue
+		}
+		wrong := 0
+		hunks := diffBytes(got, want)
+		for _, h := range hunks {
+			wrong += h.bLen
+		}
+		right += len(want) - wrong
+		if len(hunks) == 0 {
+			passed++
+			fmt.Printf("PASS %s, %s\n", p[0], byteCount(len(want)))
+			continue
+		}
+		fmt.Printf("FAIL %s, %d differences, %s of %s bytes wrong\n", p[0], len(hunks), thousands(wrong), thousands(len(want)))
+	}
+
+	accuracy := 1.0
+	if total > 0 {
+		accuracy = float64(right) / float64(total)
+	}
+	fmt.Printf("Passed %d of %d captures; %s of %s expected bytes right\n", passed, len(pairs), percent(accuracy, 2), thousands(total))
+	if passed < len(pairs) {
+		return exitDiffer
+	}
+	return exitOK
+}
+
+// corpusPairs finds every capture under dir with a file of the bytes it
+// should decode to beside it, named as it is but for the extension, and
+// returns their paths in order
+func corpusPairs(dir string) ([][2]string, error) {
+	var pairs [][2]string
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || !decoder.IsCapture(path) {
+			return err
+		}
+		capture := decoder.TrimCompressed(path)
+		expected := capture[:len(capture)-len(filepath.Ext(capture))] + corpusExpected
+		if _, err := os.Stat(expected); errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		pairs = append(pairs, [2]string{path, expected})
+		return nil
+	})
+	return pairs, err
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"wavrider/internal/decoder"
+)
+
+// writeCueSheet writes a cue sheet with one track per program, each
+// starting at the program's header tone
+func writeCueSheet(w io.Writer, wavFile string, c *decoder.Catalog) error {
+	if _, err := fmt.Fprintf(w, "FILE \"%s\" WAVE\n", filepath.Base(wavFile)); err != nil {
+		return err
+	}
+	for n := 1; n <= c.Programs; n++ {
+		start, _, _ := c.ProgramSpan(n)
+		fmt.Fprintf(w, "  TRACK %02d AUDIO\n", n)
+		fmt.Fprintf(w, "    TITLE \"%s\"\n", programLabel(c, n))
+		if _, err := fmt.Fprintf(w, "    INDEX 01 %s\n", cueTime(start)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeLabels writes an Audacity label track: tab separated start and end
+// seconds followed by the label text, one region per line
+func writeLabels(w io.Writer, c *decoder.Catalog) error {
+	for _, r := range c.Regions {
+		label := r.Kind.String()
+		if r.Program > 0 {
+			label = programLabel(c, r.Program)
+			if r.Kind == decoder.RegionHeader {
+				label += " header"
+			}
+		}
+		if _, err := fmt.Fprintf(w, "%.6f\t%.6f\t%s\n", r.Start, r.End, label); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// programLabel names program n after its size and checksum result, and
+// its name if it was given one
+func programLabel(c *decoder.Catalog, n int) string {
+	for _, r := range c.Regions {
+		if r.Kind == decoder.RegionData && r.Program == n {
+			status := "checksum OK"
+			if !r.ChecksumOK {
+				status = "checksum BAD"
+			}
+			if r.Name != "" {
+				return fmt.Sprintf("%s (program %d, %s, %s)", r.Name, n, byteCount(r.Bytes), status)
+			}
+			return fmt.Sprintf("Program %d (%s, %s)", n, byteCount(r.Bytes), status)
+		}
+	}
+	return fmt.Sprintf("Program %d", n)
+}
+
+// cueTime formats seconds as the mm:ss:ff cue sheet position, where ff
+// counts 1/75 second CD frames
+func cueTime(seconds float64) string {
+	frames := int(seconds * 75)
+	return fmt.Sprintf("%02d:%02d:%02d", frames/75/60, frames/75%60, frames%75)
+}
+
+// writeFileWith creates path and fills it using write
+func writeFileWith(path string, write func(io.Writer) error) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := write(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
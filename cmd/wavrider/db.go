@@ -0,0 +1,400 @@
+package main
+
+import (
+	"database/sql"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+	"wavrider/internal/decoder"
+
+	_ "modernc.org/sqlite"
+)
+
+// The decode database is a SQLite file recording every decode made with
+// -db: the capture, by name and hash, each program found on it and each
+// output written, so a digitization project can tell what it has done
+// and find what it holds. Decodes are only ever added.
+const dbSchema = `
+CREATE TABLE IF NOT EXISTS decodes (
+	id               INTEGER PRIMARY KEY,
+	decoded_at       TEXT NOT NULL,
+	source           TEXT NOT NULL,
+	source_sha256    TEXT NOT NULL,
+	system           TEXT NOT NULL,
+	duration_seconds REAL NOT NULL,
+	status           TEXT NOT NULL,
+	wavrider_version TEXT NOT NULL
+);
+CREATE TABLE IF NOT EXISTS programs (
+	decode_id     INTEGER NOT NULL REFERENCES decodes(id),
+	program       INTEGER NOT NULL,
+	name          TEXT NOT NULL,
+	start_seconds REAL NOT NULL,
+	end_seconds   REAL NOT NULL,
+	bytes         INTEGER NOT NULL,
+	checksum_ok   INTEGER NOT NULL,
+	type          TEXT NOT NULL,
+	load_address  INTEGER,
+	sha256        TEXT NOT NULL,
+	PRIMARY KEY (decode_id, program)
+);
+CREATE TABLE IF NOT EXISTS outputs (
+	decode_id INTEGER NOT NULL REFERENCES decodes(id),
+	file      TEXT NOT NULL,
+	bytes     INTEGER NOT NULL,
+	sha256    TEXT NOT NULL
+);
+CREATE TABLE IF NOT EXISTS payloads (
+	sha256 TEXT PRIMARY KEY,
+	data   BLOB NOT NULL
+);
+CREATE INDEX IF NOT EXISTS programs_sha256 ON programs(sha256);
+`
+
+// A program differing from an archived one in no more than one byte in
+// nearDuplicate is flagged as a near-duplicate of it: a copy of the same
+// program with a patched byte or two, or a dropout. Programs shorter than
+// nearMinLength are too short for that to mean much.
+const (
+	nearDuplicate = 50
+	nearMinLength = 256
+)
+
+// openDB opens the decode database at path, creating it if need be
+func openDB(path string) (*sql.DB, error) {
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := db.Exec(dbSchema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return db, nil
+}
+
+// dbOutput is an output as the database records it
+type dbOutput struct {
+	file   string
+	bytes  int
+	sha256 string
+}
+
+// duplicate is a program found already archived from another capture
+type duplicate struct {
+	program   int
+	decode    int
+	source    string
+	other     int
+	name      string
+	differing int // bytes, 0 for an identical copy
+}
+
+func (d duplicate) String() string {
+	other := fmt.Sprintf("program %d", d.other)
+	if d.name != "" {
+		other = fmt.Sprintf("%q (program %d)", d.name, d.other)
+	}
+	if d.differing == 0 {
+		return fmt.Sprintf("Program %d is identical to %s of %s, decode %d", d.program, other, d.source, d.decode)
+	}
+	return fmt.Sprintf("Program %d is near-identical to %s of %s, decode %d: %s differ", d.program, other, d.source, d.decode, byteCount(d.differing))
+}
+
+// recordDecode adds a decode of input, whose SHA-256 is sourceHash, with
+// outcome code, to the database at path, returning the programs on it
+// that were already archived from another capture
+func recordDecode(path, input, sourceHash string, system *decoder.System, c *decoder.Catalog, records []decoder.Record, outputs []dbOutput, code int) ([]duplicate, error) {
+	db, err := openDB(path)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var dups []duplicate
+	for _, r := range c.Regions {
+		if r.Kind != decoder.RegionData || r.Program < 1 || r.Program > len(records) {
+			continue
+		}
+		d, ok, err := findDuplicate(tx, sourceHash, records[r.Program-1].Body())
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			d.program = r.Program
+			dups = append(dups, d)
+		}
+	}
+
+	res, err := tx.Exec(`INSERT INTO decodes (decoded_at, source, source_sha256, system, duration_seconds, status, wavrider_version) VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		timestamp(time.Now()), filepath.Base(input), sourceHash, system.Name, c.Duration, statusNames[code], wavriderVersion())
+	if err != nil {
+		return nil, err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range c.Regions {
+		if r.Kind != decoder.RegionData || r.Program < 1 || r.Program > len(records) {
+			continue
+		}
+		start, end, _ := c.ProgramSpan(r.Program)
+		body := records[r.Program-1].Body()
+		var load any
+		if r.LoadAddress >= 0 {
+			load = r.LoadAddress
+		}
+		_, err := tx.Exec(`INSERT INTO programs (decode_id, program, name, start_seconds, end_seconds, bytes, checksum_ok, type, load_address, sha256) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			id, r.Program, r.Name, start, end, r.Bytes, r.ChecksumOK, r.Type, load, hashBytes(body))
+		if err != nil {
+			return nil, err
+		}
+		if _, err := tx.Exec(`INSERT OR IGNORE INTO payloads (sha256, data) VALUES (?, ?)`, hashBytes(body), body); err != nil {
+			return nil, err
+		}
+	}
+	for _, o := range outputs {
+		if _, err := tx.Exec(`INSERT INTO outputs (decode_id, file, bytes, sha256) VALUES (?, ?, ?, ?)`, id, o.file, o.bytes, o.sha256); err != nil {
+			return nil, err
+		}
+	}
+	return dups, tx.Commit()
+}
+
+// findDuplicate looks for body among the programs archived from captures
+// other than the one hashed source: first a copy of it, the one archived
+// first, and failing that the nearest near-duplicate
+func findDuplicate(tx *sql.Tx, source string, body []byte) (duplicate, bool, error) {
+	var d duplicate
+	err := tx.QueryRow(`
+		SELECT d.id, d.source, p.program, p.name
+		FROM programs p JOIN decodes d ON p.decode_id = d.id
+		WHERE p.sha256 = ? AND d.source_sha256 != ?
+		ORDER BY d.id, p.program LIMIT 1`, hashBytes(body), source).Scan(&d.decode, &d.source, &d.other, &d.name)
+	if err == nil {
+		return d, true, nil
+	}
+	if err != sql.ErrNoRows {
+		return d, false, err
+	}
+	if len(body) < nearMinLength {
+		return d, false, nil
+	}
+
+	// A near-duplicate differs in few bytes, so can't differ much in length
+	slack := len(body) / nearDuplicate
+	rows, err := tx.Query(`
+		SELECT d.id, d.source, p.program, p.name, p.sha256, pl.data
+		FROM programs p JOIN decodes d ON p.decode_id = d.id JOIN payloads pl ON pl.sha256 = p.sha256
+		WHERE d.source_sha256 != ? AND length(pl.data) BETWEEN ? AND ?
+		ORDER BY d.id, p.program`, source, len(body)-slack, len(body)+slack)
+	if err != nil {
+		return d, false, err
+	}
+	defer rows.Close()
+	found := false
+	seen := map[string]bool{}
+	for rows.Next() {
+		var c duplicate
+		var hash string
+		var data []byte
+		if err := rows.Scan(&c.decode, &c.source, &c.other, &c.name, &hash, &data); err != nil {
+			return d, false, err
+		}
+		if seen[hash] {
+			continue
+		}
+		seen[hash] = true
+		for _, h := range diffBytes(data, body) {
+			c.differing += max(h.aLen, h.bLen)
+		}
+		if c.differing <= slack && (!found || c.differing < d.differing) {
+			d, found = c, true
+		}
+	}
+	return d, found, rows.Err()
+}
+
+// runCatalog lists the decodes in the database, searches the programs on
+// them or lists the programs archived from more than one capture
+func runCatalog(args []string) int {
+	fs := flag.NewFlagSet("catalog", flag.ContinueOnError)
+	path := fs.String("db", "", "SQLite `file` decodes were recorded in with -db")
+	applyProfile := profileFlags(fs)
+	if len(args) == 0 || (args[0] != "list" && args[0] != "search" && args[0] != "duplicates") {
+		usage()
+		return exitError
+	}
+	command := args[0]
+	if code, ok := parseFlags(fs, args[1:]); !ok {
+		return code
+	}
+	if err := applyProfile(); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return exitError
+	}
+	if *path == "" {
+		fmt.Println("Error: name the database with -db")
+		return exitError
+	}
+	if command != "search" && fs.NArg() != 0 || command == "search" && fs.NArg() != 1 {
+		usage()
+		return exitError
+	}
+	if _, err := os.Stat(*path); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return exitError
+	}
+	db, err := openDB(*path)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return exitError
+	}
+	defer db.Close()
+
+	switch command {
+	case "list":
+		err = listDecodes(db)
+	case "search":
+		err = searchPrograms(db, fs.Arg(0))
+	case "duplicates":
+		err = listDuplicates(db)
+	}
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return exitError
+	}
+	return exitOK
+}
+
+// listDecodes prints a line for each decode, e.g.
+// "  3  2026-10-16T22:00:00Z  tape.wav  appleii, 3 programs, 1 bad, partial",
+// then how far the project has got
+func listDecodes(db *sql.DB) error {
+	rows, err := db.Query(`
+		SELECT d.id, d.decoded_at, d.source, d.system, d.status,
+			COUNT(p.program), COALESCE(SUM(NOT p.checksum_ok), 0)
+		FROM decodes d LEFT JOIN programs p ON p.decode_id = d.id
+		GROUP BY d.id ORDER BY d.id`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	decodes, programs, bad := 0, 0, 0
+	sources := map[string]bool{}
+	for rows.Next() {
+		var id, n, nBad int
+		var at, source, system, status string
+		if err := rows.Scan(&id, &at, &source, &system, &status, &n, &nBad); err != nil {
+			return err
+		}
+		fmt.Printf("  %d  %s  %s  %s, %d programs, %d bad, %s\n", id, at, source, system, n, nBad, status)
+		decodes++
+		programs += n
+		bad += nBad
+		sources[source] = true
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	fmt.Printf("%d decodes of %d captures, %d programs, %d bad\n", decodes, len(sources), programs, bad)
+	return nil
+}
+
+// searchPrograms prints the programs whose name, type or capture holds
+// term, or whose hash starts with it
+func searchPrograms(db *sql.DB, term string) error {
+	like := "%" + strings.ToLower(term) + "%"
+	rows, err := db.Query(`
+		SELECT d.id, d.source, p.program, p.name, p.bytes, p.checksum_ok, p.type, p.load_address, p.sha256
+		FROM programs p JOIN decodes d ON p.decode_id = d.id
+		WHERE lower(p.name) LIKE ? OR lower(p.type) LIKE ? OR lower(d.source) LIKE ? OR p.sha256 LIKE ?
+		ORDER BY d.id, p.program`, like, like, like, strings.ToLower(term)+"%")
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	found := 0
+	for rows.Next() {
+		var id, program, bytes int
+		var ok bool
+		var source, name, kind, hash string
+		var load sql.NullInt64
+		if err := rows.Scan(&id, &source, &program, &name, &bytes, &ok, &kind, &load, &hash); err != nil {
+			return err
+		}
+		fmt.Printf("  %d  %s program %d", id, source, program)
+		if name != "" {
+			fmt.Printf(" %q", name)
+		}
+		fmt.Printf(", %s", byteCount(bytes))
+		if kind != "" {
+			fmt.Printf(", %s", kind)
+		}
+		if load.Valid {
+			fmt.Printf(" at 0x%04X", load.Int64)
+		}
+		status := "checksum OK"
+		if !ok {
+			status = "checksum BAD"
+		}
+		fmt.Printf(", %s, sha256 %s\n", status, hash[:12])
+		found++
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	fmt.Printf("%d programs found\n", found)
+	return nil
+}
+
+// listDuplicates prints each program archived from more than one capture,
+// with where each copy came from, then how many copies need not be kept
+func listDuplicates(db *sql.DB) error {
+	rows, err := db.Query(`
+		SELECT p.sha256, p.bytes, d.id, d.source, p.program, p.name
+		FROM programs p JOIN decodes d ON p.decode_id = d.id
+		WHERE p.sha256 IN (
+			SELECT p.sha256 FROM programs p JOIN decodes d ON p.decode_id = d.id
+			GROUP BY p.sha256 HAVING COUNT(DISTINCT d.source_sha256) > 1)
+		ORDER BY p.sha256, d.id, p.program`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	programs, copies := 0, 0
+	last := ""
+	for rows.Next() {
+		var id, program, bytes int
+		var hash, source, name string
+		if err := rows.Scan(&hash, &bytes, &id, &source, &program, &name); err != nil {
+			return err
+		}
+		if hash != last {
+			fmt.Printf("sha256 %s, %s\n", hash[:12], byteCount(bytes))
+			programs++
+			last = hash
+		} else {
+			copies++
+		}
+		fmt.Printf("  %d  %s program %d", id, source, program)
+		if name != "" {
+			fmt.Printf(" %q", name)
+		}
+		fmt.Println()
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	fmt.Printf("%d programs archived more than once, %d copies\n", programs, copies)
+	return nil
+}
@@ -0,0 +1,382 @@
+package main
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"runtime"
+	"time"
+	"wavrider/internal/decoder"
+)
+
+// runDecode is the default command: decode one capture to one file
+func runDecode(args []string) int {
+	fs := flag.NewFlagSet("wavrider", flag.ContinueOnError)
+	jobs := fs.Int("jobs", runtime.GOMAXPROCS(0), "number of segments of a long capture to decode concurrently")
+	showCatalog := fs.Bool("catalog", false, "print a catalog of the tape's silences, header tones and programs")
+	catalogOnly := fs.Bool("catalog-only", false, "print the catalog instead of writing an output file")
+	cueFile := fs.String("cue", "", "write a cue sheet with one track per program")
+	labelFile := fs.String("labels", "", "write an Audacity label track of the catalog")
+	withProvenance := fs.Bool("provenance", false, "write a .json sidecar recording how the output was produced")
+	segment := fs.Int("segment", 0, "decode only segment N of those the scan command lists")
+	verifyAgainst := fs.String("verify-against", "", "check the decode against a known-good `file`, failing if they differ")
+	loadMap := fs.Bool("load-map", false, "print where each program loads in memory")
+	traceBits := fs.String("trace-bits", "", "write every half-cycle, how it was classified and the bits and bytes it made to `file`")
+	exportCleaned := fs.String("export-cleaned", "", "write the audio as the decoder heard it, after cleaning up, to the WAV `file`")
+	quiet := fs.Bool("quiet", false, "leave stdout to the decoded output: progress is left out, and warnings, errors and the reports asked for go to stderr")
+	reportFile := fs.String("report", "", "write an HTML report of the decode, with waveforms and the outputs to download, to `file`")
+	dbPath := fs.String("db", "", "record the decode in the SQLite `file`, for the catalog command to list and search")
+	launchCommand := fs.String("launch", "", "once every program checks out, run an emulator on them: mame, or a `command` with "+templateImage+" standing for a DOS 3.3 disk image of them, "+templateScript+" for a MAME autoboot script loading them and "+templateOut+" for them in the system's format")
+	toStdout := fs.Bool("stdout", false, "write the decoded output to stdout instead of a file, quietly as -quiet does")
+	decodeOptions := decodeFlags(fs)
+	outputOpts := outputFlags(fs)
+	newLogger := logFlags(fs)
+	applyProfile := profileFlags(fs)
+	if code, ok := parseFlags(fs, args); !ok {
+		return code
+	}
+
+	if fs.NArg() == 2 && fs.Arg(1) == "-" {
+		// "-" names stdout, as it does for most tools in a pipe
+		*toStdout = true
+	}
+
+	// The profile is applied first, for its -quiet or -stdout to count as
+	// much as the flag's
+	profileErr := applyProfile()
+
+	// info takes progress and diag diagnostics and reports, both stdout
+	// unless quiet
+	info, diag := io.Writer(os.Stdout), io.Writer(os.Stdout)
+	if *quiet || *toStdout {
+		info, diag = io.Discard, os.Stderr
+	}
+
+	status := runStatus{code: exitOK}
+	defer func() { writeStatusLine(os.Stderr, status) }()
+	started := time.Now()
+	defer func() {
+		if status.files > 0 {
+			status.finish(time.Since(started))
+			printSummary(info, status.decodeStats)
+		}
+	}()
+	fail := func(code int, format string, args ...any) int {
+		fmt.Fprintf(diag, format, args...)
+		status.code = code
+		return code
+	}
+
+	if profileErr != nil {
+		return fail(exitError, "Error: %v\n", profileErr)
+	}
+	if fs.NArg() < 1 {
+		usage()
+		status.code = exitError
+		return exitError
+	}
+
+	filename := fs.Arg(0)
+	outfile := "" // named once the system, and so its format, is known
+	if fs.NArg() > 1 {
+		if outputOpts.template != "" {
+			return fail(exitError, "Error: give an output file or -out-template, not both\n")
+		}
+		outfile = fs.Arg(1)
+	}
+	if *toStdout && (fs.NArg() > 2 || fs.NArg() == 2 && outfile != "-" || outputOpts.template != "" || outputOpts.dsk != "" || outputOpts.exec != "" || *withProvenance) {
+		return fail(exitError, "Error: -stdout cannot be combined with an output file, -out-template, -dsk, -exec or -provenance\n")
+	}
+
+	if filename == decoder.Stdin && (*segment > 0 || *reportFile != "" || *withProvenance) {
+		// Each reads the capture again, and standard input reads once
+		return fail(exitError, "Error: -segment, -report and -provenance need a capture named, not standard input\n")
+	}
+
+	fmt.Fprintf(info, "Processing %s...\n", filename)
+
+	opts, err := decodeOptions()
+	if err != nil {
+		return fail(exitError, "Error: %v\n", err)
+	}
+	if outfile == "" && outputOpts.dsk == "" {
+		// The disk image is the output unless another is named, and
+		// otherwise it is named for the format, e.g. output.cas
+		outfile = "output" + outputOpts.ext(opts.System)
+	}
+	opts.Log = newLogger(os.Stdout)
+	if *quiet || *toStdout {
+		opts.Log = slog.New(warnings{newLogger(os.Stderr).Handler()})
+	}
+	opts.Workers = *jobs
+	// An interrupt stops the decode where it has got to, and what was read
+	// until then is written as usual
+	ctx, stop := interruptContext()
+	defer stop()
+	opts.Context = ctx
+	source := sha256.New()
+	if *dbPath != "" || *withProvenance {
+		opts.Source = source
+	}
+	var cleanedErr error
+	if *exportCleaned != "" {
+		opts.Cleaned = func(samples []float64, rate uint32) {
+			cleanedErr = writeFileWith(*exportCleaned, func(w io.Writer) error {
+				return decoder.WriteWAV(w, samples, rate)
+			})
+		}
+	}
+	var trace *bufio.Writer
+	if *traceBits != "" {
+		f, err := os.Create(*traceBits)
+		if err != nil {
+			return fail(exitError, "Error: %v\n", err)
+		}
+		defer f.Close()
+		trace = bufio.NewWriter(f)
+		opts.Trace = trace
+	}
+	var records []decoder.Record
+	var catalog *decoder.Catalog
+	if *segment > 0 {
+		records, catalog, err = decodeSegment(info, filename, *segment, opts)
+	} else {
+		records, catalog, err = decoder.DecodeFileRecords(filename, opts)
+	}
+	if trace != nil {
+		if err := trace.Flush(); err != nil {
+			return fail(exitError, "Error writing bit trace: %v\n", err)
+		}
+		fmt.Fprintf(info, "Bit trace written to %s\n", *traceBits)
+	}
+	if err != nil {
+		status.add(catalog, 0)
+		return fail(decodeOutcome(nil, err), "Error: %v\n", err)
+	}
+	sourceHash := func() (string, error) {
+		return hashSource(source, filename, ctx.Err() != nil)
+	}
+	outputs, writeErr := outputOpts.write(outfile, filename, records, catalog, opts.System)
+	decoded := 0
+	for _, o := range outputs {
+		decoded += len(o.data)
+	}
+	status.add(catalog, decoded)
+	for _, m := range outputOpts.known.identify(records, outputOpts.names) {
+		fmt.Fprintf(info, "File %d is %s, %s\n", m.file, m.title, m.how)
+	}
+
+	if *showCatalog || *catalogOnly {
+		printCatalog(diag, catalog)
+	}
+	if *loadMap {
+		printLoadMap(diag, records)
+	}
+	if *cueFile != "" {
+		err := writeFileWith(*cueFile, func(w io.Writer) error {
+			return writeCueSheet(w, filename, catalog)
+		})
+		if err != nil {
+			return fail(exitError, "Error writing cue sheet: %v\n", err)
+		}
+		fmt.Fprintf(info, "Cue sheet written to %s\n", *cueFile)
+	}
+	if *exportCleaned != "" {
+		if cleanedErr != nil {
+			return fail(exitError, "Error writing cleaned audio: %v\n", cleanedErr)
+		}
+		fmt.Fprintf(info, "Cleaned audio written to %s\n", *exportCleaned)
+	}
+	if *labelFile != "" {
+		err := writeFileWith(*labelFile, func(w io.Writer) error {
+			return writeLabels(w, catalog)
+		})
+		if err != nil {
+			return fail(exitError, "Error writing labels: %v\n", err)
+		}
+		fmt.Fprintf(info, "Labels written to %s\n", *labelFile)
+	}
+
+	if writeErr != nil {
+		return fail(exitError, "Error: %v\n", writeErr)
+	}
+
+	status.code = decodeOutcome(catalog, nil)
+	if *verifyAgainst != "" {
+		switch {
+		case catalog.Programs == 0:
+			return fail(exitNoData, "Error: no programs decoded to check against %s\n", *verifyAgainst)
+		case len(outputs) == 0:
+			return fail(exitError, "Error: -verify-against checks an output, not the disk image alone\n")
+		case len(outputs) > 1:
+			return fail(exitError, "Error: -verify-against needs one output, but the template names %d\n", len(outputs))
+		}
+		want, err := os.ReadFile(*verifyAgainst)
+		if err != nil {
+			return fail(exitError, "Error reading reference: %v\n", err)
+		}
+		if !verify(diag, diffSide{name: filename, data: outputs[0].data, catalog: catalog}, diffSide{name: *verifyAgainst, data: want}) {
+			status.code = exitDiffer
+		}
+	}
+	// The decode is recorded once its outputs are written, if any are
+	var written []dbOutput
+	record := func() error {
+		if *dbPath == "" {
+			return nil
+		}
+		hash, err := sourceHash()
+		if err != nil {
+			return err
+		}
+		dups, err := recordDecode(*dbPath, filename, hash, opts.System, catalog, records, written, status.code)
+		for _, d := range dups {
+			fmt.Fprintln(info, d)
+		}
+		return err
+	}
+	report := func(outputs []output) error {
+		if *reportFile == "" {
+			return nil
+		}
+		err := writeFileWith(*reportFile, func(w io.Writer) error {
+			return writeReport(w, filename, opts.System, catalog, outputs, status.code, opts)
+		})
+		if err == nil {
+			fmt.Fprintf(info, "Report written to %s\n", *reportFile)
+		}
+		return err
+	}
+	if *catalogOnly {
+		if err := report(nil); err != nil {
+			return fail(exitError, "Error writing report: %v\n", err)
+		}
+		if err := record(); err != nil {
+			return fail(exitError, "Error recording the decode: %v\n", err)
+		}
+		return status.code
+	}
+
+	if err := outputOpts.addToDisk(info, filename, records); err != nil {
+		return fail(exitError, "Error writing disk image: %v\n", err)
+	}
+	if len(outputs) == 0 && outputOpts.dsk == "" {
+		fmt.Fprintln(info, "No data decoded. No files written")
+	}
+	for _, o := range outputs {
+		if *toStdout {
+			if _, err := os.Stdout.Write(o.data); err != nil {
+				return fail(exitError, "Error writing output: %v\n", err)
+			}
+			written = append(written, dbOutput{"-", len(o.data), hashBytes(o.data)})
+			continue
+		}
+		if err := os.WriteFile(o.name, o.data, 0644); err != nil {
+			return fail(exitError, "Error writing output: %v\n", err)
+		}
+		written = append(written, dbOutput{o.name, len(o.data), hashBytes(o.data)})
+
+		if *withProvenance {
+			sidecar := sidecarName(o.name)
+			status.finish(time.Since(started))
+			hash, err := sourceHash()
+			if err != nil {
+				return fail(exitError, "Error writing provenance: %v\n", err)
+			}
+			if err := writeProvenance(sidecar, filename, hash, o.name, o.data, outputOpts.describe(opts.System), catalog, status.decodeStats, fs); err != nil {
+				return fail(exitError, "Error writing provenance: %v\n", err)
+			}
+			fmt.Fprintf(info, "Provenance written to %s\n", sidecar)
+		}
+
+		if len(o.data) > 0 {
+			fmt.Fprintf(info, "Decoded %s. Written to %s\n", byteCount(len(o.data)), o.name)
+		} else {
+			fmt.Fprintf(info, "No data decoded. Created empty file %s\n", o.name)
+		}
+		if err := outputOpts.runExec(diag, o, filename, opts.System); err != nil {
+			fmt.Fprintf(diag, "Error: %v\n", err)
+			status.code = worse(status.code, exitError)
+		}
+	}
+	if err := report(outputs); err != nil {
+		return fail(exitError, "Error writing report: %v\n", err)
+	}
+	if err := record(); err != nil {
+		return fail(exitError, "Error recording the decode: %v\n", err)
+	}
+	if *launchCommand != "" {
+		if status.code != exitOK {
+			fmt.Fprintln(diag, "Not launching an emulator: not every program checked out")
+			return status.code
+		}
+		if err := launch(info, *launchCommand, filename, records, opts.System); err != nil {
+			return fail(exitError, "Error: %v\n", err)
+		}
+	}
+	return status.code
+}
+
+// decodeSegment scans a capture and decodes only its nth segment, saying
+// which to w. A file is rewound to decode it, and anything else opened
+// again, as a URL cannot be rewound.
+func decodeSegment(w io.Writer, filename string, n int, opts decoder.Options) ([]decoder.Record, *decoder.Catalog, error) {
+	open := decoder.Open
+	if opts.Mmap {
+		open = decoder.OpenMapped
+	}
+	f, err := open(filename)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer func() { f.Close() }()
+	scanned := io.Reader(f)
+	if opts.Source != nil {
+		scanned = io.TeeReader(f, opts.Source)
+	}
+	segments, err := decoder.Scan(scanned)
+	if err != nil {
+		return nil, nil, err
+	}
+	if opts.Source != nil {
+		// What follows the samples is the capture's too
+		if _, err := io.Copy(io.Discard, scanned); err != nil {
+			return nil, nil, err
+		}
+	}
+	if n > len(segments) {
+		return nil, nil, fmt.Errorf("segment %d requested but the scan found %d", n, len(segments))
+	}
+	seg := segments[n-1]
+	fmt.Fprintf(w, "Decoding segment %d of %d, %s–%s\n", n, len(segments), clockMillis(seg.Start), clockMillis(seg.End))
+	if s, ok := f.(io.Seeker); ok {
+		if _, err := s.Seek(0, io.SeekStart); err != nil {
+			return nil, nil, err
+		}
+	} else {
+		again, err := open(filename)
+		if err != nil {
+			return nil, nil, err
+		}
+		f.Close()
+		f = again
+	}
+	return decoder.DecodeSegment(f, seg, opts)
+}
+
+// verify reports whether a decode matches a known-good reference, and
+// writes to w where they first differ if not
+func verify(w io.Writer, got, want diffSide) bool {
+	hunks := diffBytes(got.data, want.data)
+	if len(hunks) == 0 {
+		fmt.Fprintf(w, "Verified against %s\n", want.name)
+		return true
+	}
+	fmt.Fprintf(w, "Verification against %s failed, %d differences; the first:\n", want.name, len(hunks))
+	printHunk(w, hunks[0], [2]diffSide{got, want})
+	return false
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+	"wavrider/internal/decoder"
+)
+
+// Diff alignment. When the streams disagree, the nearest point where they
+// agree again for diffResync bytes is searched for within diffWindow
+// bytes of either, so a byte lost or gained on one capture shows as just
+// that rather than as everything after it differing.
+const (
+	diffWindow = 256
+	diffResync = 8
+)
+
+// runDiff compares two decoded outputs, either of which may be a WAV to
+// decode first
+func runDiff(args []string) int {
+	fs := flag.NewFlagSet("diff", flag.ContinueOnError)
+	jobs := fs.Int("jobs", runtime.GOMAXPROCS(0), "number of segments of a long capture to decode concurrently")
+	decodeOptions := decodeFlags(fs)
+	applyProfile := profileFlags(fs)
+	if code, ok := parseFlags(fs, args); !ok {
+		return code
+	}
+	if err := applyProfile(); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return exitError
+	}
+	if fs.NArg() != 2 {
+		usage()
+		return exitError
+	}
+	opts, err := decodeOptions()
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return exitError
+	}
+	opts.Workers = *jobs
+
+	var sides [2]diffSide
+	for i, name := range fs.Args() {
+		sides[i], err = loadDiffSide(name, opts)
+		if err != nil {
+			fmt.Printf("Error: %s: %v\n", name, err)
+			return decodeOutcome(nil, err)
+		}
+		fmt.Printf("%s: %s\n", name, byteCount(len(sides[i].data)))
+	}
+
+	hunks := diffBytes(sides[0].data, sides[1].data)
+	if len(hunks) == 0 {
+		fmt.Println("Identical")
+		return exitOK
+	}
+	differing := 0
+	for _, h := range hunks {
+		printHunk(os.Stdout, h, sides)
+		differing += max(h.aLen, h.bLen)
+	}
+	fmt.Printf("%d differences, %s bytes\n", len(hunks), thousands(differing))
+	return exitDiffer
+}
+
+// diffSide is one of the things compared: its bytes and, if it was
+// decoded from a WAV, the catalog placing them on the tape
+type diffSide struct {
+	name    string
+	data    []byte
+	catalog *decoder.Catalog
+}
+
+// loadDiffSide reads a decoded file, or decodes a WAV
+func loadDiffSide(name string, opts decoder.Options) (diffSide, error) {
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return diffSide{}, err
+	}
+	if !isRIFFWAVE(data) {
+		return diffSide{name: name, data: data}, nil
+	}
+	data, catalog, err := decoder.DecodeReader(bytes.NewReader(data), opts)
+	if err != nil {
+		return diffSide{}, err
+	}
+	return diffSide{name: name, data: data, catalog: catalog}, nil
+}
+
+// isRIFFWAVE reports whether data starts like a WAV file
+func isRIFFWAVE(data []byte) bool {
+	return len(data) >= 12 && string(data[:4]) == "RIFF" && string(data[8:12]) == "WAVE"
+}
+
+// hunk is a stretch where the two streams disagree: aLen bytes at aOff
+// of the first stand where bLen bytes at bOff of the second do
+type hunk struct {
+	aOff, aLen int
+	bOff, bLen int
+}
+
+// diffBytes aligns a and b and returns where they disagree
+func diffBytes(a, b []byte) []hunk {
+	var hunks []hunk
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		if a[i] == b[j] {
+			i++
+			j++
+			continue
+		}
+		di, dj, ok := resync(a[i:], b[j:])
+		if !ok {
+			break
+		}
+		hunks = append(hunks, hunk{aOff: i, aLen: di, bOff: j, bLen: dj})
+		i += di
+		j += dj
+	}
+	if i < len(a) || j < len(b) {
+		hunks = append(hunks, hunk{aOff: i, aLen: len(a) - i, bOff: j, bLen: len(b) - j})
+	}
+	return hunks
+}
+
+// resync finds the fewest bytes to skip in a and b, as evenly split
+// between them as possible, after which they agree again
+func resync(a, b []byte) (di, dj int, ok bool) {
+	for d := 1; d <= 2*diffWindow; d++ {
+		for spread := d % 2; spread <= d; spread += 2 {
+			for _, di := range []int{(d - spread) / 2, (d + spread) / 2} {
+				dj := d - di
+				if di > min(diffWindow, len(a)) || dj > min(diffWindow, len(b)) {
+					continue
+				}
+				// Near the end, both must end together
+				n := min(diffResync, len(a)-di, len(b)-dj)
+				if n < diffResync && len(a)-di != len(b)-dj {
+					continue
+				}
+				if bytes.Equal(a[di:di+n], b[dj:dj+n]) {
+					return di, dj, true
+				}
+			}
+		}
+	}
+	return 0, 0, false
+}
+
+// printHunk describes one difference, e.g.
+// "  0x0123 (291): 2 bytes differ, a.wav 3F 00 at 00:04.512, b.bin 7F 01".
+// Offsets are in the first stream; the second's is given where it has
+// drifted, as "b.bin@0x0125".
+func printHunk(w io.Writer, h hunk, sides [2]diffSide) {
+	a := sides[0].name
+	b := sides[1].name
+	if h.bOff != h.aOff {
+		b = fmt.Sprintf("%s@0x%04X", b, h.bOff)
+	}
+	switch {
+	case h.aLen == 0:
+		fmt.Fprintf(w, "  %s: %s only in %s, %s\n", position(h.aOff), byteCount(h.bLen), b, sides[1].bytesAt(h.bOff, h.bLen))
+	case h.bLen == 0:
+		fmt.Fprintf(w, "  %s: %s only in %s, %s\n", position(h.aOff), byteCount(h.aLen), a, sides[0].bytesAt(h.aOff, h.aLen))
+	default:
+		verb := "differ"
+		if h.aLen == 1 && h.bLen == 1 {
+			verb = "differs"
+		}
+		fmt.Fprintf(w, "  %s: %s %s, %s %s, %s %s\n", position(h.aOff), byteCount(max(h.aLen, h.bLen)), verb,
+			a, sides[0].bytesAt(h.aOff, h.aLen), b, sides[1].bytesAt(h.bOff, h.bLen))
+	}
+}
+
+// bytesAt shows the side's n bytes at offset, and where on the tape they
+// were
+func (s diffSide) bytesAt(offset, n int) string {
+	return hexBytes(s.data[offset:offset+n]) + s.at(offset)
+}
+
+// at says where on its tape the byte at offset was, if it is known
+func (s diffSide) at(offset int) string {
+	if s.catalog == nil {
+		return ""
+	}
+	t, ok := s.catalog.TimeAt(offset)
+	if !ok {
+		return ""
+	}
+	return " at " + clockMillis(t)
+}
+
+func position(offset int) string {
+	return fmt.Sprintf("0x%04X (%d)", offset, offset)
+}
+
+// hexBytes shows up to the first 8 bytes of b in hex
+func hexBytes(b []byte) string {
+	s := fmt.Sprintf("% X", b[:min(len(b), 8)])
+	if len(b) > 8 {
+		s += " …"
+	}
+	return s
+}
@@ -0,0 +1,285 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"wavrider/internal/decoder"
+)
+
+// DOS 3.3 disk images hold 35 tracks of 16 256-byte sectors in DOS order.
+// The VTOC on track 17 says which sectors are free and where the catalog
+// starts; each catalog sector lists seven files, and each file has track
+// and sector lists giving where its sectors are.
+const (
+	dskTracks      = 35
+	dskSectors     = 16
+	dskSectorSize  = 256
+	dskSize        = dskTracks * dskSectors * dskSectorSize
+	dskCatalog     = 17 // track of the VTOC and catalog
+	dskVolume      = 254
+	dskPairs       = 122 // track and sector pairs in each list sector
+	dskEntries     = 7   // files in each catalog sector
+	dskEntrySize   = 35
+	dskFirstEntry  = 0x0B
+	dskFirstPair   = 0x0C
+	dskBitmaps     = 0x38 // offset in the VTOC of the free sector bitmaps
+	dskNameLength  = 30
+	dskDeletedFile = 0xFF
+
+	dosText      = 0x00
+	dosInteger   = 0x01
+	dosApplesoft = 0x02
+	dosBinary    = 0x04
+)
+
+// dskFile is a file to add to a disk image: its name, DOS type and
+// contents, including the address and length DOS keeps in front
+type dskFile struct {
+	name string
+	kind byte
+	data []byte
+}
+
+// dskFiles returns the files on a tape as DOS files, typed by what they
+// hold and named by name. A file's records go one after another from the
+// first's load address; binaries but shape tables need one.
+func dskFiles(records []decoder.Record, name func(n int, file []decoder.Record) string) ([]dskFile, error) {
+	var files []dskFile
+	for i, file := range decoder.Files(records) {
+		progs := programs(file)
+		if len(progs) == 0 {
+			continue
+		}
+		p := progs[0]
+		var body []byte
+		for _, q := range progs {
+			body = append(body, q.Body()...)
+		}
+		f := dskFile{name: strings.ToUpper(name(i+1, file))}
+		switch {
+		case p.Type == decoder.RecordBasic:
+			f.kind = dosInteger
+			if p.LoadAddress == decoder.ApplesoftProgram {
+				f.kind = dosApplesoft
+			}
+			f.data = binary.LittleEndian.AppendUint16(nil, uint16(len(body)))
+			f.data = append(f.data, body...)
+		case p.Type == decoder.RecordASCII:
+			f.kind = dosText
+			for _, b := range body {
+				f.data = append(f.data, b|0x80)
+			}
+			f.data = append(f.data, 0)
+		case p.LoadAddress < 0 && p.Type != decoder.RecordShapeTable:
+			return nil, fmt.Errorf("program %d has no load address; give one with -load-addr", p.n)
+		default:
+			// A shape table's offsets are from its start, so one with no
+			// address is left to be loaded wherever BLOAD's A puts it
+			f.kind = dosBinary
+			f.data = binary.LittleEndian.AppendUint16(nil, uint16(max(0, p.LoadAddress)))
+			f.data = binary.LittleEndian.AppendUint16(f.data, uint16(len(body)))
+			f.data = append(f.data, body...)
+		}
+		files = append(files, f)
+	}
+	return files, nil
+}
+
+// dskImage is a DOS 3.3 disk image in memory
+type dskImage []byte
+
+// sector returns the bytes of a sector
+func (d dskImage) sector(track, sector int) []byte {
+	at := (track*dskSectors + sector) * dskSectorSize
+	return d[at : at+dskSectorSize]
+}
+
+func (d dskImage) vtoc() []byte {
+	return d.sector(dskCatalog, 0)
+}
+
+// newDisk returns an empty disk with no DOS on it: the catalog track and
+// track 0 are in use, every other sector is free
+func newDisk() dskImage {
+	d := make(dskImage, dskSize)
+	v := d.vtoc()
+	v[0x01], v[0x02] = dskCatalog, dskSectors-1
+	v[0x03] = 3
+	v[0x06] = dskVolume
+	v[0x27] = dskPairs
+	v[0x30], v[0x31] = dskCatalog+1, 1
+	v[0x34], v[0x35] = dskTracks, dskSectors
+	binary.LittleEndian.PutUint16(v[0x36:], dskSectorSize)
+	for t := 1; t < dskTracks; t++ {
+		if t != dskCatalog {
+			v[dskBitmaps+4*t], v[dskBitmaps+4*t+1] = 0xFF, 0xFF
+		}
+	}
+	// The catalog sectors are chained from the last down to sector 1
+	for s := dskSectors - 1; s > 1; s-- {
+		c := d.sector(dskCatalog, s)
+		c[0x01], c[0x02] = dskCatalog, byte(s-1)
+	}
+	return d
+}
+
+// isFree reports whether the VTOC marks a sector free
+func (d dskImage) isFree(track, sector int) bool {
+	bits := binary.BigEndian.Uint16(d.vtoc()[dskBitmaps+4*track:])
+	return bits&(1<<sector) != 0
+}
+
+func (d dskImage) allocate(track, sector int) {
+	v := d.vtoc()[dskBitmaps+4*track:]
+	binary.BigEndian.PutUint16(v, binary.BigEndian.Uint16(v)&^(1<<sector))
+}
+
+// freeSector finds and allocates a free sector the way DOS does, working
+// out from the catalog track
+func (d dskImage) freeSector() (int, int, error) {
+	for i := 1; i < dskTracks; i++ {
+		for _, t := range []int{dskCatalog + i, dskCatalog - i} {
+			if t <= 0 || t >= dskTracks {
+				continue
+			}
+			for s := dskSectors - 1; s >= 0; s-- {
+				if d.isFree(t, s) {
+					d.allocate(t, s)
+					clear(d.sector(t, s))
+					return t, s, nil
+				}
+			}
+		}
+	}
+	return 0, 0, errors.New("the disk is full")
+}
+
+// freeEntry returns the first unused or deleted catalog entry
+func (d dskImage) freeEntry() ([]byte, error) {
+	v := d.vtoc()
+	t, s := int(v[0x01]), int(v[0x02])
+	for seen := 0; t != 0 && seen < dskTracks*dskSectors; seen++ {
+		if t >= dskTracks || s >= dskSectors {
+			return nil, errors.New("the catalog is damaged")
+		}
+		c := d.sector(t, s)
+		for i := range dskEntries {
+			e := c[dskFirstEntry+i*dskEntrySize:][:dskEntrySize]
+			if e[0] == 0 || e[0] == dskDeletedFile {
+				return e, nil
+			}
+		}
+		t, s = int(c[0x01]), int(c[0x02])
+	}
+	return nil, errors.New("the catalog is full")
+}
+
+// names returns the names of the files on the disk
+func (d dskImage) names() map[string]bool {
+	names := map[string]bool{}
+	v := d.vtoc()
+	t, s := int(v[0x01]), int(v[0x02])
+	for seen := 0; t != 0 && t < dskTracks && s < dskSectors && seen < dskTracks*dskSectors; seen++ {
+		c := d.sector(t, s)
+		for i := range dskEntries {
+			e := c[dskFirstEntry+i*dskEntrySize:][:dskEntrySize]
+			if e[0] != 0 && e[0] != dskDeletedFile {
+				names[dskName(e[3:3+dskNameLength])] = true
+			}
+		}
+		t, s = int(c[0x01]), int(c[0x02])
+	}
+	return names
+}
+
+// dskName reads a name as DOS stores it, in high-bit ASCII padded with
+// spaces
+func dskName(b []byte) string {
+	var name []byte
+	for _, c := range b {
+		name = append(name, c&0x7F)
+	}
+	return strings.TrimRight(string(name), " ")
+}
+
+// add writes a file to the disk under a name no other file has
+func (d dskImage) add(f dskFile) (string, error) {
+	name := f.name[:min(len(f.name), dskNameLength)]
+	taken := d.names()
+	for n := 2; taken[name]; n++ {
+		suffix := fmt.Sprintf(" %d", n)
+		name = f.name[:min(len(f.name), dskNameLength-len(suffix))] + suffix
+	}
+	entry, err := d.freeEntry()
+	if err != nil {
+		return "", err
+	}
+
+	// Data sectors, then the track and sector lists that find them
+	var pairs [][2]int
+	for at := 0; at < len(f.data) || at == 0; at += dskSectorSize {
+		t, s, err := d.freeSector()
+		if err != nil {
+			return "", err
+		}
+		copy(d.sector(t, s), f.data[at:min(at+dskSectorSize, len(f.data))])
+		pairs = append(pairs, [2]int{t, s})
+	}
+	var lists [][2]int
+	for i := 0; i < len(pairs); i += dskPairs {
+		t, s, err := d.freeSector()
+		if err != nil {
+			return "", err
+		}
+		list := d.sector(t, s)
+		binary.LittleEndian.PutUint16(list[0x05:], uint16(i))
+		for j, p := range pairs[i:min(i+dskPairs, len(pairs))] {
+			list[dskFirstPair+2*j], list[dskFirstPair+2*j+1] = byte(p[0]), byte(p[1])
+		}
+		if len(lists) > 0 {
+			prev := d.sector(lists[len(lists)-1][0], lists[len(lists)-1][1])
+			prev[0x01], prev[0x02] = byte(t), byte(s)
+		}
+		lists = append(lists, [2]int{t, s})
+	}
+
+	entry[0], entry[1], entry[2] = byte(lists[0][0]), byte(lists[0][1]), f.kind
+	for i := range dskNameLength {
+		c := byte(' ')
+		if i < len(name) {
+			c = name[i]
+		}
+		entry[3+i] = c | 0x80
+	}
+	binary.LittleEndian.PutUint16(entry[33:], uint16(len(pairs)+len(lists)))
+	return name, nil
+}
+
+// appendToDisk adds files to the DOS 3.3 image at path, creating it if
+// it does not exist, and returns the names they were given
+func appendToDisk(path string, files []dskFile) ([]string, error) {
+	d, err := os.ReadFile(path)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		d = newDisk()
+	case err != nil:
+		return nil, err
+	case len(d) != dskSize:
+		return nil, fmt.Errorf("%s is not a DOS 3.3 disk image: %d bytes, not %d", path, len(d), dskSize)
+	case d[(dskCatalog*dskSectors)*dskSectorSize+0x35] != dskSectors:
+		return nil, fmt.Errorf("%s has no DOS 3.3 catalog", path)
+	}
+	image := dskImage(d)
+	var names []string
+	for _, f := range files {
+		name, err := image.add(f)
+		if err != nil {
+			return nil, fmt.Errorf("adding %s: %w", f.name, err)
+		}
+		names = append(names, name)
+	}
+	return names, os.WriteFile(path, image, 0644)
+}
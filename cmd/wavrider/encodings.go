@@ -0,0 +1,82 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"wavrider/internal/decoder"
+
+	"github.com/BurntSushi/toml"
+)
+
+// Encoding files describe a tape format's settings, as decoder.Encoding
+// gives them, for a format wavrider has no code for:
+//
+//	coding = "pwm"
+//	zero-us = 300
+//	one-us = 300
+//	zero-cycles = 4
+//	one-cycles = 9
+//	gap-us = 1300
+//	sync-byte = 0xA5
+//	checksum = "crc16-ccitt"
+//
+// Each NAME.toml in the systems directory beside the config file adds the
+// system NAME, and -system takes the path of one too.
+const encodingExt = ".toml"
+
+// encodingsDir is the directory searched for encoding files
+func encodingsDir() string {
+	config := defaultConfigPath()
+	if config == "" {
+		return ""
+	}
+	return filepath.Join(filepath.Dir(config), "systems")
+}
+
+// loadEncodings adds a system for each encoding file found. A built-in
+// system, or an external decoder, keeps its name.
+func loadEncodings() {
+	dir := encodingsDir()
+	if dir == "" {
+		return
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return
+	}
+	for _, e := range entries {
+		name, ok := strings.CutSuffix(e.Name(), encodingExt)
+		if !ok || name == "" || e.IsDir() {
+			continue
+		}
+		if _, taken := decoder.Systems[name]; taken {
+			continue
+		}
+		s, err := loadEncoding(filepath.Join(dir, e.Name()))
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			continue
+		}
+		decoder.Systems[name] = s
+	}
+}
+
+// loadEncoding reads an encoding file and returns the system it
+// describes, named for the file
+func loadEncoding(path string) (*decoder.System, error) {
+	var e decoder.Encoding
+	md, err := toml.DecodeFile(path, &e)
+	if err != nil {
+		return nil, fmt.Errorf("encoding %s: %w", path, err)
+	}
+	if keys := md.Undecoded(); len(keys) > 0 {
+		return nil, fmt.Errorf("encoding %s: unknown setting %s", path, keys[0])
+	}
+	s, err := e.System(strings.TrimSuffix(filepath.Base(path), encodingExt))
+	if err != nil {
+		return nil, fmt.Errorf("encoding %s: %w", path, err)
+	}
+	return s, nil
+}
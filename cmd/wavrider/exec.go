@@ -0,0 +1,84 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"strings"
+	"wavrider/internal/decoder"
+)
+
+// -exec hooks. The command is run by the shell once each output is
+// written, with templateOut and the template's variables that describe
+// the output replaced by their values, quoted, and the same values in
+// environment variables named execEnvPrefix and the variable in capitals,
+// such as WAVRIDER_OUT, along with the input, the system and the
+// output's size.
+const (
+	templateOut   = "{out}" // the output written
+	execEnvPrefix = "WAVRIDER_"
+)
+
+// runExec runs the -exec command for an output of input written, if there
+// is one and every record in it checked out, its output going to w
+func (o *outputOptions) runExec(w io.Writer, out output, input string, system *decoder.System) error {
+	if o.exec == "" || len(out.records) == 0 {
+		return nil
+	}
+	bad := 0
+	for _, r := range out.records {
+		if !r.ChecksumOK {
+			bad++
+		}
+	}
+	if bad > 0 {
+		fmt.Fprintf(w, "Not running -exec on %s: %d of its records did not check out\n", out.name, bad)
+		return nil
+	}
+
+	vars := map[string]string{templateBase: inputBase(input)}
+	if out.file > 0 {
+		vars = fileVars(inputBase(input), out.file, out.title, out.records)
+	}
+	vars[templateOut] = out.name
+	vars[templateExt] = o.ext(system)
+	env := os.Environ()
+	quoted := map[string]string{}
+	for v, value := range vars {
+		quoted[v] = shellQuote(value)
+		env = append(env, execEnvPrefix+strings.ToUpper(strings.Trim(v, "{}"))+"="+value)
+	}
+	env = append(env,
+		execEnvPrefix+"INPUT="+input,
+		execEnvPrefix+"SYSTEM="+system.Name,
+		execEnvPrefix+"BYTES="+strconv.Itoa(len(out.data)),
+		execEnvPrefix+"PROGRAMS="+strconv.Itoa(len(out.records)),
+	)
+
+	cmd := shellCommand(expand(o.exec, quoted))
+	cmd.Env = env
+	cmd.Stdout, cmd.Stderr = w, w
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("-exec on %s: %w", out.name, err)
+	}
+	return nil
+}
+
+// shellCommand returns the command to run line with the platform's shell
+func shellCommand(line string) *exec.Cmd {
+	if runtime.GOOS == "windows" {
+		return exec.Command("cmd", "/C", line)
+	}
+	return exec.Command("/bin/sh", "-c", line)
+}
+
+// shellQuote quotes s as one word for the platform's shell
+func shellQuote(s string) string {
+	if runtime.GOOS == "windows" {
+		return `"` + strings.ReplaceAll(s, `"`, `""`) + `"`
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
@@ -0,0 +1,257 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"maps"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"wavrider/internal/decoder"
+)
+
+// decodeFlags registers the flags shared by every command that decodes
+// and returns a function building the Options once the flags are parsed
+func decodeFlags(fs *flag.FlagSet) func() (decoder.Options, error) {
+	system := decoder.Systems["appleii"]
+	systems := slices.Sorted(maps.Keys(decoder.Systems))
+	fs.Func("system", "computer the tape is from: "+strings.Join(systems, ", ")+", or the path of a "+encodingExt+" file describing its encoding (default appleii)", func(s string) error {
+		if strings.HasSuffix(s, encodingExt) {
+			sys, err := loadEncoding(s)
+			system = sys
+			return err
+		}
+		sys, ok := decoder.Systems[s]
+		if !ok {
+			return fmt.Errorf("unknown system %q", s)
+		}
+		system = sys
+		return nil
+	})
+	var format *decoder.Timing
+	formats := slices.Sorted(maps.Keys(decoder.Formats))
+	fs.Func("format", "Apple ][ tape format whose timings to decode with: "+strings.Join(formats, ", ")+" (default appleii)", func(s string) error {
+		t, ok := decoder.Formats[s]
+		if !ok {
+			return fmt.Errorf("unknown format %q", s)
+		}
+		format = t
+		return nil
+	})
+	shortUS := fs.Float64("short-us", decoder.AppleII.Short*1e6, "half-cycles shorter than this many microseconds are short (0) pulses")
+	longUS := fs.Float64("long-us", decoder.AppleII.Long*1e6, "half-cycles shorter than this, but not short, are long (1) pulses")
+	minHeader := fs.Int("min-header", decoder.AppleII.MinHeader, "header half-cycles that must precede the sync bit")
+	var sync []float64
+	fs.Func("sync-us", "comma-separated microseconds of each half-cycle of the sync bit (default 200,250)", func(s string) error {
+		var halves []float64
+		for _, f := range strings.Split(s, ",") {
+			us, err := strconv.ParseFloat(strings.TrimSpace(f), 64)
+			if err != nil {
+				return err
+			}
+			if us <= 0 {
+				return errors.New("half-cycles must be longer than zero")
+			}
+			halves = append(halves, us/1e6)
+		}
+		sync = halves
+		return nil
+	})
+	syncTolerance := fs.Float64("sync-tolerance", decoder.AppleII.SyncTolerance, "fraction of its nominal length a sync half-cycle may be off by")
+	trackSpeed := fs.Bool("track-speed", false, "follow drifting tape speed (wow and flutter) instead of using fixed thresholds")
+	var demod decoder.Demod
+	fs.TextVar(&demod, "demod", decoder.DemodZeroCrossing, "demodulation engine: zerocross, goertzel, matched, peak, pulse, or vote to run them all and vote on each byte")
+	noDropouts := fs.Bool("no-dropouts", false, "decode through signal dropouts instead of erasing the bytes they touch")
+	declick := fs.Bool("declick", false, "remove clicks and pops before detection, logging how many were repaired")
+	unclip := fs.Bool("unclip", false, "rebuild peaks flattened by recording too hot")
+	speedFactor := fs.Float64("speed-factor", 0, "times its nominal speed the tape played at when captured, such as 2 or 0.5 (default: nominal, trying 2 and 0.5 if nothing decodes)")
+	retry := fs.Bool("retry", false, "decode segments that do not check out again with other engines, thresholds and speeds, reporting which options read them")
+	stereo := fs.Bool("stereo", false, "decode both channels of a stereo capture of a mono tape and merge what each read")
+	azimuth := fs.Bool("azimuth", false, "mix both channels of a stereo capture of a mono tape into one, realigned for a misaligned head")
+	var mix decoder.Mix
+	fs.TextVar(&mix, "mix", decoder.Mix(nil), "decode a weighted mix of the channels, such as 0.7L+0.3R for a noisy right channel that still helps, or R for the right alone")
+	reverse := fs.Bool("reverse", false, "decode the audio backwards, for tapes digitized playing the wrong way")
+	deterministic := fs.Bool("deterministic", false, "make output depend only on the input and flags, not on the machine or the time, so a rerun reproduces it byte for byte")
+	maxDuration := fs.Float64("max-duration", 0, "refuse captures longer than this many seconds, 0 for no limit")
+	var maxMemory int64
+	fs.Func("max-memory", "refuse captures whose samples would need more than this much memory, such as 512M or 2G (default no limit)", func(s string) error {
+		n, err := parseSize(s)
+		maxMemory = n
+		return err
+	})
+	mmap := fs.Bool("mmap", false, "map local captures into memory instead of reading them, which is quicker for very large ones")
+	resample := fs.Int("resample", 0, "convert the audio to this many Hz before detection; 0 upsamples captures below 22050 Hz, -1 never resamples")
+
+	reframe := framingFlags(fs)
+
+	return func() (decoder.Options, error) {
+		system, err := reframe(system)
+		if err != nil {
+			return decoder.Options{}, err
+		}
+
+		if *stereo && *azimuth {
+			return decoder.Options{}, errors.New("-stereo and -azimuth cannot be combined")
+		}
+		if len(mix) > 0 && (*stereo || *azimuth) {
+			return decoder.Options{}, errors.New("-mix cannot be combined with -stereo or -azimuth")
+		}
+		if *speedFactor < 0 {
+			return decoder.Options{}, fmt.Errorf("-speed-factor must be positive, not %g", *speedFactor)
+		}
+		opts := decoder.Options{System: system, SpeedFactor: *speedFactor, IgnoreDropouts: *noDropouts, TrackSpeed: *trackSpeed, Demod: demod, Resample: *resample, Declick: *declick, Unclip: *unclip, Retry: *retry, Stereo: *stereo, Azimuth: *azimuth, Mix: mix, Reverse: *reverse, Deterministic: *deterministic, MaxDuration: *maxDuration, MaxMemory: maxMemory, Mmap: *mmap}
+
+		// The format, or else the system, supplies every timing the flags
+		// do not override
+		t := *system.Timing
+		changed := format != nil
+		if format != nil {
+			t = *format
+		}
+		fs.Visit(func(f *flag.Flag) {
+			switch f.Name {
+			case "short-us":
+				t.Short = *shortUS / 1e6
+			case "long-us":
+				t.Long = *longUS / 1e6
+			case "min-header":
+				t.MinHeader = *minHeader
+			case "sync-us":
+				t.Sync = sync
+			case "sync-tolerance":
+				t.SyncTolerance = *syncTolerance
+			default:
+				return
+			}
+			changed = true
+		})
+		if changed {
+			opts.Timing = &t
+		}
+		return opts, nil
+	}
+}
+
+// framingFlags registers the flags that set serial, biphase and
+// pulse-width systems up for a signal other than their own, and returns
+// a function applying those given to a system
+func framingFlags(fs *flag.FlagSet) func(system *decoder.System) (*decoder.System, error) {
+	var serial decoder.Serial
+	fs.Float64Var(&serial.Baud, "baud", 0, "bits a second, for serial systems such as uart and for biphase (default: the system's own, as for the flags below)")
+	fs.IntVar(&serial.DataBits, "data-bits", 0, "data bits in each byte, 5 to 8, for serial, biphase and pwm systems")
+	fs.TextVar(&serial.Parity, "parity", decoder.ParityNone, "parity bit after the data bits: none, even, odd, mark or space, for serial, biphase and pwm systems")
+	fs.Float64Var(&serial.StopBits, "stop-bits", 0, "stop bits after each byte, 1, 1.5 or 2 for serial systems, and 0, 1 or 2 for biphase and pwm, where any make each byte start with a start bit")
+	fs.Float64Var(&serial.Mark, "mark-hz", 0, "frequency of 1 bits and the idle line, for serial systems")
+	fs.Float64Var(&serial.Space, "space-hz", 0, "frequency of 0 bits, for serial systems")
+
+	var pwm decoder.PWM
+	fs.Float64Var(&pwm.Zero, "zero-us", 0, "microseconds each cycle of a 0 bit lasts, for pwm")
+	fs.Float64Var(&pwm.One, "one-us", 0, "microseconds each cycle of a 1 bit lasts, for pwm")
+	fs.IntVar(&pwm.ZeroCycles, "zero-cycles", 0, "cycles in a 0 bit, for pwm")
+	fs.IntVar(&pwm.OneCycles, "one-cycles", 0, "cycles in a 1 bit, for pwm")
+	fs.Float64Var(&pwm.Gap, "gap-us", 0, "microseconds of quiet after every bit, for pwm; 0 if bits follow on")
+
+	var leader int
+	var sync byte
+	fs.IntVar(&leader, "leader-bit", 0, "bit the leader before each record repeats, 0 or 1, for biphase and pwm")
+	var order decoder.BitOrder
+	fs.Func("bit-order", "order each byte's bits are sent in, msb or lsb first, for serial, biphase and pwm systems", func(s string) error {
+		o, err := decoder.ParseBitOrder(s)
+		order = o
+		return err
+	})
+	fs.Func("sync-byte", "`byte` that ends the leader and starts the data, e.g. 0x16, for biphase and pwm", func(s string) error {
+		v, err := strconv.ParseUint(s, 0, 8)
+		sync = byte(v)
+		return err
+	})
+
+	return func(system *decoder.System) (*decoder.System, error) {
+		settings, isSerial := system.Serial()
+		coding, isBiphase := system.Biphase()
+		widths, isPWM := system.PWM()
+		reframed := false
+		var err error
+		fs.Visit(func(f *flag.Flag) {
+			applies, kind := isSerial, "serial systems"
+			switch f.Name {
+			case "baud":
+				settings.Baud, coding.Baud = serial.Baud, serial.Baud
+				applies, kind = isSerial || isBiphase, "serial and biphase systems"
+			case "data-bits":
+				settings.DataBits, coding.DataBits, widths.DataBits = serial.DataBits, serial.DataBits, serial.DataBits
+				applies, kind = isSerial || isBiphase || isPWM, "serial, biphase and pwm systems"
+			case "parity":
+				settings.Parity, coding.Parity, widths.Parity = serial.Parity, serial.Parity, serial.Parity
+				applies, kind = isSerial || isBiphase || isPWM, "serial, biphase and pwm systems"
+			case "stop-bits":
+				settings.StopBits, coding.StopBits, widths.StopBits = serial.StopBits, serial.StopBits, serial.StopBits
+				applies, kind = isSerial || isBiphase || isPWM, "serial, biphase and pwm systems"
+			case "mark-hz":
+				settings.Mark = serial.Mark
+			case "space-hz":
+				settings.Space = serial.Space
+			case "zero-us":
+				widths.Zero = pwm.Zero / 1e6
+				applies, kind = isPWM, "pwm systems"
+			case "one-us":
+				widths.One = pwm.One / 1e6
+				applies, kind = isPWM, "pwm systems"
+			case "zero-cycles":
+				widths.ZeroCycles = pwm.ZeroCycles
+				applies, kind = isPWM, "pwm systems"
+			case "one-cycles":
+				widths.OneCycles = pwm.OneCycles
+				applies, kind = isPWM, "pwm systems"
+			case "gap-us":
+				widths.Gap = pwm.Gap / 1e6
+				applies, kind = isPWM, "pwm systems"
+			case "leader-bit":
+				coding.Leader, widths.Leader = leader, leader
+				applies, kind = isBiphase || isPWM, "biphase and pwm systems"
+			case "sync-byte":
+				coding.Sync, widths.Sync = sync, sync
+				applies, kind = isBiphase || isPWM, "biphase and pwm systems"
+			case "bit-order":
+				settings.Order, coding.Order, widths.Order = order, order, order
+				applies, kind = isSerial || isBiphase || isPWM, "serial, biphase and pwm systems"
+			default:
+				return
+			}
+			if !applies && err == nil {
+				err = fmt.Errorf("-%s only applies to %s, not %s", f.Name, kind, system.Name)
+			}
+			reframed = true
+		})
+		switch {
+		case err != nil || !reframed:
+			return system, err
+		case isBiphase:
+			return system.WithBiphase(coding)
+		case isPWM:
+			return system.WithPWM(widths)
+		}
+		return system.WithSerial(settings)
+	}
+}
+
+// parseSize parses a count of bytes, with an optional K, M or G for
+// kibibytes, mebibytes or gibibytes
+func parseSize(s string) (int64, error) {
+	digits, shift := s, 0
+	if n := len(s); n > 0 {
+		if i := strings.Index("KMG", strings.ToUpper(s[n-1:])); i >= 0 {
+			digits, shift = s[:n-1], 10*(i+1)
+		}
+	}
+	n, err := strconv.ParseInt(digits, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+	if n < 0 || n > math.MaxInt64>>shift {
+		return 0, fmt.Errorf("size %q out of range", s)
+	}
+	return n << shift, nil
+}
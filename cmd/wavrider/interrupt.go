@@ -0,0 +1,16 @@
+package main
+
+import (
+	"context"
+	"os"
+	"os/signal"
+)
+
+// interruptContext returns a context that is done on the first interrupt,
+// so that a decode can stop gracefully and write what it has read. A
+// second interrupt kills the program as usual.
+func interruptContext() (context.Context, context.CancelFunc) {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	context.AfterFunc(ctx, stop)
+	return ctx, stop
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"wavrider/internal/decoder"
+)
+
+// knownSoftware is a list of known programs, read from a CSV file of
+// their titles and hashes: a line such as "Lemonade Stand,<hash>,1024"
+// for each, the size optional. The hash may be a CRC-32, MD5, SHA-1 or
+// SHA-256, told apart by their length, as the lists collectors keep
+// have any of them. A first line that has no hash is taken for a header,
+// and lines starting with # are skipped.
+type knownSoftware struct {
+	programs []knownProgram
+	hashes   map[int]func() hash.Hash // by the length of their hex
+}
+
+// knownProgram is a program in a list of known software
+type knownProgram struct {
+	title string
+	hash  string // lower-case hex
+	bytes int    // 0 if not given
+}
+
+// knownHashes are the hashes a list can give, by the length of their hex
+var knownHashes = map[int]func() hash.Hash{
+	8:  func() hash.Hash { return crc32.NewIEEE() },
+	32: md5.New,
+	40: sha1.New,
+	64: sha256.New,
+}
+
+// loadKnown reads a list of known software
+func loadKnown(path string) (*knownSoftware, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	r := csv.NewReader(f)
+	r.Comment = '#'
+	r.FieldsPerRecord = -1
+	r.TrimLeadingSpace = true
+	k := &knownSoftware{hashes: map[int]func() hash.Hash{}}
+	for first := true; ; first = false {
+		fields, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		line, _ := r.FieldPos(0)
+		var p knownProgram
+		if len(fields) >= 2 {
+			p.title = strings.TrimSpace(fields[0])
+			p.hash = strings.ToLower(strings.TrimSpace(fields[1]))
+		}
+		h, ok := knownHashes[len(p.hash)]
+		if _, err := hex.DecodeString(p.hash); err != nil || !ok || p.title == "" {
+			if first {
+				continue
+			}
+			return nil, fmt.Errorf("%s:%d: not a title and a CRC-32, MD5, SHA-1 or SHA-256", path, line)
+		}
+		if len(fields) >= 3 && strings.TrimSpace(fields[2]) != "" {
+			p.bytes, err = strconv.Atoi(strings.TrimSpace(fields[2]))
+			if err != nil || p.bytes < 1 {
+				return nil, fmt.Errorf("%s:%d: %q is not a size in bytes", path, line, fields[2])
+			}
+		}
+		k.programs = append(k.programs, p)
+		k.hashes[len(p.hash)] = h
+	}
+	if len(k.programs) == 0 {
+		return nil, fmt.Errorf("%s: no programs listed", path)
+	}
+	return k, nil
+}
+
+// knownMatch is a file on a tape found in the list of known software
+type knownMatch struct {
+	file  int // its number on the tape, from 1
+	title string
+	how   string // how it matched, e.g. "an exact copy"
+}
+
+// identify finds in the list the files on a tape not named already:
+// a file matches when all its data, or any one record of it, is a copy
+// of a listed program, or is once any padding after it is dropped, or
+// starts with one of the size listed, as a record read on past its end
+// does
+func (k *knownSoftware) identify(records []decoder.Record, named tapeNames) []knownMatch {
+	if k == nil {
+		return nil
+	}
+	var matches []knownMatch
+	for i, file := range decoder.Files(records) {
+		if _, ok := named[i+1]; ok {
+			continue
+		}
+		var all []byte
+		var each [][]byte
+		for _, r := range file {
+			if r.Copy || len(r.Body()) == 0 {
+				continue
+			}
+			all = append(all, r.Body()...)
+			each = append(each, r.Body())
+		}
+		candidates := [][]byte{all}
+		if len(each) > 1 {
+			candidates = append(candidates, each...)
+		}
+		for _, data := range candidates {
+			if title, how, ok := k.match(data); ok {
+				matches = append(matches, knownMatch{i + 1, title, how})
+				break
+			}
+		}
+	}
+	return matches
+}
+
+// match looks data up in the list, returning the title of the program it
+// is and how it matched
+func (k *knownSoftware) match(data []byte) (title, how string, ok bool) {
+	sums := k.sums(data)
+	for _, p := range k.programs {
+		if sums[len(p.hash)] == p.hash {
+			return p.title, "an exact copy", true
+		}
+	}
+	if trimmed := trimPadding(data); len(trimmed) < len(data) {
+		sums := k.sums(trimmed)
+		for _, p := range k.programs {
+			if sums[len(p.hash)] == p.hash {
+				return p.title, fmt.Sprintf("with %s of padding after it", byteCount(len(data)-len(trimmed))), true
+			}
+		}
+	}
+	for _, p := range k.programs {
+		if p.bytes > 0 && p.bytes < len(data) && k.sums(data[:p.bytes])[len(p.hash)] == p.hash {
+			return p.title, fmt.Sprintf("with %s more after it", byteCount(len(data)-p.bytes)), true
+		}
+	}
+	return "", "", false
+}
+
+// sums hashes data with each of the hashes the list uses
+func (k *knownSoftware) sums(data []byte) map[int]string {
+	sums := map[int]string{}
+	for n, h := range k.hashes {
+		d := h()
+		d.Write(data)
+		sums[n] = hex.EncodeToString(d.Sum(nil))
+	}
+	return sums
+}
+
+// trimPadding drops the run of zeros, or of 0xFF bytes, that data ends
+// with, as a program saved with a range rounded up to a page does
+func trimPadding(data []byte) []byte {
+	n := len(data)
+	if n == 0 || data[n-1] != 0 && data[n-1] != 0xFF {
+		return data
+	}
+	for n > 0 && data[n-1] == data[len(data)-1] {
+		n--
+	}
+	return data[:n]
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"wavrider/internal/decoder"
+)
+
+// -launch hands a decode to an emulator. The programs are written to a
+// temporary directory, as the system's own format and, for the Apple ][,
+// on a DOS 3.3 disk image and as a script for MAME that puts them in
+// memory, and the command is run by the shell with templateImage,
+// templateScript and templateOut replaced by their paths, quoted. The
+// directory is removed once the emulator exits. A few emulators are
+// known by name; anything else is taken for a command, which a profile
+// in the config file can keep.
+const (
+	templateImage  = "{image}"  // the disk image, for the Apple ][
+	templateScript = "{script}" // the MAME autoboot script, for the Apple ][
+)
+
+// launchPresets are the emulators -launch knows by name, each starting
+// the programs itself. The disk image has no DOS on it to boot, so
+// emulators that can only be handed a disk to boot are left to a
+// command naming a DOS disk to boot as well, such as
+// "applewin -d1 MASTER.DSK -d2 {image}".
+var launchPresets = map[string]string{
+	// The //e is booted with no disk controller, to go straight to
+	// Applesoft for the script to type into
+	"mame": `mame apple2ee -sl6 "" -autoboot_delay 2 -autoboot_script ` + templateScript,
+}
+
+// launch writes the programs decoded from input where the emulator
+// command can find them and runs it, its output going to w
+func launch(w io.Writer, command, input string, records []decoder.Record, system *decoder.System) error {
+	if preset, ok := launchPresets[command]; ok {
+		command = preset
+	}
+	dir, err := os.MkdirTemp("", "wavrider-launch-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+
+	base := inputBase(input)
+	out := filepath.Join(dir, base+system.Ext())
+	if err := os.WriteFile(out, system.Pack(records), 0644); err != nil {
+		return err
+	}
+	vars := map[string]string{templateOut: shellQuote(out)}
+	if strings.Contains(command, templateScript) {
+		if system != decoder.Systems["appleii"] {
+			return fmt.Errorf("-launch: %s is a script for MAME's Apple //e, which cannot run %s programs", templateScript, system.Name)
+		}
+		script := filepath.Join(dir, base+".lua")
+		err := writeFileWith(script, func(w io.Writer) error {
+			return writeMAMEScript(w, input, records)
+		})
+		if err != nil {
+			return err
+		}
+		vars[templateScript] = shellQuote(script)
+	}
+	if strings.Contains(command, templateImage) {
+		if system != decoder.Systems["appleii"] {
+			return fmt.Errorf("-launch: %s is a DOS 3.3 disk image, which %s programs do not go on", templateImage, system.Name)
+		}
+		files, err := dskFiles(records, func(n int, _ []decoder.Record) string {
+			return fmt.Sprintf("%s %02d", base, n)
+		})
+		if err != nil {
+			return err
+		}
+		image := filepath.Join(dir, base+".dsk")
+		if _, err := appendToDisk(image, files); err != nil {
+			return err
+		}
+		vars[templateImage] = shellQuote(image)
+	}
+
+	line := expand(command, vars)
+	fmt.Fprintf(w, "Launching %s\n", line)
+	cmd := shellCommand(line)
+	cmd.Stdout, cmd.Stderr = w, w
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("-launch: %w", err)
+	}
+	return nil
+}
+
+// Applesoft's pointers to the program in memory, which LOAD sets: where
+// it starts, where its variables start, just after it, and where it ends
+const (
+	applesoftTXTTAB = 0x67
+	applesoftVARTAB = 0x69
+	applesoftPRGEND = 0xAF
+)
+
+// mameLoader begins a MAME script, defining poke to write bytes, given as
+// a string, into the Apple's memory at an address
+const mameLoader = `local memory = manager.machine.devices[":maincpu"].spaces["program"]
+local function poke(address, bytes)
+	for i = 1, #bytes do
+		memory:write_u8(address + i - 1, bytes:byte(i))
+	end
+end
+`
+
+// writeMAMEScript writes a Lua script for MAME's -autoboot_script that
+// puts the programs decoded from input into the memory of an Apple //e
+// at the Applesoft prompt where they load, and types the command that
+// starts the first it can: RUN for an Applesoft program and CALL for
+// machine code. Integer BASIC, which the //e has no ROM for, text, and
+// programs with no load address are left out.
+func writeMAMEScript(w io.Writer, input string, records []decoder.Record) error {
+	fmt.Fprintf(w, "-- The programs wavrider decoded from %s\n", filepath.Base(input))
+	io.WriteString(w, mameLoader)
+	start := ""
+	for _, file := range decoder.Files(records) {
+		progs := programs(file)
+		if len(progs) == 0 {
+			continue
+		}
+		p := progs[0]
+		var body []byte
+		for _, q := range progs {
+			body = append(body, q.Body()...)
+		}
+		switch {
+		case p.Type == decoder.RecordBasic && p.LoadAddress == decoder.ApplesoftProgram:
+			writePoke(w, p.LoadAddress, body)
+			end := p.LoadAddress + len(body)
+			for _, pointer := range []int{applesoftTXTTAB, applesoftVARTAB, applesoftPRGEND} {
+				at := end
+				if pointer == applesoftTXTTAB {
+					at = p.LoadAddress
+				}
+				writePoke(w, pointer, []byte{byte(at), byte(at >> 8)})
+			}
+			if start == "" {
+				start = "RUN"
+			}
+		case p.Type == decoder.RecordBasic || p.Type == decoder.RecordASCII || p.LoadAddress < 0:
+			continue
+		default:
+			writePoke(w, p.LoadAddress, body)
+			if start == "" && p.Type != decoder.RecordShapeTable {
+				start = fmt.Sprintf("CALL %d", p.LoadAddress)
+			}
+		}
+	}
+	if start == "" {
+		return errors.New("-launch: no Applesoft or machine code program to start; give machine code its address with -load-addr")
+	}
+	_, err := fmt.Fprintf(w, "manager.machine.natkeyboard:post(\"%s\\n\")\n", start)
+	return err
+}
+
+// writePoke writes the line of a MAME script poking b into memory at
+// address, as a string of escaped bytes
+func writePoke(w io.Writer, address int, b []byte) {
+	var s strings.Builder
+	for _, c := range b {
+		fmt.Fprintf(&s, "\\x%02X", c)
+	}
+	fmt.Fprintf(w, "poke(0x%04X, \"%s\")\n", address, s.String())
+}
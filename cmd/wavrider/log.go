@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// logFormats make the handlers decoding logs through. Plain writes each
+// message on a line of its own, as a person reads them; text and json are
+// slog's own, with the time and level of each, for other programs to read.
+var logFormats = map[string]func(w io.Writer, opts *slog.HandlerOptions) slog.Handler{
+	"plain": func(w io.Writer, opts *slog.HandlerOptions) slog.Handler {
+		return &plainHandler{w: w, level: opts.Level, mu: &sync.Mutex{}}
+	},
+	"text": func(w io.Writer, opts *slog.HandlerOptions) slog.Handler { return slog.NewTextHandler(w, opts) },
+	"json": func(w io.Writer, opts *slog.HandlerOptions) slog.Handler { return slog.NewJSONHandler(w, opts) },
+}
+
+// logFlags registers -log-format and -log-level and returns a function
+// making a logger that writes to w as they say, once the flags are parsed
+func logFlags(fs *flag.FlagSet) func(w io.Writer) *slog.Logger {
+	format := "plain"
+	names := slices.Sorted(maps.Keys(logFormats))
+	fs.Func("log-format", "how to write progress messages: "+strings.Join(names, ", ")+" (default plain)", func(s string) error {
+		if _, ok := logFormats[s]; !ok {
+			return fmt.Errorf("unknown log format %q", s)
+		}
+		format = s
+		return nil
+	})
+	var level slog.Level
+	fs.TextVar(&level, "log-level", slog.LevelInfo, "least severe messages to write: debug, info, warn or error")
+	return func(w io.Writer) *slog.Logger {
+		return slog.New(logFormats[format](w, &slog.HandlerOptions{Level: level}))
+	}
+}
+
+// plainHandler writes each message alone on a line, warnings and errors
+// marked as such and any attributes after it
+type plainHandler struct {
+	w     io.Writer
+	level slog.Leveler
+	attrs []slog.Attr
+	mu    *sync.Mutex // shared with the handlers made from it
+}
+
+func (h *plainHandler) Enabled(_ context.Context, level slog.Level) bool {
+	return level >= h.level.Level()
+}
+
+func (h *plainHandler) Handle(_ context.Context, r slog.Record) error {
+	var b strings.Builder
+	switch {
+	case r.Level >= slog.LevelError:
+		b.WriteString("Error: ")
+	case r.Level >= slog.LevelWarn:
+		b.WriteString("Warning: ")
+	}
+	b.WriteString(r.Message)
+	write := func(a slog.Attr) bool {
+		fmt.Fprintf(&b, " %s=%v", a.Key, a.Value)
+		return true
+	}
+	for _, a := range h.attrs {
+		write(a)
+	}
+	r.Attrs(write)
+	b.WriteByte('\n')
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	_, err := io.WriteString(h.w, b.String())
+	return err
+}
+
+func (h *plainHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	c := *h
+	c.attrs = append(slices.Clip(h.attrs), attrs...)
+	return &c
+}
+
+// WithGroup is ignored, as attributes are written without their groups
+func (h *plainHandler) WithGroup(string) slog.Handler {
+	return h
+}
+
+// warnings passes on only the warnings and errors of the handler it wraps
+type warnings struct {
+	slog.Handler
+}
+
+func (h warnings) Enabled(ctx context.Context, level slog.Level) bool {
+	return level >= slog.LevelWarn && h.Handler.Enabled(ctx, level)
+}
+
+func (h warnings) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return warnings{h.Handler.WithAttrs(attrs)}
+}
+
+func (h warnings) WithGroup(name string) slog.Handler {
+	return warnings{h.Handler.WithGroup(name)}
+}
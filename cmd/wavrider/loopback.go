@@ -0,0 +1,121 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"os"
+	"wavrider/internal/decoder"
+)
+
+// loopbackLead is seconds of recording before the test tape is played
+// and after it ends, for the sound card to settle and to catch it all
+const loopbackLead = 1.0
+
+// runLoopback checks the whole analog path before a real tape is
+// risked: a test program is written out as a tape and played on the
+// default output while the default input records it, and what decodes
+// from the recording is compared with what was played, with how well the
+// recording came out
+func runLoopback(args []string) int {
+	fs := flag.NewFlagSet("loopback", flag.ContinueOnError)
+	size := fs.Int("bytes", 1024, "bytes of test program to play")
+	level := fs.Float64("level", playLevel, "fraction of full scale to play the test tape at")
+	keep := fs.String("keep", "", "write the recording to the WAV `file`, to look at if the test fails")
+	decodeOptions := decodeFlags(fs)
+	applyProfile := profileFlags(fs)
+	if code, ok := parseFlags(fs, args); !ok {
+		return code
+	}
+	if err := applyProfile(); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return exitError
+	}
+	if fs.NArg() != 0 {
+		usage()
+		return exitError
+	}
+	if *size <= 0 || *level <= 0 || *level > 1 {
+		fmt.Println("Error: -bytes must be above 0, and -level above 0 and at most 1")
+		return exitError
+	}
+	opts, err := decodeOptions()
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return exitError
+	}
+
+	// The same program every time, so runs can be compared
+	random := rand.New(rand.NewPCG(1, 2))
+	want := make([]byte, *size)
+	for i := range want {
+		want[i] = byte(random.Uint32())
+	}
+	samples, err := decoder.EncodeProgram(want, -1, opts)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return exitError
+	}
+	seconds := float64(len(samples)) / decoder.RelaminateRate
+
+	ctx, stop := interruptContext()
+	defer stop()
+	recorder, err := recordAudio(ctx, decoder.RelaminateRate, int(math.Ceil(seconds+2*loopbackLead)))
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return exitError
+	}
+	var recording bytes.Buffer
+	recorder.Stdout = &recording
+	if err := recorder.Start(); err != nil {
+		fmt.Printf("Error: recording: %v\n", err)
+		return exitError
+	}
+	fmt.Printf("Playing %s of test tape and recording it...\n", clockMillis(seconds))
+	lead := make([]float64, int(loopbackLead*decoder.RelaminateRate))
+	playErr := playAudio(append(lead, samples...), decoder.RelaminateRate, *level)
+	recordErr := recorder.Wait()
+	switch {
+	case ctx.Err() != nil:
+		fmt.Println("Interrupted")
+		return exitInterrupted
+	case playErr != nil:
+		fmt.Printf("Error: %v\n", playErr)
+		return exitError
+	case recordErr != nil:
+		fmt.Printf("Error: recording: %v\n", recordErr)
+		return exitError
+	}
+	if *keep != "" {
+		if err := os.WriteFile(*keep, recording.Bytes(), 0644); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			return exitError
+		}
+		fmt.Printf("Recording written to %s\n", *keep)
+	}
+
+	records, catalog, err := decoder.DecodeRecords(bytes.NewReader(recording.Bytes()), opts)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return decodeOutcome(nil, err)
+	}
+	printQuality(os.Stdout, "Recording", catalog.Quality())
+	progs := programs(records)
+	if len(progs) == 0 {
+		fmt.Println("FAIL: nothing decoded; check the cables, that the input is the one recording, and the levels")
+		return exitNoData
+	}
+	got := progs[0]
+	if hunks := diffBytes(got.Body(), want); len(hunks) > 0 || !got.ChecksumOK {
+		fmt.Printf("FAIL: the test program came back with %d differences", len(hunks))
+		if catalog.Clipped > 0 {
+			fmt.Print("; the recording clipped, so turn the input level down")
+		}
+		fmt.Println()
+		return exitPartial
+	}
+	fmt.Printf("PASS: %s played and decoded back the same\n", byteCount(len(want)))
+	return exitOK
+}
@@ -3,37 +3,89 @@ package main
 import (
 	"fmt"
 	"os"
-	"wavrider/internal/decoder"
 )
 
-func main() {
-	if len(os.Args) < 2 {
-		fmt.Println("Usage: wavrider <wav-file>")
-		os.Exit(1)
-	}
-
-	filename := os.Args[1]
-	outfile := "output.bin"
-	if len(os.Args) > 2 {
-		outfile = os.Args[2]
-	}
-
-	fmt.Printf("Processing %s...\n", filename)
+func usage() {
+	fmt.Println("Usage: wavrider [-profile NAME] [-jobs N] [-quiet] [-stdout] [-catalog|-catalog-only] [-cue FILE] [-labels FILE] [-report FILE] [-provenance] [-segment N] [-verify-against FILE] [-export-cleaned FILE] [-trace-bits FILE] [-out-format FORMAT] [-charset NAME] [-dialect NAME] [-load-addr ADDR] [-monitor-range RANGES] [-names FILE] [-known FILE] [-load-map] [-dsk FILE] [-exec COMMAND] [-launch EMULATOR] [-db FILE] [-log-format FORMAT] [-log-level LEVEL] <wav-file> [output-file | - | -out-template TEMPLATE]")
+	fmt.Println("       wavrider align [-profile NAME] <wav-file> <wav-file>")
+	fmt.Println("       wavrider analyze [-profile NAME] <wav-file>...")
+	fmt.Println("       wavrider bench [-profile NAME] [-jobs N] [-n RUNS] <wav-file | -synthetic MINUTES>")
+	fmt.Println("       wavrider batch [-profile NAME] [-jobs N] [-out-dir DIR] [-checkpoint] [-resume] [-timeout DURATION] [-out-format FORMAT] [-charset NAME] [-dialect NAME] [-monitor-range RANGES] [-names FILE] [-known FILE] [-out-template TEMPLATE] [-dsk FILE] [-exec COMMAND] [-db FILE] [-log-format FORMAT] [-log-level LEVEL] <wav-file>...")
+	fmt.Println("       wavrider capture [-profile NAME] [-o FILE] [-rate HZ] [-duration SECONDS] [-prompt] <wav-file>")
+	fmt.Println("       wavrider catalog list|search|duplicates [-profile NAME] -db FILE [TERM]")
+	fmt.Println("       wavrider corpus [-profile NAME] [-jobs N] <dir>")
+	fmt.Println("       wavrider diff [-profile NAME] <wav-or-output> <wav-or-output>")
+	fmt.Println("       wavrider loopback [-profile NAME] [-bytes N] [-level FRACTION] [-keep FILE]")
+	fmt.Println("       wavrider play [-profile NAME] [-level FRACTION] [-load-addr ADDR] <wav-file | program-file>")
+	fmt.Println("       wavrider relaminate [-profile NAME] <wav-file> <restored-wav-file>")
+	fmt.Println("       wavrider scan <wav-file>")
+	fmt.Println("       wavrider send [-profile NAME] [-jobs N] -port DEVICE [-speed BAUD] [-timeout DURATION] [-force] [-load-addr ADDR] [-monitor-range RANGES] <wav-file>")
+	fmt.Println("       wavrider send [-slot N] [-speed BAUD] -client FILE")
+	fmt.Println("       wavrider serve [-profile NAME] [-listen ADDR]")
+	fmt.Println("       wavrider watch [-profile NAME] [-jobs N] [-timeout DURATION] [-out-dir DIR] [-done-dir DIR] [-failed-dir DIR] <dir>")
+	fmt.Println("       wavrider trim [-profile NAME] [-gap SECONDS] [-lead SECONDS] <wav-file> [trimmed-wav-file]")
+	fmt.Println("       wavrider tui [-profile NAME] [-o FILE] <wav-file|->")
+	fmt.Println("A <wav-file> may be - for standard input, an http:// or https:// URL, decoded as it downloads,")
+	fmt.Println("or a ZIP or tar archive holding one, or ARCHIVE!PATH naming one in it; batch decodes every WAV")
+	fmt.Println("in an archive.")
+	fmt.Println("Captures and archives compressed with gzip or zstd are decompressed as they are read.")
+	fmt.Println("Programs named " + pluginPrefix + "NAME on the PATH, or in the plugins directory beside the")
+	fmt.Println("config file, decode the tapes of -system NAME, as do files NAME" + encodingExt + " in the systems directory")
+	fmt.Println("beside it describing a format's tones, bit cells, sync byte, framing and checksum.")
+}
 
-	data, err := decoder.Decode(filename)
-	if err != nil {
-		fmt.Printf("Error: %v\n", err)
-		os.Exit(1)
+func main() {
+	loadPlugins()
+	loadEncodings()
+	code := run(os.Args[1:])
+	if !statusWritten {
+		writeStatusLine(os.Stderr, runStatus{code: code})
 	}
+	os.Exit(code)
+}
 
-	if err := os.WriteFile(outfile, data, 0644); err != nil {
-		fmt.Printf("Error writing output: %v\n", err)
-		os.Exit(1)
+// run runs the command args name, or decodes if they name none
+func run(args []string) int {
+	if len(args) < 1 {
+		usage()
+		return exitError
 	}
 
-	if len(data) > 0 {
-		fmt.Printf("Decoded %d bytes. Written to %s\n", len(data), outfile)
-	} else {
-		fmt.Printf("No data decoded. Created empty file %s\n", outfile)
+	switch args[0] {
+	case "align":
+		return runAlign(args[1:])
+	case "analyze":
+		return runAnalyze(args[1:])
+	case "batch":
+		return runBatch(args[1:])
+	case "bench":
+		return runBench(args[1:])
+	case "capture":
+		return runCapture(args[1:])
+	case "catalog":
+		return runCatalog(args[1:])
+	case "corpus":
+		return runCorpus(args[1:])
+	case "diff":
+		return runDiff(args[1:])
+	case "loopback":
+		return runLoopback(args[1:])
+	case "play":
+		return runPlay(args[1:])
+	case "relaminate":
+		return runRelaminate(args[1:])
+	case "scan":
+		return runScan(args[1:])
+	case "send":
+		return runSend(args[1:])
+	case "serve":
+		return runServe(args[1:])
+	case "trim":
+		return runTrim(args[1:])
+	case "tui":
+		return runTUI(args[1:])
+	case "watch":
+		return runWatch(args[1:])
 	}
+	return runDecode(args)
 }
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"wavrider/internal/decoder"
+)
+
+// tapeNames are the names an annotations file gives the files on a tape,
+// by their number on it, from 1. Each line of the file is a number and
+// the name, e.g. "2 Lemonade Stand"; blank lines and those starting with
+// # are skipped.
+type tapeNames map[int]string
+
+// loadNames reads an annotations file
+func loadNames(path string) (tapeNames, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	names := tapeNames{}
+	lines := bufio.NewScanner(f)
+	for n := 1; lines.Scan(); n++ {
+		line := strings.TrimSpace(lines.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		number, name := line, ""
+		if i := strings.IndexAny(line, " \t"); i >= 0 {
+			number, name = line[:i], line[i+1:]
+		}
+		file, err := strconv.Atoi(strings.TrimSuffix(number, ":"))
+		name = strings.TrimSpace(name)
+		if err != nil || file < 1 || name == "" {
+			return nil, fmt.Errorf("%s:%d: not a file's number and its name", path, n)
+		}
+		if _, ok := names[file]; ok {
+			return nil, fmt.Errorf("%s:%d: file %d is named twice", path, n, file)
+		}
+		names[file] = name
+	}
+	if err := lines.Err(); err != nil {
+		return nil, err
+	}
+	return names, nil
+}
+
+// apply names the programs of each named file in the catalog
+func (t tapeNames) apply(records []decoder.Record, catalog *decoder.Catalog) {
+	program := 0
+	for i, file := range decoder.Files(records) {
+		name, ok := t[i+1]
+		for range file {
+			program++
+			if !ok {
+				continue
+			}
+			for j := range catalog.Regions {
+				if r := &catalog.Regions[j]; r.Program == program {
+					r.Name = name
+				}
+			}
+		}
+	}
+}
+
+// fileName makes a name safe to use in a file name, its path separators
+// and the characters Windows forbids replaced with dashes
+func fileName(name string) string {
+	return strings.Map(func(r rune) rune {
+		if strings.ContainsRune(`/\:*?"<>|`, r) || r < ' ' {
+			return '-'
+		}
+		return r
+	}, name)
+}
@@ -0,0 +1,519 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"maps"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"wavrider/internal/decoder"
+)
+
+// formatter writes decoded records as a file
+type formatter func(records []decoder.Record, f formatting) ([]byte, error)
+
+// formatting is what a formatter goes by besides the records: the system
+// they were decoded as and how to read the text and BASIC in them
+type formatting struct {
+	system  *decoder.System
+	charset *decoder.Charset
+	dialect *decoder.Dialect // nil to go by the system, or else the program
+}
+
+// outFormats write decoded records as a file. Besides the system's own
+// format, they place each program at its load address.
+var outFormats = map[string]formatter{
+	"native": func(records []decoder.Record, f formatting) ([]byte, error) {
+		return f.system.Pack(records), nil
+	},
+	"hex":         intelHex,
+	"applesingle": appleSingle,
+	"text":        plainText,
+	"basic":       basicListing,
+}
+
+// outExts are the extensions of the files each output format writes,
+// besides native, which writes whatever the system's format uses
+var outExts = map[string]string{
+	"hex":         ".hex",
+	"applesingle": ".as",
+	"text":        ".txt",
+	"basic":       ".bas",
+}
+
+// outputOptions are the flags choosing what a decode writes and where
+type outputOptions struct {
+	format      formatter
+	formatName  string                 // the -out-format the formatter is
+	charset     *decoder.Charset       // nil for the system's own
+	dialect     *decoder.Dialect       // nil for the system's own, or whichever lists the program
+	loadAddress int                    // -1 for the tape's own
+	ranges      []decoder.MonitorRange // the monitor saved each binary from, in tape order, if given
+	names       tapeNames              // what the files on the tape are called, if given
+	known       *knownSoftware         // programs to name the files on the tape after, if given
+	template    string                 // names the outputs, if set
+	dsk         string                 // disk image to add the files to, if set
+	exec        string                 // command to run on each output written, if set
+}
+
+// output is a file to write, and the records it was made from
+type output struct {
+	name    string
+	data    []byte
+	records []decoder.Record
+	file    int    // the file on the tape it holds, from 1, or 0 for the whole tape
+	title   string // what that file is called, if known
+}
+
+// outputFlags registers the flags choosing what decode writes
+func outputFlags(fs *flag.FlagSet) *outputOptions {
+	o := &outputOptions{format: outFormats["native"], formatName: "native", loadAddress: -1}
+	names := slices.Sorted(maps.Keys(outFormats))
+	fs.Func("out-format", "what to write: "+strings.Join(names, ", ")+" (default native, the system's own format)", func(s string) error {
+		f, ok := outFormats[s]
+		if !ok {
+			return fmt.Errorf("unknown output format %q", s)
+		}
+		o.format, o.formatName = f, s
+		return nil
+	})
+	charsets := slices.Sorted(maps.Keys(decoder.Charsets))
+	fs.Func("charset", "character set text output reads the tape's text as: "+strings.Join(charsets, ", ")+" (default the system's own)", func(s string) error {
+		c, ok := decoder.Charsets[s]
+		if !ok {
+			return fmt.Errorf("unknown character set %q", s)
+		}
+		o.charset = c
+		return nil
+	})
+	dialects := slices.Sorted(maps.Keys(decoder.Dialects))
+	fs.Func("dialect", "BASIC the basic output lists programs in: "+strings.Join(dialects, ", ")+" (default the system's own, or whichever fits)", func(s string) error {
+		d, ok := decoder.Dialects[s]
+		if !ok {
+			return fmt.Errorf("unknown BASIC dialect %q", s)
+		}
+		o.dialect = d
+		return nil
+	})
+	fs.Func("load-addr", "`address` every program loads at, e.g. 0x0800, overriding any the tape gives", func(s string) error {
+		n, err := strconv.ParseUint(s, 0, 16)
+		if err != nil {
+			return errors.New("not an address between 0 and 0xFFFF")
+		}
+		o.loadAddress = int(n)
+		return nil
+	})
+	fs.Func("monitor-range", "`ranges` the tape's binaries were saved from with the monitor's W command, in tape order, e.g. \"0800.0BFFW 6000.6FFFW\"", func(s string) error {
+		ranges, err := decoder.ParseMonitorRanges(s)
+		o.ranges = ranges
+		return err
+	})
+	fs.Func("names", "annotations `file` naming the files on the tape, a line such as \"2 Lemonade Stand\" for each, for the catalog, the disk image and "+templateName+" in templates", func(s string) error {
+		names, err := loadNames(s)
+		o.names = names
+		return err
+	})
+	fs.Func("known", "CSV `file` of known software, a line such as \"Lemonade Stand,<hash>,1024\" for each, naming the files on the tape found in it as -names does", func(s string) error {
+		known, err := loadKnown(s)
+		o.known = known
+		return err
+	})
+	fs.StringVar(&o.dsk, "dsk", "", "add each file on the tape to the DOS 3.3 disk image `file`, creating it if need be")
+	fs.StringVar(&o.exec, "exec", "", "run `command` on each output whose programs all check out, "+templateOut+" standing for its name, with what it holds in "+execEnvPrefix+"* environment variables")
+	fs.Func("out-template", "name outputs from `template`, writing one for each file on the tape if it uses more than "+templateBase+" and "+templateExt+", e.g. "+exampleTemplate, func(s string) error {
+		o.template = s
+		return checkTemplate(s)
+	})
+	return o
+}
+
+// ext returns the extension, with its dot, of the files the output
+// format writes for tapes from system, e.g. ".cas" for MSX tapes in their
+// native format
+func (o *outputOptions) ext(system *decoder.System) string {
+	if ext, ok := outExts[o.formatName]; ok {
+		return ext
+	}
+	return system.Ext()
+}
+
+// describe records what the output format writes for tapes from system,
+// for the provenance sidecar
+func (o *outputOptions) describe(system *decoder.System) provenanceFormat {
+	return provenanceFormat{Format: o.formatName, System: system.Name, Ext: o.ext(system)}
+}
+
+// fileNames returns what the files on a tape are called: as -names
+// names them, or else as the program -known finds each is
+func (o *outputOptions) fileNames(records []decoder.Record) tapeNames {
+	names := tapeNames{}
+	for n, name := range o.names {
+		names[n] = name
+	}
+	for _, m := range o.known.identify(records, o.names) {
+		names[m.file] = m.title
+	}
+	return names
+}
+
+// diskFiles returns the files decoded from input as they go on a disk
+// image, named as the template names them without any extension, or as
+// -names or -known does, or as the input and their number on the tape
+func (o *outputOptions) diskFiles(input string, records []decoder.Record) ([]dskFile, error) {
+	base := inputBase(input)
+	names := o.fileNames(records)
+	return dskFiles(records, func(n int, file []decoder.Record) string {
+		if o.template == "" {
+			if name, ok := names[n]; ok {
+				return name
+			}
+			return fmt.Sprintf("%s %02d", base, n)
+		}
+		vars := fileVars(base, n, names[n], file)
+		vars[templateExt] = ""
+		name := filepath.Base(expand(o.template, vars))
+		return strings.TrimSuffix(name, filepath.Ext(name))
+	})
+}
+
+// addToDisk adds the files decoded from input to the disk image, if one
+// was asked for, saying which to w
+func (o *outputOptions) addToDisk(w io.Writer, input string, records []decoder.Record) error {
+	if o.dsk == "" {
+		return nil
+	}
+	files, err := o.diskFiles(input, records)
+	if err != nil {
+		return err
+	}
+	names, err := appendToDisk(o.dsk, files)
+	if err != nil {
+		return err
+	}
+	noun := "files"
+	if len(names) == 1 {
+		noun = "file"
+	}
+	fmt.Fprintf(w, "Added %d %s to %s: %s\n", len(names), noun, o.dsk, strings.Join(names, ", "))
+	return nil
+}
+
+// write returns the outputs for records decoded from input: one named
+// name, or those the template names. With neither, there are none, as
+// when the files only go on a disk image.
+func (o *outputOptions) write(name, input string, records []decoder.Record, catalog *decoder.Catalog, system *decoder.System) ([]output, error) {
+	if o.loadAddress >= 0 {
+		setLoadAddress(records, catalog, o.loadAddress)
+	}
+	if o.ranges != nil {
+		if err := setMonitorRanges(records, catalog, o.ranges); err != nil {
+			return nil, err
+		}
+	}
+	names := o.fileNames(records)
+	names.apply(records, catalog)
+	if o.template == "" && name == "" {
+		return nil, nil
+	}
+	f := formatting{system: system, charset: o.charset, dialect: o.dialect}
+	if f.charset == nil {
+		f.charset = system.Charset()
+	}
+	if o.template == "" {
+		data, err := o.format(records, f)
+		return []output{{name, data, records, 0, ""}}, err
+	}
+	base, ext := inputBase(input), o.ext(system)
+	if !perFile(o.template) {
+		data, err := o.format(records, f)
+		return []output{{expand(o.template, map[string]string{templateBase: base, templateExt: ext}), data, records, 0, ""}}, err
+	}
+	var outputs []output
+	written := map[string]int{} // the file each name was given to
+	for i, file := range decoder.Files(records) {
+		data, err := o.format(file, f)
+		if err != nil {
+			return nil, fmt.Errorf("file %d: %w", i+1, err)
+		}
+		vars := fileVars(base, i+1, names[i+1], file)
+		vars[templateExt] = ext
+		name := expand(o.template, vars)
+		if n, ok := written[name]; ok {
+			return nil, fmt.Errorf("files %d and %d would both be written to %s; put %s in the template to tell them apart", n, i+1, name, templateSegment)
+		}
+		written[name] = i + 1
+		outputs = append(outputs, output{name, data, file, i + 1, names[i+1]})
+	}
+	return outputs, nil
+}
+
+// setLoadAddress loads every program at address, in the records and in
+// the catalog
+func setLoadAddress(records []decoder.Record, catalog *decoder.Catalog, address int) {
+	for i := range records {
+		if records[i].Type == decoder.RecordHeader {
+			continue
+		}
+		records[i].LoadAddress = address
+		for j := range catalog.Regions {
+			if r := &catalog.Regions[j]; r.Kind == decoder.RegionData && r.Program == i+1 {
+				r.LoadAddress = address
+			}
+		}
+	}
+}
+
+// setMonitorRanges loads each binary, every program but BASIC and its
+// variables, from the range it was saved from, in the records and in the
+// catalog, failing unless there is a range for each that is its length
+func setMonitorRanges(records []decoder.Record, catalog *decoder.Catalog, ranges []decoder.MonitorRange) error {
+	next := 0
+	for i := range records {
+		r := &records[i]
+		if r.Copy && i > 0 {
+			r.LoadAddress = records[i-1].LoadAddress
+			continue
+		}
+		if r.Type == decoder.RecordHeader || r.Type == decoder.RecordBasic || r.Type == decoder.RecordVariables {
+			continue
+		}
+		if next == len(ranges) {
+			return fmt.Errorf("program %d has no monitor range; %d given", i+1, len(ranges))
+		}
+		m := ranges[next]
+		next++
+		if m.Len() != r.Length {
+			return fmt.Errorf("program %d is %d bytes, but %s is %d", i+1, r.Length, m, m.Len())
+		}
+		r.LoadAddress = m.Start
+		for j := range catalog.Regions {
+			if c := &catalog.Regions[j]; c.Kind == decoder.RegionData && c.Program == i+1 {
+				c.LoadAddress = m.Start
+				c.Note = decoder.MonitorNote(m)
+			}
+		}
+	}
+	if next < len(ranges) {
+		return fmt.Errorf("%d monitor ranges given, but the tape holds %d binaries", len(ranges), next)
+	}
+	return nil
+}
+
+// program is a record that loads into memory, numbered as the catalog
+// numbers it
+type program struct {
+	n int
+	decoder.Record
+}
+
+// programs returns the records that load into memory, leaving out
+// headers and any that are empty. Of a record and its copy, the first
+// that checks out is kept.
+func programs(records []decoder.Record) []program {
+	var out []program
+	for i, r := range records {
+		if r.Type == decoder.RecordHeader || r.Length == 0 {
+			continue
+		}
+		if r.Copy {
+			if last := len(out) - 1; last >= 0 && out[last].n == i && !out[last].ChecksumOK && r.ChecksumOK {
+				out[last] = program{i + 1, r}
+			}
+			continue
+		}
+		out = append(out, program{i + 1, r})
+	}
+	return out
+}
+
+// placed returns the programs, failing if any has no load address or
+// would run past the top of memory
+func placed(records []decoder.Record) ([]program, error) {
+	progs := programs(records)
+	for _, p := range progs {
+		if p.LoadAddress < 0 {
+			return nil, fmt.Errorf("program %d has no load address; give one with -load-addr", p.n)
+		}
+		if p.LoadAddress+p.Length > 0x10000 {
+			return nil, fmt.Errorf("program %d runs past 0xFFFF from 0x%04X", p.n, p.LoadAddress)
+		}
+	}
+	return progs, nil
+}
+
+// hexLine is the bytes of data in each line of Intel HEX
+const hexLine = 16
+
+// intelHex writes the programs as Intel HEX, each at its load address
+func intelHex(records []decoder.Record, _ formatting) ([]byte, error) {
+	progs, err := placed(records)
+	if err != nil {
+		return nil, err
+	}
+	var out []byte
+	line := func(address int, kind byte, data []byte) {
+		rec := []byte{byte(len(data)), byte(address >> 8), byte(address), kind}
+		rec = append(rec, data...)
+		sum := byte(0)
+		for _, b := range rec {
+			sum += b
+		}
+		out = fmt.Appendf(out, ":%X%02X\n", rec, -sum)
+	}
+	for _, p := range progs {
+		body := p.Body()
+		for at := 0; at < len(body); at += hexLine {
+			line(p.LoadAddress+at, 0x00, body[at:min(at+hexLine, len(body))])
+		}
+	}
+	line(0, 0x01, nil)
+	return out, nil
+}
+
+// plainText writes the programs that hold text as a modern text file, or
+// every program if none was found to, converting from the character set
+func plainText(records []decoder.Record, f formatting) ([]byte, error) {
+	progs := programs(records)
+	text := slices.DeleteFunc(slices.Clone(progs), func(p program) bool {
+		return p.Type != decoder.RecordASCII
+	})
+	if len(text) > 0 {
+		progs = text
+	}
+	var out []byte
+	for _, p := range progs {
+		out = append(out, f.charset.Decode(p.Body())...)
+	}
+	return out, nil
+}
+
+// basicListing lists the BASIC programs as text, or every program if
+// none was found to be BASIC, in the dialect asked for, else the system's,
+// else whichever lists the program
+func basicListing(records []decoder.Record, f formatting) ([]byte, error) {
+	progs := programs(records)
+	basic := slices.DeleteFunc(slices.Clone(progs), func(p program) bool {
+		return p.Type != decoder.RecordBasic
+	})
+	if len(basic) > 0 {
+		progs = basic
+	}
+	var out []byte
+	for _, p := range progs {
+		dialect := f.dialect
+		if dialect == nil {
+			if d := f.system.Dialect(); d != nil {
+				if _, err := d.List(p.Body()); err == nil {
+					dialect = d
+				}
+			}
+		}
+		if dialect == nil {
+			dialect = decoder.DetectDialect(p.Body())
+		}
+		if dialect == nil {
+			return nil, fmt.Errorf("program %d is not BASIC in any dialect; choose one with -dialect", p.n)
+		}
+		listing, err := dialect.List(p.Body())
+		if err != nil {
+			return nil, fmt.Errorf("program %d is not %s BASIC: %w", p.n, dialect.Name, err)
+		}
+		out = append(out, listing...)
+	}
+	return out, nil
+}
+
+// AppleSingle files keep a ProDOS file type and auxiliary type with the
+// data, which for binaries is the load address
+const (
+	appleSingleMagic   = 0x00051600
+	appleSingleVersion = 0x00020000
+	appleSingleData    = 1  // entry ID of the data fork
+	appleSingleProDOS  = 11 // entry ID of the ProDOS file info
+
+	prodosText      = 0x04
+	prodosBinary    = 0x06
+	prodosInteger   = 0xFA
+	prodosApplesoft = 0xFC
+	prodosAccess    = 0xC3 // destroy, rename, write and read enabled
+)
+
+// appleSingle writes the one program decoded as an AppleSingle file,
+// typed for ProDOS by what it holds
+func appleSingle(records []decoder.Record, _ formatting) ([]byte, error) {
+	progs := programs(records)
+	if len(progs) != 1 {
+		return nil, fmt.Errorf("an AppleSingle file holds one program, but %d were decoded", len(progs))
+	}
+	p := progs[0]
+	kind, aux := byte(prodosBinary), p.LoadAddress
+	switch {
+	case p.Type == decoder.RecordBasic && p.LoadAddress == decoder.ApplesoftProgram:
+		kind = prodosApplesoft
+	case p.Type == decoder.RecordBasic:
+		kind, aux = prodosInteger, 0
+	case p.Type == decoder.RecordASCII:
+		kind, aux = prodosText, 0
+	case p.LoadAddress < 0 && p.Type != decoder.RecordShapeTable:
+		// A shape table loads anywhere, so it can do without
+		return nil, fmt.Errorf("program %d has no load address; give one with -load-addr", p.n)
+	}
+
+	const header = 26
+	const entry = 12
+	info := binary.BigEndian.AppendUint16(nil, prodosAccess)
+	info = binary.BigEndian.AppendUint16(info, uint16(kind))
+	info = binary.BigEndian.AppendUint32(info, uint32(max(0, aux)))
+	out := binary.BigEndian.AppendUint32(nil, appleSingleMagic)
+	out = binary.BigEndian.AppendUint32(out, appleSingleVersion)
+	out = append(out, make([]byte, 16)...)
+	out = binary.BigEndian.AppendUint16(out, 2)
+	at := header + 2*entry
+	for _, e := range []struct {
+		id uint32
+		n  int
+	}{{appleSingleProDOS, len(info)}, {appleSingleData, p.Length}} {
+		out = binary.BigEndian.AppendUint32(out, e.id)
+		out = binary.BigEndian.AppendUint32(out, uint32(at))
+		out = binary.BigEndian.AppendUint32(out, uint32(e.n))
+		at += e.n
+	}
+	out = append(out, info...)
+	return append(out, p.Body()...), nil
+}
+
+// printLoadMap lists where each program loads, e.g.
+// "  0x0800–0x0BFF  program 2, basic, 1,024 bytes", and which overlap
+func printLoadMap(w io.Writer, records []decoder.Record) {
+	progs := programs(records)
+	fmt.Fprintln(w, "Memory map:")
+	if len(progs) == 0 {
+		fmt.Fprintln(w, "  no programs")
+		return
+	}
+	slices.SortStableFunc(progs, func(a, b program) int {
+		return a.LoadAddress - b.LoadAddress
+	})
+	for i, p := range progs {
+		span := fmt.Sprintf("%-13s", "unknown")
+		if p.LoadAddress >= 0 {
+			span = fmt.Sprintf("0x%04X–0x%04X", p.LoadAddress, p.LoadAddress+p.Length-1)
+		}
+		fmt.Fprintf(w, "  %s  program %d", span, p.n)
+		if p.Type != "" {
+			fmt.Fprintf(w, ", %s", p.Type)
+		}
+		fmt.Fprintf(w, ", %s", byteCount(p.Length))
+		for _, q := range progs[:i] {
+			if p.LoadAddress >= 0 && q.LoadAddress >= 0 && p.LoadAddress < q.LoadAddress+q.Length {
+				fmt.Fprintf(w, ", overlaps program %d", q.n)
+			}
+		}
+		fmt.Fprintln(w)
+	}
+}
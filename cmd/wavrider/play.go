@@ -0,0 +1,86 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"wavrider/internal/decoder"
+)
+
+// runPlay plays a tape into a real machine: a WAV, such as relaminate
+// writes, as it is, or a program written out first as the system saves
+// it
+func runPlay(args []string) int {
+	fs := flag.NewFlagSet("play", flag.ContinueOnError)
+	level := fs.Float64("level", playLevel, "fraction of full scale to play the loudest sample at")
+	loadAddress := -1
+	fs.Func("load-addr", "`address` a program loads at, e.g. 0x0800, which the monitor command to read it back gives", func(s string) error {
+		n, err := strconv.ParseUint(s, 0, 16)
+		if err != nil {
+			return errors.New("not an address between 0 and 0xFFFF")
+		}
+		loadAddress = int(n)
+		return nil
+	})
+	decodeOptions := decodeFlags(fs)
+	applyProfile := profileFlags(fs)
+	if code, ok := parseFlags(fs, args); !ok {
+		return code
+	}
+	if err := applyProfile(); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return exitError
+	}
+	if fs.NArg() != 1 {
+		usage()
+		return exitError
+	}
+	if *level <= 0 || *level > 1 {
+		fmt.Println("Error: -level must be above 0 and at most 1")
+		return exitError
+	}
+	opts, err := decodeOptions()
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return exitError
+	}
+	input := fs.Arg(0)
+
+	var samples []float64
+	rate := uint32(decoder.RelaminateRate)
+	if decoder.IsCapture(input) {
+		f, err := decoder.Open(input)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			return exitError
+		}
+		samples, rate, err = decoder.ReadWAV(f, decoder.Options{})
+		f.Close()
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			return decodeOutcome(nil, err)
+		}
+	} else {
+		data, err := os.ReadFile(input)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			return exitError
+		}
+		if samples, err = decoder.EncodeProgram(data, loadAddress, opts); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			return exitError
+		}
+		if loadAddress >= 0 && len(data) > 0 && opts.System == decoder.Systems["appleii"] {
+			fmt.Printf("Read it back on the Apple ][ with %sR\n", decoder.MonitorRange{Start: loadAddress, End: loadAddress + len(data) - 1})
+		}
+	}
+
+	fmt.Printf("Playing %s, %s...\n", input, clockMillis(float64(len(samples))/float64(rate)))
+	if err := playAudio(samples, rate, *level); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return exitError
+	}
+	return exitOK
+}
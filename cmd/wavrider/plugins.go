@@ -0,0 +1,62 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"wavrider/internal/decoder"
+)
+
+// External decoders are programs named wavrider-system-NAME, each adding
+// the system NAME, found in the plugins directory beside the config file
+// or else on the PATH. They speak the protocol decoder.ExternalSystem
+// describes.
+const pluginPrefix = "wavrider-system-"
+
+// pluginDirs are the directories searched for external decoders, in
+// order
+func pluginDirs() []string {
+	var dirs []string
+	if config := defaultConfigPath(); config != "" {
+		dirs = append(dirs, filepath.Join(filepath.Dir(config), "plugins"))
+	}
+	return append(dirs, filepath.SplitList(os.Getenv("PATH"))...)
+}
+
+// loadPlugins adds a system for each external decoder found. A built-in
+// system, or one found earlier, keeps its name.
+func loadPlugins() {
+	for _, dir := range pluginDirs() {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			continue
+		}
+		for _, e := range entries {
+			name, ok := strings.CutPrefix(e.Name(), pluginPrefix)
+			if !ok || name == "" || !isExecutable(e) {
+				continue
+			}
+			if runtime.GOOS == "windows" {
+				name = strings.TrimSuffix(name, filepath.Ext(name))
+			}
+			if _, taken := decoder.Systems[name]; taken {
+				continue
+			}
+			decoder.Systems[name] = decoder.ExternalSystem(name, filepath.Join(dir, e.Name()))
+		}
+	}
+}
+
+// isExecutable reports whether a directory entry is a program that can be
+// run
+func isExecutable(e os.DirEntry) bool {
+	info, err := e.Info()
+	if err != nil || info.IsDir() {
+		return false
+	}
+	if runtime.GOOS == "windows" {
+		return strings.EqualFold(filepath.Ext(e.Name()), ".exe")
+	}
+	return info.Mode()&0111 != 0
+}
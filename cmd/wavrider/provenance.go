@@ -0,0 +1,225 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime/debug"
+	"strconv"
+	"time"
+	"wavrider/internal/decoder"
+)
+
+// version is overridden at link time with -ldflags "-X main.version=..."
+var version = ""
+
+// wavriderVersion reports the linked version, falling back to the module
+// version or VCS revision recorded in the build info
+func wavriderVersion() string {
+	if version != "" {
+		return version
+	}
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return "unknown"
+	}
+	if v := info.Main.Version; v != "" && v != "(devel)" {
+		return v
+	}
+	for _, s := range info.Settings {
+		if s.Key == "vcs.revision" {
+			return s.Value
+		}
+	}
+	return "devel"
+}
+
+// provenance is the sidecar recorded next to a decoded output so an
+// archive can tell where every file came from and how it was produced
+type provenance struct {
+	Version   string            `json:"wavrider_version"`
+	DecodedAt string            `json:"decoded_at,omitempty"`
+	Source    provenanceSource  `json:"source"`
+	Options   map[string]string `json:"options"`
+	Output    provenanceOutput  `json:"output"`
+	Programs  []provenanceEntry `json:"programs"`
+	Stats     decodeStats       `json:"stats"`                // of the whole run, which may have written other outputs
+	StoppedAt *float64          `json:"stopped_at,omitempty"` // seconds into the capture an interrupted decode stopped at
+}
+
+type provenanceSource struct {
+	File          string  `json:"file"`
+	SHA256        string  `json:"sha256"`
+	SampleRate    uint32  `json:"sample_rate"`
+	Channels      int     `json:"channels"`
+	BitsPerSample int     `json:"bits_per_sample"`
+	Duration      float64 `json:"duration_seconds"`
+}
+
+type provenanceOutput struct {
+	File   string `json:"file"`
+	Bytes  int    `json:"bytes"`
+	SHA256 string `json:"sha256"`
+	provenanceFormat
+}
+
+// provenanceFormat is the format an output was written in, and the
+// extension it takes for the system the tape is from
+type provenanceFormat struct {
+	Format string `json:"format"`
+	System string `json:"system"`
+	Ext    string `json:"extension"`
+}
+
+type provenanceEntry struct {
+	Program    int     `json:"program"`
+	Name       string  `json:"name,omitempty"`
+	Start      float64 `json:"start_seconds"`
+	End        float64 `json:"end_seconds"`
+	Bytes      int     `json:"bytes"`
+	ChecksumOK bool    `json:"checksum_ok"`
+	Checksum   string  `json:"checksum,omitempty"`
+	Read       string  `json:"checksum_read,omitempty"`
+	Computed   string  `json:"checksum_computed,omitempty"`
+	Confidence float64 `json:"confidence"`
+	Type       string  `json:"type,omitempty"`
+	LoadAddr   *int    `json:"load_address,omitempty"`
+	EndAddr    *int    `json:"end_address,omitempty"` // the last address it loads to
+}
+
+// sidecarName returns the provenance file name for an output file
+func sidecarName(outfile string) string {
+	return outfile + ".json"
+}
+
+// writeProvenance records how outfile was decoded from wavFile, whose
+// SHA-256 is sourceHash. Every
+// flag is listed with its effective value so defaults are captured too.
+// With -deterministic the sidecar is reproducible as well: the decoding
+// time comes from SOURCE_DATE_EPOCH, or is left out, and -jobs, which no
+// longer changes the output, is not recorded, nor how long decoding took.
+func writeProvenance(path, wavFile, sourceHash, outfile string, data []byte, format provenanceFormat, c *decoder.Catalog, stats decodeStats, fs *flag.FlagSet) error {
+	deterministic := false
+	if f := fs.Lookup("deterministic"); f != nil {
+		deterministic = f.Value.String() == "true"
+	}
+	decodedAt := time.Now()
+	if deterministic {
+		decodedAt = time.Time{}
+		stats.Elapsed, stats.Realtime = 0, 0
+		if epoch := os.Getenv("SOURCE_DATE_EPOCH"); epoch != "" {
+			secs, err := strconv.ParseInt(epoch, 10, 64)
+			if err != nil {
+				return fmt.Errorf("SOURCE_DATE_EPOCH: %w", err)
+			}
+			decodedAt = time.Unix(secs, 0)
+		}
+	}
+
+	p := provenance{
+		Version:   wavriderVersion(),
+		DecodedAt: timestamp(decodedAt),
+		Source: provenanceSource{
+			File:          filepath.Base(wavFile),
+			SHA256:        sourceHash,
+			SampleRate:    c.SampleRate,
+			Channels:      c.Channels,
+			BitsPerSample: c.BitsPerSample,
+			Duration:      c.Duration,
+		},
+		Options: map[string]string{},
+		Output: provenanceOutput{
+			File:   filepath.Base(outfile),
+			Bytes:  len(data),
+			SHA256: hashBytes(data),
+
+			provenanceFormat: format,
+		},
+		Programs: []provenanceEntry{},
+		Stats:    stats,
+	}
+	if c.Interrupted {
+		p.StoppedAt = &c.StoppedAt
+	}
+	fs.VisitAll(func(f *flag.Flag) {
+		if deterministic && f.Name == "jobs" {
+			return
+		}
+		p.Options[f.Name] = f.Value.String()
+	})
+	for _, r := range c.Regions {
+		if r.Kind != decoder.RegionData {
+			continue
+		}
+		start, end, _ := c.ProgramSpan(r.Program)
+		entry := provenanceEntry{
+			Program:    r.Program,
+			Name:       r.Name,
+			Start:      start,
+			End:        end,
+			Bytes:      r.Bytes,
+			ChecksumOK: r.ChecksumOK,
+			Confidence: r.Confidence,
+			Type:       r.Type,
+		}
+		if v := r.Verified; v.Algorithm != "" {
+			entry.Checksum = v.Algorithm
+			entry.Read = hex.EncodeToString(v.Read)
+			entry.Computed = hex.EncodeToString(v.Computed)
+		}
+		if r.LoadAddress >= 0 {
+			entry.LoadAddr = &r.LoadAddress
+			if r.Bytes > 0 {
+				end := r.LoadAddress + r.Bytes - 1
+				entry.EndAddr = &end
+			}
+		}
+		p.Programs = append(p.Programs, entry)
+	}
+
+	out, err := json.MarshalIndent(p, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(out, '\n'), 0644)
+}
+
+// hashSource returns the SHA-256 of capture input from h, which hashed it
+// as it was decoded, through decoder.Options.Source, so that standard
+// input or a URL is not read twice. A decode that was stopped need not
+// have read it to the end, and it is read again instead, which standard
+// input cannot be.
+func hashSource(h hash.Hash, input string, stopped bool) (string, error) {
+	if !stopped {
+		return hex.EncodeToString(h.Sum(nil)), nil
+	}
+	if input == decoder.Stdin {
+		return "", errors.New("the decode stopped before standard input was read to the end, so it cannot be hashed")
+	}
+	return hashFile(input)
+}
+
+func hashFile(path string) (string, error) {
+	f, err := decoder.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func hashBytes(b []byte) string {
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"runtime"
+	"wavrider/internal/decoder"
+)
+
+// runRelaminate restores a damaged tape: what decodes is written out
+// again as an ideal recording, each record where it was on the tape, and
+// what does not is left silent
+func runRelaminate(args []string) int {
+	fs := flag.NewFlagSet("relaminate", flag.ContinueOnError)
+	jobs := fs.Int("jobs", runtime.GOMAXPROCS(0), "number of segments of a long capture to decode concurrently")
+	decodeOptions := decodeFlags(fs)
+	applyProfile := profileFlags(fs)
+	if code, ok := parseFlags(fs, args); !ok {
+		return code
+	}
+	if err := applyProfile(); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return exitError
+	}
+	if fs.NArg() != 2 {
+		usage()
+		return exitError
+	}
+	opts, err := decodeOptions()
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return exitError
+	}
+	opts.Workers = *jobs
+	input, output := fs.Arg(0), fs.Arg(1)
+
+	fmt.Printf("Processing %s...\n", input)
+	records, catalog, err := decoder.DecodeFileRecords(input, opts)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return decodeOutcome(nil, err)
+	}
+	samples, silent, err := decoder.Relaminate(records, catalog.Duration, opts)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return exitError
+	}
+	err = writeFileWith(output, func(w io.Writer) error {
+		return decoder.WriteWAV(w, samples, decoder.RelaminateRate)
+	})
+	if err != nil {
+		fmt.Printf("Error writing restored audio: %v\n", err)
+		return exitError
+	}
+	for _, r := range silent {
+		fmt.Printf("  %s–%s left silent: %s did not check out\n", clock(r.Start), clock(r.End), byteCount(len(r.Data)))
+	}
+	fmt.Printf("Restored %d of %d records to %s\n", len(records)-len(silent), len(records), output)
+	return decodeOutcome(catalog, nil)
+}
@@ -0,0 +1,359 @@
+package main
+
+import (
+	"encoding/base64"
+	"fmt"
+	"html/template"
+	"io"
+	"math"
+	"path/filepath"
+	"strings"
+	"time"
+	"wavrider/internal/decoder"
+)
+
+// The report is a single HTML file, with its waveforms and charts drawn
+// in SVG and its outputs embedded, so it can be mailed or put on a share
+// as it is and opened in any browser.
+const (
+	reportWidth         = 900 // pixels, of the whole tape's waveform
+	reportThumbWidth    = 300 // of each program's
+	reportHeight        = 80
+	reportThumbHeight   = 40
+	reportLowConfidence = 0.95 // programs read less cleanly are charted in amber
+)
+
+// reportColors are the colors a region is shaded in behind the waveform
+var reportColors = map[decoder.RegionKind]string{
+	decoder.RegionHeader:  "#dde8f8",
+	decoder.RegionData:    "#d8f0d8",
+	decoder.RegionDropout: "#f8c080",
+}
+
+const reportBadColor = "#f8d0d0" // a program whose checksum failed
+
+// report is what the report template shows
+type report struct {
+	Input      string
+	System     string
+	DecodedAt  string
+	Version    string
+	Status     string
+	Duration   string
+	Programs   int
+	Good       int
+	Bytes      string
+	SampleRate uint32
+	Clipped    string
+	SNR        string
+	Notes      []string
+	Waveform   template.HTML
+	Confidence template.HTML
+	Rows       []reportRow
+	Outputs    []reportOutput
+}
+
+// reportRow is a program in the report's table
+type reportRow struct {
+	Program    int
+	Name       string
+	Span       string
+	Bytes      string
+	Type       string
+	Load       string
+	OK         bool
+	Checksum   string
+	Confidence string
+	Speed      string
+	Errors     []string
+	Note       string
+	Waveform   template.HTML
+
+	confidence float64
+}
+
+// reportOutput is a file the decode wrote, embedded for download
+type reportOutput struct {
+	Name string
+	Size string
+	Href template.URL
+}
+
+// writeReport writes the HTML report of a decode of input, reading the
+// capture again for its waveforms
+func writeReport(w io.Writer, input string, system *decoder.System, c *decoder.Catalog, outputs []output, code int, opts decoder.Options) error {
+	f, err := decoder.Open(input)
+	if err != nil {
+		return err
+	}
+	samples, rate, err := decoder.ReadWAV(f, opts)
+	f.Close()
+	if err != nil {
+		return err
+	}
+
+	rep := report{
+		Input:      filepath.Base(input),
+		System:     system.Name,
+		DecodedAt:  timestamp(time.Now()),
+		Version:    wavriderVersion(),
+		Status:     statusNames[code],
+		Duration:   clock(c.Duration),
+		SampleRate: rate,
+		Waveform:   waveformSVG(samples, rate, 0, c.Duration, reportWidth, reportHeight, c.Regions, nil),
+	}
+	if c.Clipped > 0 {
+		rep.Clipped = percent(c.Clipped, 1)
+	}
+	if c.SNR != 0 {
+		rep.SNR = decibels(c.SNR)
+	}
+	if c.Interrupted {
+		rep.Notes = append(rep.Notes, fmt.Sprintf("The decode was interrupted at %s; nothing after was decoded.", clock(c.StoppedAt)))
+	}
+	bytes := 0
+	for _, r := range c.Regions {
+		if r.Kind != decoder.RegionData {
+			continue
+		}
+		rep.Programs++
+		bytes += r.Bytes
+		if r.ChecksumOK {
+			rep.Good++
+		}
+		rep.Rows = append(rep.Rows, reportProgram(samples, rate, r))
+	}
+	rep.Bytes = byteCount(bytes)
+	rep.Confidence = confidenceSVG(rep.Rows)
+	for _, o := range outputs {
+		name := o.name
+		if name == "-" {
+			name = "output" + system.Ext()
+		}
+		rep.Outputs = append(rep.Outputs, reportOutput{
+			Name: filepath.Base(name),
+			Size: size(int64(len(o.data))),
+			Href: template.URL("data:application/octet-stream;base64," + base64.StdEncoding.EncodeToString(o.data)),
+		})
+	}
+	return reportTemplate.Execute(w, rep)
+}
+
+// reportProgram makes the table row of a program's data region
+func reportProgram(samples []float64, rate uint32, r decoder.Region) reportRow {
+	row := reportRow{
+		Program:    r.Program,
+		Name:       r.Name,
+		Span:       clock(r.Start) + "–" + clock(r.End),
+		Bytes:      thousands(r.Bytes),
+		Type:       r.Type,
+		OK:         r.ChecksumOK,
+		Checksum:   "OK",
+		Confidence: percent(r.Confidence, 1),
+		Note:       r.Note,
+		confidence: r.Confidence,
+	}
+	if r.LoadAddress >= 0 {
+		row.Load = fmt.Sprintf("0x%04X", r.LoadAddress)
+	}
+	if !r.ChecksumOK {
+		row.Checksum = "BAD"
+		if v := r.Verified; v.Algorithm != "" {
+			row.Checksum += " (" + v.String() + ")"
+		}
+	}
+	if r.Speed > 0 {
+		row.Speed = change(r.Speed)
+	}
+	if r.BitErrors > 0 {
+		row.Errors = append(row.Errors, fmt.Sprintf("%s bit errors", thousands(r.BitErrors)))
+	}
+	if r.Erasures > 0 {
+		row.Errors = append(row.Errors, byteCount(r.Erasures)+" erased")
+	}
+	if len(r.Misframed) > 0 {
+		row.Errors = append(row.Errors, fmt.Sprintf("%s misframed (%s)", byteCount(len(r.Misframed)), misframedAt(r.Misframed)))
+	}
+	if len(r.Disputes) > 0 {
+		row.Errors = append(row.Errors, fmt.Sprintf("%s disputed (%s)", byteCount(len(r.Disputes)), disputeWinners(r.Disputes)))
+	}
+	if r.Retry != "" {
+		row.Errors = append(row.Errors, "read with "+r.Retry)
+	}
+
+	// Bad bytes are marked where they were read, taking the bytes to be
+	// spread evenly across the region
+	var marks []float64
+	at := func(offset int) float64 {
+		if r.Bytes == 0 {
+			return r.Start
+		}
+		return r.Start + (r.End-r.Start)*float64(offset)/float64(r.Bytes)
+	}
+	for _, e := range r.Misframed {
+		marks = append(marks, at(e.Offset))
+	}
+	for _, d := range r.Disputes {
+		marks = append(marks, at(d.Offset))
+	}
+	row.Waveform = waveformSVG(samples, rate, r.Start, r.End, reportThumbWidth, reportThumbHeight, []decoder.Region{r}, marks)
+	return row
+}
+
+// waveformSVG draws the samples between from and to seconds as an
+// envelope, the highest and lowest sample of each column, over the
+// regions shaded and with a red line at each of marks
+func waveformSVG(samples []float64, rate uint32, from, to float64, width, height int, regions []decoder.Region, marks []float64) template.HTML {
+	if to <= from {
+		to = from + 1
+	}
+	x := func(t float64) float64 {
+		return math.Max(0, math.Min(float64(width), (t-from)/(to-from)*float64(width)))
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d">`, width, height, width, height)
+	for _, r := range regions {
+		color, ok := reportColors[r.Kind]
+		if !ok || r.End < from || r.Start > to {
+			continue
+		}
+		if r.Kind == decoder.RegionData && !r.ChecksumOK {
+			color = reportBadColor
+		}
+		fmt.Fprintf(&b, `<rect x="%.1f" y="0" width="%.1f" height="%d" fill="%s"/>`, x(r.Start), math.Max(1, x(r.End)-x(r.Start)), height, color)
+	}
+
+	mid := float64(height) / 2
+	first := max(0, min(len(samples), int(from*float64(rate))))
+	last := max(0, min(len(samples), int(to*float64(rate))))
+	if first < last {
+		b.WriteString(`<path fill="none" stroke="#246" stroke-width="1" d="`)
+		per := float64(last-first) / float64(width)
+		for col := 0; col < width; col++ {
+			lo, hi := first+int(float64(col)*per), first+int(float64(col+1)*per)
+			if hi <= lo {
+				hi = lo + 1
+			}
+			top, bottom := 0.0, 0.0
+			for _, s := range samples[lo:min(hi, last)] {
+				top, bottom = math.Max(top, s), math.Min(bottom, s)
+			}
+			fmt.Fprintf(&b, "M%d.5 %.1fV%.1f", col, mid-top*mid, mid-bottom*mid)
+		}
+		b.WriteString(`"/>`)
+	}
+	for _, t := range marks {
+		fmt.Fprintf(&b, `<line x1="%.1f" y1="0" x2="%.1f" y2="%d" stroke="#c00" stroke-width="1"/>`, x(t), x(t), height)
+	}
+	b.WriteString(`</svg>`)
+	return template.HTML(b.String())
+}
+
+// confidenceSVG charts how cleanly each program was read, a bar for each
+func confidenceSVG(rows []reportRow) template.HTML {
+	const bar, gap, label, length = 16, 4, 110, 400
+	height := len(rows) * (bar + gap)
+	var b strings.Builder
+	fmt.Fprintf(&b, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" font-family="sans-serif" font-size="12">`, label+length+60, height)
+	for i, row := range rows {
+		y := i * (bar + gap)
+		color := "#4a4"
+		switch {
+		case !row.OK:
+			color = "#c44"
+		case row.confidence < reportLowConfidence:
+			color = "#ca4"
+		}
+		name := fmt.Sprintf("Program %d", row.Program)
+		if row.Name != "" {
+			name = row.Name
+		}
+		fmt.Fprintf(&b, `<text x="0" y="%d">%s</text>`, y+bar-4, template.HTMLEscapeString(name))
+		fmt.Fprintf(&b, `<rect x="%d" y="%d" width="%d" height="%d" fill="#eee"/>`, label, y, length, bar)
+		fmt.Fprintf(&b, `<rect x="%d" y="%d" width="%.1f" height="%d" fill="%s"/>`, label, y, row.confidence*length, bar, color)
+		fmt.Fprintf(&b, `<text x="%d" y="%d">%s</text>`, label+length+6, y+bar-4, row.Confidence)
+	}
+	b.WriteString(`</svg>`)
+	return template.HTML(b.String())
+}
+
+var reportTemplate = template.Must(template.New("report").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>{{.Input}} — wavrider report</title>
+<style>
+body { font-family: sans-serif; margin: 2em; color: #222; }
+table { border-collapse: collapse; margin: 1em 0; }
+th, td { border: 1px solid #ccc; padding: 4px 8px; text-align: left; vertical-align: top; }
+th { background: #f4f4f4; }
+td.num { text-align: right; }
+.bad { color: #b00; font-weight: bold; }
+.ok { color: #070; }
+dl { display: grid; grid-template-columns: max-content auto; gap: 2px 1em; }
+dt { font-weight: bold; }
+dd { margin: 0; }
+.key span { display: inline-block; padding: 0 6px; margin-right: 6px; }
+</style>
+</head>
+<body>
+<h1>{{.Input}}</h1>
+<dl>
+<dt>System</dt><dd>{{.System}}</dd>
+<dt>Length</dt><dd>{{.Duration}}, {{.SampleRate}} Hz</dd>
+<dt>Programs</dt><dd>{{.Programs}}, {{.Good}} with good checksums, {{.Bytes}}</dd>
+<dt>Outcome</dt><dd class="{{if eq .Status "ok"}}ok{{else}}bad{{end}}">{{.Status}}</dd>
+{{- if .Clipped}}
+<dt>Clipped</dt><dd>{{.Clipped}} of samples</dd>
+{{- end}}
+{{- if .SNR}}
+<dt>Signal to noise</dt><dd>{{.SNR}}</dd>
+{{- end}}
+<dt>Decoded</dt><dd>{{.DecodedAt}} by wavrider {{.Version}}</dd>
+</dl>
+{{- range .Notes}}
+<p class="bad">{{.}}</p>
+{{- end}}
+
+<h2>The tape</h2>
+{{.Waveform}}
+<p class="key"><span style="background:#dde8f8">header tone</span><span style="background:#d8f0d8">program</span><span style="background:#f8d0d0">bad checksum</span><span style="background:#f8c080">dropout</span><span style="color:#c00">| bad byte</span></p>
+
+{{- if .Rows}}
+<h2>Programs</h2>
+<table>
+<tr><th>#</th><th>Name</th><th>Time</th><th>Bytes</th><th>Type</th><th>Loads at</th><th>Checksum</th><th>Read cleanly</th><th>Speed</th><th>Problems</th><th>Waveform</th></tr>
+{{- range .Rows}}
+<tr>
+<td class="num">{{.Program}}</td>
+<td>{{.Name}}</td>
+<td>{{.Span}}</td>
+<td class="num">{{.Bytes}}</td>
+<td>{{.Type}}</td>
+<td>{{.Load}}</td>
+<td class="{{if .OK}}ok{{else}}bad{{end}}">{{.Checksum}}</td>
+<td class="num">{{.Confidence}}</td>
+<td class="num">{{.Speed}}</td>
+<td>{{range .Errors}}{{.}}<br>{{end}}{{.Note}}</td>
+<td>{{.Waveform}}</td>
+</tr>
+{{- end}}
+</table>
+
+<h2>How cleanly each program was read</h2>
+{{.Confidence}}
+{{- else}}
+<p class="bad">No programs were found on the tape.</p>
+{{- end}}
+
+{{- if .Outputs}}
+<h2>Files</h2>
+<ul>
+{{- range .Outputs}}
+<li><a href="{{.Href}}" download="{{.Name}}">{{.Name}}</a>, {{.Size}}</li>
+{{- end}}
+</ul>
+{{- end}}
+</body>
+</html>
+`))
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"wavrider/internal/decoder"
+)
+
+// runScan lists the records on a tape without decoding them
+func runScan(args []string) int {
+	fs := flag.NewFlagSet("scan", flag.ContinueOnError)
+	if code, ok := parseFlags(fs, args); !ok {
+		return code
+	}
+	if fs.NArg() != 1 {
+		usage()
+		return exitError
+	}
+
+	f, err := decoder.Open(fs.Arg(0))
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return exitError
+	}
+	defer f.Close()
+	segments, err := decoder.Scan(f)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return decodeOutcome(nil, err)
+	}
+	printSegments(os.Stdout, segments)
+	return exitOK
+}
+
+// printSegments writes one line per segment, e.g.
+// "  1  00:02.104–00:12.331 header tone 770 Hz, 00:12.331–00:15.010 data"
+func printSegments(w io.Writer, segments []decoder.SegmentInfo) {
+	fmt.Fprintf(w, "%d segments:\n", len(segments))
+	for i, s := range segments {
+		fmt.Fprintf(w, "  %2d  ", i+1)
+		if s.Header > 0 {
+			fmt.Fprintf(w, "%s–%s header tone %s Hz, ", clockMillis(s.Start), clockMillis(s.Sync), fixed(s.Tone, 0))
+		}
+		fmt.Fprintf(w, "%s–%s data\n", clockMillis(s.Sync), clockMillis(s.End))
+	}
+}
@@ -0,0 +1,241 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+	"time"
+	"wavrider/internal/decoder"
+)
+
+// The send protocol, which a client of a page or so on the Apple ][, as
+// send -client writes one, speaks through a Super Serial Card, 8 data
+// bits, no parity and 1 stop bit. For each program the sender writes sendStart, the program's load
+// address and length, two bytes each low first, and their checksum; then
+// the program in blocks of sendBlock bytes, the last shorter, each
+// followed by its checksum. The checksum is the monitor's tape checksum,
+// 0xFF exclusive-ored with every byte. The client answers the header and
+// each block with sendACK, or with sendNAK to have it sent again; one it
+// does not answer in time is sent again too. After the last program the
+// sender writes sendEnd.
+const (
+	sendStart = 0x02 // STX
+	sendEnd   = 0x04 // EOT
+	sendACK   = 0x06
+	sendNAK   = 0x15
+	sendBlock = 256
+
+	sendRetries = 5 // times a block is sent before giving up
+)
+
+// sendUsage explains send and its protocol, for send -h
+const sendUsage = `Usage: wavrider send [flags] -port DEVICE <wav-file>
+       wavrider send [-slot N] [-speed BAUD] -client FILE
+
+Decodes a capture and sends its programs over a serial port to the Apple ][
+they came from, which receives them with a client on a Super Serial Card.
+-client writes the client, 185 bytes of machine code loading at 0x300, to
+FILE: play it to the Apple with "wavrider play -load-addr 0x300 FILE" and
+load it with 300.3B8R in the monitor, or type in the listing printed with
+it, then start it with 300G and run send. It returns to the monitor once
+every program is in.
+
+The protocol runs at 8 data bits, no parity and 1 stop bit. For each program
+the sender writes STX (0x02), the load address and length, two bytes each,
+low byte first, and their checksum; then the program in blocks of 256 bytes,
+the last shorter, each followed by its checksum. A checksum is 0xFF
+exclusive-ored with every byte summed, as the monitor's tape routines sum
+them. The client answers the header and each block with ACK (0x06), or with
+NAK (0x15) to have it sent again; one it does not answer within -timeout is
+sent again as well, up to 5 times in all. After the last program the sender
+writes EOT (0x04).
+
+Flags:
+`
+
+// runSend decodes a capture and sends its programs over a serial port to
+// a client on the machine they came from
+func runSend(args []string) int {
+	fs := flag.NewFlagSet("send", flag.ContinueOnError)
+	jobs := fs.Int("jobs", runtime.GOMAXPROCS(0), "number of segments of a long capture to decode concurrently")
+	port := fs.String("port", "", "serial `device` the client is on, e.g. /dev/ttyUSB0")
+	speed := fs.Int("speed", 19200, "bits a second on the serial port")
+	timeout := fs.Duration("timeout", 10*time.Second, "how long to wait for the client to answer each block")
+	force := fs.Bool("force", false, "send programs whose checksums failed as well")
+	client := fs.String("client", "", "write the client for the Apple ][ to `file` rather than send anything")
+	slot := fs.Int("slot", 2, "slot of the Super Serial Card the client talks through")
+	decodeOptions := decodeFlags(fs)
+	outputOpts := outputFlags(fs)
+	applyProfile := profileFlags(fs)
+	fs.Usage = func() {
+		fmt.Fprint(fs.Output(), sendUsage)
+		fs.PrintDefaults()
+	}
+	if code, ok := parseFlags(fs, args); !ok {
+		return code
+	}
+	if err := applyProfile(); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return exitError
+	}
+	if *client != "" {
+		return writeSendClient(*client, *slot, *speed)
+	}
+	if fs.NArg() != 1 {
+		usage()
+		return exitError
+	}
+	if *port == "" {
+		fmt.Println("Error: name the serial port with -port")
+		return exitError
+	}
+	opts, err := decodeOptions()
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return exitError
+	}
+	opts.Workers = *jobs
+	input := fs.Arg(0)
+
+	fmt.Printf("Processing %s...\n", input)
+	records, catalog, err := decoder.DecodeFileRecords(input, opts)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return decodeOutcome(nil, err)
+	}
+	// -load-addr and -monitor-range place the programs as for a decode
+	if _, err := outputOpts.write("", input, records, catalog, opts.System); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return exitError
+	}
+	progs, err := placed(records)
+	if err == nil && len(progs) == 0 {
+		err = errors.New("no programs to send")
+	}
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return exitError
+	}
+	for _, p := range progs {
+		if !p.ChecksumOK && !*force {
+			fmt.Printf("Error: program %d did not check out; send it anyway with -force\n", p.n)
+			return exitPartial
+		}
+	}
+
+	conn, err := openSerial(*port, *speed, *timeout)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return exitError
+	}
+	defer conn.Close()
+	for _, p := range progs {
+		fmt.Printf("Sending program %d, %s to 0x%04X...\n", p.n, byteCount(p.Length), p.LoadAddress)
+		if err := sendProgram(conn, p.LoadAddress, p.Body(), *timeout); err != nil {
+			fmt.Printf("Error: program %d: %v\n", p.n, err)
+			return exitError
+		}
+	}
+	if _, err := conn.Write([]byte{sendEnd}); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return exitError
+	}
+	fmt.Printf("Sent %d programs to %s\n", len(progs), *port)
+	return decodeOutcome(catalog, nil)
+}
+
+// writeSendClient writes the client for a Super Serial Card in slot at
+// speed to path, saying how to get it onto the Apple ][
+func writeSendClient(path string, slot, speed int) int {
+	code, err := sendClient(slot, speed)
+	if err == nil {
+		err = os.WriteFile(path, code, 0644)
+	}
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return exitError
+	}
+	end := sendClientOrigin + len(code) - 1
+	fmt.Printf("Wrote the client for a Super Serial Card in slot %d at %d bits a second to %s.\n", slot, speed, path)
+	fmt.Printf("Play it with \"wavrider play -load-addr 0x%X %s\" and load it with %X.%XR in the\n", sendClientOrigin, path, sendClientOrigin, end)
+	fmt.Printf("monitor, or type it in there:\n")
+	writeMonitorListing(os.Stdout, sendClientOrigin, code)
+	fmt.Printf("Then start it with %XG, and send.\n", sendClientOrigin)
+	return exitOK
+}
+
+// sendProgram sends one program loading at address to the client on rw,
+// waiting up to timeout for each answer
+func sendProgram(rw io.ReadWriter, address int, body []byte, timeout time.Duration) error {
+	header := []byte{byte(address), byte(address >> 8), byte(len(body)), byte(len(body) >> 8)}
+	if err := sendFrame(rw, append([]byte{sendStart}, header...), header, timeout); err != nil {
+		return fmt.Errorf("header: %w", err)
+	}
+	for at := 0; at < len(body); at += sendBlock {
+		block := body[at:min(at+sendBlock, len(body))]
+		if err := sendFrame(rw, block, block, timeout); err != nil {
+			return fmt.Errorf("block at 0x%04X: %w", address+at, err)
+		}
+	}
+	return nil
+}
+
+// errNoAnswer is returned by readAnswer when the client says nothing in time
+var errNoAnswer = errors.New("no answer")
+
+// sendFrame writes frame and the checksum of its summed bytes until the
+// client acknowledges it, sending it again when the client refuses it or
+// does not answer, up to sendRetries times
+func sendFrame(rw io.ReadWriter, frame, summed []byte, timeout time.Duration) error {
+	sum := byte(0xFF)
+	for _, b := range summed {
+		sum ^= b
+	}
+	frame = append(frame[:len(frame):len(frame)], sum)
+	unanswered := 0
+	for range sendRetries {
+		if _, err := rw.Write(frame); err != nil {
+			return err
+		}
+		answer, err := readAnswer(rw, timeout)
+		if errors.Is(err, errNoAnswer) {
+			unanswered++
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if answer == sendACK {
+			return nil
+		}
+	}
+	switch unanswered {
+	case 0:
+		return fmt.Errorf("refused %d times", sendRetries)
+	case sendRetries:
+		return fmt.Errorf("%w within %s, %d times", errNoAnswer, timeout, sendRetries)
+	}
+	return fmt.Errorf("refused %d times and unanswered %d times", sendRetries-unanswered, unanswered)
+}
+
+// readAnswer waits up to timeout for the client's answer, skipping
+// anything that is neither an ACK nor a NAK, and returns errNoAnswer if
+// none comes. Reads from the port return nothing when they time out, so
+// they are tried until the timeout is up.
+func readAnswer(r io.Reader, timeout time.Duration) (byte, error) {
+	deadline := time.Now().Add(timeout)
+	b := make([]byte, 1)
+	for time.Now().Before(deadline) {
+		n, err := r.Read(b)
+		if err != nil && err != io.EOF {
+			return 0, err
+		}
+		if n == 1 && (b[0] == sendACK || b[0] == sendNAK) {
+			return b[0], nil
+		}
+	}
+	return 0, errNoAnswer
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"fmt"
+	"io"
+)
+
+// sendClientOrigin is where the client loads and runs: page 3, which
+// DOS, BASIC and the monitor leave free, so that it can receive programs
+// anywhere else
+const sendClientOrigin = 0x0300
+
+// aciaSpeeds are the baud rate codes of the Super Serial Card's 6551
+// ACIA, by the speed they set
+var aciaSpeeds = map[int]byte{
+	1200:  0x08,
+	2400:  0x0A,
+	4800:  0x0C,
+	9600:  0x0E,
+	19200: 0x0F,
+}
+
+// sendClient returns the client for the Apple ][ that receives programs
+// from send: 6502 machine code loading at sendClientOrigin, for a Super
+// Serial Card in slot talking at speed. It prints a dot for each block
+// it receives and returns to whatever ran it once the sender is done.
+func sendClient(slot, speed int) ([]byte, error) {
+	baud, ok := aciaSpeeds[speed]
+	if !ok {
+		return nil, fmt.Errorf("the Super Serial Card cannot talk at %d bits a second", speed)
+	}
+	if slot < 1 || slot > 7 {
+		return nil, fmt.Errorf("no slot %d; slots are 1 to 7", slot)
+	}
+	acia := 0xC088 + slot<<4
+	data := []byte{byte(acia), byte(acia >> 8)}
+	status := []byte{byte(acia + 1), byte((acia + 1) >> 8)}
+	command := []byte{byte(acia + 2), byte((acia + 2) >> 8)}
+	control := []byte{byte(acia + 3), byte((acia + 3) >> 8)}
+
+	// Zero page: PTR $06-$07 where the block goes, LEN $08-$09 bytes of
+	// the program still to come, SUM $EB, CNT $EC the block's length, 0
+	// for 256, and HDR $FA-$FD the header
+	var code []byte
+	asm := func(b ...any) {
+		for _, v := range b {
+			switch v := v.(type) {
+			case int:
+				code = append(code, byte(v))
+			case []byte:
+				code = append(code, v...)
+			}
+		}
+	}
+	asm(0x8D, status)         // 0300        STA STATUS   reset the ACIA
+	asm(0xA9, 0x0B)           // 0303        LDA #$0B     no parity, DTR on, no interrupts
+	asm(0x8D, command)        // 0305        STA COMMAND
+	asm(0xA9, 0x10|int(baud)) // 0308        LDA #CTRL    8 data bits, 1 stop bit, the speed
+	asm(0x8D, control)        // 030A        STA CONTROL
+	asm(0x20, 0x9B, 0x03)     // 030D WAIT   JSR GET      wait for STX or EOT
+	asm(0xC9, sendEnd)        // 0310        CMP #EOT
+	asm(0xD0, 0x01)           // 0312        BNE NOTEOT
+	asm(0x60)                 // 0314        RTS
+	asm(0xC9, sendStart)      // 0315 NOTEOT CMP #STX
+	asm(0xD0, 0xF4)           // 0317        BNE WAIT
+	asm(0xA2, 0x00)           // 0319        LDX #0       read the header
+	asm(0xA9, 0xFF)           // 031B        LDA #$FF
+	asm(0x85, 0xEB)           // 031D        STA SUM
+	asm(0x20, 0x9B, 0x03)     // 031F HLOOP  JSR GET
+	asm(0x95, 0xFA)           // 0322        STA HDR,X
+	asm(0x45, 0xEB)           // 0324        EOR SUM
+	asm(0x85, 0xEB)           // 0326        STA SUM
+	asm(0xE8)                 // 0328        INX
+	asm(0xE0, 0x04)           // 0329        CPX #4
+	asm(0xD0, 0xF2)           // 032B        BNE HLOOP
+	asm(0x20, 0x9B, 0x03)     // 032D        JSR GET      its checksum
+	asm(0xC5, 0xEB)           // 0330        CMP SUM
+	asm(0xF0, 0x06)           // 0332        BEQ HOK
+	asm(0x20, 0xAA, 0x03)     // 0334        JSR NAK      to have it sent again
+	asm(0x4C, 0x0D, 0x03)     // 0337        JMP WAIT
+	asm(0xA5, 0xFA)           // 033A HOK    LDA HDR      PTR = address
+	asm(0x85, 0x06)           // 033C        STA PTR
+	asm(0xA5, 0xFB)           // 033E        LDA HDR+1
+	asm(0x85, 0x07)           // 0340        STA PTR+1
+	asm(0xA5, 0xFC)           // 0342        LDA HDR+2    LEN = length
+	asm(0x85, 0x08)           // 0344        STA LEN
+	asm(0xA5, 0xFD)           // 0346        LDA HDR+3
+	asm(0x85, 0x09)           // 0348        STA LEN+1
+	asm(0x20, 0xA6, 0x03)     // 034A        JSR ACK
+	asm(0xA5, 0x08)           // 034D BLOCK  LDA LEN      until the program is all in
+	asm(0x05, 0x09)           // 034F        ORA LEN+1
+	asm(0xF0, 0xBA)           // 0351        BEQ WAIT
+	asm(0xA5, 0x09)           // 0353        LDA LEN+1    a whole block, or what is left
+	asm(0xF0, 0x04)           // 0355        BEQ SHORT
+	asm(0xA9, 0x00)           // 0357        LDA #0
+	asm(0xF0, 0x02)           // 0359        BEQ SETCNT
+	asm(0xA5, 0x08)           // 035B SHORT  LDA LEN
+	asm(0x85, 0xEC)           // 035D SETCNT STA CNT
+	asm(0xA0, 0x00)           // 035F RETRY  LDY #0       read the block into place
+	asm(0xA9, 0xFF)           // 0361        LDA #$FF
+	asm(0x85, 0xEB)           // 0363        STA SUM
+	asm(0x20, 0x9B, 0x03)     // 0365 BLOOP  JSR GET
+	asm(0x91, 0x06)           // 0368        STA (PTR),Y
+	asm(0x45, 0xEB)           // 036A        EOR SUM
+	asm(0x85, 0xEB)           // 036C        STA SUM
+	asm(0xC8)                 // 036E        INY
+	asm(0xC4, 0xEC)           // 036F        CPY CNT
+	asm(0xD0, 0xF2)           // 0371        BNE BLOOP
+	asm(0x20, 0x9B, 0x03)     // 0373        JSR GET      its checksum
+	asm(0xC5, 0xEB)           // 0376        CMP SUM
+	asm(0xF0, 0x06)           // 0378        BEQ BOK
+	asm(0x20, 0xAA, 0x03)     // 037A        JSR NAK
+	asm(0x4C, 0x5F, 0x03)     // 037D        JMP RETRY
+	asm(0xA9, 0xAE)           // 0380 BOK    LDA #'.'
+	asm(0x20, 0xED, 0xFD)     // 0382        JSR COUT
+	asm(0x20, 0xA6, 0x03)     // 0385        JSR ACK
+	asm(0xA5, 0xEC)           // 0388        LDA CNT
+	asm(0xF0, 0x08)           // 038A        BEQ FULL
+	asm(0xA9, 0x00)           // 038C        LDA #0       a short block is the last
+	asm(0x85, 0x08)           // 038E        STA LEN
+	asm(0x85, 0x09)           // 0390        STA LEN+1
+	asm(0xF0, 0xB9)           // 0392        BEQ BLOCK
+	asm(0xE6, 0x07)           // 0394 FULL   INC PTR+1
+	asm(0xC6, 0x09)           // 0396        DEC LEN+1
+	asm(0x4C, 0x4D, 0x03)     // 0398        JMP BLOCK
+	asm(0xAD, status)         // 039B GET    LDA STATUS   wait for a byte
+	asm(0x29, 0x08)           // 039E        AND #$08
+	asm(0xF0, 0xF9)           // 03A0        BEQ GET
+	asm(0xAD, data)           // 03A2        LDA DATA
+	asm(0x60)                 // 03A5        RTS
+	asm(0xA9, sendACK)        // 03A6 ACK    LDA #ACK
+	asm(0xD0, 0x02)           // 03A8        BNE PUT
+	asm(0xA9, sendNAK)        // 03AA NAK    LDA #NAK
+	asm(0x48)                 // 03AC PUT    PHA
+	asm(0xAD, status)         // 03AD PWAIT  LDA STATUS   wait to send it
+	asm(0x29, 0x10)           // 03B0        AND #$10
+	asm(0xF0, 0xF9)           // 03B2        BEQ PWAIT
+	asm(0x68)                 // 03B4        PLA
+	asm(0x8D, data)           // 03B5        STA DATA
+	asm(0x60)                 // 03B8        RTS
+	return code, nil
+}
+
+// writeMonitorListing writes code loading at address as lines to type
+// into the monitor, e.g. "300: 8D A9 C0 A9 0B 8D AA C0"
+func writeMonitorListing(w io.Writer, address int, code []byte) {
+	for at := 0; at < len(code); at += 8 {
+		line := code[at:min(at+8, len(code))]
+		fmt.Fprintf(w, "%X: % X\n", address+at, line)
+	}
+}
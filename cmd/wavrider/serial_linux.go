@@ -0,0 +1,55 @@
+//go:build linux
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// serialSpeeds are the speeds a port can be set to
+var serialSpeeds = map[int]uint32{
+	1200:   unix.B1200,
+	2400:   unix.B2400,
+	4800:   unix.B4800,
+	9600:   unix.B9600,
+	19200:  unix.B19200,
+	38400:  unix.B38400,
+	57600:  unix.B57600,
+	115200: unix.B115200,
+}
+
+// openSerial opens a serial port raw at speed, 8 data bits, no parity
+// and 1 stop bit. Reads return nothing after a tenth of timeout, up to
+// the most a port can wait, rather than block.
+func openSerial(path string, speed int, timeout time.Duration) (*os.File, error) {
+	baud, ok := serialSpeeds[speed]
+	if !ok {
+		return nil, fmt.Errorf("unsupported speed %d", speed)
+	}
+	f, err := os.OpenFile(path, os.O_RDWR|unix.O_NOCTTY, 0)
+	if err != nil {
+		return nil, err
+	}
+	t, err := unix.IoctlGetTermios(int(f.Fd()), unix.TCGETS)
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("%s is not a serial port: %w", path, err)
+	}
+	t.Iflag &^= unix.IGNBRK | unix.BRKINT | unix.PARMRK | unix.ISTRIP | unix.INLCR | unix.IGNCR | unix.ICRNL | unix.IXON | unix.IXOFF
+	t.Oflag &^= unix.OPOST
+	t.Lflag &^= unix.ECHO | unix.ECHONL | unix.ICANON | unix.ISIG | unix.IEXTEN
+	t.Cflag &^= unix.CSIZE | unix.PARENB | unix.CSTOPB | unix.CRTSCTS | unix.CBAUD
+	t.Cflag |= unix.CS8 | unix.CREAD | unix.CLOCAL | baud
+	t.Ispeed, t.Ospeed = baud, baud
+	t.Cc[unix.VMIN] = 0
+	t.Cc[unix.VTIME] = uint8(min(255, max(1, timeout/time.Second)))
+	if err := unix.IoctlSetTermios(int(f.Fd()), unix.TCSETS, t); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("setting up %s: %w", path, err)
+	}
+	return f, nil
+}
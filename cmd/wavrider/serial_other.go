@@ -0,0 +1,14 @@
+//go:build !linux
+
+package main
+
+import (
+	"errors"
+	"os"
+	"time"
+)
+
+// openSerial cannot set up serial ports here
+func openSerial(path string, speed int, timeout time.Duration) (*os.File, error) {
+	return nil, errors.New("sending over a serial port is only supported on Linux")
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net"
+	"wavrider/internal/rpc"
+	"wavrider/internal/rpc/wavriderpb"
+
+	"google.golang.org/grpc"
+)
+
+// runServe serves the streaming decoder over gRPC until the listener
+// fails, decoding every call with the options the flags give
+func runServe(args []string) int {
+	fs := flag.NewFlagSet("serve", flag.ContinueOnError)
+	listen := fs.String("listen", ":50051", "address to listen on")
+	decodeOptions := decodeFlags(fs)
+	applyProfile := profileFlags(fs)
+	if code, ok := parseFlags(fs, args); !ok {
+		return code
+	}
+	if err := applyProfile(); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return exitError
+	}
+	opts, err := decodeOptions()
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return exitError
+	}
+
+	lis, err := net.Listen("tcp", *listen)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return exitError
+	}
+
+	s := grpc.NewServer()
+	wavriderpb.RegisterDecoderServer(s, &rpc.Server{Options: opts})
+	fmt.Printf("Serving gRPC decoder for %s tapes on %s\n", opts.System.Name, lis.Addr())
+	if err := s.Serve(lis); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return exitError
+	}
+	return exitOK
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"time"
+	"wavrider/internal/decoder"
+)
+
+// decodeStats sums up what a run decoded and how fast, for the summary
+// that ends it and the provenance sidecar
+type decodeStats struct {
+	Programs    int     `json:"programs"`
+	Bytes       int     `json:"bytes"`
+	ChecksumsOK int     `json:"checksums_ok"`
+	PassRate    float64 `json:"checksum_pass_rate"` // fraction of programs whose checksums were good, 1 with none
+	BitErrors   int     `json:"bit_errors"`
+	Retried     int     `json:"retried"` // programs read only with other options
+	Audio       float64 `json:"audio_seconds"`
+
+	// Left out of deterministic sidecars, as they differ from run to run
+	Elapsed  float64 `json:"elapsed_seconds,omitempty"`
+	Realtime float64 `json:"realtime,omitempty"` // seconds of audio decoded a second
+}
+
+// add counts a capture's catalog and the bytes decoded from it
+func (s *decodeStats) add(c *decoder.Catalog, bytes int) {
+	s.Bytes += bytes
+	if c == nil {
+		return
+	}
+	s.Audio += c.Duration
+	for _, r := range c.Regions {
+		if r.Kind != decoder.RegionData {
+			continue
+		}
+		s.Programs++
+		if r.ChecksumOK {
+			s.ChecksumsOK++
+		}
+		if r.Retry != "" {
+			s.Retried++
+		}
+		s.BitErrors += r.BitErrors
+	}
+}
+
+// finish sets the rates, the run having taken elapsed
+func (s *decodeStats) finish(elapsed time.Duration) {
+	s.PassRate = 1
+	if s.Programs > 0 {
+		s.PassRate = float64(s.ChecksumsOK) / float64(s.Programs)
+	}
+	s.Elapsed = elapsed.Seconds()
+	if s.Elapsed > 0 {
+		s.Realtime = s.Audio / s.Elapsed
+	}
+}
+
+// printSummary writes the statistics on one line, e.g. "Summary: 3
+// programs, 1,327 bytes, 2 of 3 checksums good (67%), 12 bit errors, 1
+// retried; 00:42.300 of audio in 1.21s, 35.0x realtime"
+func printSummary(w io.Writer, s decodeStats) {
+	fmt.Fprintf(w, "Summary: %s, %s, %d of %d checksums good (%s), %s bit errors, %d retried; %s of audio in %s, %s realtime\n",
+		programCount(s.Programs), byteCount(s.Bytes), s.ChecksumsOK, s.Programs, percent(s.PassRate, 0), thousands(s.BitErrors), s.Retried, clockMillis(s.Audio), seconds(s.Elapsed, 2), times(s.Realtime, 1))
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"wavrider/internal/decoder"
+)
+
+// Exit codes. Scripts can rely on these to branch on the decode outcome.
+const (
+	exitOK          = 0 // every program decoded with a good checksum
+	exitError       = 1 // usage, I/O or other failure
+	exitPartial     = 2 // data decoded but at least one checksum failed
+	exitNoData      = 3 // the input was readable but held no programs
+	exitBadInput    = 4 // the input is not a WAV file wavrider can read
+	exitDiffer      = 5 // the outputs compared are not the same
+	exitInterrupted = 6 // stopped early; what was decoded until then was written
+)
+
+var statusNames = map[int]string{
+	exitOK:          "ok",
+	exitError:       "error",
+	exitPartial:     "partial",
+	exitNoData:      "no-data",
+	exitBadInput:    "bad-input",
+	exitDiffer:      "differ",
+	exitInterrupted: "interrupted",
+}
+
+// severity orders exit codes so batch runs can report the worst outcome
+var severity = map[int]int{
+	exitOK:          0,
+	exitPartial:     1,
+	exitDiffer:      1,
+	exitNoData:      2,
+	exitInterrupted: 2,
+	exitBadInput:    3,
+	exitError:       4,
+}
+
+func worse(a, b int) int {
+	if severity[b] > severity[a] {
+		return b
+	}
+	return a
+}
+
+// decodeOutcome classifies a finished decode
+func decodeOutcome(c *decoder.Catalog, err error) int {
+	var formatErr *decoder.FormatError
+	switch {
+	case errors.As(err, &formatErr):
+		return exitBadInput
+	case err != nil:
+		return exitError
+	case c.Interrupted:
+		return exitInterrupted
+	case c.Programs == 0:
+		return exitNoData
+	}
+	for _, r := range c.Regions {
+		if r.Kind == decoder.RegionData && !r.ChecksumOK {
+			return exitPartial
+		}
+	}
+	return exitOK
+}
+
+// runStatus summarizes a run for the final status line
+type runStatus struct {
+	code  int
+	files int
+	decodeStats
+}
+
+func (s *runStatus) add(c *decoder.Catalog, bytes int) {
+	s.files++
+	s.decodeStats.add(c, bytes)
+}
+
+// writeStatusLine prints the single machine-readable line that ends every
+// run, e.g. "wavrider: status=partial exit=2 files=1 programs=3 bytes=1327 bad_checksums=1".
+// The commands that decode captures count what they decoded; main writes
+// it for the rest, with the outcome alone.
+func writeStatusLine(w io.Writer, s runStatus) {
+	statusWritten = true
+	fmt.Fprintf(w, "wavrider: status=%s exit=%d files=%d programs=%d bytes=%d bad_checksums=%d\n",
+		statusNames[s.code], s.code, s.files, s.Programs, s.Bytes, s.Programs-s.ChecksumsOK)
+}
+
+// statusWritten is set once the status line is written, so that main
+// knows whether the command wrote one
+var statusWritten bool
+
+// parseFlags parses a command's arguments, returning false and the code to
+// exit with if they do not parse: exitOK after -h, exitError for a bad
+// flag. The flag set has printed why.
+func parseFlags(fs *flag.FlagSet, args []string) (int, bool) {
+	err := fs.Parse(args)
+	switch {
+	case err == nil:
+		return exitOK, true
+	case errors.Is(err, flag.ErrHelp):
+		return exitOK, false
+	}
+	return exitError, false
+}
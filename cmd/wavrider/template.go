@@ -0,0 +1,95 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"wavrider/internal/decoder"
+)
+
+// Output name templates. Each variable in braces is replaced by what it
+// stands for; a template using any but {base} writes each file on the
+// tape to a file of its own.
+const (
+	templateBase    = "{base}"    // the input's name without its directory or extension
+	templateSegment = "{segment}" // the file's number on the tape, from 01
+	templateType    = "{type}"    // what the file holds, e.g. basic or machine-code
+	templateAddr    = "{addr}"    // where it loads, in four hex digits, or none
+	templateTime    = "{time}"    // where on the tape it starts, e.g. 01m23s
+	templateExt     = "{ext}"     // the extension of the output format, e.g. .cas for MSX tapes
+	templateName    = "{name}"    // the name -names gives the file, or its number if none
+
+	exampleTemplate = "{base}-{segment}-{type}{ext}"
+)
+
+// templateVars are the variables an output name template can use
+var templateVars = []string{templateBase, templateSegment, templateType, templateAddr, templateTime, templateExt, templateName}
+
+// templateVar matches what a template holds in braces
+var templateVar = regexp.MustCompile(`\{[^{}]*\}`)
+
+// checkTemplate returns an error if template uses a variable in braces
+// that is not one of templateVars, which would be left in the names as
+// it is
+func checkTemplate(template string) error {
+	for _, v := range templateVar.FindAllString(template, -1) {
+		if !slices.Contains(templateVars, v) {
+			return fmt.Errorf("no variable %s; the variables are %s", v, strings.Join(templateVars, ", "))
+		}
+	}
+	return nil
+}
+
+// perFile reports whether template names each file on the tape apart
+func perFile(template string) bool {
+	for _, v := range []string{templateSegment, templateType, templateAddr, templateTime, templateName} {
+		if strings.Contains(template, v) {
+			return true
+		}
+	}
+	return false
+}
+
+// fileVars returns the template's variables for the nth file on a tape,
+// made of records, decoded from an input named base, and named name if
+// it was given one
+func fileVars(base string, n int, name string, records []decoder.Record) map[string]string {
+	// The file is described by its data, after any header
+	data := records[0]
+	for _, r := range records {
+		if r.Type != decoder.RecordHeader && r.Type != decoder.RecordVariables {
+			data = r
+			break
+		}
+	}
+	kind := strings.ReplaceAll(data.Type, " ", "-")
+	if kind == "" {
+		kind = "unknown"
+	}
+	addr := "none"
+	if data.LoadAddress >= 0 {
+		addr = fmt.Sprintf("%04X", data.LoadAddress)
+	}
+	start := int(records[0].Start)
+	if name == "" {
+		name = fmt.Sprintf("%02d", n)
+	}
+	return map[string]string{
+		templateName:    fileName(name),
+		templateBase:    base,
+		templateSegment: fmt.Sprintf("%02d", n),
+		templateType:    kind,
+		templateAddr:    addr,
+		templateTime:    fmt.Sprintf("%02dm%02ds", start/60, start%60),
+	}
+}
+
+// expand replaces the variables in template with their values
+func expand(template string, vars map[string]string) string {
+	var pairs []string
+	for v, value := range vars {
+		pairs = append(pairs, v, value)
+	}
+	return strings.NewReplacer(pairs...).Replace(template)
+}
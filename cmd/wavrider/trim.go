@@ -0,0 +1,93 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"runtime"
+	"wavrider/internal/decoder"
+)
+
+// runTrim reports the gaps between the records on a tape and, given an
+// output, writes the capture again with each gap made the same length
+func runTrim(args []string) int {
+	fs := flag.NewFlagSet("trim", flag.ContinueOnError)
+	jobs := fs.Int("jobs", runtime.GOMAXPROCS(0), "number of segments of a long capture to decode concurrently")
+	gap := fs.Float64("gap", decoder.TrimGap, "seconds of silence to put between records")
+	lead := fs.Float64("lead", decoder.TrimLead, "seconds of silence to put before the first record and after the last")
+	decodeOptions := decodeFlags(fs)
+	applyProfile := profileFlags(fs)
+	if code, ok := parseFlags(fs, args); !ok {
+		return code
+	}
+	if err := applyProfile(); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return exitError
+	}
+	if fs.NArg() < 1 || fs.NArg() > 2 {
+		usage()
+		return exitError
+	}
+	opts, err := decodeOptions()
+	if err == nil && opts.Reverse {
+		err = errors.New("-reverse cannot be used to trim, as the gaps would be found in the reversed audio")
+	}
+	if err == nil && (*gap < 0 || *lead < 0) {
+		err = errors.New("-gap and -lead cannot be negative")
+	}
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return exitError
+	}
+	opts.Workers = *jobs
+	input := fs.Arg(0)
+
+	fmt.Printf("Processing %s...\n", input)
+	_, catalog, err := decoder.DecodeFileRecords(input, opts)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return decodeOutcome(nil, err)
+	}
+	rate := float64(catalog.SampleRate)
+	total := 0.0
+	for _, g := range catalog.Gaps() {
+		where := fmt.Sprintf("between programs %d and %d", g.Before, g.After)
+		switch {
+		case g.Before == 0 && g.After == 0:
+			where = "with no programs"
+		case g.Before == 0:
+			where = fmt.Sprintf("before program %d", g.After)
+		case g.After == 0:
+			where = fmt.Sprintf("after program %d", g.Before)
+		}
+		fmt.Printf("  %s–%s %7s %s, samples %s–%s\n", clockMillis(g.Start), clockMillis(g.End), seconds(g.End-g.Start, 3), where, thousands(int(g.Start*rate)), thousands(int(g.End*rate)))
+		total += g.End - g.Start
+	}
+	fmt.Printf("%s of %s is gaps between %d programs\n", seconds(total, 3), seconds(catalog.Duration, 3), catalog.Programs)
+	if fs.NArg() < 2 {
+		return decodeOutcome(catalog, nil)
+	}
+
+	output := fs.Arg(1)
+	f, err := decoder.Open(input)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return exitError
+	}
+	defer f.Close()
+	samples, sampleRate, err := decoder.TrimGaps(f, catalog, *gap, *lead)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return exitError
+	}
+	err = writeFileWith(output, func(w io.Writer) error {
+		return decoder.WriteWAV(w, samples, sampleRate)
+	})
+	if err != nil {
+		fmt.Printf("Error writing trimmed audio: %v\n", err)
+		return exitError
+	}
+	fmt.Printf("Wrote %s of audio, with %s gaps, to %s\n", seconds(float64(len(samples))/float64(sampleRate), 3), seconds(*gap, -1), output)
+	return decodeOutcome(catalog, nil)
+}
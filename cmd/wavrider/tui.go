@@ -0,0 +1,217 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+	"wavrider/internal/decoder"
+)
+
+// runTUI decodes a file, or a live stream on stdin, while drawing a
+// scrolling waveform and the decoder's state in the terminal
+func runTUI(args []string) int {
+	fs := flag.NewFlagSet("tui", flag.ContinueOnError)
+	outfile := fs.String("o", "", "file to write the decoded bytes to (default output and the system's extension, e.g. output.bin)")
+	decodeOptions := decodeFlags(fs)
+	applyProfile := profileFlags(fs)
+	if code, ok := parseFlags(fs, args); !ok {
+		return code
+	}
+	if err := applyProfile(); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return exitError
+	}
+	if fs.NArg() != 1 {
+		usage()
+		return exitError
+	}
+
+	name := fs.Arg(0)
+	in, err := decoder.Open(name)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return exitError
+	}
+	defer in.Close()
+
+	t := newTUI(os.Stdout, name)
+	opts, err := decodeOptions()
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return exitError
+	}
+	if *outfile == "" {
+		*outfile = "output" + opts.System.Ext()
+	}
+	// Each record is written out as it completes, so a live capture
+	// loses nothing already decoded if it is interrupted
+	out, err := os.Create(*outfile)
+	if err != nil {
+		fmt.Printf("Error writing output: %v\n", err)
+		return exitError
+	}
+	defer out.Close()
+	opts.Progress = t.progress
+	opts.Output = out
+	// An interrupt stops the decode where it has got to, keeping what was
+	// written until then
+	ctx, stop := interruptContext()
+	defer stop()
+	opts.Context = ctx
+	fmt.Print("\x1b[?25l") // hide the cursor while drawing
+	defer fmt.Print("\x1b[?25h")
+	status := runStatus{files: 1}
+	err = decoder.DecodeStream(in, opts, func(e decoder.Event) {
+		if e.Kind == decoder.EventRecordEnd {
+			status.Programs++
+			if e.ChecksumOK {
+				status.ChecksumsOK++
+			}
+		}
+	})
+	t.draw()
+	defer func() { writeStatusLine(os.Stderr, status) }()
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		status.code = decodeOutcome(nil, err)
+		return status.code
+	}
+	info, err := out.Stat()
+	if err == nil {
+		err = out.Close()
+	}
+	if err != nil {
+		fmt.Printf("Error writing output: %v\n", err)
+		status.code = exitError
+		return status.code
+	}
+	status.Bytes = int(info.Size())
+	switch {
+	case ctx.Err() != nil:
+		fmt.Printf("Interrupted; decoded %s until then. Written to %s\n", byteCount(status.Bytes), *outfile)
+		status.code = exitInterrupted
+		return status.code
+	case status.Programs == 0:
+		status.code = exitNoData
+	case status.ChecksumsOK < status.Programs:
+		status.code = exitPartial
+	}
+	fmt.Printf("Decoded %s. Written to %s\n", byteCount(status.Bytes), *outfile)
+	return status.code
+}
+
+// Waveform display parameters
+const (
+	tuiColumn  = 0.010 // seconds of audio per waveform column
+	tuiRows    = 13    // waveform height, odd so there is a center line
+	tuiRefresh = 50 * time.Millisecond
+)
+
+// envelope is the sample range covered by one waveform column
+type envelope struct {
+	lo, hi float64
+	err    bool // a bit error was seen while this column was filling
+}
+
+type tui struct {
+	out   io.Writer
+	title string
+	width int
+
+	cols  []envelope // newest last, at most width
+	acc   envelope
+	accN  int
+	last  decoder.Progress
+	drawn time.Time
+}
+
+func newTUI(out io.Writer, title string) *tui {
+	width := 80
+	if n, err := strconv.Atoi(os.Getenv("COLUMNS")); err == nil && n > 20 {
+		width = n
+	}
+	return &tui{out: out, title: title, width: width - 2}
+}
+
+func (t *tui) progress(p decoder.Progress) {
+	perColumn := max(1, int(tuiColumn*float64(p.SampleRate)))
+	newErrors := p.Errors > t.last.Errors
+
+	for _, s := range p.Window {
+		if t.accN == 0 {
+			t.acc = envelope{lo: s, hi: s}
+		}
+		t.acc.lo = min(t.acc.lo, s)
+		t.acc.hi = max(t.acc.hi, s)
+		t.accN++
+		if t.accN == perColumn {
+			t.push(t.acc)
+			t.accN = 0
+		}
+	}
+	if newErrors && len(t.cols) > 0 {
+		t.cols[len(t.cols)-1].err = true
+	}
+
+	p.Window = nil
+	t.last = p
+	if time.Since(t.drawn) >= tuiRefresh {
+		t.draw()
+	}
+}
+
+func (t *tui) push(e envelope) {
+	if len(t.cols) == t.width {
+		copy(t.cols, t.cols[1:])
+		t.cols = t.cols[:len(t.cols)-1]
+	}
+	t.cols = append(t.cols, e)
+}
+
+func (t *tui) draw() {
+	t.drawn = time.Now()
+	p := t.last
+
+	var b strings.Builder
+	b.WriteString("\x1b[H\x1b[2J")
+	fmt.Fprintf(&b, "wavrider — %s\n", t.title)
+	fmt.Fprintf(&b, "Time %s  State %-6s  Header run %-5d  Programs %d  Bytes %s  Errors %d  Dropouts %d\n\n",
+		clock(p.Time), p.State, p.Header, p.Programs, thousands(p.Bytes), p.Errors, p.Dropouts)
+
+	b.WriteString("┌" + strings.Repeat("─", t.width) + "┐\n")
+	for row := range tuiRows {
+		// Amplitude band covered by this row, top row is +1
+		top := 1 - 2*float64(row)/tuiRows
+		bottom := 1 - 2*float64(row+1)/tuiRows
+		b.WriteString("│")
+		for i := range t.width {
+			switch {
+			case i >= len(t.cols):
+				b.WriteByte(' ')
+			case t.cols[i].hi >= bottom && t.cols[i].lo <= top:
+				b.WriteString("█")
+			case row == tuiRows/2:
+				b.WriteString("·")
+			default:
+				b.WriteByte(' ')
+			}
+		}
+		b.WriteString("│\n")
+	}
+	b.WriteString("└" + strings.Repeat("─", t.width) + "┘\n")
+
+	b.WriteString(" ")
+	for _, c := range t.cols {
+		if c.err {
+			b.WriteByte('!')
+		} else {
+			b.WriteByte(' ')
+		}
+	}
+	b.WriteString("\n ! = bit error\n")
+	io.WriteString(t.out, b.String())
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Times, sizes and proportions are formatted here, for the text, JSON
+// and HTML that wavrider writes alike, so that they read the same
+// wherever they appear. The formats do not follow the locale: digits are
+// ASCII, the decimal point is a point and thousands are grouped with
+// commas, so output read by a script, diffed, or sent from one archive to
+// another reads the same everywhere.
+
+// clock formats seconds as mm:ss
+func clock(seconds float64) string {
+	s := int(seconds)
+	return fmt.Sprintf("%02d:%02d", s/60, s%60)
+}
+
+// clockMillis formats seconds as mm:ss.mmm
+func clockMillis(seconds float64) string {
+	ms := int(seconds * 1000)
+	return fmt.Sprintf("%02d:%02d.%03d", ms/60000, ms/1000%60, ms%1000)
+}
+
+// timestamp formats t in UTC as RFC 3339, or gives "" for the zero time
+func timestamp(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
+}
+
+// thousands formats n with comma separators. The sign is taken off the
+// digits rather than n negated, which math.MinInt cannot be.
+func thousands(n int) string {
+	s, sign := strconv.Itoa(n), ""
+	if n < 0 {
+		s, sign = s[1:], "-"
+	}
+	for i := len(s) - 3; i > 0; i -= 3 {
+		s = s[:i] + "," + s[i:]
+	}
+	return sign + s
+}
+
+// byteCount gives n bytes exactly, e.g. "1,024 bytes" or "1 byte", as a
+// program's size is always given
+func byteCount(n int) string {
+	if n == 1 {
+		return "1 byte"
+	}
+	return thousands(n) + " bytes"
+}
+
+// programCount gives n programs, e.g. "3 programs" or "1 program"
+func programCount(n int) string {
+	if n == 1 {
+		return "1 program"
+	}
+	return thousands(n) + " programs"
+}
+
+// size gives n bytes for a reader, exactly up to sizeExact and in binary
+// units after, e.g. "3.4 MiB", as a capture's or a run's total is given
+func size(n int64) string {
+	if n < sizeExact {
+		return byteCount(int(n))
+	}
+	value, unit := float64(n)/1024, "KiB"
+	for _, u := range []string{"MiB", "GiB", "TiB"} {
+		if value < 1024 {
+			break
+		}
+		value, unit = value/1024, u
+	}
+	return fixed(value, 1) + " " + unit
+}
+
+// rate gives how fast size bytes went in elapsed, in the units size
+// gives, e.g. "12.3 MiB/s", or "n/a" if no time elapsed
+func rate(n int, elapsed time.Duration) string {
+	if elapsed <= 0 {
+		return "n/a"
+	}
+	return size(int64(float64(n)/elapsed.Seconds())) + "/s"
+}
+
+// sizeExact is the size from which size gives units rather than bytes
+const sizeExact = 100 * 1024
+
+// fixed formats v with places decimals, or as few as it needs if places
+// is -1. What rounds to zero is given as zero, never "-0.0".
+func fixed(v float64, places int) string {
+	if places >= 0 {
+		scale := math.Pow(10, float64(places))
+		v = math.Round(v*scale) / scale
+	}
+	if v == 0 {
+		v = 0 // not -0
+	}
+	return strconv.FormatFloat(v, 'f', places, 64)
+}
+
+// signed formats v as fixed does, with its sign even when positive
+func signed(v float64, places int) string {
+	s := fixed(v, places)
+	if !strings.HasPrefix(s, "-") {
+		s = "+" + s
+	}
+	return s
+}
+
+// seconds formats a duration in seconds with places decimals, e.g.
+// "1.250s"
+func seconds(s float64, places int) string {
+	return fixed(s, places) + "s"
+}
+
+// milliseconds formats a duration in seconds as whole milliseconds, e.g.
+// "12 ms"
+func milliseconds(s float64) string {
+	return fixed(s*1000, 0) + " ms"
+}
+
+// times formats a multiple with places decimals, e.g. "35.0x"
+func times(x float64, places int) string {
+	return fixed(x, places) + "x"
+}
+
+// percent formats a fraction as a percentage with places decimals, e.g.
+// "12.5%"
+func percent(fraction float64, places int) string {
+	return fixed(100*fraction, places) + "%"
+}
+
+// decibels formats a level in dB with one decimal, e.g. "32.5 dB"
+func decibels(db float64) string {
+	return fixed(db, 1) + " dB"
+}
+
+// change formats how far ratio is from 1 as a signed percentage with one
+// decimal, e.g. "+1.5%" for a tape playing 1.5% fast, and "+0.0%" for
+// one within a twentieth of a percent of right
+func change(ratio float64) string {
+	return signed(100*(ratio-1), 1) + "%"
+}
@@ -0,0 +1,218 @@
+package main
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+	"wavrider/internal/decoder"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// runWatch decodes every WAV file that appears in a directory. Files are
+// only picked up once they have stopped growing, so captures still being
+// recorded are left alone. An interrupt stops the captures under way
+// where they have got to, writing what they read, and leaves them to be
+// decoded again.
+func runWatch(args []string) int {
+	fs := flag.NewFlagSet("watch", flag.ContinueOnError)
+	outDir := fs.String("out-dir", "", "directory for decoded files (default <dir>/decoded)")
+	doneDir := fs.String("done-dir", "", "directory captures are moved to after decoding (default <dir>/processed)")
+	failedDir := fs.String("failed-dir", "", "directory captures are moved to when decoding fails (default <dir>/failed)")
+	settle := fs.Duration("settle", 2*time.Second, "how long a file must stay unchanged before it is decoded")
+	jobs := fs.Int("jobs", 1, "number of captures to decode concurrently")
+	timeout := fs.Duration("timeout", 0, "give up on a capture that takes longer than this to decode, 0 for no limit")
+	decodeOptions := decodeFlags(fs)
+	applyProfile := profileFlags(fs)
+	if code, ok := parseFlags(fs, args); !ok {
+		return code
+	}
+	if err := applyProfile(); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return exitError
+	}
+	if fs.NArg() != 1 {
+		usage()
+		return exitError
+	}
+
+	dir := fs.Arg(0)
+	w := watchDirs{
+		out:    orDefault(*outDir, filepath.Join(dir, "decoded")),
+		done:   orDefault(*doneDir, filepath.Join(dir, "processed")),
+		failed: orDefault(*failedDir, filepath.Join(dir, "failed")),
+	}
+	for _, d := range []string{w.out, w.done, w.failed} {
+		if err := os.MkdirAll(d, 0755); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			return exitError
+		}
+	}
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return exitError
+	}
+	defer watcher.Close()
+	if err := watcher.Add(dir); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return exitError
+	}
+
+	// pending maps each WAV to the last time it changed
+	pending := map[string]time.Time{}
+	existing, _ := filepath.Glob(filepath.Join(dir, "*"))
+	for _, path := range existing {
+		if isWAV(path) {
+			pending[path] = time.Now()
+		}
+	}
+
+	opts, err := decodeOptions()
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return exitError
+	}
+	ctx, stop := interruptContext()
+	defer stop()
+	// Captures are decoded by at most jobs goroutines at a time, each
+	// printing its report whole once done
+	busy := make(chan struct{}, max(1, *jobs))
+	var wg sync.WaitGroup
+	var printing sync.Mutex // and counting
+	status := runStatus{code: exitOK}
+
+	fmt.Printf("Watching %s for WAV files...\n", dir)
+	ticker := time.NewTicker(max(*settle/4, 100*time.Millisecond))
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			fmt.Println("Interrupted; finishing the captures under way")
+			wg.Wait()
+			// A watch only ends when it is stopped
+			status.code = worse(status.code, exitInterrupted)
+			writeStatusLine(os.Stderr, status)
+			return status.code
+		case ev, ok := <-watcher.Events:
+			if !ok {
+				return exitError
+			}
+			if isWAV(ev.Name) && ev.Has(fsnotify.Create|fsnotify.Write) {
+				pending[ev.Name] = time.Now()
+			}
+			if ev.Has(fsnotify.Remove | fsnotify.Rename) {
+				delete(pending, ev.Name)
+			}
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return exitError
+			}
+			fmt.Printf("Watch error: %v\n", err)
+		case <-ticker.C:
+			var ready []string
+			for path, changed := range pending {
+				if time.Since(changed) >= *settle {
+					ready = append(ready, path)
+				}
+			}
+			slices.Sort(ready)
+			for _, path := range ready {
+				select {
+				case busy <- struct{}{}:
+				default:
+					// The rest wait for the next tick
+					continue
+				}
+				delete(pending, path)
+				wg.Go(func() {
+					defer func() { <-busy }()
+					var report bytes.Buffer
+					catalog, decoded, err := w.process(ctx, *timeout, &report, path, opts)
+					printing.Lock()
+					defer printing.Unlock()
+					os.Stdout.Write(report.Bytes())
+					status.add(catalog, decoded)
+					status.code = worse(status.code, decodeOutcome(catalog, err))
+				})
+			}
+		}
+	}
+}
+
+// watchDirs are where the watcher files its results
+type watchDirs struct {
+	out, done, failed string
+}
+
+// process decodes one capture, writes the decoded bytes and a catalog
+// label file to the output directory and moves the capture out of the
+// watched directory, reporting to out, and returns its catalog, the bytes
+// decoded and why it failed. A capture whose decode is interrupted
+// through ctx stays where it is; one that takes longer than timeout, if
+// above 0, fails.
+func (w watchDirs) process(ctx context.Context, timeout time.Duration, out io.Writer, path string, opts decoder.Options) (*decoder.Catalog, int, error) {
+	fmt.Fprintf(out, "Processing %s...\n", path)
+	base := inputBase(path)
+	outfile := filepath.Join(w.out, base+opts.System.Ext())
+
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	opts.Context = ctx
+	data, catalog, err := decoder.DecodeWithCatalog(path, opts)
+	if err == nil && catalog.Interrupted && ctx.Err() == context.DeadlineExceeded {
+		err = fmt.Errorf("timed out after %s, at %s of %s", timeout, clock(catalog.StoppedAt), clock(catalog.Duration))
+	}
+	if err == nil {
+		err = os.WriteFile(outfile, data, 0644)
+	}
+	if err == nil {
+		err = writeFileWith(filepath.Join(w.out, base+".txt"), func(f io.Writer) error {
+			printCatalog(f, catalog)
+			return nil
+		})
+	}
+
+	dest := w.done
+	switch {
+	case err != nil:
+		fmt.Fprintf(out, "Error: %v\n", err)
+		dest = w.failed
+	case catalog.Interrupted:
+		fmt.Fprintf(out, "Interrupted at %s of %s; decoded %s (%s) to %s, and left the capture to decode again\n", clock(catalog.StoppedAt), clock(catalog.Duration), byteCount(len(data)), programCount(catalog.Programs), outfile)
+		return catalog, len(data), nil
+	default:
+		fmt.Fprintf(out, "Decoded %s (%s) to %s\n", byteCount(len(data)), programCount(catalog.Programs), outfile)
+	}
+	if moveErr := os.Rename(path, filepath.Join(dest, filepath.Base(path))); moveErr != nil {
+		fmt.Fprintf(out, "Error moving %s: %v\n", path, moveErr)
+		err = cmp.Or(err, moveErr)
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+	return catalog, len(data), nil
+}
+
+func isWAV(path string) bool {
+	return decoder.IsCapture(path)
+}
+
+func orDefault(s, def string) string {
+	if s != "" {
+		return s
+	}
+	return def
+}
@@ -0,0 +1,106 @@
+package decoder
+
+import "fmt"
+
+// The Apple-1 Cassette Interface writes bits the way the Apple ][ monitor
+// later did, 0 bits as 2kHz cycles and 1 bits as 1kHz cycles MSB first,
+// but its header tone is a run of 1 bits and its records carry neither a
+// checksum nor the addresses they were saved from. Memory is read back
+// with the monitor's START.ENDR ranges; Integer BASIC programs are saved
+// as two of them, the zero page variables 004A.00FF then the program from
+// 0800.
+const (
+	ACIBasicZeroPage = 0x004A // start of the zero page range a BASIC program saves
+	ACIBasicProgram  = 0x0800 // start of the BASIC program range
+
+	// ACINoise is the fraction of a 2kHz half-cycle below which a
+	// half-cycle is taken for hiss. The 1kHz header tone reads as data,
+	// so only the hiss of the gap before it can end a record.
+	ACINoise = 0.5
+)
+
+// aciTiming is AppleII with a 1kHz header tone and a sync bit that may be
+// a whole 2kHz cycle
+var aciTiming = Timing{
+	Short:      AppleII.Short,
+	Long:       AppleII.Long,
+	MinHeader:  AppleII.MinHeader,
+	HeaderTone: 0.000500, // 1kHz
+	Sync: []float64{
+		0.000250, // 2kHz
+		0.000250,
+	},
+	SyncTolerance: 0.5,
+	Nominal: [numPulses]float64{
+		pulseShort: 0.000250, // 2kHz
+		pulseLong:  0.000500, // 1kHz, the header tone as well
+	},
+	Cells: AppleII.Cells,
+}
+
+var aciSystem = System{
+	Name:      "aci",
+	Timing:    &aciTiming,
+	Demods:    []Demod{DemodZeroCrossing, DemodPeak},
+	newFramer: func() framer { return aciFramer{} },
+	check:     cleanlyFramed,
+	payload:   func(data []byte) int { return len(data) },
+	pack:      concatBlocks,
+	describe:  aciRanges,
+	identify:  identifyACI,
+	binaries:  true,
+	encode:    encodeMonitor(0),
+}
+
+// aciFramer reads Apple ][ bit cells, ending the record at hiss rather
+// than at a header tone
+type aciFramer struct{}
+
+func (aciFramer) halfCycle(d *bitDecoder, p pulse) {
+	if d.length < ACINoise*aciTiming.Nominal[pulseShort] {
+		p = pulseHeader
+	}
+	d.step(p)
+}
+
+// aciRanges gives the monitor range each record reads back with. A record
+// the length of BASIC's zero page range starts a BASIC program, whose
+// next record loads at 0800; other records' addresses are not known, so
+// only their length is given.
+func aciRanges(records []record) []string {
+	lines := make([]string, len(records))
+	basic := false
+	for i, r := range records {
+		n := len(r.data)
+		switch {
+		case n == 0x100-ACIBasicZeroPage:
+			lines[i] = fmt.Sprintf("BASIC variables, read back with %04X.%04XR", ACIBasicZeroPage, 0xFF)
+			basic = true
+			continue
+		case basic:
+			lines[i] = fmt.Sprintf("BASIC program, read back with %04X.%04XR", ACIBasicProgram, ACIBasicProgram+n-1)
+		default:
+			lines[i] = fmt.Sprintf("read back with START.ENDR where END is START+%04X", n-1)
+		}
+		basic = false
+	}
+	return lines
+}
+
+// identifyACI finds the two records of a BASIC program as aciRanges
+// does
+func identifyACI(records []Record) {
+	basic := false
+	for i := range records {
+		r := &records[i]
+		switch {
+		case len(r.Data) == 0x100-ACIBasicZeroPage:
+			r.Type, r.LoadAddress = RecordVariables, ACIBasicZeroPage
+			basic = true
+			continue
+		case basic:
+			r.Type, r.LoadAddress = RecordBasic, ACIBasicProgram
+		}
+		basic = false
+	}
+}
@@ -0,0 +1,182 @@
+package decoder
+
+import (
+	"cmp"
+	"errors"
+	"math"
+	"slices"
+)
+
+// Two captures of the same tape line up once one is shifted and stretched
+// to fit the other: they start at different moments, and two decks, or
+// one deck on two days, play at slightly different speeds. The header
+// tones on both mark the same places on the tape, so the moments they
+// start and stop are cross-correlated for each speed ratio in turn, the
+// one whose best offset lines the most of them up within AlignMatch of
+// each other winning. The pairs it lines up then fit the offset and ratio
+// exactly, by least squares.
+const (
+	AlignMaxSpeed = 0.1 // fraction the captures' speeds may differ by
+	AlignMatch    = 0.5 // seconds apart the ends of a header tone may be, once aligned, and be taken for the same
+	AlignMinPairs = 2   // moments that must line up
+)
+
+// Alignment is how a capture lines up with another: the moment t seconds
+// into the first is Offset + Ratio*t seconds into the second
+type Alignment struct {
+	Offset float64 // seconds
+	Ratio  float64 // above 1 if the second capture played slower
+	Pairs  []AlignedPair
+	RMS    float64 // seconds; how far the pairs are from the fit
+}
+
+// AlignedPair is a moment a header tone starts or stops, in the first
+// capture and in the second
+type AlignedPair struct {
+	Program int // of the first capture the header tone belongs to
+	Start   bool
+	A, B    float64 // seconds
+}
+
+// At returns where the moment t seconds into the first capture is in the
+// second
+func (a Alignment) At(t float64) float64 {
+	return a.Offset + a.Ratio*t
+}
+
+// Align finds how the capture catalogued in b lines up with that in a
+// from their header tones
+func Align(a, b *Catalog) (Alignment, error) {
+	as, bs := headerEdges(a), headerEdges(b)
+	if len(as) == 0 || len(bs) == 0 {
+		return Alignment{}, errors.New("no header tones to align by")
+	}
+
+	// Each ratio is tried a step apart small enough that the moments it
+	// misplaces stay within AlignMatch over the whole capture
+	span := max(a.Duration, 1)
+	step := AlignMatch / span
+	best, bestOffset, bestRatio := 0, 0.0, 1.0
+	for k := 0; ; k++ {
+		// Out from 1, so that ties go to the ratio nearest it
+		r := 1 + float64((k+1)/2)*step
+		if k%2 == 1 {
+			r = 1 - float64((k+1)/2)*step
+		}
+		if math.Abs(r-1) > AlignMaxSpeed {
+			break
+		}
+		if n, offset := correlate(as, bs, r); n > best {
+			best, bestOffset, bestRatio = n, offset, r
+		}
+	}
+
+	al := Alignment{Offset: bestOffset, Ratio: bestRatio}
+	al.Pairs = pairEdges(as, bs, al)
+	al.fit()
+	// The fit can bring in pairs the search left out, or push some out
+	al.Pairs = pairEdges(as, bs, al)
+	al.fit()
+	if len(al.Pairs) < AlignMinPairs {
+		return Alignment{}, errors.New("the captures' header tones do not line up, as if of different tapes")
+	}
+	return al, nil
+}
+
+// headerEdge is a moment a header tone starts or stops
+type headerEdge struct {
+	at      float64
+	program int
+	start   bool
+}
+
+// headerEdges returns where the header tones catalogued start and stop,
+// in time order
+func headerEdges(c *Catalog) []headerEdge {
+	var edges []headerEdge
+	for _, r := range c.Regions {
+		if r.Kind == RegionHeader {
+			edges = append(edges, headerEdge{r.Start, r.Program, true}, headerEdge{r.End, r.Program, false})
+		}
+	}
+	slices.SortFunc(edges, func(x, y headerEdge) int {
+		return cmp.Compare(x.at, y.at)
+	})
+	return edges
+}
+
+// correlate cross-correlates the moments of as, stretched by ratio, with
+// those of bs, returning the most that any offset lines up within
+// AlignMatch of each other and that offset
+func correlate(as, bs []headerEdge, ratio float64) (int, float64) {
+	var offsets []float64
+	for _, a := range as {
+		for _, b := range bs {
+			if a.start == b.start {
+				offsets = append(offsets, b.at-ratio*a.at)
+			}
+		}
+	}
+	slices.Sort(offsets)
+	best, bestOffset := 0, 0.0
+	j := 0
+	for i := range offsets {
+		for offsets[i]-offsets[j] > AlignMatch {
+			j++
+		}
+		if n := i - j + 1; n > best {
+			best, bestOffset = n, (offsets[i]+offsets[j])/2
+		}
+	}
+	return best, bestOffset
+}
+
+// pairEdges pairs each moment of as with the nearest alike moment of bs
+// within AlignMatch of it once aligned, using each of bs once
+func pairEdges(as, bs []headerEdge, al Alignment) []AlignedPair {
+	var pairs []AlignedPair
+	used := map[int]bool{}
+	for _, a := range as {
+		at := al.At(a.at)
+		nearest := -1
+		for j, b := range bs {
+			if b.start == a.start && math.Abs(b.at-at) <= AlignMatch && (nearest < 0 || math.Abs(b.at-at) < math.Abs(bs[nearest].at-at)) {
+				nearest = j
+			}
+		}
+		if nearest >= 0 && !used[nearest] {
+			used[nearest] = true
+			pairs = append(pairs, AlignedPair{Program: a.program, Start: a.start, A: a.at, B: bs[nearest].at})
+		}
+	}
+	return pairs
+}
+
+// fit sets the offset and ratio that best line up the pairs, and how far
+// they are from it. Pairs too close together to fix a ratio within
+// AlignMaxSpeed fix only the offset.
+func (al *Alignment) fit() {
+	n := float64(len(al.Pairs))
+	if n == 0 {
+		return
+	}
+	var sa, sb, saa, sab float64
+	for _, p := range al.Pairs {
+		sa += p.A
+		sb += p.B
+		saa += p.A * p.A
+		sab += p.A * p.B
+	}
+	if d := n*saa - sa*sa; d > 1e-9 {
+		if r := (n*sab - sa*sb) / d; math.Abs(r-1) <= AlignMaxSpeed {
+			al.Ratio = r
+		}
+	}
+	al.Offset = (sb - al.Ratio*sa) / n
+	var squares float64
+	for _, p := range al.Pairs {
+		e := p.B - al.At(p.A)
+		squares += e * e
+	}
+	al.RMS = math.Sqrt(squares / n)
+}
@@ -0,0 +1,151 @@
+package decoder
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"slices"
+	"strings"
+)
+
+// Captures can be read from inside ZIP and tar archives, named as the
+// archive, "!" and the path of the capture in it. An archive named alone
+// stands for the one capture in it.
+const ArchiveSeparator = "!"
+
+// IsArchive reports whether name is a ZIP or tar archive, by its
+// extension. Tar archives may be compressed.
+func IsArchive(name string) bool {
+	switch strings.ToLower(path.Ext(name)) {
+	case ".zip", ".tar", ".tgz":
+		return true
+	}
+	return strings.EqualFold(path.Ext(TrimCompressed(name)), ".tar")
+}
+
+// SplitArchive splits the name of a capture in an archive into the
+// archive's name and the capture's path in it. ok is false if name is
+// not in an archive.
+func SplitArchive(name string) (archive, member string, ok bool) {
+	archive, member, ok = strings.Cut(name, ArchiveSeparator)
+	if !ok || !IsArchive(archive) {
+		return name, "", false
+	}
+	return archive, member, true
+}
+
+// ArchiveMembers returns the names of the WAV captures in an archive, as
+// Open takes them
+func ArchiveMembers(archive string) ([]string, error) {
+	return archiveMembers(context.Background(), archive)
+}
+
+// archiveMembers is ArchiveMembers, an archive downloading stopping once
+// ctx is done
+func archiveMembers(ctx context.Context, archive string) ([]string, error) {
+	var names []string
+	_, err := walkArchive(ctx, archive, func(member string, _ func() (io.Reader, error)) (bool, error) {
+		if IsCapture(member) {
+			names = append(names, archive+ArchiveSeparator+member)
+		}
+		return false, nil
+	})
+	slices.Sort(names)
+	return names, err
+}
+
+// openArchive opens a capture in an archive, or the only one if member
+// is empty
+func openArchive(ctx context.Context, archive, member string) (io.ReadCloser, error) {
+	if member == "" {
+		names, err := archiveMembers(ctx, archive)
+		if err != nil {
+			return nil, err
+		}
+		if len(names) != 1 {
+			return nil, fmt.Errorf("%s holds %d WAV files; name one as %s%s<path>", archive, len(names), archive, ArchiveSeparator)
+		}
+		_, member, _ = SplitArchive(names[0])
+	}
+	var r io.Reader
+	closer, err := walkArchive(ctx, archive, func(name string, open func() (io.Reader, error)) (bool, error) {
+		if name != path.Clean(member) {
+			return false, nil
+		}
+		var err error
+		r, err = open()
+		return true, err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if closer == nil {
+		return nil, fmt.Errorf("%s has no %s", archive, member)
+	}
+	d, err := Decompress(r)
+	if err != nil {
+		closer.Close()
+		return nil, err
+	}
+	return decompressed{d, closer}, nil
+}
+
+// walkArchive calls visit with the path of each file in an archive and a
+// function opening it, until visit returns true. The archive is then left
+// open for the file visit opened and returned, for the caller to close.
+func walkArchive(ctx context.Context, archive string, visit func(member string, open func() (io.Reader, error)) (bool, error)) (io.Closer, error) {
+	if strings.EqualFold(path.Ext(archive), ".zip") {
+		if IsURL(archive) {
+			return nil, errors.New("ZIP archives are read from files, not URLs")
+		}
+		z, err := zip.OpenReader(archive)
+		if err != nil {
+			return nil, err
+		}
+		for _, f := range z.File {
+			if f.FileInfo().IsDir() {
+				continue
+			}
+			done, err := visit(path.Clean(f.Name), func() (io.Reader, error) { return f.Open() })
+			if err != nil {
+				z.Close()
+				return nil, err
+			}
+			if done {
+				return z, nil
+			}
+		}
+		return nil, z.Close()
+	}
+
+	f, err := openDecompressed(ctx, archive)
+	if err != nil {
+		return nil, err
+	}
+	t := tar.NewReader(f)
+	for {
+		h, err := t.Next()
+		if err == io.EOF {
+			return nil, f.Close()
+		}
+		if err != nil {
+			f.Close()
+			return nil, fmt.Errorf("reading %s: %w", archive, err)
+		}
+		if h.Typeflag != tar.TypeReg {
+			continue
+		}
+		done, err := visit(path.Clean(h.Name), func() (io.Reader, error) { return t, nil })
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+		if done {
+			return f, nil
+		}
+	}
+}
@@ -0,0 +1,294 @@
+package decoder
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+// Amateur packet radio, APRS among it, sends AX.25 frames at 1200 baud
+// in Bell 202 tones. Unlike serial bytes the bits are synchronous: a 0 is
+// a change of tone and a 1 no change, so the bit clock is recovered from
+// the changes. Frames are HDLC, LSB first between 0x7E flags, with a 0
+// stuffed after any five 1s, and end with a CRC of the rest. Each frame
+// is a record, and frames are written out as the monitor lines a TNC
+// prints.
+const (
+	AX25Lock     = 0.5 // fraction of a tone change's timing error the bit clock takes up
+	AX25MinFrame = 17  // bytes in the shortest frame: two addresses, control and CRC
+	ax25Flag     = 0x7E
+)
+
+// Bell202 is the tones and speed of 1200 baud packet radio. The framing
+// settings do not apply to its synchronous bits.
+var Bell202 = Serial{Baud: 1200, Framing: Serial8N1, Mark: 1200, Space: 2200}
+
+var ax25System = System{
+	Name:            "ax25",
+	Demods:          []Demod{DemodZeroCrossing, DemodPeak},
+	newSerialFramer: newAX25Framer,
+	check:           ax25CRCOK,
+	payload:         func(data []byte) int { return max(0, len(data)-2) },
+	pack:            packTNC2,
+	ext:             ".txt",
+	trailer:         2,
+	checksum:        &ax25FCS,
+}.withSerial(Bell202)
+
+// ax25Framer recovers the bit clock from tone changes and reads HDLC
+// frames
+type ax25Framer struct {
+	toneTracker
+
+	// Spans from examined on have yet to be looked at for tone changes
+	examined int
+	tone     bool // tone of the last span examined
+	clocked  bool // the bit clock has been set by a tone change
+	next     float64
+	last     float64 // sample offset of the last bit sampled
+	level    bool    // tone at the last bit sampled
+
+	shift   byte // the last eight bits, for spotting flags
+	ones    int  // 1 bits in a row
+	inFrame bool
+	frame   []byte
+	starts  []int // sample offset each byte of the frame began
+	current byte
+	bits    int
+	flagAt  int // where the first flag before the frame began
+}
+
+func newAX25Framer(s Serial) framer {
+	return &ax25Framer{toneTracker: newToneTracker(s), flagAt: -1}
+}
+
+func (f *ax25Framer) halfCycle(d *bitDecoder, p pulse) {
+	settled, lost, _ := f.add(d, p)
+	f.advance(d, settled)
+	if lost {
+		// Without the carrier there is no bit clock, and no frame
+		f.spans = f.spans[:0]
+		f.examined = 0
+		f.clocked = false
+		f.shift, f.ones = 0, 0
+		f.inFrame = false
+		f.flagAt = -1
+		d.header = 0
+	}
+}
+
+// finish reads what is left at the end of the stream
+func (f *ax25Framer) finish(d *bitDecoder, at int) {
+	if len(f.spans) > 0 {
+		// Bits are clocked for as long as there is audio, not forever
+		f.advance(d, float64(f.spans[len(f.spans)-1].end)+f.reach)
+	}
+}
+
+// advance samples bits and follows tone changes, in time order, as far as
+// the audio up to sample offset settled allows
+func (f *ax25Framer) advance(d *bitDecoder, settled float64) {
+	for {
+		middle := math.Inf(1)
+		if f.examined < len(f.spans) {
+			middle = f.middle(f.examined)
+		}
+		if f.clocked && f.next <= middle {
+			if f.next+f.reach > settled {
+				break
+			}
+			f.sample(d, f.isMark(d, f.next))
+			continue
+		}
+		if middle+f.reach > settled {
+			break
+		}
+		s := f.spans[f.examined]
+		f.examined++
+		tone := f.isMark(d, middle)
+		if tone != f.tone || !f.clocked {
+			f.lock(float64(s.at))
+		}
+		f.tone = tone
+	}
+
+	from := f.next
+	if f.examined < len(f.spans) {
+		from = min(from, float64(f.spans[f.examined].at))
+	}
+	f.examined = max(0, f.examined-f.forget(from))
+}
+
+// lock pulls the bit clock toward a tone change at sample offset at,
+// which should fall between bits
+func (f *ax25Framer) lock(at float64) {
+	if !f.clocked {
+		f.clocked = true
+		f.next = at + f.bitTime/2
+		f.last = math.Inf(-1)
+		return
+	}
+	// The boundary nearest the change, and how far the change is off it
+	boundary := f.next - f.bitTime/2
+	boundary += math.Round((at-boundary)/f.bitTime) * f.bitTime
+	f.next += AX25Lock * (at - boundary)
+	for f.next <= f.last+f.bitTime/2 {
+		f.next += f.bitTime
+	}
+}
+
+// sample reads the bit at f.next: 1 if the tone has not changed since
+// the last bit, 0 if it has
+func (f *ax25Framer) sample(d *bitDecoder, tone bool) {
+	at := f.next
+	one := tone == f.level
+	f.level, f.last = tone, at
+	f.next += f.bitTime
+
+	var bit byte
+	if one {
+		bit = 1
+	}
+	f.shift = f.shift>>1 | bit<<7
+	if f.shift == ax25Flag {
+		f.flag(d, int(at))
+		return
+	}
+	if one {
+		f.ones++
+		if f.ones > 6 {
+			// An abort, or hiss
+			f.inFrame = false
+			f.flagAt = -1
+			return
+		}
+	} else {
+		stuffed := f.ones == 5
+		f.ones = 0
+		if stuffed {
+			return
+		}
+	}
+	if !f.inFrame {
+		return
+	}
+	if f.bits == 0 {
+		f.starts = append(f.starts, int(at-f.bitTime/2))
+	}
+	f.current |= bit << f.bits
+	f.bits++
+	if f.bits == 8 {
+		f.frame = append(f.frame, f.current)
+		f.current, f.bits = 0, 0
+	}
+}
+
+// flag ends any frame in progress and starts the next, at sample offset
+// at
+func (f *ax25Framer) flag(d *bitDecoder, at int) {
+	f.ones = 0
+	if f.inFrame && len(f.frame) >= AX25MinFrame {
+		f.emit(d, at)
+	}
+	if f.flagAt < 0 || f.inFrame && len(f.frame) > 0 {
+		f.flagAt = at - int(8*f.bitTime)
+		d.header = 0
+	}
+	d.header++
+	f.inFrame = true
+	f.frame, f.starts = f.frame[:0], f.starts[:0]
+	f.current, f.bits = 0, 0
+}
+
+// emit makes a record of the frame just read, ending at sample offset at
+func (f *ax25Framer) emit(d *bitDecoder, at int) {
+	d.headerStart = f.flagAt
+	d.startData(pulseShort)
+	d.open.dataStart = f.starts[0]
+	for i, b := range f.frame {
+		end := at
+		if i+1 < len(f.starts) {
+			end = f.starts[i+1]
+		}
+		d.erasing = d.inDropout(f.starts[i], end)
+		d.addByte(b)
+	}
+	d.open.cells = 8 * len(f.frame)
+	d.closeRecord(at)
+	d.state = stateHeader
+	f.flagAt = -1
+}
+
+// ax25FCS is a frame's check sequence, its last two bytes, low byte
+// first: the CRC-16 of the rest as X.25 computes it
+var ax25FCS = Checksums["crc16-x25"]
+
+// ax25CRCOK reports whether a frame is long enough to be one and its
+// check sequence matches
+func ax25CRCOK(r *record) bool {
+	return len(r.data) >= AX25MinFrame && ax25FCS.ok(r)
+}
+
+// packTNC2 prints each frame that checks out as a TNC's monitor does:
+// source, destination and path, then the information field. Bytes that
+// do not print are shown in hex.
+func packTNC2(blocks []Record) []byte {
+	var out strings.Builder
+	for _, b := range blocks {
+		if !b.ChecksumOK {
+			continue
+		}
+		frame := b.Data[:len(b.Data)-2]
+		// Addresses run until one has its extension bit set
+		n := 0
+		for n*7+7 <= len(frame) {
+			n++
+			if frame[n*7-1]&1 != 0 {
+				break
+			}
+		}
+		if n < 2 || frame[n*7-1]&1 == 0 {
+			continue
+		}
+		out.WriteString(ax25Address(frame[7:14]))
+		out.WriteByte('>')
+		out.WriteString(ax25Address(frame[0:7]))
+		for i := 2; i < n; i++ {
+			a := frame[i*7 : i*7+7]
+			out.WriteByte(',')
+			out.WriteString(ax25Address(a))
+			if a[6]&0x80 != 0 {
+				out.WriteByte('*')
+			}
+		}
+		rest := frame[n*7:]
+		// Only I and UI frames carry a protocol id and information
+		if len(rest) >= 2 && (rest[0]&1 == 0 || rest[0]&^0x10 == 0x03) {
+			out.WriteByte(':')
+			for _, c := range rest[2:] {
+				if c >= ' ' && c < 0x7F {
+					out.WriteByte(c)
+				} else {
+					fmt.Fprintf(&out, "<0x%02x>", c)
+				}
+			}
+		}
+		out.WriteByte('\n')
+	}
+	return []byte(out.String())
+}
+
+// ax25Address formats an address field as CALL-SSID, leaving out an SSID
+// of 0
+func ax25Address(a []byte) string {
+	var call strings.Builder
+	for _, c := range a[:6] {
+		if c>>1 != ' ' {
+			call.WriteByte(c >> 1)
+		}
+	}
+	if ssid := a[6] >> 1 & 0x0F; ssid != 0 {
+		fmt.Fprintf(&call, "-%d", ssid)
+	}
+	return call.String()
+}
@@ -0,0 +1,74 @@
+package decoder
+
+import "math"
+
+// Azimuth compensation. The two channels of a stereo capture of a mono
+// tape carry the same signal, but a head whose gap is not square to the
+// tape reads one track a little before the other, so summed as they are
+// the channels partly cancel. The delay between them is the lag at which
+// they correlate best, found to a fraction of a sample by fitting a
+// parabola through the peak; the right channel is shifted back by it and
+// the two averaged, which keeps the signal and halves the power of the
+// noise the channels do not share. A head wired backwards on one track
+// shows as a negative peak, and that channel is inverted.
+const (
+	AzimuthMaxSkew = 0.001   // seconds either channel may lag the other
+	AzimuthSamples = 1 << 20 // samples the correlation is taken over at most, spread across the capture
+)
+
+// mixChannels averages the channels of a stereo capture into one after
+// realigning them
+func mixChannels(left, right []float64, sampleRate uint32, opts Options) []float64 {
+	n := min(len(left), len(right))
+	lag, sign := channelSkew(left[:n], right[:n], int(AzimuthMaxSkew*float64(sampleRate)))
+	inverted := ""
+	if sign < 0 {
+		inverted = ", inverted"
+	}
+	opts.logf("Right channel lags the left by %.2f samples (%.0fµs)%s; realigned before mixing", lag, lag/float64(sampleRate)*1e6, inverted)
+
+	whole := math.Floor(lag)
+	frac := lag - whole
+	at := func(i int) float64 {
+		return right[max(0, min(n-1, i))]
+	}
+	mixed := make([]float64, n)
+	for i := range mixed {
+		j := i + int(whole)
+		mixed[i] = (left[i] + sign*((1-frac)*at(j)+frac*at(j+1))) / 2
+	}
+	return mixed
+}
+
+// channelSkew returns the lag in samples, up to most, at which right best
+// matches left, and whether it matches inverted (-1) or not (1)
+func channelSkew(left, right []float64, most int) (float64, float64) {
+	step := max(1, len(left)/AzimuthSamples)
+	corr := func(lag int) float64 {
+		sum := 0.0
+		for i := max(0, -lag); i < len(left) && i+lag < len(right); i += step {
+			sum += left[i] * right[i+lag]
+		}
+		return sum
+	}
+	c := make([]float64, 2*most+1)
+	best := 0
+	for k := range c {
+		c[k] = corr(k - most)
+		if math.Abs(c[k]) > math.Abs(c[best]) {
+			best = k
+		}
+	}
+	sign := 1.0
+	if c[best] < 0 {
+		sign = -1
+	}
+	lag := float64(best - most)
+	if best > 0 && best < len(c)-1 {
+		a, b, d := sign*c[best-1], sign*c[best], sign*c[best+1]
+		if curve := a - 2*b + d; curve < 0 {
+			lag += (a - d) / (2 * curve)
+		}
+	}
+	return lag, sign
+}
@@ -0,0 +1,419 @@
+package decoder
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Dialect lists the tokenized BASIC programs of a family of computers as
+// text, the way the computers list them
+type Dialect struct {
+	Name string
+	list func(data []byte) (string, error)
+}
+
+// List returns the program in data as text, or an error if data is not a
+// program in the dialect
+func (d *Dialect) List(data []byte) (string, error) {
+	return d.list(data)
+}
+
+// Dialects names every BASIC that programs can be listed from
+var Dialects = map[string]*Dialect{
+	"applesoft":  {"applesoft", msBasic(applesoftTokens, nil, Charsets["ascii"], true)},
+	"commodore":  {"commodore", msBasic(commodoreTokens, map[byte]string{0xFF: "π"}, Charsets["petscii"], false)},
+	"zxspectrum": {"zxspectrum", listSpectrum},
+	"zx81":       {"zx81", listZX81},
+	"atari":      {"atari", listAtari},
+}
+
+// dialectOrder is the order DetectDialect tries dialects in. The
+// Microsoft BASICs go last, as they are laid out alike, and of those
+// Applesoft, as its tokens are a superset of Commodore's codes.
+var dialectOrder = []string{"atari", "zx81", "zxspectrum", "commodore", "applesoft"}
+
+// DetectDialect returns the first dialect that lists data as a whole
+// program, or nil if none does
+func DetectDialect(data []byte) *Dialect {
+	for _, name := range dialectOrder {
+		if _, err := Dialects[name].List(data); err == nil {
+			return Dialects[name]
+		}
+	}
+	return nil
+}
+
+// applesoftTokens are Applesoft's keywords from 0x80
+var applesoftTokens = []string{
+	"END", "FOR", "NEXT", "DATA", "INPUT", "DEL", "DIM", "READ", "GR", "TEXT", "PR#", "IN#",
+	"CALL", "PLOT", "HLIN", "VLIN", "HGR2", "HGR", "HCOLOR=", "HPLOT", "DRAW", "XDRAW",
+	"HTAB", "HOME", "ROT=", "SCALE=", "SHLOAD", "TRACE", "NOTRACE", "NORMAL", "INVERSE",
+	"FLASH", "COLOR=", "POP", "VTAB", "HIMEM:", "LOMEM:", "ONERR", "RESUME", "RECALL",
+	"STORE", "SPEED=", "LET", "GOTO", "RUN", "IF", "RESTORE", "&", "GOSUB", "RETURN", "REM",
+	"STOP", "ON", "WAIT", "LOAD", "SAVE", "DEF", "POKE", "PRINT", "CONT", "LIST", "CLEAR",
+	"GET", "NEW", "TAB(", "TO", "FN", "SPC(", "THEN", "AT", "NOT", "STEP", "+", "-", "*", "/",
+	"^", "AND", "OR", ">", "=", "<", "SGN", "INT", "ABS", "USR", "FRE", "SCRN(", "PDL", "POS",
+	"SQR", "RND", "LOG", "EXP", "COS", "SIN", "TAN", "ATN", "PEEK", "LEN", "STR$", "VAL",
+	"ASC", "CHR$", "LEFT$", "RIGHT$", "MID$",
+}
+
+// commodoreTokens are Commodore BASIC V2's keywords from 0x80
+var commodoreTokens = []string{
+	"END", "FOR", "NEXT", "DATA", "INPUT#", "INPUT", "DIM", "READ", "LET", "GOTO", "RUN",
+	"IF", "RESTORE", "GOSUB", "RETURN", "REM", "STOP", "ON", "WAIT", "LOAD", "SAVE",
+	"VERIFY", "DEF", "POKE", "PRINT#", "PRINT", "CONT", "LIST", "CLR", "CMD", "SYS", "OPEN",
+	"CLOSE", "GET", "NEW", "TAB(", "TO", "FN", "SPC(", "THEN", "NOT", "STEP", "+", "-", "*",
+	"/", "^", "AND", "OR", ">", "=", "<", "SGN", "INT", "ABS", "USR", "FRE", "POS", "SQR",
+	"RND", "LOG", "EXP", "COS", "SIN", "TAN", "ATN", "PEEK", "LEN", "STR$", "VAL", "ASC",
+	"CHR$", "LEFT$", "RIGHT$", "MID$", "GO",
+}
+
+// msBasic returns a lister for the Microsoft BASICs of the Apple ][ and
+// the Commodore machines. Each line is the address of the next, a line
+// number and the tokens, ending with a zero; a zero address ends the
+// program. The addresses must all be out by the same amount from where
+// the lines are in data, which is where the program loads. Outside
+// strings, remarks and data, bytes with the high bit set are tokens, or
+// one of extra, and there are no control codes. Spaced dialects list
+// tokens with a space either side.
+func msBasic(tokens []string, extra map[byte]string, text *Charset, spaced bool) func(data []byte) (string, error) {
+	rem := byte(0x80 + indexOf(tokens, "REM"))
+	data := byte(0x80 + indexOf(tokens, "DATA"))
+	return func(program []byte) (string, error) {
+		var out strings.Builder
+		at, base, last := 0, 0, -1
+		for {
+			if at+2 > len(program) {
+				return "", errors.New("the program runs off the end")
+			}
+			link := int(binary.LittleEndian.Uint16(program[at:]))
+			if link == 0 {
+				break
+			}
+			if at+4 > len(program) {
+				return "", errors.New("the program runs off the end")
+			}
+			number := int(binary.LittleEndian.Uint16(program[at+2:]))
+			end := bytes.IndexByte(program[at+4:], 0)
+			if end < 0 {
+				return "", fmt.Errorf("line %d runs off the end", number)
+			}
+			end += at + 4
+			if last < 0 {
+				base = link - (end + 1)
+			}
+			if link-base != end+1 {
+				return "", fmt.Errorf("line %d links to 0x%04X, not to the line after it", number, link)
+			}
+			if number <= last || number > 63999 {
+				return "", fmt.Errorf("line %d is out of order", number)
+			}
+			last = number
+
+			fmt.Fprintf(&out, "%d ", number)
+			// Remarks run to the end of the line, data to the end of the
+			// statement
+			quoted, remark, inData := false, false, false
+			for _, b := range program[at+4 : end] {
+				switch {
+				case remark:
+					out.WriteString(text.chars[b])
+				case b == '"':
+					quoted = !quoted
+					out.WriteByte(b)
+				case quoted:
+					out.WriteString(text.chars[b])
+				case inData:
+					inData = b != ':'
+					out.WriteString(text.chars[b])
+				case b >= 0x80 && int(b-0x80) < len(tokens):
+					if spaced {
+						fmt.Fprintf(&out, " %s ", tokens[b-0x80])
+					} else {
+						out.WriteString(tokens[b-0x80])
+					}
+					remark, inData = b == rem, b == data
+				case extra[b] != "":
+					out.WriteString(extra[b])
+				case b < 0x20 || b >= 0x80:
+					return "", fmt.Errorf("line %d has code 0x%02X outside a string", number, b)
+				default:
+					out.WriteString(text.chars[b])
+				}
+			}
+			out.WriteByte('\n')
+			at = end + 1
+		}
+		if last < 0 {
+			return "", errors.New("the program has no lines")
+		}
+		return out.String(), nil
+	}
+}
+
+func indexOf(tokens []string, token string) int {
+	for i, t := range tokens {
+		if t == token {
+			return i
+		}
+	}
+	return -1
+}
+
+// Sinclair programs are lines of a line number, high byte first, the
+// length of the rest, and the text, which ends with a newline code.
+// Numbers in the text are followed by a marker and the number in five
+// bytes of floating point, which listings do not show.
+const (
+	sinclairMaxLine = 9999
+	sinclairFloat   = 5 // bytes of a number's floating point form
+
+	spectrumNewline = 0x0D
+	spectrumNumber  = 0x0E
+	spectrumVars    = 0x40 // line number high bytes from which the variables begin
+
+	zx81Newline = 0x76
+	zx81Number  = 0x7E
+	zx81Program = 0x407D // where the program starts, after the system variables
+	zx81Dfile   = 0x400C // system variable holding where the display, after the program, starts
+)
+
+// listSpectrum lists a ZX Spectrum program, which the variables may
+// follow. Colour and position codes take one or two bytes after them.
+func listSpectrum(data []byte) (string, error) {
+	end := 0
+	for end < len(data) && data[end] < spectrumVars {
+		if end+4 > len(data) {
+			end = len(data)
+			break
+		}
+		end += 4 + int(binary.LittleEndian.Uint16(data[end+2:]))
+	}
+	return listSinclair(data[:min(end, len(data))], Charsets["zxspectrum"], spectrumNewline, spectrumNumber, func(b byte) int {
+		switch {
+		case b >= 0x10 && b <= 0x15:
+			return 1
+		case b == 0x16 || b == 0x17:
+			return 2
+		}
+		return 0
+	})
+}
+
+// listZX81 lists the program in the memory image a ZX81 saves, which
+// starts with the system variables and has the display after the program
+func listZX81(data []byte) (string, error) {
+	from := zx81Program - ZX81Vars
+	if len(data) < from {
+		return "", errors.New("too short for the ZX81's system variables")
+	}
+	to := int(binary.LittleEndian.Uint16(data[zx81Dfile-ZX81Vars:])) - ZX81Vars
+	if to < from || to > len(data) {
+		return "", fmt.Errorf("the display is at 0x%04X, outside the file", to+ZX81Vars)
+	}
+	return listSinclair(data[from:to], Charsets["zx81"], zx81Newline, zx81Number, func(byte) int { return 0 })
+}
+
+// listSinclair lists Sinclair program lines, reading the text as chars.
+// After code b, params(b) bytes are skipped.
+func listSinclair(data []byte, chars *Charset, newline, number byte, params func(b byte) int) (string, error) {
+	var out strings.Builder
+	last := 0
+	for at := 0; at < len(data); {
+		if at+4 > len(data) {
+			return "", errors.New("the program runs off the end")
+		}
+		n := int(binary.BigEndian.Uint16(data[at:]))
+		end := at + 4 + int(binary.LittleEndian.Uint16(data[at+2:]))
+		if n <= last || n > sinclairMaxLine {
+			return "", fmt.Errorf("line %d is out of order", n)
+		}
+		if end > len(data) || data[end-1] != newline {
+			return "", fmt.Errorf("line %d does not end where its length says", n)
+		}
+		last = n
+		fmt.Fprintf(&out, "%d ", n)
+		for i := at + 4; i < end-1; i++ {
+			b := data[i]
+			switch {
+			case b == number:
+				i += sinclairFloat
+			case params(b) > 0:
+				i += params(b)
+			case chars.chars[b] == "":
+				return "", fmt.Errorf("line %d has code 0x%02X", n, b)
+			default:
+				out.WriteString(chars.chars[b])
+			}
+		}
+		out.WriteByte('\n')
+		at = end
+	}
+	if last == 0 {
+		return "", errors.New("the program has no lines")
+	}
+	return out.String(), nil
+}
+
+// Atari BASIC saves a header of pointers, the variable name table, the
+// variable value table and the statement table. Each line of statements
+// is its number, its length and statements, each the offset of the next
+// in the line, a command and tokens. Line 32768 holds whatever was typed
+// to save the program, and ends it.
+const (
+	atariHeader      = 14 // bytes of pointers before the tables
+	atariImmediate   = 32768
+	atariNumber      = 0x0E // token of a number, in six bytes of BCD
+	atariString      = 0x0F // token of a string, its length and its text
+	atariOperators   = 0x10 // the first operator token
+	atariVariables   = 0x80 // the token of the first variable
+	atariEOL         = 0x9B // ATASCII's end of line
+	atariImpliedLet  = 0x36 // command of an assignment without LET
+	atariErrorSyntax = 0x37 // command of a line that would not parse
+)
+
+// atariCommands are Atari BASIC's commands from 0
+var atariCommands = []string{
+	"REM", "DATA", "INPUT", "COLOR", "LIST", "ENTER", "LET", "IF", "FOR", "NEXT", "GOTO",
+	"GO TO", "GOSUB", "TRAP", "BYE", "CONT", "COM", "CLOSE", "CLR", "DEG", "DIM", "END",
+	"NEW", "OPEN", "LOAD", "SAVE", "STATUS", "NOTE", "POINT", "XIO", "ON", "POKE", "PRINT",
+	"RAD", "READ", "RESTORE", "RETURN", "RUN", "STOP", "POP", "?", "GET", "PUT", "GRAPHICS",
+	"PLOT", "POSITION", "DOS", "DRAWTO", "SETCOLOR", "LOCATE", "SOUND", "LPRINT", "CSAVE",
+	"CLOAD", "", "ERROR-",
+}
+
+// atariOperatorTokens are Atari BASIC's operators and functions from
+// 0x10. Array names end in a parenthesis already, so the ones that open
+// their subscripts list as nothing.
+var atariOperatorTokens = []string{
+	"", "", ",", "$", ":", ";", "", " GOTO ", " GOSUB ", " TO ", " STEP ", " THEN ", "#",
+	"<=", "<>", ">=", "<", ">", "=", "^", "*", "+", "-", "/", " NOT ", " OR ", " AND ", "(",
+	")", "=", "=", "<=", "<>", ">=", "<", ">", "=", "+", "-", "(", "", "", "(", "", ",",
+	"STR$", "CHR$", "USR", "ASC", "VAL", "LEN", "ADR", "ATN", "COS", "PEEK", "SIN", "RND",
+	"FRE", "EXP", "LOG", "CLOG", "SQR", "SGN", "ABS", "INT", "PADDLE", "STICK", "PTRIG",
+	"STRIG",
+}
+
+// listAtari lists an Atari BASIC program as SAVE writes it
+func listAtari(data []byte) (string, error) {
+	if len(data) < atariHeader {
+		return "", errors.New("too short for Atari BASIC's header")
+	}
+	var ptr [7]int
+	for i := range ptr {
+		ptr[i] = int(binary.LittleEndian.Uint16(data[2*i:]))
+	}
+	// The tables are saved as if they began right after the header
+	vntp, vvtp, stmtab, stmcur := ptr[1], ptr[3], ptr[4], ptr[5]
+	offset := func(p int) int { return p - vntp + atariHeader }
+	if ptr[0] != 0 || !(vntp <= ptr[2] && ptr[2] <= vvtp && vvtp <= stmtab && stmtab <= stmcur) || offset(stmcur) > len(data) {
+		return "", errors.New("the header's pointers are not in order")
+	}
+	var names []string
+	var name strings.Builder
+	for _, b := range data[atariHeader:offset(ptr[2])] {
+		name.WriteByte(b & 0x7F)
+		if b&0x80 != 0 {
+			names = append(names, name.String())
+			name.Reset()
+		}
+	}
+
+	atascii := Charsets["atascii"]
+	var out strings.Builder
+	last := -1
+	for at := offset(stmtab); at < offset(stmcur); {
+		if at+3 > offset(stmcur) {
+			return "", errors.New("the program runs off the end")
+		}
+		n := int(binary.LittleEndian.Uint16(data[at:]))
+		if n == atariImmediate {
+			break
+		}
+		end := at + int(data[at+2])
+		if n <= last || end <= at+3 || end > len(data) {
+			return "", fmt.Errorf("line %d is out of order or runs off the end", n)
+		}
+		last = n
+		fmt.Fprintf(&out, "%d ", n)
+		for i := at + 3; i < end; {
+			if i+2 > end {
+				return "", fmt.Errorf("line %d has a bad statement", n)
+			}
+			next, command := at+int(data[i]), int(data[i+1])
+			if next <= i+1 || next > end || command >= len(atariCommands) {
+				return "", fmt.Errorf("line %d has a bad statement", n)
+			}
+			out.WriteString(atariCommands[command])
+			if command != atariImpliedLet {
+				out.WriteByte(' ')
+			}
+			i += 2
+			if command == 0 || command == 1 || command == atariErrorSyntax {
+				// Remarks, data and what would not parse are kept as typed
+				for ; i < next && data[i] != atariEOL; i++ {
+					out.WriteString(atascii.chars[data[i]])
+				}
+				i = next
+				continue
+			}
+			for i < next {
+				t := data[i]
+				i++
+				switch {
+				case t == atariNumber && i+6 <= next:
+					s, err := atariBCD(data[i : i+6])
+					if err != nil {
+						return "", fmt.Errorf("line %d: %w", n, err)
+					}
+					out.WriteString(s)
+					i += 6
+				case t == atariString && i < next && i+1+int(data[i]) <= next:
+					out.WriteByte('"')
+					for _, c := range data[i+1 : i+1+int(data[i])] {
+						out.WriteString(atascii.chars[c])
+					}
+					out.WriteByte('"')
+					i += 1 + int(data[i])
+				case t >= atariVariables && int(t-atariVariables) < len(names):
+					out.WriteString(names[t-atariVariables])
+				case t >= atariOperators && int(t-atariOperators) < len(atariOperatorTokens):
+					out.WriteString(atariOperatorTokens[t-atariOperators])
+				default:
+					return "", fmt.Errorf("line %d has token 0x%02X", n, t)
+				}
+			}
+		}
+		out.WriteByte('\n')
+		at = end
+	}
+	if last < 0 {
+		return "", errors.New("the program has no lines")
+	}
+	return out.String(), nil
+}
+
+// atariBCD reads an Atari floating point number: an exponent of 100,
+// excess 64, with the sign in its top bit, and five bytes of two decimal
+// digits, the first of them before the point
+func atariBCD(b []byte) (string, error) {
+	if b[0] == 0 {
+		return "0", nil
+	}
+	digits := fmt.Sprintf("%X", b[1:])
+	if strings.ContainsAny(digits, "ABCDEF") {
+		return "", fmt.Errorf("number %X is not decimal", b)
+	}
+	v, err := strconv.ParseFloat(fmt.Sprintf("0.%se%d", digits, 2*(int(b[0]&0x7F)-64+1)), 64)
+	if err != nil {
+		return "", err
+	}
+	if b[0]&0x80 != 0 {
+		v = -v
+	}
+	return strconv.FormatFloat(v, 'G', -1, 64), nil
+}
@@ -0,0 +1,289 @@
+package decoder
+
+import (
+	"errors"
+	"fmt"
+	"math/bits"
+)
+
+// Biphase-L, or Manchester, coding, as some homebrew and industrial data
+// recorders use: every bit cell has a transition in its middle, high to
+// low for a 1 and low to high for a 0, and another at its start only
+// when the bit repeats the last one. The crossing detector's half-cycles
+// are then the gaps between transitions, half a cell or a whole one. A
+// whole cell always runs from the middle of one cell to the middle of the
+// next, a bit unlike the last; two halves make a bit like it. Which way a
+// transition goes is lost in the half-cycles, so bits are known only
+// from a leader of repeated bits whose value is given: the first whole
+// cell after it fixes where cells start, and the bits that follow are
+// searched for the sync byte that starts a record's data. A record is
+// everything up to the signal stopping, or giving way to hiss: a few
+// half-cycles in a row that no cell could hold.
+const (
+	BiphaseGlitch = 0.5 // fraction of a half cell below which a half-cycle is noise
+	BiphaseLost   = 4   // bad half-cycles in a row that end a record
+)
+
+// Biphase describes a biphase-L signal
+type Biphase struct {
+	Baud   float64 // bit cells a second
+	Leader int     // the bit the leader repeats, 0 or 1
+	Sync   byte    // the byte that ends the leader, eight bits in the framing's order
+	Framing
+}
+
+// Biphase1200 is the settings the biphase system decodes unless told
+// otherwise: 1200 bits a second, a leader of 0 bits and an ASCII SYN,
+// then bare bytes MSB first
+var Biphase1200 = Biphase{Baud: 1200, Leader: 0, Sync: 0x16, Framing: Bare8}
+
+// check returns an error if the settings cannot be decoded
+func (b Biphase) check() error {
+	switch {
+	case b.Baud <= 0:
+		return errors.New("baud rate must be above zero")
+	case b.Leader != 0 && b.Leader != 1:
+		return fmt.Errorf("leader bit %d is not 0 or 1", b.Leader)
+	}
+	if err := b.Framing.check(); err != nil {
+		return err
+	}
+	return b.whole("biphase")
+}
+
+// Biphase returns the settings of a system that decodes biphase-L
+func (s *System) Biphase() (Biphase, bool) {
+	if s.biphase == nil {
+		return Biphase{}, false
+	}
+	return *s.biphase, true
+}
+
+// WithBiphase returns a biphase-L system decoding with settings b instead
+// of its own
+func (s *System) WithBiphase(b Biphase) (*System, error) {
+	if s.biphase == nil {
+		return nil, fmt.Errorf("%s tapes are not biphase coded", s.Name)
+	}
+	if err := b.check(); err != nil {
+		return nil, err
+	}
+	return s.withBiphase(b), nil
+}
+
+// withBiphase returns a copy of the system set up for settings already
+// checked
+func (s System) withBiphase(b Biphase) *System {
+	cell := 1 / b.Baud
+	s.Timing = &Timing{
+		Short:      0.75 * cell,
+		Long:       1.5 * cell, // longer is no signal, ending the record
+		MinHeader:  32,
+		HeaderTone: cell / 2,
+		Nominal: [numPulses]float64{
+			pulseShort: cell / 2,
+			pulseLong:  cell,
+		},
+	}
+	s.biphase = &b
+	s.framing = b.Framing
+	s.newFramer = func() framer { return &biphaseFramer{biphase: b} }
+	s.encode = func(t *tape, timing *Timing, r Record) { encodeBiphase(b, t, timing, r) }
+	return &s
+}
+
+var biphaseSystem = System{
+	Name:    "biphase",
+	Demods:  []Demod{DemodZeroCrossing, DemodPulse}, // half and whole cells mix, which the peak engine cannot time
+	check:   cleanlyFramed,
+	payload: func(data []byte) int { return len(data) },
+	pack:    concatBlocks,
+}.withBiphase(Biphase1200)
+
+// biphaseFramer follows the transitions of a biphase-L signal
+type biphaseFramer struct {
+	biphase Biphase
+
+	locked   bool // cells have been found, and bit holds the last one
+	bit      int
+	boundary bool // a half-cell has brought the signal to a cell's start
+	sync     syncSearch
+
+	// bad counts the half-cycles in a row no cell could hold, from badAt.
+	// They count as an error only once a good bit follows, as the signal
+	// dying away at the end of a record is none.
+	bad   int
+	badAt int
+}
+
+func (f *biphaseFramer) halfCycle(d *bitDecoder, p pulse) {
+	if p == pulseHeader {
+		// The signal has stopped
+		f.reset(d)
+		return
+	}
+	glitch := d.length < BiphaseGlitch*d.timing.Nominal[pulseShort]
+	if !f.locked {
+		if glitch {
+			d.header = 0
+			return
+		}
+		if p == pulseShort {
+			d.countHeader(p)
+			return
+		}
+		if d.header <= d.timing.MinHeader {
+			d.header = 0
+			return
+		}
+		// The leader's bits are whole cells of two halves, so the first
+		// whole cell ends in the middle of the first bit unlike them
+		d.startData(p)
+		f.locked, f.bit = true, 1-f.biphase.Leader
+		f.sync = newSyncSearch(f.biphase.Leader, f.biphase.Sync, f.biphase.Order)
+		f.bitRead(d)
+		return
+	}
+
+	switch {
+	case glitch || p == pulseLong && f.boundary:
+		// Neither a glitch nor a whole cell from a cell's start can be:
+		// a transition was missed or added, so the cell is dropped and
+		// the next taken to start where this one ends
+		d.tracef("half-cycle no cell could hold, dropped")
+		if f.bad == 0 {
+			f.badAt = d.at
+		}
+		if f.bad++; f.bad == BiphaseLost {
+			d.at = f.badAt
+			f.reset(d)
+			return
+		}
+		if !glitch {
+			f.boundary = false
+			f.bit = 1 - f.bit
+		}
+	case p == pulseLong:
+		f.bit = 1 - f.bit
+		f.bitRead(d)
+	case !f.boundary:
+		f.boundary = true
+	default:
+		f.boundary = false
+		f.bitRead(d)
+	}
+}
+
+// bitRead takes in the bit just read
+func (f *biphaseFramer) bitRead(d *bitDecoder) {
+	if f.bad > 0 {
+		d.open.cells++
+		d.open.cellErrors++
+		d.totalErrors++
+		f.bad = 0
+	}
+	if !f.sync.add(d, f.bit) {
+		f.reset(d)
+	}
+}
+
+// reset ends any record and looks for the next leader
+func (f *biphaseFramer) reset(d *bitDecoder) {
+	d.closeRecord(d.at)
+	d.state = stateHeader
+	d.header = 0
+	*f = biphaseFramer{biphase: f.biphase}
+}
+
+// SyncSearch is how many bits past the end of a leader the sync byte may
+// end by, before the leader is taken for noise
+const SyncSearch = 32
+
+// syncSearch follows the bits after a leader until they end in the sync
+// byte, then shifts the rest into the open record
+type syncSearch struct {
+	sync     byte
+	shift    byte // the last 8 bits, the leader's before any are read
+	searched int  // bits read looking for it
+	found    bool
+}
+
+func newSyncSearch(leader int, sync byte, order BitOrder) syncSearch {
+	s := syncSearch{sync: sync}
+	if order == LSBFirst {
+		// Bits are shifted in as they come, so the byte comes reversed
+		s.sync = bits.Reverse8(sync)
+	}
+	if leader == 1 {
+		s.shift = 0xFF
+	}
+	return s
+}
+
+// add takes in the next bit, reporting false if the sync byte has not
+// been found where it should be
+func (s *syncSearch) add(d *bitDecoder, bit int) bool {
+	if s.found {
+		d.open.cells++
+		d.shiftBit(bit == 1)
+		return true
+	}
+	s.shift = s.shift<<1 | byte(bit)
+	s.searched++
+	if s.shift == s.sync {
+		d.tracef("sync byte found")
+		s.found = true
+	}
+	return s.found || s.searched < SyncSearch
+}
+
+// leaderBits returns enough leader bits for headerHalves half-cycles of
+// header, when each bit is perBit of them, rounded to whole bytes
+func leaderBits(leader, halves, perBit int) []int {
+	n := (halves/perBit + 7) / 8
+	bits := make([]int, 8*n)
+	for i := range bits {
+		bits[i] = leader
+	}
+	return bits
+}
+
+// sent returns the bits of the sync byte and then of data, each byte
+// framed, in the order they are sent
+func (f Framing) sent(sync byte, data []byte) []int {
+	var bits []int
+	syncFraming := Framing{Order: f.Order, DataBits: 8}
+	for i := range 8 {
+		bits = append(bits, syncFraming.bit(sync, i))
+	}
+	for _, v := range data {
+		bits = append(bits, f.frame(v)...)
+	}
+	return bits
+}
+
+// encodeBiphase writes a record as a biphase-L recorder would: a leader,
+// the sync byte and the data, then a half-cell to end the last cell
+func encodeBiphase(b Biphase, t *tape, timing *Timing, r Record) {
+	half := timing.Nominal[pulseShort]
+	bits := leaderBits(b.Leader, headerHalves(timing, r), 2)
+	bits = append(bits, b.sent(b.Sync, r.Data)...)
+
+	// Each bit is a level for each half of its cell; a run of the same
+	// level is one half-cycle
+	high := false
+	run := 0
+	level := func(l bool) {
+		if run > 0 && l != high {
+			t.half(float64(run) * half)
+			run = 0
+		}
+		high = l
+		run++
+	}
+	for _, bit := range bits {
+		level(bit == 1)
+		level(bit == 0)
+	}
+	t.half(float64(run) * half)
+}
@@ -0,0 +1,700 @@
+package decoder
+
+import (
+	"fmt"
+	"log/slog"
+	"math"
+	"slices"
+)
+
+// pulse is the classification of a single half-cycle
+type pulse int
+
+const (
+	pulseShort  pulse = iota // half of a 0 bit, or of the sync bit
+	pulseLong                // half of a 1 bit
+	pulseHeader              // header tone (or silence)
+	numPulses
+)
+
+// cell is what the two half-cycles of a data bit cell add up to
+type cell int
+
+const (
+	cellError cell = iota // mismatched halves, dropped
+	cellZero
+	cellOne
+	cellEnd // header tone seen, the record is over
+)
+
+// Timing describes how a tape format encodes bits as half-cycles
+type Timing struct {
+	Short     float64 // seconds; shorter half-cycles are short pulses
+	Long      float64 // seconds; shorter (but not short) half-cycles are long pulses
+	MinHeader int     // header half-cycles that must precede the sync bit
+
+	// HeaderTone is the nominal length in seconds of a header tone
+	// half-cycle, which the tape's speed is measured against; 0 if the
+	// format has no steady header tone
+	HeaderTone float64
+
+	// Sync is the nominal length in seconds of each half-cycle of the sync
+	// bit, in order. Each may differ from it by SyncTolerance of itself.
+	Sync          []float64
+	SyncTolerance float64
+
+	// Nominal is the ideal length in seconds of each pulse class, which
+	// speed tracking measures drift against
+	Nominal [numPulses]float64
+
+	// Cells maps the first and second half of a data bit cell to a bit
+	Cells [numPulses][numPulses]cell
+}
+
+// AppleII is the Apple ][ monitor cassette format: a 770Hz header tone,
+// a short sync bit, then 0 bits as 2kHz cycles and 1 bits as 1kHz cycles
+var AppleII = Timing{
+	Short:      0.000350, // 350us
+	Long:       0.000600, // 600us
+	MinHeader:  50,
+	HeaderTone: 0.000649, // 770Hz
+	Sync: []float64{
+		0.000200, // 2.5kHz
+		0.000250,
+	},
+	SyncTolerance: 0.75,
+	Nominal: [numPulses]float64{
+		pulseShort:  0.000250, // 2kHz
+		pulseLong:   0.000500, // 1kHz
+		pulseHeader: 0.000649, // 770Hz
+	},
+	Cells: [numPulses][numPulses]cell{
+		pulseShort:  {pulseShort: cellZero, pulseLong: cellError, pulseHeader: cellEnd},
+		pulseLong:   {pulseShort: cellError, pulseLong: cellOne, pulseHeader: cellEnd},
+		pulseHeader: {cellEnd, cellEnd, cellEnd},
+	},
+}
+
+// Formats names the timings that can be selected by name. Besides the
+// standard format, a number of commercial Apple ][ tapes were mastered
+// for fast loaders that keep the monitor's encoding but shorten every
+// cycle in proportion; the common double and triple speed variants are
+// included.
+var Formats = map[string]*Timing{
+	"appleii":    &AppleII,
+	"appleii-2x": ptr(AppleII.scaled(2)), // 4kHz 0 bits, 2kHz 1 bits
+	"appleii-3x": ptr(AppleII.scaled(3)), // 6kHz 0 bits, 3kHz 1 bits
+}
+
+// scaled returns the timing played speed times faster
+func (t Timing) scaled(speed float64) Timing {
+	t.Short /= speed
+	t.Long /= speed
+	t.HeaderTone /= speed
+	t.Sync = slices.Clone(t.Sync)
+	for i := range t.Sync {
+		t.Sync[i] /= speed
+	}
+	for i := range t.Nominal {
+		t.Nominal[i] /= speed
+	}
+	return t
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
+
+// Speed tracking limits. The tracker follows the tape's speed with a
+// first-order loop, nudging its estimate toward each pulse's length
+// relative to nominal.
+const (
+	SpeedGain     = 1.0 / 32 // fraction of each pulse's error taken up
+	MaxSpeedDrift = 0.3      // estimate stays within 1±MaxSpeedDrift
+
+	// SteadyJitter is the most a header tone's cycles may vary for the
+	// speed it played at to move the thresholds its record is read with
+	SteadyJitter = 0.05
+
+	// speedOutlier rejects pulses too far from any nominal length to be
+	// signal, such as silence between records
+	speedOutlier = 0.35
+)
+
+// speedAt returns the playback speed relative to nominal at which the
+// header tone's half-cycles last seconds, or 0 if the format has no
+// header tone or the tone is too far off it to be one
+func (t *Timing) speedAt(seconds float64) float64 {
+	speed := t.HeaderTone / seconds
+	if math.Abs(speed-1) > speedOutlier {
+		return 0
+	}
+	return speed
+}
+
+// isSync reports whether a half-cycle of seconds can be half i of the
+// sync bit
+func (t *Timing) isSync(i int, seconds float64) bool {
+	return math.Abs(seconds-t.Sync[i]) <= t.SyncTolerance*t.Sync[i]
+}
+
+func (t *Timing) classify(seconds float64) pulse {
+	switch {
+	case seconds < t.Short:
+		return pulseShort
+	case seconds < t.Long:
+		return pulseLong
+	default:
+		return pulseHeader
+	}
+}
+
+// Decoder states
+const (
+	stateHeader     = iota // counting header tone half-cycles
+	stateSync              // part of the sync bit seen
+	stateFirstHalf         // waiting for the first half of a data bit
+	stateSecondHalf        // waiting for the second half of a data bit
+)
+
+// step is the state machine: it advances it by a half-cycle of class p.
+// The header and sync bit are told by their lengths, and data bits are
+// resolved through the format's Cells table.
+func (d *bitDecoder) step(p pulse) {
+	switch d.state {
+	case stateHeader:
+		d.trySync(p)
+	case stateSync:
+		d.nextSync(p)
+	case stateFirstHalf:
+		d.firstHalf(p)
+	case stateSecondHalf:
+		d.secondHalf(p)
+	}
+}
+
+// framer turns classified half-cycles into records for one system,
+// using the bit decoder for header counting and record keeping
+type framer interface {
+	halfCycle(d *bitDecoder, p pulse)
+}
+
+// finisher is implemented by framers that hold back part of a record
+// until what follows shows how it ends
+type finisher interface {
+	finish(d *bitDecoder, at int)
+}
+
+// appleFramer reads Apple ][ bit cells through the state machine
+type appleFramer struct{}
+
+func (appleFramer) halfCycle(d *bitDecoder, p pulse) {
+	d.step(p)
+}
+
+// record is one program as the bit decoder found it. Positions are sample
+// offsets into the capture.
+type record struct {
+	system      *System
+	headerStart int // first half-cycle of the header tone
+	dataStart   int // sync bit
+	end         int // header tone or end of stream that closed the record
+	data        []byte
+
+	header int     // half-cycles of header tone before the sync bit
+	pulse  float64 // seconds; average header half-cycle, at nominal speed
+
+	// speed is the playback speed relative to nominal that the header
+	// tone shows, 0 if unknown, and jitter how much its cycles vary
+	// relative to their mean
+	speed  float64
+	jitter float64
+
+	// eye counts the record's half-cycles by length, as classified
+	eye eyeCounts
+
+	cells      int // bit cells read
+	cellErrors int // bit cells whose halves did not agree
+
+	// erased lists the offsets in data of bytes that overlapped a dropout.
+	// They are stored as zero.
+	erased []int
+
+	// frameErrors lists the bytes whose start, parity or stop bits were
+	// wrong, for systems whose bytes have them
+	frameErrors []FrameError
+
+	// unreadable counts the blocks of a record recorded more than once of
+	// which no copy, alone or combined, checked out
+	unreadable int
+
+	// disputes lists the bytes engines disagreed on in an ensemble decode
+	disputes []Dispute
+
+	// tail holds the tailBits bits of a byte the record closed partway
+	// through, the last read lowest
+	tail     byte
+	tailBits int
+
+	// retry gives the options that read the record when those given did
+	// not, as flags
+	retry string
+}
+
+// confidence is the fraction of bit cells that decoded cleanly
+func (r *record) confidence() float64 {
+	if r.cells == 0 {
+		return 0
+	}
+	return 1 - float64(r.cellErrors)/float64(r.cells)
+}
+
+// checksumOK reports whether the record's checksum matches, or for a
+// system without one, whether the record was read cleanly
+func (r *record) checksumOK() bool {
+	return r.system.check(r)
+}
+
+// verify returns how the record's checksum checked out, if the system's
+// is one of Checksums
+func (r *record) verify() Verification {
+	if r.system.checksum == nil {
+		return Verification{}
+	}
+	return r.system.checksum.Verify(r.data)
+}
+
+// payload is the number of bytes in the record besides its checksums
+func (r *record) payload() int {
+	return r.system.payload(r.data)
+}
+
+// export returns the record as decoders hand it out, for a capture at
+// rate samples per second. What it holds is left for the system to
+// identify.
+func (r *record) export(rate float64) Record {
+	rec := Record{
+		LoadAddress: -1,
+		Data:        r.data,
+		ChecksumOK:  r.checksumOK(),
+		Verified:    r.verify(),
+		Start:       float64(r.headerStart) / rate,
+		End:         float64(r.end) / rate,
+		Header:      r.header,
+		Pulse:       r.pulse,
+	}
+	rec.setBody(r.data[:r.payload()])
+	if n := r.system.trailer; n > 0 && len(r.data) >= n {
+		rec.Checksum = r.data[len(r.data)-n:]
+	}
+	return rec
+}
+
+// appleChecksum is an Apple ][ record's trailing checksum byte. The
+// monitor XORs every byte into an accumulator seeded with 0xFF, so a
+// good record including its checksum XORs to zero.
+var appleChecksum = Checksum{Name: "xor", Size: 1, Seed: 0xFF, sum: xorSum}
+
+// bitDecoder turns a stream of half-cycle durations into records in a
+// single pass, framed by the system's framer, which shifts bits into
+// bytes as the system's Framing says.
+type bitDecoder struct {
+	system *System
+	framer framer
+	timing *Timing
+	state  int
+	header int     // header half-cycles seen in a row
+	first  pulse   // first half of the current bit cell
+	synced int     // sync bit half-cycles seen so far
+	at     int     // sample offset of the current half-cycle
+	length float64 // seconds the current half-cycle lasts, at nominal speed
+	end    int     // sample offset where the current half-cycle ends
+	rate   float64
+
+	// trackSpeed scales half-cycles by speed, the running estimate of
+	// playback speed relative to nominal (1 is exact, above 1 is slow)
+	trackSpeed bool
+	speed      float64
+
+	// headerSpeed classifies a record's half-cycles at the speed its
+	// header tone played at
+	headerSpeed bool
+
+	cellStart   int     // sample offset of the current bit cell
+	averageCell float64 // running average bit cell length in samples
+	erasing     bool    // the byte being assembled overlaps a dropout
+	dropping    bool    // cells are being skipped inside a dropout
+	dropStart   int     // where the skipped cells began
+
+	// dropouts are the known dropout spans in time order. The streaming
+	// decoder appends to them as they are found.
+	dropouts    [][2]int
+	nextDropout int
+
+	headerStart int
+	headerTime  float64 // seconds of header tone counted
+
+	// The last run of header half-cycles of one class, as recorded
+	// before speed tracking, which the tape's speed and jitter are
+	// measured from. Whole cycles are timed, as lopsided waveforms make
+	// their halves unequal.
+	tone        pulse
+	toneCount   int     // half-cycles
+	toneHalf    float64 // seconds; first half of the cycle in progress
+	toneTime    float64 // seconds of whole cycles
+	toneSquares float64
+	current     byte
+	bitCount    int // data bits in current
+	open        *record
+
+	// framePos counts the bits of the byte in progress, framing bits
+	// included, ones its 1 data bits and fault what was wrong with them
+	framePos int
+	ones     int
+	fault    FrameError
+
+	records []record
+
+	// Running totals across all records
+	totalBytes  int
+	totalErrors int
+
+	// Hooks for streaming use. When onRecord is set, closed records are
+	// handed to it instead of being collected in records.
+	onStart  func(r *record)
+	onRecord func(r record)
+
+	// trace, if set, is told everything the decoder does
+	trace *tracer
+
+	// log, if set, is told what went wrong in framers that can fail, as
+	// external decoders can
+	log *slog.Logger
+}
+
+func newBitDecoder(s *System, t *Timing, sampleRate uint32) *bitDecoder {
+	return &bitDecoder{system: s, framer: s.newFramer(), timing: t, rate: float64(sampleRate), speed: 1}
+}
+
+// warnf logs something gone wrong in the framer at warning level
+func (d *bitDecoder) warnf(format string, args ...any) {
+	if d.log != nil {
+		d.log.Warn(fmt.Sprintf(format, args...))
+	}
+}
+
+// stateName describes what the decoder is currently looking for
+func (d *bitDecoder) stateName() string {
+	switch d.state {
+	case stateHeader:
+		return "header"
+	case stateSync:
+		return "sync"
+	default:
+		return "data"
+	}
+}
+
+// halfCycle feeds the next half-cycle, which starts at sample offset at
+// and lasts length samples
+func (d *bitDecoder) halfCycle(at, length int) {
+	d.at = at
+	d.end = at + length
+	seconds := float64(length) / d.rate
+	if d.trackSpeed {
+		seconds /= d.speed
+	}
+	d.length = seconds
+	classified := seconds
+	if d.headerSpeed && d.open != nil && d.open.speed > 0 && d.open.jitter <= SteadyJitter {
+		// The thresholds move with the speed the header tone played at
+		classified *= d.open.speed
+	}
+	p := d.timing.classify(classified)
+	if d.open != nil && !d.system.selfTimed {
+		d.open.eye.add(classified, d.timing)
+	}
+	if d.trackSpeed {
+		d.followSpeed(p, seconds)
+	}
+	d.traceHalfCycle(p)
+	d.framer.halfCycle(d, p)
+}
+
+// finish closes any record still open when the stream ends at sample
+// offset at
+func (d *bitDecoder) finish(at int) {
+	if f, ok := d.framer.(finisher); ok {
+		f.finish(d, at)
+	}
+	d.closeRecord(at)
+}
+
+// abandon drops the record under way, or the header tone, as when the
+// decode stops before its end, returning where it began, or at if
+// neither was
+func (d *bitDecoder) abandon(at int) int {
+	switch {
+	case d.open != nil:
+		at = d.open.headerStart
+	case d.header > 0:
+		at = d.headerStart
+	}
+	d.open = nil
+	return at
+}
+
+func (d *bitDecoder) closeRecord(at int) {
+	if d.open == nil {
+		return
+	}
+	// A sync with no whole byte behind it was noise, not a program
+	if len(d.open.data) > 0 {
+		d.tracef("record closed, %d bytes", len(d.open.data))
+		d.open.end = at
+		d.open.tail, d.open.tailBits = d.current, d.bitCount
+		if d.onRecord != nil {
+			d.onRecord(*d.open)
+		} else {
+			d.records = append(d.records, *d.open)
+		}
+	}
+	d.open = nil
+}
+
+func (d *bitDecoder) countHeader(p pulse) {
+	if d.header == 0 {
+		d.headerStart = d.at
+		d.headerTime = 0
+	}
+	d.header++
+	d.headerTime += d.length
+
+	if d.header == 1 || p != d.tone {
+		d.tone, d.toneCount, d.toneTime, d.toneSquares = p, 0, 0, 0
+	}
+	seconds := float64(d.end-d.at) / d.rate
+	d.toneCount++
+	if d.toneCount%2 == 1 {
+		d.toneHalf = seconds
+		return
+	}
+	cycle := d.toneHalf + seconds
+	if n := float64(d.toneCount/2 - 1); n > 0 && math.Abs(cycle-d.toneTime/n) > speedOutlier*d.toneTime/n {
+		// Not the same tone; the measurement starts again
+		d.toneCount, d.toneTime, d.toneSquares = 0, 0, 0
+		return
+	}
+	d.toneTime += cycle
+	d.toneSquares += cycle * cycle
+}
+
+func (d *bitDecoder) trySync(p pulse) {
+	// After enough header tone, this may be the first half of the sync bit
+	if d.header > d.timing.MinHeader && d.timing.isSync(0, d.length) {
+		d.state = stateSync
+		d.synced = 0
+		d.nextSync(p)
+		return
+	}
+	if p == pulseShort {
+		d.header = 0
+		return
+	}
+	// 1kHz passes for header too
+	d.countHeader(p)
+}
+
+func (d *bitDecoder) nextSync(p pulse) {
+	if !d.timing.isSync(d.synced, d.length) {
+		d.resync(p)
+		return
+	}
+	d.synced++
+	if d.synced == len(d.timing.Sync) {
+		d.startData(p)
+	}
+}
+
+func (d *bitDecoder) resync(p pulse) {
+	// Not a sync bit after all; this half-cycle may start a new header
+	d.state = stateHeader
+	d.header = 0
+	d.countHeader(p)
+}
+
+func (d *bitDecoder) startData(pulse) {
+	d.state = stateFirstHalf
+	d.current = 0
+	d.bitCount = 0
+	d.framePos, d.ones, d.fault = 0, 0, FrameError{}
+	d.erasing = false
+	d.dropping = false
+	d.open = &record{system: d.system, headerStart: d.headerStart, dataStart: d.at, header: d.header}
+	d.tracef("record opened after %d half-cycles of header tone", d.header)
+	if d.header > 0 {
+		d.open.pulse = d.headerTime / float64(d.header)
+	}
+	if d.header > 0 && d.toneCount > d.timing.MinHeader {
+		n := float64(d.toneCount / 2)
+		mean := d.toneTime / n
+		// Less the variance of rounding both crossings to whole samples
+		variance := d.toneSquares/n - mean*mean - 1/(6*d.rate*d.rate)
+		d.open.jitter = math.Sqrt(max(0, variance)) / mean
+		d.open.speed = d.timing.speedAt(mean / 2)
+	}
+	if d.onStart != nil {
+		d.onStart(d.open)
+	}
+}
+
+func (d *bitDecoder) firstHalf(p pulse) {
+	d.first = p
+	d.cellStart = d.at
+	d.state = stateSecondHalf
+}
+
+func (d *bitDecoder) secondHalf(p pulse) {
+	d.state = stateFirstHalf
+
+	if d.inDropout(d.cellStart, d.end) {
+		// Whatever the cell looks like it is noise, including an apparent
+		// header tone, so drop it and remember where the gap began
+		if !d.dropping {
+			d.dropping = true
+			d.dropStart = d.cellStart
+		}
+		return
+	}
+	if d.dropping {
+		d.fillDropout()
+	}
+
+	c := d.timing.Cells[d.first][p]
+	if c != cellEnd {
+		d.open.cells++
+	}
+	switch c {
+	case cellZero, cellOne:
+		d.averageCell += (float64(d.end-d.cellStart) - d.averageCell) / 16
+		d.shiftBit(c == cellOne)
+	case cellEnd:
+		d.closeRecord(d.at)
+		d.state = stateHeader
+		d.header = 0
+	case cellError:
+		// Mismatched halves; drop the cell and keep going
+		d.tracef("cell %s then %s, dropped", d.first, p)
+		d.open.cellErrors++
+		d.totalErrors++
+	}
+}
+
+// fillDropout stands in for the bit cells lost in a dropout, estimating
+// their number from the average cell length so that the bytes after it
+// stay aligned. Every byte the estimate touches is erased.
+func (d *bitDecoder) fillDropout() {
+	d.dropping = false
+	if d.averageCell == 0 {
+		return
+	}
+	lost := int(float64(d.cellStart-d.dropStart)/d.averageCell + 0.5)
+	d.tracef("dropout, standing in %d bits", lost)
+	for range lost {
+		d.erasing = true
+		d.shiftBit(false)
+	}
+	d.erasing = d.bitCount > 0
+}
+
+func (d *bitDecoder) shiftBit(one bool) {
+	bit := byte(0)
+	if one {
+		bit = 1
+	}
+	d.tracef("bit %d", bit)
+	f := d.system.framing
+	switch f.part(d.framePos) {
+	case partStart:
+		if one {
+			// The line idling between bytes
+			return
+		}
+	case partData:
+		d.current = d.current<<1 | bit
+		d.bitCount++
+		d.ones += int(bit)
+	case partParity:
+		d.fault.Parity = one != f.parityBit(d.ones)
+	case partStop:
+		d.fault.Stop = !one
+	}
+	d.framePos++
+	if d.framePos < int(f.bits()) && !d.fault.Stop {
+		return
+	}
+	d.addFramed(f.value(d.current), d.fault)
+	d.current = 0
+	d.bitCount = 0
+	d.framePos, d.ones = 0, 0
+	if d.fault.Stop {
+		// No stop bit; take this as the next start bit
+		d.framePos = 1
+	}
+	d.fault = FrameError{}
+}
+
+// addFramed appends a byte whose framing bits were as fault says,
+// marking it if any were wrong
+func (d *bitDecoder) addFramed(b byte, fault FrameError) {
+	if fault.Parity || fault.Stop {
+		d.tracef("  framing bits wrong: bad parity %t, missing stop bit %t", fault.Parity, fault.Stop)
+		fault.Offset = len(d.open.data)
+		d.open.frameErrors = append(d.open.frameErrors, fault)
+		d.open.cellErrors++
+		d.totalErrors++
+	}
+	d.addByte(b)
+}
+
+// addByte appends a whole byte to the open record, or a zero in its place
+// if it overlapped a dropout
+func (d *bitDecoder) addByte(b byte) {
+	d.tracef("byte %d = 0x%02X", len(d.open.data), b)
+	if d.erasing {
+		d.tracef("  erased, overlapping a dropout")
+		d.open.erased = append(d.open.erased, len(d.open.data))
+		b = 0
+		d.erasing = false
+	}
+	d.open.data = append(d.open.data, b)
+	d.totalBytes++
+}
+
+// followSpeed moves the speed estimate toward what a pulse of class p,
+// measured at the current estimate, implies. Only an established header
+// tone or data moves it; noise between records would drag it away.
+func (d *bitDecoder) followSpeed(p pulse, seconds float64) {
+	if d.state == stateHeader && d.header <= d.timing.MinHeader {
+		return
+	}
+	nominal := d.timing.Nominal[p]
+	if nominal == 0 {
+		return
+	}
+	ratio := seconds / nominal
+	if ratio < 1-speedOutlier || ratio > 1+speedOutlier {
+		return
+	}
+	d.speed *= 1 + (ratio-1)*SpeedGain
+	d.speed = min(max(d.speed, 1-MaxSpeedDrift), 1+MaxSpeedDrift)
+}
+
+// inDropout reports whether [start, end) overlaps a known dropout. Calls
+// must come in time order.
+func (d *bitDecoder) inDropout(start, end int) bool {
+	for d.nextDropout < len(d.dropouts) && d.dropouts[d.nextDropout][1] <= start {
+		d.nextDropout++
+	}
+	return d.nextDropout < len(d.dropouts) && d.dropouts[d.nextDropout][0] < end
+}
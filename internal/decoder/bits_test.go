@@ -0,0 +1,152 @@
+package decoder
+
+import (
+	"bytes"
+	"slices"
+	"testing"
+)
+
+// appleHalves builds Apple ][ half-cycles by hand: header half-cycles of
+// header tone, the sync bit if sync is set, then each byte's bits, most
+// significant first, and a trailer of header tone that ends the record
+func appleHalves(header int, sync bool, data ...byte) []float64 {
+	var h []float64
+	for range header {
+		h = append(h, AppleII.HeaderTone)
+	}
+	if sync {
+		h = append(h, AppleII.Sync...)
+	}
+	for _, b := range data {
+		for i := 7; i >= 0; i-- {
+			p := AppleII.Nominal[pulseShort]
+			if b>>i&1 == 1 {
+				p = AppleII.Nominal[pulseLong]
+			}
+			h = append(h, p, p)
+		}
+	}
+	for range appleTrailer {
+		h = append(h, AppleII.HeaderTone)
+	}
+	return h
+}
+
+// cellAt returns the index in halves built by appleHalves of the first
+// half of bit (from 0, most significant first) of byte n
+func cellAt(header, n, bit int) int {
+	return header + len(AppleII.Sync) + 2*(8*n+bit)
+}
+
+func TestAppleIIStateMachine(t *testing.T) {
+	const header = 100
+	short := AppleII.Nominal[pulseShort]
+	clean := appleHalves(header, true, 0x5A, 0xA5)
+
+	// A 1 bit whose second half came out short: the cell is dropped, every
+	// bit after moves up one, and the last byte is left a bit short
+	shortCell := slices.Clone(clean)
+	shortCell[cellAt(header, 0, 1)+1] = short
+
+	// A half-cycle of header tone mid-record ends it there
+	longCell := slices.Clone(clean)
+	longCell[cellAt(header, 1, 0)] = AppleII.HeaderTone
+
+	// Without the sync bit the first 1 bit, which cannot be one, leaves
+	// the decoder hunting for a header tone it never hears again
+	noSync := appleHalves(header, false, 0xFF, 0x00)
+
+	// The trailer cut off a byte partway through
+	tail := appleHalves(header, true, 0x5A, 0xA5)
+	tail = append(tail[:cellAt(header, 1, 4)], tail[len(tail)-appleTrailer:]...)
+
+	tests := []struct {
+		name   string
+		halves []float64
+		want   [][]byte
+		ok     []bool
+		errors int
+	}{
+		{"clean", clean, [][]byte{{0x5A, 0xA5}}, []bool{true}, 0},
+		{"short cell", shortCell, [][]byte{{0x35}}, []bool{false}, 1},
+		{"long cell", longCell, [][]byte{{0x5A}}, []bool{false}, 0},
+		{"missing sync", noSync, nil, nil, 0},
+		{"short header", appleHalves(AppleII.MinHeader/2, true, 0x5A, 0xA5), nil, nil, 0},
+		{"tail", tail, [][]byte{{0x5A}}, []bool{false}, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			records, errors := DecodeHalfCycles(tt.halves, Options{System: &appleIISystem})
+			if len(records) != len(tt.want) {
+				t.Fatalf("got %d records, want %d", len(records), len(tt.want))
+			}
+			for i, r := range records {
+				if !bytes.Equal(r.Data, tt.want[i]) {
+					t.Errorf("record %d holds % X, want % X", i+1, r.Data, tt.want[i])
+				}
+				if r.ChecksumOK != tt.ok[i] {
+					t.Errorf("record %d checksum OK %v, want %v", i+1, r.ChecksumOK, tt.ok[i])
+				}
+			}
+			if errors != tt.errors {
+				t.Errorf("got %d cell errors, want %d", errors, tt.errors)
+			}
+		})
+	}
+}
+
+// serialHalves builds the half-cycles of bytes sent 8N1 over FSK as s
+// sets it out, phase-continuous as a modem sends them, with idle line
+// before; stop set false drops the last byte's stop bit, the carrier
+// ending where it would have been
+func serialHalves(s Serial, stop bool, data ...byte) []float64 {
+	var bits []bool
+	for range 20 {
+		bits = append(bits, true)
+	}
+	for i, b := range data {
+		bits = append(bits, false)
+		for j := range 8 {
+			bits = append(bits, b>>j&1 == 1)
+		}
+		if stop || i < len(data)-1 {
+			bits = append(bits, true)
+		}
+	}
+	var h []float64
+	bit, clock := 1/s.Baud, 0.0
+	for i, mark := range bits {
+		tone := s.Space
+		if mark {
+			tone = s.Mark
+		}
+		for end := float64(i+1) * bit; clock < end; {
+			h = append(h, 1/(2*tone))
+			clock += 1 / (2 * tone)
+		}
+	}
+	return h
+}
+
+func TestSerialStateMachine(t *testing.T) {
+	tests := []struct {
+		name string
+		stop bool
+		want []byte
+		ok   bool
+	}{
+		{"clean", true, []byte("HELLO"), true},
+		{"tail with no stop bit", false, []byte("HELLO"), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			records, _ := DecodeHalfCycles(serialHalves(Bell103, tt.stop, []byte("HELLO")...), Options{System: uartSystem})
+			if len(records) != 1 {
+				t.Fatalf("got %d records, want 1", len(records))
+			}
+			if r := records[0]; !bytes.Equal(r.Data, tt.want) || r.ChecksumOK != tt.ok {
+				t.Errorf("got %q, checksum OK %v; want %q, %v", r.Data, r.ChecksumOK, tt.want, tt.ok)
+			}
+		})
+	}
+}
@@ -0,0 +1,284 @@
+package decoder
+
+import (
+	"bytes"
+	"cmp"
+	"math"
+	"slices"
+)
+
+// RegionKind says what a stretch of tape contains
+type RegionKind int
+
+const (
+	RegionSilence RegionKind = iota
+	RegionHeader
+	RegionData
+	RegionDropout
+)
+
+func (k RegionKind) String() string {
+	switch k {
+	case RegionSilence:
+		return "silence"
+	case RegionHeader:
+		return "header tone"
+	case RegionData:
+		return "program"
+	case RegionDropout:
+		return "dropout"
+	}
+	return "unknown"
+}
+
+// Region is one stretch of the tape
+type Region struct {
+	Kind  RegionKind
+	Start float64 // seconds from the start of the capture
+	End   float64
+
+	// Program is the 1-based program a header tone or data region
+	// belongs to, in tape order, and Name what whoever archived the
+	// tape called it, if they said
+	Program int
+	Name    string
+
+	// Data regions only
+	Bytes      int          // payload bytes, not counting the checksum byte
+	ChecksumOK bool         // for systems without checksums, every byte was framed cleanly
+	Verified   Verification // the checksum read and computed, if the system's is one of Checksums
+	Confidence float64      // fraction of bit cells that decoded cleanly
+	BitErrors  int          // bit cells that did not
+	Erasures   int          // bytes zeroed because they overlapped a dropout
+	Misframed  []FrameError // bytes whose start, parity or stop bits were wrong
+	Disputes   []Dispute
+	Note       string  // what the system makes of the record, if anything
+	Retry      string  // options that read the record when those given did not, as flags
+	Speed      float64 // playback speed relative to nominal from the header tone, 0 if unknown
+	Jitter     float64 // spread of the header tone's cycle lengths relative to their mean
+
+	// What the record holds and where it loads, as its Record gives them;
+	// LoadAddress is -1 if unknown
+	Type        string
+	LoadAddress int
+
+	// Offset is where a data region's bytes begin in the decoded file, or
+	// -1 if the file does not hold them as the tape did
+	Offset int
+}
+
+// Catalog lists everything found on a tape in time order
+type Catalog struct {
+	SampleRate    uint32
+	Channels      int
+	BitsPerSample int
+	Duration      float64 // seconds
+	Clipped       float64 // fraction of the signal's samples flattened by clipping
+	SNR           float64 // dB; header tone against the noise between records, 0 if unknown
+	Eye           *Eye    // how close the records' half-cycles came to the thresholds, if any were read
+
+	Regions  []Region
+	Programs int
+
+	// Interrupted is set if the decode stopped early, its Context done,
+	// StoppedAt seconds into the capture; nothing after was decoded
+	Interrupted bool
+	StoppedAt   float64
+}
+
+// MinCatalogSilence is the shortest quiet stretch listed in a catalog
+const MinCatalogSilence = 0.25 // seconds
+
+// Noise measurement. The capture is cut into windows, and the noise is
+// the power of the window this far up from the quietest.
+const (
+	NoiseWindow     = 0.01 // seconds
+	NoisePercentile = 0.05
+)
+
+// buildCatalog lists what was found in samples, which run at sampleRate;
+// the header describes the capture as recorded
+func buildCatalog(samples []float64, sampleRate uint32, header WavHeader, records []record, dropouts [][2]int) *Catalog {
+	rate := float64(sampleRate)
+	c := &Catalog{
+		SampleRate:    header.SampleRate,
+		Channels:      int(header.NumChannels),
+		BitsPerSample: int(header.BitsPerSample),
+		Duration:      float64(len(samples)) / rate,
+	}
+
+	for _, s := range findSilences(samples, int(MinCatalogSilence*rate)) {
+		c.Regions = append(c.Regions, Region{
+			Kind:  RegionSilence,
+			Start: float64(s[0]) / rate,
+			End:   float64(s[1]) / rate,
+		})
+	}
+
+	for i, r := range records {
+		// Systems whose records start straight after silence have none
+		if r.dataStart > r.headerStart {
+			c.Regions = append(c.Regions, Region{
+				Kind:    RegionHeader,
+				Start:   float64(r.headerStart) / rate,
+				End:     float64(r.dataStart) / rate,
+				Program: i + 1,
+			})
+		}
+		c.Regions = append(c.Regions, Region{
+			Kind:       RegionData,
+			Start:      float64(r.dataStart) / rate,
+			End:        float64(r.end) / rate,
+			Program:    i + 1,
+			Bytes:      r.payload(),
+			ChecksumOK: r.checksumOK(),
+			Verified:   r.verify(),
+			Confidence: r.confidence(),
+			BitErrors:  r.cellErrors,
+			Erasures:   len(r.erased),
+			Misframed:  r.frameErrors,
+			Disputes:   r.disputes,
+			Retry:      r.retry,
+			Speed:      r.speed,
+			Jitter:     r.jitter,
+			Offset:     -1,
+		})
+	}
+	c.Programs = len(records)
+
+	// Dropouts sit inside the program they damaged
+	program := 0
+	for _, d := range dropouts {
+		for program < len(records) && records[program].end <= d[0] {
+			program++
+		}
+		r := Region{
+			Kind:  RegionDropout,
+			Start: float64(d[0]) / rate,
+			End:   float64(d[1]) / rate,
+		}
+		if program < len(records) && records[program].headerStart <= d[0] {
+			r.Program = program + 1
+		}
+		c.Regions = append(c.Regions, r)
+	}
+
+	slices.SortStableFunc(c.Regions, func(a, b Region) int {
+		return cmp.Compare(a.Start, b.Start)
+	})
+	c.SNR = signalToNoise(samples, rate, c.Regions)
+	return c
+}
+
+// signalToNoise compares the power of the header tones with that of the
+// noise, in dB. The noise is measured where the capture is quietest,
+// which is between records whether or not hiss fills the gaps. Noise
+// below the step of 16-bit audio counts as one step.
+func signalToNoise(samples []float64, rate float64, regions []Region) float64 {
+	signal, n := 0.0, 0
+	for _, r := range regions {
+		if r.Kind != RegionHeader {
+			continue
+		}
+		for _, s := range samples[int(r.Start*rate):min(len(samples), int(r.End*rate))] {
+			signal += s * s
+			n++
+		}
+	}
+	size := max(1, int(NoiseWindow*rate))
+	var windows []float64
+	for at := 0; at+size <= len(samples); at += size {
+		power := 0.0
+		for _, s := range samples[at : at+size] {
+			power += s * s
+		}
+		windows = append(windows, power/float64(size))
+	}
+	if n == 0 || len(windows) == 0 {
+		return 0
+	}
+	slices.Sort(windows)
+	noise := max(windows[int(NoisePercentile*float64(len(windows)-1))], 1.0/(32768*32768))
+	signal = signal/float64(n) - noise
+	if signal <= noise {
+		// No quiet stretch to tell the noise by
+		return 0
+	}
+	return 10 * math.Log10(signal/noise)
+}
+
+// describe sets the note on program n's data region
+func (c *Catalog) describe(n int, note string) {
+	for i := range c.Regions {
+		if c.Regions[i].Kind == RegionData && c.Regions[i].Program == n {
+			c.Regions[i].Note = note
+		}
+	}
+}
+
+// identify copies what each record holds and where it loads to its data
+// region
+func (c *Catalog) identify(records []Record) {
+	for i := range c.Regions {
+		r := &c.Regions[i]
+		if r.Kind != RegionData {
+			continue
+		}
+		r.LoadAddress = -1
+		if r.Program > 0 && r.Program <= len(records) {
+			r.Type = records[r.Program-1].Type
+			r.LoadAddress = records[r.Program-1].LoadAddress
+		}
+	}
+}
+
+// locate finds where each record's bytes, less any checksum, went in the
+// decoded file. Formats that keep records as they are hold them in tape
+// order, each after the last.
+func (c *Catalog) locate(file []byte, records []record) {
+	at := 0
+	for i, r := range records {
+		body := r.data[:r.payload()]
+		if len(body) == 0 {
+			continue
+		}
+		n := bytes.Index(file[at:], body)
+		if n < 0 {
+			continue
+		}
+		for j := range c.Regions {
+			if c.Regions[j].Kind == RegionData && c.Regions[j].Program == i+1 {
+				c.Regions[j].Offset = at + n
+			}
+		}
+		at += n + len(body)
+	}
+}
+
+// TimeAt returns when the byte at offset in the decoded file passed the
+// tape head, in seconds, if it came from a record the file holds as it is
+func (c *Catalog) TimeAt(offset int) (float64, bool) {
+	for _, r := range c.Regions {
+		if r.Kind != RegionData || r.Offset < 0 || offset < r.Offset || offset >= r.Offset+r.Bytes {
+			continue
+		}
+		return r.Start + (r.End-r.Start)*float64(offset-r.Offset)/float64(r.Bytes), true
+	}
+	return 0, false
+}
+
+// ProgramSpan returns the start of program n's header tone and the end of
+// its data, in seconds
+func (c *Catalog) ProgramSpan(n int) (start, end float64, ok bool) {
+	for _, r := range c.Regions {
+		if r.Program != n {
+			continue
+		}
+		if !ok || r.Start < start {
+			start = r.Start
+		}
+		end = max(end, r.End)
+		ok = true
+	}
+	return start, end, ok
+}
@@ -0,0 +1,300 @@
+package decoder
+
+import "math"
+
+// Cell-by-cell demodulation. Instead of timing every zero crossing, these
+// engines decide each bit cell by which data tone it matches best and
+// keep in step with the tape from how far the match is shifted. Noise
+// that adds or hides crossings barely moves the match, so they cope with
+// recordings the crossing engine cannot. Only the sync bit is found from
+// crossings, once per record.
+const (
+	GoertzelHop    = 0.0005 // seconds between tone decisions between records
+	GoertzelWindow = 0.004  // seconds; window telling the header tone from data
+	CellTracking   = 0.5    // fraction of each cell's timing error corrected
+	SyncHysteresis = 0.3    // fraction of the header tone's amplitude a crossing must swing
+)
+
+// cellDetector measures how well one full cycle of a tone fits the
+// samples starting at a bit cell
+type cellDetector interface {
+	// match returns the amplitude of a cycle of n samples at omega
+	// radians per sample starting at offset at, and how many samples
+	// late the cycle actually starts. samples returns the audio from an
+	// absolute offset; a quarter cycle either side of the cell is
+	// available.
+	match(samples func(at, n int) []float64, at, n int, omega float64) (amplitude, drift float64)
+}
+
+// tone is the dominant signal between records
+type tone int
+
+const (
+	toneSilence tone = iota
+	toneHeader
+	toneOther // data the engine did not sync to
+)
+
+type cellDemod struct {
+	timing   *Timing
+	detector cellDetector
+	omega    [numPulses]float64 // radians per sample of each pulse class's tone
+	cycle    [numPulses]int     // samples in one full cycle of each tone
+	short    int                // Timing.Short in samples
+	long     int                // Timing.Long in samples
+	rate     float64
+	hop      int
+	window   int
+
+	buf  []float64 // samples from base onwards
+	base int
+	last int // end of the last half-cycle reported, -1 before the first
+
+	// Between records, at is the center of the next tone decision and
+	// runStart where the current tone began. In a record, at is the start
+	// of the next bit cell.
+	data     bool
+	at       int
+	tone     tone
+	runStart int
+
+	headerLevel float64 // amplitude of the last header tone heard
+
+	// With trackSpeed, cells are measured against speed, the running
+	// estimate of playback speed relative to nominal
+	trackSpeed bool
+	speed      float64
+}
+
+func newCellDemod(t *Timing, sampleRate uint32, detector cellDetector, trackSpeed bool) *cellDemod {
+	rate := float64(sampleRate)
+	c := &cellDemod{
+		timing:   t,
+		detector: detector,
+		short:    int(t.Short * rate),
+		long:     int(t.Long * rate),
+		rate:     rate,
+		hop:      max(1, int(GoertzelHop*rate)),
+		window:   max(2, int(GoertzelWindow*rate)),
+		last:     -1,
+
+		trackSpeed: trackSpeed,
+		speed:      1,
+	}
+	for p, nominal := range t.Nominal {
+		if nominal > 0 {
+			c.omega[p] = math.Pi / (nominal * rate)
+			c.cycle[p] = max(2, int(math.Round(2*nominal*rate)))
+		}
+	}
+	c.at = c.window / 2
+	return c
+}
+
+func (c *cellDemod) feed(window []float64, sink bitSink) {
+	c.buf = append(c.buf, window...)
+	for c.step(sink) {
+	}
+	// Keep enough history to search back for a sync bit
+	keep := c.at - 2*c.window
+	if !c.data {
+		keep = min(keep, c.runStart)
+	}
+	if keep -= c.base; keep > 0 {
+		c.buf = append(c.buf[:0], c.buf[keep:]...)
+		c.base += keep
+	}
+}
+
+func (c *cellDemod) emit(sink bitSink, at, length int) {
+	c.last = at + length
+	sink.halfCycle(at, length)
+}
+
+// samples returns n samples starting at absolute offset at
+func (c *cellDemod) samples(at, n int) []float64 {
+	return c.buf[at-c.base : at-c.base+n]
+}
+
+// step makes one decision, or reports false if it needs more samples
+func (c *cellDemod) step(sink bitSink) bool {
+	if c.at+c.window > c.base+len(c.buf) {
+		return false
+	}
+	if c.data {
+		c.decideCell(sink)
+	} else {
+		c.decideTone(sink)
+	}
+	return true
+}
+
+// decideTone classifies the window around at while looking for a record
+func (c *cellDemod) decideTone(sink bitSink) {
+	x := c.samples(c.at-c.window/2, c.window)
+	header := level(x, c.omega[pulseHeader])
+	low := level(x, c.omega[pulseLong])
+	high := level(x, c.omega[pulseShort])
+
+	t := toneOther
+	switch {
+	case max(header, low, high) < SilenceLevel:
+		t = toneSilence
+	case header > low && header > high:
+		t = toneHeader
+		c.headerLevel = header
+	}
+	if t != c.tone {
+		// Only a header tone long enough to precede a record can end in a
+		// sync bit
+		minHeader := c.timing.MinHeader * c.cycle[pulseHeader] / 2
+		if c.tone == toneHeader && c.at-c.runStart > minHeader {
+			if edges := c.findSync(c.at-c.window, c.at+c.window); edges != nil {
+				c.emitRun(sink, edges[0])
+				for i := 1; i < len(edges); i++ {
+					c.emit(sink, edges[i-1], edges[i]-edges[i-1])
+				}
+				c.data = true
+				c.at = edges[len(edges)-1]
+				return
+			}
+		}
+		c.emitRun(sink, c.at)
+		c.tone = t
+	}
+	c.at += c.hop
+}
+
+// emitRun reports the current tone from runStart up to end. Header tone
+// becomes header half-cycles; a silence long enough to end a record
+// becomes one long half-cycle.
+func (c *cellDemod) emitRun(sink bitSink, end int) {
+	length := end - c.runStart
+	switch c.tone {
+	case toneHeader:
+		half := c.cycle[pulseHeader] / 2
+		for n := length / half; n > 0; n-- {
+			c.emit(sink, end-n*half, half)
+		}
+	case toneSilence:
+		if length >= c.long {
+			c.emit(sink, c.runStart, length)
+		}
+	}
+	c.runStart = end
+}
+
+// findSync looks between from and to for a half-cycle that is not short
+// followed by the sync bit's half-cycles, returning the crossings that
+// bound them: where the sync bit starts, where each later half starts and
+// where the first data cell starts. Crossings only count once the signal
+// swings well past zero, so noise riding on the tone does not add
+// spurious ones.
+func (c *cellDemod) findSync(from, to int) []int {
+	from = max(from, c.base+1, c.runStart)
+	to = min(to, c.base+len(c.buf))
+	threshold := c.headerLevel * SyncHysteresis
+
+	var crossings []int
+	positive := c.buf[from-1-c.base] >= 0
+	zero := from
+	for at := from; at < to; at++ {
+		v := c.buf[at-c.base]
+		if (c.buf[at-1-c.base] < 0) != (v < 0) {
+			zero = at
+		}
+		if positive && v < -threshold || !positive && v > threshold {
+			positive = !positive
+			crossings = append(crossings, zero)
+		}
+	}
+	halves := len(c.timing.Sync)
+	for i := 1; i+halves < len(crossings); i++ {
+		if crossings[i]-crossings[i-1] < c.short {
+			continue
+		}
+		ok := true
+		for k := range halves {
+			seconds := float64(crossings[i+k+1]-crossings[i+k]) / c.rate / c.speed
+			ok = ok && c.timing.isSync(k, seconds)
+		}
+		if ok {
+			return crossings[i : i+halves+1]
+		}
+	}
+	return nil
+}
+
+// decideCell decides the bit cell starting at at by which data tone fits
+// it best, or ends the record when the header tone or silence takes over
+func (c *cellDemod) decideCell(sink bitSink) {
+	n0, omega0 := c.scaled(pulseShort)
+	n1, omega1 := c.scaled(pulseLong)
+	nh, omegah := c.scaled(pulseHeader)
+
+	// A cell that sounds more like header tone than data, or like nothing,
+	// may be the end of the record
+	header := level(c.samples(c.at, nh), omegah)
+	bits := max(level(c.samples(c.at, n0), omega0), level(c.samples(c.at, n1), omega1))
+	if max(header, bits) < SilenceLevel || header > bits {
+		if t, over := c.recordOver(); over {
+			// Look for the next record from here
+			c.data = false
+			c.tone = t
+			c.runStart = c.at
+			c.at += c.window / 2
+			return
+		}
+	}
+
+	a0, drift0 := c.detector.match(c.samples, c.at, n0, omega0)
+	a1, drift1 := c.detector.match(c.samples, c.at, n1, omega1)
+
+	n, drift := n0, drift0
+	if a1 > a0 {
+		n, drift = n1, drift1
+	}
+	if c.trackSpeed {
+		c.speed *= 1 + drift/float64(n)*SpeedGain
+		c.speed = min(max(c.speed, 1-MaxSpeedDrift), 1+MaxSpeedDrift)
+	}
+	next := c.at + n + int(math.Round(drift*CellTracking))
+	c.emit(sink, c.at, n/2)
+	c.emit(sink, c.at+n/2, next-c.at-n/2)
+	c.at = next
+}
+
+// scaled returns the cycle length and frequency of pulse class p's tone
+// at the current speed
+func (c *cellDemod) scaled(p pulse) (int, float64) {
+	if c.speed == 1 {
+		return c.cycle[p], c.omega[p]
+	}
+	return int(math.Round(float64(c.cycle[p]) * c.speed)), c.omega[p] / c.speed
+}
+
+// recordOver confirms that the header tone or silence has taken over from
+// the data at at, and says which. The window is several cells long so
+// that a dropout or burst of noise does not end a record early.
+func (c *cellDemod) recordOver() (tone, bool) {
+	x := c.samples(c.at, c.window)
+	header := level(x, c.omega[pulseHeader])
+	low := level(x, c.omega[pulseLong])
+	high := level(x, c.omega[pulseShort])
+	switch {
+	case max(header, low, high) < SilenceLevel:
+		return toneSilence, true
+	case header > max(low, high):
+		return toneHeader, true
+	}
+	return toneOther, false
+}
+
+func (c *cellDemod) flush(sink bitSink) {
+	if !c.data {
+		c.emitRun(sink, c.base+len(c.buf))
+	}
+	if c.last >= 0 {
+		sink.finish(c.last)
+	}
+}
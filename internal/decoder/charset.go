@@ -0,0 +1,192 @@
+package decoder
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// Charset maps the character codes of a computer to Unicode text, so that
+// text saved on it reads on a modern one. Codes for keywords read as the
+// keyword, block graphics as their nearest Unicode block, other graphics
+// as a shaded block, and control codes as nothing.
+type Charset struct {
+	Name  string
+	chars [256]string
+}
+
+// charsetGraphic stands in for graphics characters Unicode has no match for
+const charsetGraphic = "▒"
+
+// Charsets names every character set text can be converted from
+var Charsets = map[string]*Charset{
+	"ascii":      asciiCharset(),
+	"atascii":    atasciiCharset(),
+	"petscii":    petsciiCharset(),
+	"zxspectrum": spectrumCharset(),
+	"zx81":       zx81Charset(),
+}
+
+// Decode converts data to text. Lines end with LF, whatever ended them
+// on the tape.
+func (c *Charset) Decode(data []byte) string {
+	var s strings.Builder
+	for _, b := range data {
+		s.WriteString(c.chars[b])
+	}
+	// Only ASCII has CR and LF both
+	return strings.ReplaceAll(strings.ReplaceAll(s.String(), "\r\n", "\n"), "\r", "\n")
+}
+
+// asciiCharset reads ASCII with or without the high bit the Apple ][
+// sets, dropping the zero bytes and end of file marks that pad out text
+func asciiCharset() *Charset {
+	c := &Charset{Name: "ascii"}
+	for b := range 256 {
+		switch r := b & 0x7F; {
+		case r >= 0x20 && r < 0x7F, r == '\r', r == '\n', r == '\t':
+			c.chars[b] = string(rune(r))
+		}
+	}
+	return c
+}
+
+// petsciiCharset reads Commodore PETSCII as the C64 shows it on power up,
+// in capitals and graphics
+func petsciiCharset() *Charset {
+	c := &Charset{Name: "petscii"}
+	for b := 0x20; b < 0x5B; b++ {
+		c.chars[b] = string(rune(b))
+	}
+	c.chars[0x0D] = "\n"
+	c.chars[0x8D] = "\n"
+	c.chars[0x5B], c.chars[0x5C], c.chars[0x5D], c.chars[0x5E], c.chars[0x5F] = "[", "£", "]", "↑", "←"
+	for b := 0x60; b < 0x80; b++ {
+		c.chars[b] = charsetGraphic
+	}
+	graphics := map[int]string{
+		0x60: "─", 0x61: "♠", 0x62: "│", 0x63: "─", 0x6B: "╮", 0x6C: "╰", 0x6D: "╯",
+		0x71: "●", 0x73: "♥", 0x75: "╭", 0x76: "╳", 0x77: "○", 0x78: "♣", 0x7A: "♦",
+		0x7B: "┼", 0x7D: "│", 0x7E: "π", 0x7F: "◥",
+	}
+	for b, s := range graphics {
+		c.chars[b] = s
+	}
+	// The same graphics again, and more
+	for b := 0xA0; b < 0xC0; b++ {
+		c.chars[b] = charsetGraphic
+	}
+	c.chars[0xA0] = " "
+	for b := 0xC0; b < 0xE0; b++ {
+		c.chars[b] = c.chars[b-0x60]
+	}
+	for b := 0xE0; b < 0x100; b++ {
+		c.chars[b] = c.chars[b-0x40]
+	}
+	c.chars[0xFF] = "π"
+	return c
+}
+
+// atasciiCharset reads the Atari 8-bit computers' ATASCII, in which codes
+// with the high bit set are the same characters in inverse video
+func atasciiCharset() *Charset {
+	c := &Charset{Name: "atascii"}
+	for b := range 0x80 {
+		switch {
+		case b < 0x20:
+			c.chars[b] = charsetGraphic
+		case b < 0x7B:
+			c.chars[b] = string(rune(b))
+		default:
+			c.chars[b] = ""
+		}
+	}
+	graphics := map[int]string{
+		0x00: "♥", 0x01: "┣", 0x02: "┃", 0x03: "┛", 0x04: "┫", 0x05: "┓", 0x06: "╱", 0x07: "╲",
+		0x08: "◢", 0x09: "▗", 0x0A: "◣", 0x0B: "▝", 0x0C: "▘", 0x0D: "▔", 0x0E: "▁", 0x0F: "▖",
+		0x10: "♣", 0x11: "┏", 0x12: "━", 0x13: "╋", 0x14: "●", 0x15: "▄", 0x16: "▎", 0x17: "┳",
+		0x18: "┻", 0x19: "▌", 0x1A: "┗", 0x60: "♦", 0x7B: "♠", 0x7C: "|",
+	}
+	for b, s := range graphics {
+		c.chars[b] = s
+	}
+	for b := 0x80; b < 0x100; b++ {
+		c.chars[b] = c.chars[b-0x80]
+	}
+	c.chars[0x9B] = "\n"
+	return c
+}
+
+// zxQuadrants are the block graphics of the Sinclair machines, by the
+// quadrants they fill: bit 0 top right, 1 top left, 2 bottom right and 3
+// bottom left
+var zxQuadrants = []string{" ", "▝", "▘", "▀", "▗", "▐", "▚", "▜", "▖", "▞", "▌", "▛", "▄", "▟", "▙", "█"}
+
+// spectrumKeywords are the ZX Spectrum's keyword codes from 0xA5
+var spectrumKeywords = []string{
+	"RND", "INKEY$", "PI", "FN", "POINT", "SCREEN$", "ATTR", "AT", "TAB", "VAL$", "CODE",
+	"VAL", "LEN", "SIN", "COS", "TAN", "ASN", "ACS", "ATN", "LN", "EXP", "INT", "SQR", "SGN",
+	"ABS", "PEEK", "IN", "USR", "STR$", "CHR$", "NOT", "BIN", "OR", "AND", "<=", ">=", "<>",
+	"LINE", "THEN", "TO", "STEP", "DEF FN", "CAT", "FORMAT", "MOVE", "ERASE", "OPEN #",
+	"CLOSE #", "MERGE", "VERIFY", "BEEP", "CIRCLE", "INK", "PAPER", "FLASH", "BRIGHT",
+	"INVERSE", "OVER", "OUT", "LPRINT", "LLIST", "STOP", "READ", "DATA", "RESTORE", "NEW",
+	"BORDER", "CONTINUE", "DIM", "REM", "FOR", "GO TO", "GO SUB", "INPUT", "LOAD", "LIST",
+	"LET", "PAUSE", "NEXT", "POKE", "PRINT", "PLOT", "RUN", "SAVE", "RANDOMIZE", "IF", "CLS",
+	"DRAW", "CLEAR", "RETURN", "COPY",
+}
+
+// spectrumCharset reads the ZX Spectrum's character set, which is ASCII
+// but for a few symbols, then block graphics, user defined graphics,
+// shown as the letters they are typed with, and keywords
+func spectrumCharset() *Charset {
+	c := &Charset{Name: "zxspectrum"}
+	for b := 0x20; b < 0x80; b++ {
+		c.chars[b] = string(rune(b))
+	}
+	c.chars[0x0D] = "\n"
+	c.chars[0x5E], c.chars[0x60], c.chars[0x7F] = "↑", "£", "©"
+	for i, s := range zxQuadrants {
+		c.chars[0x80+i] = s
+	}
+	for b := 0x90; b < 0xA5; b++ {
+		c.chars[b] = string(rune('A' + b - 0x90))
+	}
+	for i, k := range spectrumKeywords {
+		c.chars[0xA5+i] = keyword(k)
+	}
+	return c
+}
+
+// zx81Keywords are the ZX81's keyword codes from 0xC0; 0xC3 is unused
+var zx81Keywords = []string{
+	`""`, "AT", "TAB", "?", "CODE", "VAL", "LEN", "SIN", "COS", "TAN", "ASN", "ACS", "ATN",
+	"LN", "EXP", "INT", "SQR", "SGN", "ABS", "PEEK", "USR", "STR$", "CHR$", "NOT", "**",
+	"OR", "AND", "<=", ">=", "<>", "THEN", "TO", "STEP", "LPRINT", "LLIST", "STOP", "SLOW",
+	"FAST", "NEW", "SCROLL", "CONT", "DIM", "REM", "FOR", "GOTO", "GOSUB", "INPUT", "LOAD",
+	"LIST", "LET", "PAUSE", "NEXT", "POKE", "PRINT", "PLOT", "RUN", "SAVE", "RAND", "IF",
+	"CLS", "UNPLOT", "CLEAR", "RETURN", "COPY",
+}
+
+// zx81Charset reads the ZX81's own character set, which has no lower case
+// and shows codes with the high bit set in inverse video
+func zx81Charset() *Charset {
+	c := &Charset{Name: "zx81"}
+	for b, r := range zx81Chars {
+		c.chars[b] = string(r)
+		c.chars[b|0x80] = string(r)
+	}
+	c.chars[0x40], c.chars[0x41], c.chars[0x42] = "RND", "INKEY$", "PI"
+	c.chars[0x76] = "\n"
+	for i, k := range zx81Keywords {
+		c.chars[0xC0+i] = keyword(k)
+	}
+	return c
+}
+
+// keyword spaces out a keyword the way listings show it, with a space
+// after any made of letters
+func keyword(k string) string {
+	if r, _ := utf8.DecodeLastRuneInString(k); r >= 'A' && r <= 'Z' || r == '$' || r == '#' {
+		return k + " "
+	}
+	return k
+}
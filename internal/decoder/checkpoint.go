@@ -0,0 +1,136 @@
+package decoder
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"sync"
+)
+
+// A checkpoint saves the records of each segment of a long capture as it
+// is decoded, so that a decode that is interrupted can resume with the
+// segments it had not finished. The capture is cut as Deterministic cuts
+// it, so the segments are the same on resuming whatever the Workers.
+type checkpoint struct {
+	System   string
+	Demod    Demod
+	Rate     uint32
+	Samples  int // after preprocessing
+	Bounds   [][2]int
+	Segments map[int]checkpointSegment // by index in Bounds
+
+	path string
+	mu   sync.Mutex
+}
+
+// checkpointSegment is a decoded segment, its positions from its start
+type checkpointSegment struct {
+	Records  []checkpointRecord
+	Dropouts [][2]int
+}
+
+// checkpointRecord is a record as a checkpoint saves it
+type checkpointRecord struct {
+	HeaderStart, DataStart, End int
+	Data                        []byte
+	Header                      int
+	Pulse, Speed, Jitter        float64
+	Eye                         []int
+	Cells, CellErrors           int
+	Erased                      []int
+	FrameErrors                 []FrameError
+	Unreadable                  int
+	Disputes                    []Dispute
+	Retry                       string
+}
+
+// openCheckpoint returns the checkpoint for decoding samples cut at
+// bounds. With resume, the segments saved at path are kept if they are
+// of the same capture decoded the same way.
+func openCheckpoint(path string, resume bool, samples int, rate uint32, bounds [][2]int, opts Options) (*checkpoint, error) {
+	c := &checkpoint{
+		System:   opts.system().Name,
+		Demod:    opts.Demod,
+		Rate:     rate,
+		Samples:  samples,
+		Bounds:   bounds,
+		Segments: map[int]checkpointSegment{},
+		path:     path,
+	}
+	if !resume {
+		return c, nil
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return c, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var saved checkpoint
+	if err := json.Unmarshal(data, &saved); err != nil {
+		return nil, fmt.Errorf("reading checkpoint %s: %w", path, err)
+	}
+	if saved.System != c.System || saved.Demod != c.Demod || saved.Rate != c.Rate || saved.Samples != c.Samples || !slices.Equal(saved.Bounds, c.Bounds) {
+		return nil, fmt.Errorf("checkpoint %s is of another capture, or one decoded differently", path)
+	}
+	c.Segments = saved.Segments
+	return c, nil
+}
+
+// done returns the records and dropouts of segment i if they were saved
+func (c *checkpoint) done(i int, system *System) ([]record, [][2]int, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	seg, ok := c.Segments[i]
+	if !ok {
+		return nil, nil, false
+	}
+	records := make([]record, len(seg.Records))
+	for j, r := range seg.Records {
+		records[j] = record{
+			system: system, headerStart: r.HeaderStart, dataStart: r.DataStart, end: r.End, data: r.Data,
+			header: r.Header, pulse: r.Pulse, speed: r.Speed, jitter: r.Jitter, eye: r.Eye,
+			cells: r.Cells, cellErrors: r.CellErrors, erased: r.Erased, unreadable: r.Unreadable, disputes: r.Disputes,
+			frameErrors: r.FrameErrors, retry: r.Retry,
+		}
+	}
+	return records, seg.Dropouts, true
+}
+
+// save adds the records and dropouts of segment i and writes the
+// checkpoint out, replacing the last one only once it is written
+func (c *checkpoint) save(i int, records []record, dropouts [][2]int) error {
+	seg := checkpointSegment{Dropouts: dropouts}
+	for _, r := range records {
+		seg.Records = append(seg.Records, checkpointRecord{
+			HeaderStart: r.headerStart, DataStart: r.dataStart, End: r.end, Data: r.data,
+			Header: r.header, Pulse: r.pulse, Speed: r.speed, Jitter: r.jitter, Eye: r.eye,
+			Cells: r.cells, CellErrors: r.cellErrors, Erased: r.erased, Unreadable: r.unreadable, Disputes: r.disputes,
+			FrameErrors: r.frameErrors, Retry: r.retry,
+		})
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.Segments[i] = seg
+	data, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+	tmp := c.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, c.path)
+}
+
+// remove deletes the checkpoint once the decode it was for is finished
+func (c *checkpoint) remove() error {
+	err := os.Remove(c.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
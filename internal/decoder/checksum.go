@@ -0,0 +1,153 @@
+package decoder
+
+import (
+	"fmt"
+	"hash/crc32"
+	"maps"
+	"slices"
+	"strings"
+)
+
+// Checksums that end a record, as many formats share them. A checksum
+// sums every byte of a record before it, from a seed, and a record
+// checks out when what it ends with is what the rest sums to.
+
+// Checksum is one algorithm and how a format applies it
+type Checksum struct {
+	Name      string
+	Size      int    // bytes it takes, 1, 2 or 4
+	Seed      uint32 // value the sum starts from
+	BigEndian bool   // stored high byte first
+	sum       func(seed uint32, data []byte) uint32
+}
+
+// Checksums are the algorithms records can be checked with, each with
+// its usual seed
+var Checksums = map[string]Checksum{
+	"xor":         {Name: "xor", Size: 1, sum: xorSum},
+	"sum8":        {Name: "sum8", Size: 1, sum: sum8},
+	"crc16-ccitt": {Name: "crc16-ccitt", Size: 2, Seed: 0xFFFF, BigEndian: true, sum: crc16CCITT},
+	"crc16-x25":   {Name: "crc16-x25", Size: 2, Seed: 0xFFFF, sum: crc16X25},
+	"crc32":       {Name: "crc32", Size: 4, Seed: 0xFFFFFFFF, sum: crc32IEEE},
+	"fletcher16":  {Name: "fletcher16", Size: 2, BigEndian: true, sum: fletcher16},
+}
+
+// ChecksumNames returns the names of the checksums, sorted and
+// comma-separated
+func ChecksumNames() string {
+	return strings.Join(slices.Sorted(maps.Keys(Checksums)), ", ")
+}
+
+// Sum returns the checksum of data, as the record would store it
+func (c Checksum) Sum(data []byte) []byte {
+	v := c.sum(c.Seed, data)
+	out := make([]byte, c.Size)
+	for i := range c.Size {
+		shift := 8 * i
+		if c.BigEndian {
+			shift = 8 * (c.Size - 1 - i)
+		}
+		out[i] = byte(v >> shift)
+	}
+	return out
+}
+
+// Verify checks a record that ends in the checksum
+func (c Checksum) Verify(data []byte) Verification {
+	v := Verification{Algorithm: c.Name}
+	if len(data) < c.Size {
+		return v
+	}
+	body := data[:len(data)-c.Size]
+	v.Read = data[len(body):]
+	v.Computed = c.Sum(body)
+	return v
+}
+
+// ok reports whether a record checks out, as a system's check
+func (c Checksum) ok(r *record) bool {
+	return c.Verify(r.data).OK()
+}
+
+// Verification is how a record's checksum checked out: what it ends with
+// and what the rest of it sums to
+type Verification struct {
+	Algorithm      string
+	Read, Computed []byte // nil if the record is too short to hold it
+}
+
+// OK reports whether the checksum matches
+func (v Verification) OK() bool {
+	return v.Read != nil && slices.Equal(v.Read, v.Computed)
+}
+
+func (v Verification) String() string {
+	if v.Read == nil {
+		return fmt.Sprintf("%s: too short for a checksum", v.Algorithm)
+	}
+	return fmt.Sprintf("%s: read %X, computed %X", v.Algorithm, v.Read, v.Computed)
+}
+
+func xorSum(seed uint32, data []byte) uint32 {
+	sum := byte(seed)
+	for _, b := range data {
+		sum ^= b
+	}
+	return uint32(sum)
+}
+
+func sum8(seed uint32, data []byte) uint32 {
+	sum := byte(seed)
+	for _, b := range data {
+		sum += b
+	}
+	return uint32(sum)
+}
+
+// crc16CCITT is CRC-16-CCITT as most formats compute it, MSB first
+func crc16CCITT(seed uint32, data []byte) uint32 {
+	crc := uint16(seed)
+	for _, b := range data {
+		crc ^= uint16(b) << 8
+		for range 8 {
+			if crc&0x8000 != 0 {
+				crc = crc<<1 ^ 0x1021
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+	return uint32(crc)
+}
+
+// crc16X25 is the CRC-16 of X.25 and HDLC, LSB first and inverted
+func crc16X25(seed uint32, data []byte) uint32 {
+	crc := uint16(seed)
+	for _, b := range data {
+		crc ^= uint16(b)
+		for range 8 {
+			if crc&1 != 0 {
+				crc = crc>>1 ^ 0x8408
+			} else {
+				crc >>= 1
+			}
+		}
+	}
+	return uint32(^crc)
+}
+
+// crc32IEEE is the CRC-32 of Ethernet and ZIP, from a register of seed
+func crc32IEEE(seed uint32, data []byte) uint32 {
+	return crc32.Update(^seed, crc32.IEEETable, data)
+}
+
+// fletcher16 is Fletcher's checksum of bytes, the running sum in the low
+// byte and the sum of sums in the high one
+func fletcher16(seed uint32, data []byte) uint32 {
+	a, b := seed&0xFF, seed>>8&0xFF
+	for _, v := range data {
+		a = (a + uint32(v)) % 255
+		b = (b + a) % 255
+	}
+	return b<<8 | a
+}
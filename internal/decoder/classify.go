@@ -0,0 +1,82 @@
+package decoder
+
+import "math"
+
+// Content classification. A record saved from memory that nothing else
+// identified is told apart by what its bytes look like: a shape table by
+// its index of offsets to shapes, each ending in a zero byte, and data by
+// its entropy, which is high for anything compressed or random and low
+// for tables and bitmaps, while machine code falls between.
+const (
+	ClassifyMinLength = 64  // bytes in the shortest record classified
+	DataMinEntropy    = 7.2 // bits per byte above which a record is data
+	DataMaxEntropy    = 2.5 // bits per byte below which a record is data
+)
+
+// classifyBinaries types the records nothing else identified by their
+// content
+func classifyBinaries(records []Record) {
+	for i := range records {
+		r := &records[i]
+		if r.Type != "" {
+			continue
+		}
+		body := r.Body()
+		switch {
+		case IsShapeTable(body):
+			r.Type = RecordShapeTable
+		case len(body) < ClassifyMinLength:
+		case Entropy(body) > DataMinEntropy, Entropy(body) < DataMaxEntropy:
+			r.Type = RecordData
+		default:
+			r.Type = RecordMachineCode
+		}
+	}
+}
+
+// Entropy returns the Shannon entropy of data in bits per byte, from 0
+// for a run of one byte to 8 for bytes evenly spread
+func Entropy(data []byte) float64 {
+	var counts [256]int
+	for _, b := range data {
+		counts[b]++
+	}
+	h := 0.0
+	for _, n := range counts {
+		if n > 0 {
+			p := float64(n) / float64(len(data))
+			h -= p * math.Log2(p)
+		}
+	}
+	return h
+}
+
+// IsShapeTable reports whether data is laid out as an Apple ][ shape
+// table: the number of shapes and an unused byte, then the offset of each
+// shape from the start of the table, two bytes low first, each past the
+// index and each shape ending in a zero byte
+func IsShapeTable(data []byte) bool {
+	if len(data) < 2 {
+		return false
+	}
+	n := int(data[0])
+	index := 2 + 2*n
+	if n == 0 || index >= len(data) {
+		return false
+	}
+	for i := range n {
+		at := int(data[2+2*i]) | int(data[3+2*i])<<8
+		if at < index || at >= len(data) {
+			return false
+		}
+		end := at
+		for end < len(data) && data[end] != 0 {
+			end++
+		}
+		if end == at || end == len(data) {
+			// Empty, or running off the end of the table
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,159 @@
+package decoder
+
+import (
+	"math"
+	"slices"
+)
+
+// Clipping. A capture recorded too hot has its peaks flattened where the
+// sound card or the deck's amplifier ran out of range, which shifts the
+// crossings either side slightly. A peak is taken as clipped when several
+// consecutive samples hold exactly the same value; a real peak is never
+// that flat. Clipped peaks can be rebuilt with a curve that carries on the
+// slopes leading into and out of them.
+const (
+	ClipTime    = 0.0001 // seconds a flat run must last to count as clipping
+	ClipFloor   = 0.25   // flat runs closer to zero than this are silence, not clipping
+	ClipWarning = 0.01   // fraction of clipped signal samples worth warning about
+)
+
+// clipper measures clipping across consecutive windows of samples and,
+// with repair set, rebuilds the clipped peaks. It holds back the current
+// flat run, and one sample past a clipped one, until it knows what to do
+// with them.
+type clipper struct {
+	minRun int
+	repair bool
+
+	run   []float64 // samples of the current flat run, not yet output
+	prev  [2]float64
+	after bool    // a clipped run has ended and waits for a second sample past it
+	first float64 // the first sample past that run
+	out   []float64
+
+	signal  int // samples louder than silence
+	clipped int // samples in clipped runs
+	peaks   int // clipped runs
+}
+
+func newClipper(sampleRate uint32, repair bool) *clipper {
+	return &clipper{
+		minRun: max(3, int(math.Ceil(ClipTime*float64(sampleRate)))),
+		repair: repair,
+	}
+}
+
+// fraction returns how much of the signal so far was clipped
+func (c *clipper) fraction() float64 {
+	if c.signal == 0 {
+		return 0
+	}
+	return float64(c.clipped) / float64(c.signal)
+}
+
+// log reports how much was clipped, warning if it is enough to matter
+func (c *clipper) log(opts Options) {
+	if c.clipped == 0 {
+		return
+	}
+	if c.fraction() >= ClipWarning {
+		opts.warnf("%.1f%% of the signal is clipped; record at a lower level if you can", 100*c.fraction())
+	} else {
+		opts.logf("%.2f%% of the signal is clipped", 100*c.fraction())
+	}
+	if c.repair {
+		opts.logf("Rebuilt %d clipped peaks", c.peaks)
+	}
+}
+
+// feed returns the samples that can be output so far. The returned slice
+// is reused by the next call.
+func (c *clipper) feed(window []float64) []float64 {
+	// Growing the output once, to the most it can hold, keeps the appends
+	// below from reallocating it sample by sample on a whole capture
+	c.out = slices.Grow(c.out[:0], len(c.run)+1+len(window))
+	for _, x := range window {
+		if math.Abs(x) > SilenceLevel {
+			c.signal++
+		}
+		if c.after {
+			c.rebuild(x)
+		}
+		if len(c.run) > 0 && x == c.run[0] {
+			c.run = append(c.run, x)
+			continue
+		}
+		if len(c.run) == 1 {
+			// Most samples differ from the one before, which is then
+			// output straight away, as too short a run to be clipping
+			c.out = append(c.out, c.run[0])
+			c.prev[0], c.prev[1] = c.prev[1], c.run[0]
+			c.run[0] = x
+			continue
+		}
+		if c.endRun(c.repair) {
+			c.after, c.first = true, x
+			continue
+		}
+		c.run = append(c.run[:0], x)
+	}
+	return c.out
+}
+
+// flush returns the samples still held back
+func (c *clipper) flush() []float64 {
+	c.out = c.out[:0]
+	if c.after {
+		c.rebuild(c.first)
+	}
+	// A run still flat at the end has no far side to rebuild toward
+	c.endRun(false)
+	return c.out
+}
+
+// endRun counts the flat run just ended and reports whether it is held
+// for repair, which only a clipped run is when hold is set; otherwise it
+// is output
+func (c *clipper) endRun(hold bool) bool {
+	if len(c.run) >= c.minRun && math.Abs(c.run[0]) >= ClipFloor {
+		c.clipped += len(c.run)
+		c.peaks++
+		if hold {
+			return true
+		}
+	}
+	c.emit(c.run...)
+	c.run = c.run[:0]
+	return false
+}
+
+// rebuild replaces the held clipped run with a cubic joining the samples
+// either side of it, given next, the second sample past it. The curve
+// keeps the slopes going into and out of the run, so it rises past the
+// clipping level the way the signal would have; it never dips below it.
+func (c *clipper) rebuild(next float64) {
+	c.after = false
+	p, q := c.prev[1], c.first
+	m0, m1 := c.prev[1]-c.prev[0], next-q
+	level := c.run[0]
+	h := float64(len(c.run) + 1)
+	for k := range c.run {
+		t := float64(k+1) / h
+		t2, t3 := t*t, t*t*t
+		y := (2*t3-3*t2+1)*p + (t3-2*t2+t)*h*m0 + (-2*t3+3*t2)*q + (t3-t2)*h*m1
+		if math.Abs(y) < math.Abs(level) {
+			y = level
+		}
+		c.run[k] = y
+	}
+	c.emit(c.run...)
+	c.emit(c.first)
+	c.run = c.run[:0]
+}
+
+func (c *clipper) emit(samples ...float64) {
+	for _, x := range samples {
+		c.out = append(c.out, x)
+		c.prev[0], c.prev[1] = c.prev[1], x
+	}
+}
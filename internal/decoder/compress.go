@@ -0,0 +1,102 @@
+package decoder
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io"
+	"path"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Captures compressed with gzip or zstd are decompressed as they are
+// read, told by the magic numbers they start with rather than by name
+var (
+	gzipMagic = []byte{0x1F, 0x8B}
+	zstdMagic = []byte{0x28, 0xB5, 0x2F, 0xFD}
+)
+
+// compressedExts are the extensions of compressed files
+var compressedExts = []string{".gz", ".zst"}
+
+// TrimCompressed returns name without any extension of a compressed file,
+// such as the .gz of tape.wav.gz
+func TrimCompressed(name string) string {
+	for _, ext := range compressedExts {
+		if strings.EqualFold(path.Ext(name), ext) {
+			return name[:len(name)-len(ext)]
+		}
+	}
+	return name
+}
+
+// IsCapture reports whether name is that of a WAV capture, compressed or
+// not
+func IsCapture(name string) bool {
+	return strings.EqualFold(path.Ext(TrimCompressed(name)), ".wav")
+}
+
+// Decompress returns a reader of r's data, decompressed if it is gzip or
+// zstd. A stream that is neither reads as it is.
+func Decompress(r io.Reader) (io.ReadCloser, error) {
+	b := bufio.NewReader(r)
+	magic, _ := b.Peek(len(zstdMagic))
+	switch {
+	case bytes.HasPrefix(magic, gzipMagic):
+		return gzip.NewReader(b)
+	case bytes.HasPrefix(magic, zstdMagic):
+		z, err := zstd.NewReader(b)
+		if err != nil {
+			return nil, err
+		}
+		return z.IOReadCloser(), nil
+	}
+	return io.NopCloser(b), nil
+}
+
+// decompressed reads a stream decompressed, closing the stream with it
+type decompressed struct {
+	io.ReadCloser
+	stream io.Closer
+}
+
+func (d decompressed) Close() error {
+	d.ReadCloser.Close()
+	return d.stream.Close()
+}
+
+// openDecompressed opens a stream by name and decompresses it
+func openDecompressed(ctx context.Context, name string) (io.ReadCloser, error) {
+	f, err := openStream(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	// A file that is not compressed is read as it is, so that it can be
+	// seeked in. Pipes have the methods but cannot.
+	if s, ok := f.(io.ReadSeeker); ok && seekable(s) {
+		magic := make([]byte, len(zstdMagic))
+		n, _ := io.ReadFull(s, magic)
+		if _, err := s.Seek(0, io.SeekStart); err != nil {
+			f.Close()
+			return nil, err
+		}
+		if !bytes.HasPrefix(magic[:n], gzipMagic) && !bytes.HasPrefix(magic[:n], zstdMagic) {
+			return f, nil
+		}
+	}
+	r, err := Decompress(f)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return decompressed{r, f}, nil
+}
+
+// seekable reports whether s can be seeked in
+func seekable(s io.Seeker) bool {
+	_, err := s.Seek(0, io.SeekCurrent)
+	return err == nil
+}
@@ -0,0 +1,254 @@
+package decoder
+
+import (
+	"encoding/binary"
+	"math"
+)
+
+// Amstrad CPC tapes give every bit one cycle, a 1 twice as long as a 0,
+// at whatever speed the program was saved at: 1000 baud by default, 2000
+// after SPEED WRITE 1, and other rates from custom loaders. A block is a
+// pilot tone of 1 bits, a 0 sync bit, a sync byte, then 256-byte segments
+// each followed by a CRC, MSB first throughout. The framer measures each
+// block's pilot and reads the block against it, so every speed decodes
+// alike, and the speed is kept in the .CDT file written.
+const (
+	CPCHeaderTolerance = 0.35 // fraction a pilot half-cycle may differ from the running average
+	CPCSegment         = 256  // bytes between CRCs
+
+	// A file is saved as 2K data blocks, each after a header block
+	// giving its type, length and where it loads. The sync byte tells
+	// the two apart.
+	CPCHeaderSync = 0x2C
+	CPCDataSync   = 0x16
+	CPCFileType   = 18 // offset in a header of the file type
+	CPCLength     = 19 // offset of the data block's length
+	CPCLoad       = 21 // offset of where the data block loads
+)
+
+// cpcTiming classifies 1000 baud half-cycles. The framer itself goes by
+// the pilot tone, so the thresholds only steer speed tracking.
+var cpcTiming = Timing{
+	Short:     0.000500,
+	Long:      0.001000,
+	MinHeader: 256,
+	Nominal: [numPulses]float64{
+		pulseShort: 0.000333, // 1500Hz
+		pulseLong:  0.000667, // 750Hz
+	},
+}
+
+var cpcSystem = System{
+	Name:      "cpc",
+	Timing:    &cpcTiming,
+	Demods:    []Demod{DemodZeroCrossing, DemodPeak},
+	newFramer: func() framer { return &cpcFramer{} },
+	check:     cpcChecksumOK,
+	payload:   func(data []byte) int { return max(0, len(data)-1) / (CPCSegment + 2) * CPCSegment },
+	pack:      packCDT,
+	ext:       ".cdt",
+	selfTimed: true,
+	identify:  identifyCPC,
+	encode:    encodeCPC,
+}
+
+// cpcFramer reads CPC bit cells against the block's pilot tone
+type cpcFramer struct {
+	unit float64 // running average length in seconds of a 1 bit's half-cycle
+}
+
+// classify sorts a half-cycle by its length against the pilot's. Any far
+// too short or too long for a bit, such as noise in a gap, is reported as
+// pulseHeader.
+func (f *cpcFramer) classify(seconds float64) pulse {
+	switch {
+	case seconds < 0.25*f.unit:
+		return pulseHeader
+	case seconds < 0.75*f.unit:
+		return pulseShort
+	case seconds < 1.5*f.unit:
+		return pulseLong
+	}
+	return pulseHeader
+}
+
+func (f *cpcFramer) halfCycle(d *bitDecoder, _ pulse) {
+	h := d.length
+	p := f.classify(h)
+	switch d.state {
+	case stateHeader:
+		if d.header > d.timing.MinHeader && p == pulseShort {
+			// The first half of the sync bit
+			d.state = stateSync
+			return
+		}
+		if d.header == 0 || math.Abs(h-f.unit) > CPCHeaderTolerance*f.unit {
+			// Not the pilot so far; it may start here
+			f.unit = h
+			d.header = 0
+		} else {
+			f.unit += (h - f.unit) / 16
+		}
+		d.countHeader(pulseLong)
+	case stateSync:
+		if p != pulseShort {
+			d.resync(pulseLong)
+			return
+		}
+		d.startData(pulseShort)
+	case stateFirstHalf:
+		if p == pulseHeader {
+			f.endBlock(d)
+			return
+		}
+		d.firstHalf(p)
+	case stateSecondHalf:
+		if p == pulseHeader {
+			f.endBlock(d)
+			return
+		}
+		d.open.cells++
+		if p != d.first {
+			// Out of step; this half may start the next cell
+			d.open.cellErrors++
+			d.totalErrors++
+			d.firstHalf(p)
+			return
+		}
+		d.state = stateFirstHalf
+		if p == pulseLong {
+			f.unit += (h - f.unit) / 32
+		} else {
+			f.unit += (2*h - f.unit) / 32
+		}
+		if d.inDropout(d.cellStart, d.end) {
+			d.erasing = true
+		}
+		d.shiftBit(p == pulseLong)
+	}
+}
+
+// endBlock closes the block at the gap after it, dropping any byte left
+// unfinished, and looks for the next pilot tone
+func (f *cpcFramer) endBlock(d *bitDecoder) {
+	d.closeRecord(d.at)
+	d.state = stateHeader
+	d.header = 0
+}
+
+// cpcChecksumOK reports whether a record has at least one whole segment
+// and every whole segment's CRC matches
+func cpcChecksumOK(r *record) bool {
+	if len(r.data) < 1+CPCSegment+2 {
+		return false
+	}
+	for seg := r.data[1:]; len(seg) >= CPCSegment+2; seg = seg[CPCSegment+2:] {
+		if cpcCRC(seg[:CPCSegment]) != binary.BigEndian.Uint16(seg[CPCSegment:]) {
+			return false
+		}
+	}
+	return true
+}
+
+// identifyCPC types each data block by the header block before it, which
+// also gives where it loads and how much of it is the file's
+func identifyCPC(records []Record) {
+	var header []byte
+	for i := range records {
+		r := &records[i]
+		if len(r.Data) == 0 {
+			continue
+		}
+		switch r.Data[0] {
+		case CPCHeaderSync:
+			r.Type = RecordHeader
+			header = r.Data[1:]
+			if len(header) < CPCLoad+2 {
+				header = nil
+			}
+			continue
+		case CPCDataSync:
+			if header == nil {
+				break
+			}
+			switch header[CPCFileType] & 0x0E {
+			case 0:
+				r.Type = RecordBasic
+			case 2:
+				r.Type = RecordMachineCode
+			case 6:
+				r.Type = RecordASCII
+			default:
+				r.Type = RecordData
+			}
+			r.LoadAddress = int(binary.LittleEndian.Uint16(header[CPCLoad:]))
+			body := cpcSegments(r.Data)
+			r.setBody(body[:min(len(body), int(binary.LittleEndian.Uint16(header[CPCLength:])))])
+		}
+		header = nil
+	}
+}
+
+// cpcSegments returns a block's whole segments without their CRCs
+func cpcSegments(data []byte) []byte {
+	var out []byte
+	for seg := data[1:]; len(seg) >= CPCSegment+2; seg = seg[CPCSegment+2:] {
+		out = append(out, seg[:CPCSegment]...)
+	}
+	return out
+}
+
+// cpcCRC is the firmware's CRC-16-CCITT, stored inverted
+func cpcCRC(data []byte) uint16 {
+	return ^uint16(crc16CCITT(0xFFFF, data))
+}
+
+// encodeCPC writes a block at the speed its pilot tone played at: the
+// pilot, the 0 sync bit, then the block MSB first, the sync byte, CRCs
+// and trailer included
+func encodeCPC(t *tape, timing *Timing, r Record) {
+	unit := r.Pulse
+	if unit == 0 {
+		unit = timing.Nominal[pulseLong]
+	}
+	t.halves(headerHalves(timing, r), unit)
+	t.halves(2, unit/2)
+	for _, b := range r.Data {
+		for i := 7; i >= 0; i-- {
+			if b>>i&1 == 1 {
+				t.halves(2, unit)
+			} else {
+				t.halves(2, unit/2)
+			}
+		}
+	}
+}
+
+// CDT files are TZX files, timed in T-states of the Spectrum's clock
+const (
+	CDTClock = 3500000 // T-states per second
+	CDTPause = 1000    // milliseconds of silence written after each block
+)
+
+// packCDT writes blocks in the .CDT container CPC emulators load, each as
+// a turbo speed data block timed from its own pilot tone
+func packCDT(blocks []Record) []byte {
+	out := []byte("ZXTape!\x1a\x01\x14")
+	for _, b := range blocks {
+		one := uint16(math.Round(b.Pulse * CDTClock))
+		zero := one / 2
+		out = append(out, 0x11)
+		out = binary.LittleEndian.AppendUint16(out, one)  // pilot pulse
+		out = binary.LittleEndian.AppendUint16(out, zero) // first sync pulse
+		out = binary.LittleEndian.AppendUint16(out, zero) // second sync pulse
+		out = binary.LittleEndian.AppendUint16(out, zero)
+		out = binary.LittleEndian.AppendUint16(out, one)
+		out = binary.LittleEndian.AppendUint16(out, uint16(min(b.Header, math.MaxUint16)))
+		out = append(out, 8) // bits used in the last byte
+		out = binary.LittleEndian.AppendUint16(out, CDTPause)
+		n := len(b.Data)
+		out = append(out, byte(n), byte(n>>8), byte(n>>16))
+		out = append(out, b.Data...)
+	}
+	return out
+}
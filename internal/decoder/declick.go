@@ -0,0 +1,96 @@
+package decoder
+
+import (
+	"math"
+	"slices"
+)
+
+// Click removal. Dirt on the tape head throws sharp spikes into the audio
+// that add a pair of spurious zero crossings wherever they land. A spike a
+// sample or two wide stands off the median of its neighbours by far more
+// than the signal moves from one sample to the next, while a tone never
+// does. Such samples are bridged with a straight line between the good
+// samples either side.
+const (
+	ClickRatio  = 3     // distance from the median, in average sample-to-sample steps, that marks a click
+	ClickWindow = 0.002 // seconds the average step is taken over
+)
+
+// declicker repairs clicks across consecutive windows of samples. Its
+// output lags its input by two samples, and by any click in progress,
+// which flush returns.
+type declicker struct {
+	decay float64 // fraction of the average step moved per sample
+	step  float64 // running average difference between consecutive samples
+
+	buf     []float64 // two samples of context, then samples not yet output
+	started bool
+	good    float64 // last sample that was not a click
+	pending int     // samples in the click in progress
+	out     []float64
+
+	clicks   int // runs of repaired samples
+	repaired int // samples replaced
+}
+
+func newDeclicker(sampleRate uint32) *declicker {
+	return &declicker{decay: 1 / max(1, ClickWindow*float64(sampleRate))}
+}
+
+// feed returns the repaired samples that the input so far determines. The
+// returned slice is reused by the next call.
+func (c *declicker) feed(window []float64) []float64 {
+	if !c.started && len(window) > 0 {
+		// The first samples have only themselves before them
+		c.buf = append(c.buf, window[0], window[0])
+		c.started = true
+	}
+	c.buf = append(c.buf, window...)
+	return c.run()
+}
+
+// flush returns the samples still held back
+func (c *declicker) flush() []float64 {
+	if !c.started {
+		return nil
+	}
+	last := c.buf[len(c.buf)-1]
+	c.buf = append(c.buf, last, last)
+	out := c.run()
+	for ; c.pending > 0; c.pending-- {
+		out = append(out, c.good)
+	}
+	return out
+}
+
+func (c *declicker) run() []float64 {
+	c.out = c.out[:0]
+	i := 2
+	for ; i+2 < len(c.buf); i++ {
+		x := c.buf[i]
+		if math.Abs(x-median5(c.buf[i-2:i+3])) > max(SilenceLevel, ClickRatio*c.step) {
+			if c.pending == 0 {
+				c.clicks++
+			}
+			c.pending++
+			c.repaired++
+		} else {
+			for k := 1; k <= c.pending; k++ {
+				c.out = append(c.out, c.good+(x-c.good)*float64(k)/float64(c.pending+1))
+			}
+			c.pending = 0
+			c.out = append(c.out, x)
+			c.good = x
+		}
+		c.step += (math.Abs(x-c.buf[i-1]) - c.step) * c.decay
+	}
+	c.buf = append(c.buf[:0], c.buf[i-2:]...)
+	return c.out
+}
+
+func median5(x []float64) float64 {
+	var s [5]float64
+	copy(s[:], x)
+	slices.Sort(s[:])
+	return s[2]
+}
@@ -1,323 +1,495 @@
 package decoder
 
 import (
-	"encoding/binary"
+	"context"
 	"fmt"
 	"io"
-	"os"
+	"log/slog"
+	"math"
+	"slices"
+	"sync"
 )
 
-// WavHeader represents the header of a WAV file
-type WavHeader struct {
-	ChunkID       [4]byte
-	ChunkSize     uint32
-	Format        [4]byte
-	Subchunk1ID   [4]byte
-	Subchunk1Size uint32
-	AudioFormat   uint16
-	NumChannels   uint16
-	SampleRate    uint32
-	ByteRate      uint32
-	BlockAlign    uint16
-	BitsPerSample uint16
+// Options controls how a file is decoded
+type Options struct {
+	// Log receives progress messages, details of the capture at debug
+	// level and trouble worth knowing about at warning level. Nil discards
+	// them, which lets several files be decoded concurrently without
+	// interleaved output.
+	Log *slog.Logger
+
+	// Workers is the number of goroutines used to decode the segments of
+	// a single long capture. Values below 2 decode serially.
+	Workers int
+
+	// Deterministic cuts a long capture into the same segments however
+	// many Workers there are, even one, so that the result depends only
+	// on the audio and the options and not on the machine decoding it
+	Deterministic bool
+
+	// Checkpoint, when set, names a file that the decode of a long
+	// capture saves each segment's records to as it finishes them,
+	// cutting the capture as Deterministic does. The file is removed
+	// once every segment is decoded.
+	Checkpoint string
+
+	// Resume takes up a decode interrupted before it finished from its
+	// Checkpoint, decoding only the segments not saved in it
+	Resume bool
+
+	// Context, if set, stops the decode early once it is done, as when it
+	// is interrupted: the segments of a long capture not yet begun are
+	// skipped and those under way finished, and a capture decoded whole
+	// stops where it has got to. What was read until then is returned,
+	// the catalog noting where the decode stopped, and a Checkpoint is
+	// kept to resume from.
+	Context context.Context
+	halt    *halt
+
+	// System is the computer whose tapes are decoded; nil is the Apple ][
+	System *System
+
+	// Timing overrides the system's pulse thresholds
+	Timing *Timing
+
+	// Progress, when set, is called by DecodeStream after every window of
+	// samples with a snapshot of the decoder's state
+	Progress func(Progress)
+
+	// Output, when set, receives the decoded file from DecodeStream as it
+	// is decoded: each record's share is written as soon as the record
+	// is complete and no later record can change it. If Output has a
+	// Flush() error method, as a bufio.Writer does, it is called after
+	// every write.
+	Output io.Writer
+
+	// IgnoreDropouts decodes straight through dropouts instead of
+	// treating the bytes they touch as erasures
+	IgnoreDropouts bool
+
+	// TrackSpeed follows drifting tape speed, classifying half-cycles
+	// against a running estimate of the bit cell period instead of the
+	// fixed thresholds alone. Without it, the thresholds are moved for
+	// each record by the speed its header tone played at.
+	TrackSpeed bool
+
+	// Demod is the engine that recovers half-cycles from the audio
+	Demod Demod
+
+	// Resample is the rate in Hz the audio is converted to before
+	// detection. Zero upsamples captures below MinCrossingRate to at
+	// least WorkingRate and leaves others alone; negative never resamples.
+	Resample int
+
+	// Declick replaces clicks and pops with the median of the samples
+	// around them before anything else looks at the audio
+	Declick bool
+
+	// Unclip rebuilds peaks flattened by recording too hot. Clipping is
+	// measured and reported either way.
+	Unclip bool
+
+	// SpeedFactor is how many times its nominal speed the tape played at
+	// as it was captured, such as 2 for one digitized at double speed.
+	// Zero decodes at nominal speed and, should no record check out at it,
+	// tries each of SpeedFactors, keeping the first that reads more
+	// records whole than nominal speed found at all.
+	SpeedFactor float64
+
+	// Retry decodes each segment whose records do not all check out
+	// again with other options, keeping the first that reads more of them
+	// and noting in its records what it was
+	Retry bool
+
+	// Stereo decodes both channels of a stereo capture of a mono tape,
+	// each on its own, and merges the records they read, bit by bit
+	// where they differ, so that one channel makes up for what the other
+	// missed
+	Stereo bool
+
+	// Azimuth mixes the channels of a stereo capture of a mono tape into
+	// one before decoding, first undoing the delay between them that a
+	// misaligned head puts there
+	Azimuth bool
+
+	// Mix, when set, decodes a weighted sum of a capture's channels
+	// instead of its first channel alone
+	Mix Mix
+
+	// MaxDuration, if above 0, is the longest capture in seconds that is
+	// read; a longer one fails. MaxMemory, if above 0, is the most memory
+	// in bytes the samples of a capture may need, at MemoryPerSample for
+	// each, in a decode that holds them all.
+	MaxDuration float64
+	MaxMemory   int64
+
+	// Mmap maps a capture that is a local file into memory instead
+	// of reading it, as OpenMapped does, when it is opened by name
+	Mmap bool
+
+	// Source, if set, is written every byte of a capture opened by name
+	// as the decode reads it, and after the decode what it left unread,
+	// unless it was stopped; so the capture can be hashed without being
+	// read twice, which standard input cannot be
+	Source io.Writer
+
+	// Reverse decodes the capture backwards, for audio digitized from a
+	// tape played the wrong way or reversed since. Positions in the
+	// catalog are then of the reversed audio.
+	Reverse bool
+
+	// Cleaned, when set, is handed the audio decoded as the engines hear
+	// it, after click removal, clipping repair and resampling, at the rate
+	// it is then at. WriteWAV writes it out.
+	Cleaned func(samples []float64, sampleRate uint32)
+
+	// Trace, when set, is written a line for every half-cycle the bit
+	// decoder is fed and everything it makes of them. A capture is traced
+	// decoding serially, and of a stereo capture only the left channel.
+	Trace io.Writer
 }
 
-// Decode reads a WAV file and attempts to decode Apple ][ data
-func Decode(filename string) ([]byte, error) {
-	f, err := os.Open(filename)
-	if err != nil {
-		return nil, err
+func (o Options) system() *System {
+	if o.System != nil {
+		return o.System
 	}
-	defer f.Close()
+	return &appleIISystem
+}
 
-	var header WavHeader
-	if err := binary.Read(f, binary.LittleEndian, &header); err != nil {
-		return nil, fmt.Errorf("failed to read WAV header: %w", err)
+// channels is how many channels of a capture are decoded
+func (o Options) channels() int {
+	if o.Stereo || o.Azimuth {
+		return 2
 	}
+	return max(1, len(o.Mix))
+}
 
-	fmt.Printf("WAV Header: %+v\n", header)
+// SpeedFactors are the wrong speeds tapes are most often captured at,
+// played at double speed or at half, which are tried in turn when no
+// record checks out at nominal speed
+var SpeedFactors = []float64{2, 0.5}
 
-	if string(header.ChunkID[:]) != "RIFF" || string(header.Format[:]) != "WAVE" {
-		return nil, fmt.Errorf("invalid WAV file")
+// decodeRate is the sample rate audio at rate is decoded as, so that its
+// half-cycles are timed as the tape recorded them
+func (o Options) decodeRate(rate uint32) uint32 {
+	if o.SpeedFactor == 0 {
+		return rate
 	}
+	return uint32(math.Round(float64(rate) / o.SpeedFactor))
+}
 
-	// Find the data chunk
-	for {
-		var chunkID [4]byte
-		var chunkSize uint32
-		if err := binary.Read(f, binary.LittleEndian, &chunkID); err != nil {
-			if err == io.EOF {
-				return nil, fmt.Errorf("data chunk not found")
-			}
-			return nil, err
-		}
-		if err := binary.Read(f, binary.LittleEndian, &chunkSize); err != nil {
-			return nil, err
-		}
+func (o Options) timing() *Timing {
+	if o.Timing != nil {
+		return o.Timing
+	}
+	return o.system().Timing
+}
+
+// headerSpeed reports whether records are read at the speed their header
+// tone played at: the engine times half-cycles from the audio rather than
+// making them up from bit decisions, and speed tracking is not following
+// the tape more closely
+func (o Options) headerSpeed() bool {
+	return !o.TrackSpeed && (o.Demod == DemodZeroCrossing || o.Demod == DemodPeak || o.Demod == DemodPulse)
+}
+
+// logf logs a progress message at info level
+func (o Options) logf(format string, args ...any) {
+	o.logAt(slog.LevelInfo, format, args...)
+}
+
+// debugf logs a detail of the capture at debug level
+func (o Options) debugf(format string, args ...any) {
+	o.logAt(slog.LevelDebug, format, args...)
+}
+
+// warnf logs something gone wrong, or likely to, at warning level
+func (o Options) warnf(format string, args ...any) {
+	o.logAt(slog.LevelWarn, format, args...)
+}
+
+func (o Options) logAt(level slog.Level, format string, args ...any) {
+	if o.Log != nil {
+		o.Log.Log(context.Background(), level, fmt.Sprintf(format, args...))
+	}
+}
+
+// DecodeReader decodes a WAV stream and returns the decoded bytes along
+// with a catalog of the silences, header tones and programs on the tape
+func DecodeReader(r io.Reader, opts Options) ([]byte, *Catalog, error) {
+	_, data, catalog, err := decodeReader(r, opts)
+	return data, catalog, err
+}
+
+// DecodeRecords decodes a WAV stream into its records, identified as far
+// as the system allows, for writing out in formats of the caller's own.
+// The catalog is that of DecodeReader.
+func DecodeRecords(r io.Reader, opts Options) ([]Record, *Catalog, error) {
+	records, _, catalog, err := decodeReader(r, opts)
+	return records, catalog, err
+}
+
+func decodeReader(r io.Reader, opts Options) ([]Record, []byte, *Catalog, error) {
+	if err := opts.system().supports(opts.Demod); err != nil {
+		return nil, nil, nil, err
+	}
+	channels, header, err := readWAV(r, opts)
+	if err != nil {
+		return nil, nil, opts.interrupted(), opts.stopped(err)
+	}
+	records, data, catalog := decodeSamples(channels, header, opts)
+	return records, data, catalog, nil
+}
 
-		if string(chunkID[:]) == "data" {
-			break // Found data chunk
+// decodeSamples decodes the channels of a capture as recorded, at the
+// rate in header, to records and the file the system packs them into.
+// Further channels, if given, are mixed into the first or else decoded
+// too and merged with it.
+func decodeSamples(channels [][]float64, header WavHeader, opts Options) ([]Record, []byte, *Catalog) {
+	if len(opts.Mix) > 0 {
+		opts.logf("Decoding the mix %v of the channels", opts.Mix)
+		channels = [][]float64{opts.Mix.mix(make([]float64, 0, len(channels[0])), channels)}
+	}
+	if opts.Azimuth {
+		channels = [][]float64{mixChannels(channels[0], channels[1], header.SampleRate, opts)}
+	}
+	c := decodeChannel(channels[0], header, opts)
+	if len(channels) > 1 {
+		other := opts
+		other.Log, other.Cleaned, other.Trace = nil, nil, nil
+		if other.Checkpoint != "" {
+			other.Checkpoint += ".right"
 		}
+		mergeChannels(c, decodeChannel(channels[1], header, other), opts)
+	}
+	records, samples, rate := c.records, c.samples, c.rate
 
-		// Skip other chunks
-		if _, err := f.Seek(int64(chunkSize), io.SeekCurrent); err != nil {
-			return nil, err
+	exported := make([]Record, len(records))
+	for i, r := range records {
+		exported[i] = r.export(float64(rate))
+	}
+	opts.system().Identify(exported)
+	data := opts.system().Pack(exported)
+	catalog := buildCatalog(samples, rate, header, records, c.dropouts)
+	catalog.identify(exported)
+	catalog.locate(data, records)
+	catalog.Eye = newEye(records, opts.timing())
+	if describe := opts.system().describe; describe != nil {
+		for i, line := range describe(records) {
+			opts.logf("Program %d: %s", i+1, line)
+			catalog.describe(i+1, line)
 		}
 	}
+	catalog.Clipped = c.clipped
+	if c.stopped >= 0 {
+		catalog.Interrupted, catalog.StoppedAt = true, float64(c.stopped)/float64(rate)
+		opts.warnf("Stopped at %.3fs of %.3fs; the rest of the capture was not decoded", catalog.StoppedAt, catalog.Duration)
+	}
+	return exported, data, catalog
+}
 
-	// Read samples
-	// Assuming 8-bit unsigned or 16-bit signed PCM
-	// We'll convert everything to float64 for easier processing
-	var samples []float64
-
-	if header.BitsPerSample == 8 {
-		// 8-bit samples are unsigned 0-255, center at 128
-		buf := make([]byte, 1024)
-		for {
-			n, err := f.Read(buf)
-			if n > 0 {
-				for i := 0; i < n; i += int(header.NumChannels) {
-					// Use Left channel (first sample)
-					sample := (float64(buf[i]) - 128.0) / 128.0
-					samples = append(samples, sample)
-				}
-			}
-			if err != nil {
+// channel is one channel of a capture as decoded, before its records are
+// identified and packed
+type channel struct {
+	samples  []float64 // after preprocessing
+	rate     uint32
+	records  []record
+	dropouts [][2]int
+	clipped  float64 // fraction of the samples flattened by clipping
+	stopped  int     // sample the decode stopped at, its Context done; -1 if it finished
+}
+
+// decodeChannel cleans up the samples of one channel and decodes them to
+// records
+func decodeChannel(samples []float64, header WavHeader, opts Options) *channel {
+	if opts.Reverse {
+		slices.Reverse(samples)
+	}
+	pre := newPreprocessor(opts, header.SampleRate)
+	samples = pre.all(samples, opts)
+	rate := pre.rate
+	if opts.Cleaned != nil {
+		opts.Cleaned(samples, rate)
+	}
+
+	if opts.Context != nil {
+		opts.halt = &halt{at: -1}
+	}
+
+	// Zero-crossing analysis
+	var records []record
+	var dropouts [][2]int
+	if (opts.Workers > 1 || opts.Deterministic || opts.Checkpoint != "") && opts.Trace == nil {
+		records, dropouts = processParallel(samples, opts.decodeRate(rate), opts)
+	} else {
+		records, dropouts = processRetrying(samples, opts.decodeRate(rate), opts)
+	}
+	if opts.SpeedFactor == 0 && intact(records) == 0 && !opts.stopping() {
+		for _, f := range SpeedFactors {
+			at := opts.uninterrupted()
+			at.SpeedFactor, at.Log, at.Trace = f, nil, nil
+			if found, d := processSamples(samples, at.decodeRate(rate), at); intact(found) > len(records) {
+				opts.logf("No programs read at nominal speed, but %d at %gx; decoding them at that speed", intact(found), f)
+				records, dropouts = found, d
 				break
 			}
 		}
-	} else if header.BitsPerSample == 16 {
-		// 16-bit samples are signed -32768 to 32767
-		// Read all channels
-		buf := make([]int16, 1024)
-		for {
-			err := binary.Read(f, binary.LittleEndian, &buf)
-			if err == nil {
-				for i := 0; i < len(buf); i += int(header.NumChannels) {
-					// Use Left channel (first sample)
-					if i < len(buf) {
-						sample := float64(buf[i]) / 32768.0
-						samples = append(samples, sample)
-					}
-				}
-			} else {
-				break
-			}
+	}
+	if len(records) == 0 && !opts.Reverse && !opts.stopping() {
+		if n := reversedRecords(samples, opts.decodeRate(rate), opts.uninterrupted()); n > 0 {
+			opts.warnf("No programs found, but %d read with the audio reversed; it may be backwards, so try -reverse", n)
 		}
-	} else {
-		return nil, fmt.Errorf("unsupported bits per sample: %d", header.BitsPerSample)
 	}
-
-	fmt.Printf("Read %d samples\n", len(samples))
-
-	// Zero-crossing analysis
-	return processSamples(samples, header.SampleRate), nil
+	c := &channel{samples: samples, rate: rate, records: records, dropouts: dropouts, clipped: pre.clipper.fraction(), stopped: -1}
+	if opts.halt != nil {
+		c.stopped = opts.halt.at
+	}
+	return c
 }
 
-func processSamples(samples []float64, sampleRate uint32) []byte {
-	var crossings []int
-	prevSample := samples[0]
+// processSamples measures the time between zero crossings and feeds each
+// half-cycle through the bit decoder. It also returns the dropouts found.
+func processSamples(samples []float64, sampleRate uint32, opts Options) ([]record, [][2]int) {
+	if opts.stopping() {
+		opts.stop(0)
+		return nil, nil
+	}
+	if opts.Demod == DemodVote {
+		return processVote(samples, sampleRate, opts)
+	}
 
-	for i, sample := range samples {
-		if (prevSample < 0 && sample >= 0) || (prevSample >= 0 && sample < 0) {
-			crossings = append(crossings, i)
+	d := newBitDecoder(opts.system(), opts.timing(), sampleRate)
+	d.trackSpeed = opts.TrackSpeed
+	d.headerSpeed = opts.headerSpeed()
+	d.log = opts.Log
+	if opts.Trace != nil {
+		d.trace = &tracer{w: opts.Trace, rate: float64(sampleRate)}
+		if opts.SpeedFactor > 0 {
+			d.trace.rate *= opts.SpeedFactor
+		}
+	}
+	if !opts.IgnoreDropouts {
+		d.dropouts = findDropouts(samples, sampleRate)
+		if len(d.dropouts) > 0 {
+			opts.logf("Detected %d dropouts", len(d.dropouts))
 		}
-		prevSample = sample
 	}
 
-	fmt.Printf("Detected %d zero crossings\n", len(crossings))
-
-	// State machine
-	const (
-		StateFindHeader = iota
-		StateFindSync
-		StateReadData
-	)
+	if opts.Demod != DemodZeroCrossing {
+		demod := newDemodulator(opts, sampleRate)
+		demod.feed(samples, d)
+		demod.flush(d)
+		return d.records, d.dropouts
+	}
 
-	state := StateFindHeader
-	var decodedBytes []byte
-	var currentByte byte
-	var bitCount int
+	crossings := findCrossings(samples)
+	opts.debugf("Detected %d zero crossings", len(crossings))
+	for i := 1; i < len(crossings); i++ {
+		if i%stopInterval == 0 && opts.stopping() {
+			// What was cut off is dropped, the decode stopping before it
+			at := d.abandon(crossings[i-1])
+			opts.stop(at)
+			return d.records, slices.DeleteFunc(d.dropouts, func(s [2]int) bool { return s[0] >= at })
+		}
+		d.halfCycle(crossings[i-1], crossings[i]-crossings[i-1])
+	}
+	if len(crossings) > 0 {
+		d.finish(crossings[len(crossings)-1])
+	}
+	return d.records, d.dropouts
+}
 
-	// Thresholds
-	const (
-		ShortThreshold = 0.000350 // 350us
-		LongThreshold  = 0.000600 // 600us
-	)
+// stopInterval is how many half-cycles are decoded between looks at
+// whether the decode is to stop
+const stopInterval = 1 << 16
 
-	// We iterate through half-cycles.
-	// We need pairs of half-cycles to form a bit.
-	// Ideally, they should match (Short+Short or Long+Long).
+// halt is where a decode stopped early, its Context done
+type halt struct {
+	mu sync.Mutex
+	at int // sample of the channel decoded; -1 if it has not stopped
+}
 
-	headerCount := 0
+// stopping reports whether the decode is to stop
+func (o Options) stopping() bool {
+	return o.Context != nil && o.Context.Err() != nil
+}
 
-	for i := 1; i < len(crossings); i++ {
-		durationSamples := crossings[i] - crossings[i-1]
-		durationSec := float64(durationSamples) / float64(sampleRate)
-
-		var isShort, isHeader bool
-		if durationSec < ShortThreshold {
-			isShort = true
-		} else if durationSec < LongThreshold {
-			// isLong = true
-		} else {
-			isHeader = true
-		}
+// stopped returns err, which stopped a decode before it began, unless
+// the Context being done caused it: the decode was then interrupted
+func (o Options) stopped(err error) error {
+	if o.stopping() {
+		return nil
+	}
+	return err
+}
 
-		switch state {
-		case StateFindHeader:
-			if isHeader {
-				headerCount++
-			} else {
-				// If we had enough header tone, and now we see a Short, it might be the sync bit
-				if headerCount > 100 && isShort {
-					// Potential sync bit start
-					// We need another Short to confirm sync bit (0 is Short+Short)
-					state = StateFindSync
-				} else {
-					headerCount = 0
-				}
-			}
-		case StateFindSync:
-			if isShort {
-				// Second half of sync bit found!
-				// fmt.Println("Sync bit found! Starting data decode...")
-				state = StateReadData
-				currentByte = 0
-				bitCount = 0
-			} else {
-				// False alarm, go back to finding header
-				state = StateFindHeader
-				headerCount = 0
-			}
-		case StateReadData:
-			// We need to read pairs.
-			// This is a simplified approach: we just look at the current half-cycle.
-			// A more robust approach would buffer the next half-cycle and check consistency.
-			// But for now, let's assume if we see a Short, we expect another Short.
-			// If we see a Long, we expect another Long.
-
-			// Actually, let's just peek at the next one if possible, or maintain state.
-			// Let's use a sub-state or just skip the next one if it matches.
-
-			// Better: Read two half-cycles at a time?
-			// The loop is iterating one by one.
-			// Let's just track "first half" vs "second half".
-
-			// Wait, the loop index `i` is for the current half-cycle.
-			// Let's skip the loop index manipulation and just use a flag.
-		}
+// interrupted returns the catalog of a decode interrupted before it
+// began, its Context done, or nil if it was not
+func (o Options) interrupted() *Catalog {
+	if !o.stopping() {
+		return nil
 	}
+	return &Catalog{Interrupted: true}
+}
 
-	// Re-implementing the loop to handle pairs properly
-	i := 1
-	state = StateFindHeader
-	headerCount = 0
+// stop records that the decode stopped at sample at, unless it stopped
+// sooner
+func (o Options) stop(at int) {
+	if o.halt == nil {
+		return
+	}
+	o.halt.mu.Lock()
+	defer o.halt.mu.Unlock()
+	if o.halt.at < 0 || at < o.halt.at {
+		o.halt.at = at
+	}
+}
 
-	for i < len(crossings) {
-		durationSamples := crossings[i] - crossings[i-1]
-		durationSec := float64(durationSamples) / float64(sampleRate)
-		i++ // Move to next
+// uninterrupted returns the options for a decode that, once begun, is
+// finished whatever the Context: another try at samples already decoded,
+// or a segment under way
+func (o Options) uninterrupted() Options {
+	o.Context, o.halt = nil, nil
+	return o
+}
 
-		var isShort, isHeader bool
-		if durationSec < ShortThreshold {
-			isShort = true
-		} else if durationSec < LongThreshold {
-			// isLong = true
-		} else {
-			isHeader = true
+// intact counts the records that check out and hold something, as noise
+// that happens to frame a lone checksum byte does not
+func intact(records []record) int {
+	n := 0
+	for _, r := range records {
+		if r.checksumOK() && r.payload() > 0 {
+			n++
 		}
+	}
+	return n
+}
 
-		switch state {
-		case StateFindHeader:
-			// Accept Header (> 600us) or Long (1000Hz, ~500us) as header tone
-			if isHeader || (durationSec > ShortThreshold && durationSec < LongThreshold) {
-				headerCount++
-			} else {
-				// If we had enough header tone, and now we see a Short, it might be the sync bit
-				if headerCount > 50 && isShort { // Reduced header requirement for testing
-					// Check next half-cycle for Sync (Short+Short)
-					if i < len(crossings) {
-						nextDur := float64(crossings[i]-crossings[i-1]) / float64(sampleRate)
-						if nextDur < ShortThreshold {
-							// Sync confirmed
-							// fmt.Println("Sync bit found!")
-							state = StateReadData
-							currentByte = 0
-							bitCount = 0
-							i++ // Consumed the second half of sync
-						} else {
-							state = StateFindHeader
-							headerCount = 0
-						}
-					}
-				} else {
-					headerCount = 0
-				}
-			}
-		case StateReadData:
-			// Read a bit (2 half cycles)
-			if i >= len(crossings) {
-				break
-			}
-
-			// We already have the first half in `durationSec` (from before i++),
-			// but wait, I incremented i already.
-			// Let's step back. `durationSec` is `crossings[i-1] - crossings[i-2]`.
-			// We need the second half.
-
-			dur1 := durationSec
-			dur2Samples := crossings[i] - crossings[i-1]
-			dur2 := float64(dur2Samples) / float64(sampleRate)
-			i++ // Consume second half
-
-			// Determine bit
-			// 0 = Short + Short
-			// 1 = Long + Long
-
-			isZero := dur1 < ShortThreshold && dur2 < ShortThreshold
-			isOne := (dur1 >= ShortThreshold && dur1 < LongThreshold) && (dur2 >= ShortThreshold && dur2 < LongThreshold)
-
-			if isZero {
-				// 0 bit
-				// Apple II data is MSB first? No, usually LSB first in some formats, but Monitor is MSB?
-				// Actually, standard Monitor `RDBYTE` shifts bits in.
-				// It does `ROL` (Rotate Left), so new bit goes into LSB, and everything shifts left?
-				// Wait, `ROL` shifts Carry into LSB, and MSB into Carry.
-				// The routine reads 8 bits.
-				// Let's assume MSB first for now (shifting into LSB means the first bit read ends up at MSB? No.)
-				// If I read B1, shift left -> B1.
-				// Read B2, shift left -> B1 B2.
-				// ...
-				// Read B8, shift left -> B1 B2 ... B8.
-				// So B1 is MSB.
-
-				// "0" bit
-				currentByte = (currentByte << 1) // | 0
-				bitCount++
-			} else if isOne {
-				// "1" bit
-				currentByte = (currentByte << 1) | 1
-				bitCount++
-			} else {
-				// Error or end of data
-				// fmt.Printf("Bit error at %d: %.6f, %.6f\n", i, dur1, dur2)
-				// For now, let's just ignore or reset?
-				// If it's a Header tone, maybe we finished?
-				if dur1 > LongThreshold || dur2 > LongThreshold {
-					// fmt.Println("End of data (header tone found)")
-					state = StateFindHeader
-					headerCount = 0
-				}
-			}
+// reversedRecords returns how many records the audio holds when it is
+// played backwards, as a capture of a reversed tape does
+func reversedRecords(samples []float64, rate uint32, opts Options) int {
+	reversed := slices.Clone(samples)
+	slices.Reverse(reversed)
+	opts.Log, opts.Trace = nil, nil
+	records, _ := processSamples(reversed, rate, opts)
+	return len(records)
+}
 
-			if bitCount == 8 {
-				decodedBytes = append(decodedBytes, currentByte)
-				currentByte = 0
-				bitCount = 0
-			}
+// findCrossings returns the index of every sample whose sign differs from
+// the one before it
+func findCrossings(samples []float64) []int {
+	if len(samples) == 0 {
+		return nil
+	}
+	var crossings []int
+	// Ranging over the samples, rather than indexing two at a time, keeps
+	// bounds checks out of the loop
+	negative := samples[0] < 0
+	for i, x := range samples[1:] {
+		if (x < 0) != negative {
+			crossings = append(crossings, i+1)
+			negative = !negative
 		}
 	}
-
-	return decodedBytes
+	return crossings
 }
@@ -0,0 +1,91 @@
+package decoder
+
+import "fmt"
+
+// Demod selects how half-cycles are recovered from the audio
+type Demod int
+
+const (
+	DemodZeroCrossing Demod = iota // time the gaps between zero crossings
+	DemodGoertzel                  // decide each bit cell by tone energy
+	DemodMatched                   // decide each bit cell by correlation with ideal cycles
+	DemodPeak                      // time the gaps between alternating peaks
+	DemodVote                      // run every engine and vote on each byte
+	DemodPulse                     // time the gaps between swings past a threshold
+)
+
+func (m Demod) String() string {
+	switch m {
+	case DemodZeroCrossing:
+		return "zerocross"
+	case DemodGoertzel:
+		return "goertzel"
+	case DemodMatched:
+		return "matched"
+	case DemodPeak:
+		return "peak"
+	case DemodVote:
+		return "vote"
+	case DemodPulse:
+		return "pulse"
+	}
+	return "unknown"
+}
+
+// ParseDemod parses a demodulator name as printed by Demod.String
+func ParseDemod(s string) (Demod, error) {
+	for _, m := range []Demod{DemodZeroCrossing, DemodGoertzel, DemodMatched, DemodPeak, DemodVote, DemodPulse} {
+		if s == m.String() {
+			return m, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown demodulator %q", s)
+}
+
+func (m Demod) MarshalText() ([]byte, error) {
+	return []byte(m.String()), nil
+}
+
+func (m *Demod) UnmarshalText(b []byte) error {
+	v, err := ParseDemod(string(b))
+	if err != nil {
+		return err
+	}
+	*m = v
+	return nil
+}
+
+// bitSink receives what a demodulation engine recovers from the audio.
+// The bit decoder is the usual sink; because every engine reports the
+// same way, their results can be compared or combined.
+type bitSink interface {
+	// halfCycle reports a half-cycle starting at sample offset at and
+	// lasting length samples
+	halfCycle(at, length int)
+
+	// finish reports the end of the stream, the last half-cycle having
+	// ended at sample offset at
+	finish(at int)
+}
+
+// demodulator recovers half-cycles from consecutive windows of samples
+type demodulator interface {
+	feed(window []float64, sink bitSink)
+
+	// flush reports anything held back and ends the stream
+	flush(sink bitSink)
+}
+
+func newDemodulator(opts Options, sampleRate uint32) demodulator {
+	switch opts.Demod {
+	case DemodGoertzel:
+		return newCellDemod(opts.timing(), sampleRate, goertzelDetector{}, opts.TrackSpeed)
+	case DemodMatched:
+		return newCellDemod(opts.timing(), sampleRate, &matchedDetector{}, opts.TrackSpeed)
+	case DemodPeak:
+		return newPeakTracker(sampleRate)
+	case DemodPulse:
+		return newPulseTracker(sampleRate)
+	}
+	return newCrossingTracker()
+}
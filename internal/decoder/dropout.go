@@ -0,0 +1,108 @@
+package decoder
+
+import "math"
+
+// Dropout detection. A dropout is where oxide damage or poor head contact
+// makes the signal collapse for a few milliseconds before it recovers.
+// Zero crossings inside one are noise, so the bit decoder treats the bytes
+// they touch as erasures instead of decoding garbage.
+const (
+	DropoutBlock = 0.001 // seconds per envelope measurement
+	DropoutRatio = 0.25  // envelope below this fraction of the running level
+	MinDropout   = 0.002 // seconds; shorter dips are ignored
+	MaxDropout   = 0.250 // seconds; longer collapses are the signal ending
+
+	// dropoutSmoothing is how far the running level moves toward each
+	// block's peak, giving a time constant of about 20 blocks
+	dropoutSmoothing = 0.05
+)
+
+// dropoutDetector follows the signal envelope a block at a time and
+// reports spans where it collapses and recovers. Windows may be fed in
+// pieces of any size.
+type dropoutDetector struct {
+	block  int // samples per envelope block
+	minLen int
+	maxLen int
+
+	pos   int     // absolute offset of the next sample
+	fill  int     // samples in the current block
+	peak  float64 // largest magnitude in the current block
+	level float64 // running signal level
+	start int     // start of the dropout in progress, -1 if none
+
+	found [][2]int
+}
+
+func newDropoutDetector(sampleRate uint32) *dropoutDetector {
+	rate := float64(sampleRate)
+	return &dropoutDetector{
+		block:  max(1, int(DropoutBlock*rate)),
+		minLen: int(MinDropout * rate),
+		maxLen: int(MaxDropout * rate),
+		start:  -1,
+	}
+}
+
+// findDropouts returns the [start, end) sample spans of every dropout
+func findDropouts(samples []float64, sampleRate uint32) [][2]int {
+	d := newDropoutDetector(sampleRate)
+	d.feed(samples)
+	return d.found
+}
+
+func (d *dropoutDetector) feed(window []float64) {
+	// A block at a time, so that the loop over its samples does nothing
+	// but find the peak
+	for len(window) > 0 {
+		n := min(len(window), d.block-d.fill)
+		peak := d.peak
+		for _, s := range window[:n] {
+			if s = math.Abs(s); s > peak {
+				peak = s
+			}
+		}
+		d.peak = peak
+		d.pos += n
+		d.fill += n
+		window = window[n:]
+		if d.fill == d.block {
+			d.endBlock(d.pos - d.block)
+			d.fill = 0
+			d.peak = 0
+		}
+	}
+}
+
+func (d *dropoutDetector) endBlock(at int) {
+	collapsed := d.peak < DropoutRatio*d.level
+	if d.start < 0 {
+		if collapsed && d.level > SilenceLevel {
+			d.start = at
+			return
+		}
+		d.level += (d.peak - d.level) * dropoutSmoothing
+		return
+	}
+
+	switch {
+	case !collapsed:
+		if at-d.start >= d.minLen {
+			d.found = append(d.found, [2]int{d.start, at})
+		}
+		d.start = -1
+	case at-d.start > d.maxLen:
+		// The signal ended rather than dropping out; follow it down
+		d.start = -1
+		d.level = d.peak
+	}
+}
+
+// settled returns the sample offset before which every dropout has been
+// reported. Anything that starts later may still turn out to be one.
+func (d *dropoutDetector) settled() int {
+	if d.start >= 0 {
+		return d.start
+	}
+	return d.pos - d.fill
+}
@@ -0,0 +1,199 @@
+package decoder
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+)
+
+// Encodings described rather than programmed. Many obscure machines
+// differ from a coding wavrider already reads only in its settings: the
+// tones, how bits are timed, the sync byte, how bytes are framed and how
+// records are checked. An Encoding gives those settings, as a file can,
+// and makes a system of them, so such a machine needs no code of its own.
+// Settings left at zero take the coding's own.
+
+// Encoding describes a tape format in terms of one of the codings whose
+// settings can be changed
+type Encoding struct {
+	Coding string `toml:"coding"` // serial, biphase or pwm
+
+	// Tones and bit cells
+	Baud       float64 `toml:"baud"`        // serial and biphase bits a second
+	Mark       float64 `toml:"mark-hz"`     // serial 1 bits and idle line
+	Space      float64 `toml:"space-hz"`    // serial 0 bits
+	Zero       float64 `toml:"zero-us"`     // microseconds each cycle of a pwm 0 bit lasts
+	One        float64 `toml:"one-us"`      // and of a 1 bit
+	ZeroCycles int     `toml:"zero-cycles"` // cycles in a pwm 0 bit
+	OneCycles  int     `toml:"one-cycles"`  // and in a 1 bit
+	Gap        float64 `toml:"gap-us"`      // microseconds of quiet after every pwm bit
+
+	// The leader and sync byte before each biphase or pwm record
+	Leader int   `toml:"leader-bit"`
+	Sync   *byte `toml:"sync-byte"`
+
+	// Framing
+	DataBits int       `toml:"data-bits"` // data bits in each byte
+	Parity   Parity    `toml:"parity"`    // parity bit after the data bits
+	StopBits float64   `toml:"stop-bits"` // stop bits after each byte, which then starts with a start bit
+	Order    *BitOrder `toml:"bit-order"` // order of each byte's bits
+
+	// Checksum is how records are checked: none, or one of Checksums
+	// ending each record. ChecksumSeed and ChecksumOrder, big or little
+	// endian, replace the algorithm's own.
+	Checksum      string  `toml:"checksum"`
+	ChecksumSeed  *uint32 `toml:"checksum-seed"`
+	ChecksumOrder string  `toml:"checksum-order"`
+}
+
+// uses lists the settings each coding has a use for
+var uses = map[string][]string{
+	"serial":  {"baud", "mark-hz", "space-hz", "data-bits", "parity", "stop-bits", "bit-order"},
+	"biphase": {"baud", "leader-bit", "sync-byte", "data-bits", "parity", "stop-bits", "bit-order"},
+	"pwm":     {"zero-us", "one-us", "zero-cycles", "one-cycles", "gap-us", "leader-bit", "sync-byte", "data-bits", "parity", "stop-bits", "bit-order"},
+}
+
+// System returns a system called name that decodes tapes of the encoding
+func (e Encoding) System(name string) (*System, error) {
+	if e.Coding == "" {
+		return nil, errors.New("no coding given: serial, biphase or pwm")
+	}
+	used, ok := uses[e.Coding]
+	if !ok {
+		return nil, fmt.Errorf("unknown coding %q, not serial, biphase or pwm", e.Coding)
+	}
+	for _, key := range e.given() {
+		if !slices.Contains(used, key) {
+			return nil, fmt.Errorf("%s coding has no use for %s", e.Coding, key)
+		}
+	}
+	var s *System
+	var err error
+	switch e.Coding {
+	case "serial":
+		s, err = uartSystem.WithSerial(e.serial())
+	case "biphase":
+		s, err = biphaseSystem.WithBiphase(e.biphase())
+	case "pwm":
+		s, err = pwmSystem.WithPWM(e.pwm())
+	}
+	if err != nil {
+		return nil, err
+	}
+	s.Name = name
+	if e.Checksum == "" || e.Checksum == "none" {
+		if e.ChecksumSeed != nil || e.ChecksumOrder != "" {
+			return nil, errors.New("checksum-seed and checksum-order need a checksum")
+		}
+		return s, nil
+	}
+	c, ok := Checksums[e.Checksum]
+	if !ok {
+		return nil, fmt.Errorf("unknown checksum %q, not none or %s", e.Checksum, ChecksumNames())
+	}
+	if e.ChecksumSeed != nil {
+		c.Seed = *e.ChecksumSeed
+	}
+	switch e.ChecksumOrder {
+	case "":
+	case "big":
+		c.BigEndian = true
+	case "little":
+		c.BigEndian = false
+	default:
+		return nil, fmt.Errorf("unknown checksum-order %q, not big or little", e.ChecksumOrder)
+	}
+	s.checksum = &c
+	s.check = func(r *record) bool { return c.ok(r) && cleanlyFramed(r) }
+	s.payload = func(data []byte) int { return max(0, len(data)-c.Size) }
+	s.trailer = c.Size
+	return s, nil
+}
+
+// given returns the settings of a coding that are not left at zero
+func (e Encoding) given() []string {
+	var keys []string
+	for _, s := range []struct {
+		key string
+		set bool
+	}{
+		{"baud", e.Baud != 0},
+		{"mark-hz", e.Mark != 0},
+		{"space-hz", e.Space != 0},
+		{"zero-us", e.Zero != 0},
+		{"one-us", e.One != 0},
+		{"zero-cycles", e.ZeroCycles != 0},
+		{"one-cycles", e.OneCycles != 0},
+		{"gap-us", e.Gap != 0},
+		{"leader-bit", e.Leader != 0},
+		{"sync-byte", e.Sync != nil},
+		{"data-bits", e.DataBits != 0},
+		{"parity", e.Parity != ParityNone},
+		{"stop-bits", e.StopBits != 0},
+		{"bit-order", e.Order != nil},
+	} {
+		if s.set {
+			keys = append(keys, s.key)
+		}
+	}
+	return keys
+}
+
+// or returns v, or if it is zero, def
+func or[T comparable](v, def T) T {
+	var zero T
+	if v == zero {
+		return def
+	}
+	return v
+}
+
+// framing returns the encoding's framing, taking what it leaves at zero
+// from def
+func (e Encoding) framing(def Framing) Framing {
+	f := Framing{
+		Order:    def.Order,
+		DataBits: or(e.DataBits, def.DataBits),
+		Parity:   e.Parity,
+		StopBits: or(e.StopBits, def.StopBits),
+	}
+	if e.Order != nil {
+		f.Order = *e.Order
+	}
+	return f
+}
+
+func (e Encoding) serial() Serial {
+	return Serial{
+		Baud:    or(e.Baud, Bell103.Baud),
+		Framing: e.framing(Bell103.Framing),
+		Mark:    or(e.Mark, Bell103.Mark),
+		Space:   or(e.Space, Bell103.Space),
+	}
+}
+
+func (e Encoding) biphase() Biphase {
+	b := Biphase1200
+	b.Baud = or(e.Baud, b.Baud)
+	b.Leader = e.Leader
+	if e.Sync != nil {
+		b.Sync = *e.Sync
+	}
+	b.Framing = e.framing(b.Framing)
+	return b
+}
+
+func (e Encoding) pwm() PWM {
+	c := PulseWidth
+	c.Zero = or(e.Zero/1e6, c.Zero)
+	c.One = or(e.One/1e6, c.One)
+	c.ZeroCycles = or(e.ZeroCycles, c.ZeroCycles)
+	c.OneCycles = or(e.OneCycles, c.OneCycles)
+	c.Gap = e.Gap / 1e6
+	c.Leader = e.Leader
+	if e.Sync != nil {
+		c.Sync = *e.Sync
+	}
+	c.Framing = e.framing(c.Framing)
+	return c
+}
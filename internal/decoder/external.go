@@ -0,0 +1,182 @@
+//go:build !js
+
+package decoder
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"os/exec"
+	"strings"
+)
+
+// External decoders. A format wavrider does not know can be read by a
+// program of its own, which wavrider runs for each stretch of audio it
+// decodes and talks to over its standard input and output. wavrider
+// writes a line
+//
+//	wavrider 1 RATE
+//
+// giving the version of the protocol and the sample rate, then a line
+//
+//	AT LENGTH
+//
+// for each half-cycle, the sample it starts at and how many it lasts,
+// and closes the stream at the end of the audio. The decoder writes a
+// JSON object for each record it finds, one to a line:
+//
+//	{"start": 1234, "end": 5678, "data": "AQID", "errors": 0}
+//
+// giving the samples the record starts and ends at, its bytes in base64,
+// and how many of them it could not read cleanly; a record with none is
+// intact. Records must lie within the audio: one starting before it, or
+// ending before it starts or after the audio does, is dropped. What the
+// decoder writes to standard error is logged, a warning for each line.
+const ExternalProtocol = 1
+
+// externalRecord is a record as an external decoder writes it
+type externalRecord struct {
+	Start  int    `json:"start"`
+	End    int    `json:"end"`
+	Data   []byte `json:"data"`
+	Errors int    `json:"errors"`
+}
+
+// ExternalSystem returns a system whose tapes the program at path
+// decodes, speaking the protocol above. The WebAssembly build, which
+// runs no programs, has none.
+func ExternalSystem(name, path string) *System {
+	return &System{
+		Name: name,
+		// Every half-cycle is handed on as it is, so none is a header
+		// tone to split a long capture inside
+		Timing:    &Timing{Short: math.Inf(1), Long: math.Inf(1)},
+		Demods:    []Demod{DemodZeroCrossing, DemodPeak},
+		newFramer: func() framer { return &externalFramer{path: path} },
+		check:     cleanlyFramed,
+		payload:   func(data []byte) int { return len(data) },
+		pack:      concatBlocks,
+		selfTimed: true,
+	}
+}
+
+// externalFramer hands half-cycles to an external decoder, started with
+// the first of them, and reads back the records it found once the audio
+// ends
+type externalFramer struct {
+	path    string
+	cmd     *exec.Cmd
+	in      io.WriteCloser
+	w       *bufio.Writer
+	records chan []externalRecord
+	stderr  *lineLogger
+	err     error
+}
+
+func (f *externalFramer) halfCycle(d *bitDecoder, _ pulse) {
+	if f.err != nil {
+		return
+	}
+	if f.cmd == nil {
+		f.err = f.start(d)
+		if f.err != nil {
+			d.warnf("%s: %v", f.path, f.err)
+			return
+		}
+	}
+	fmt.Fprintf(f.w, "%d %d\n", d.at, d.end-d.at)
+}
+
+// start runs the decoder and sends it the first line
+func (f *externalFramer) start(d *bitDecoder) error {
+	f.cmd = exec.Command(f.path)
+	f.stderr = &lineLogger{log: func(line string) { d.warnf("%s: %s", f.path, line) }}
+	f.cmd.Stderr = f.stderr
+	var err error
+	if f.in, err = f.cmd.StdinPipe(); err != nil {
+		return err
+	}
+	out, err := f.cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	if err := f.cmd.Start(); err != nil {
+		return err
+	}
+	// Records are read as they come, so that a decoder writing them
+	// early never waits on a full pipe while wavrider waits on it
+	f.records = make(chan []externalRecord, 1)
+	go func() {
+		var records []externalRecord
+		lines := bufio.NewScanner(out)
+		lines.Buffer(nil, math.MaxInt32)
+		for lines.Scan() {
+			var r externalRecord
+			if err := json.Unmarshal(lines.Bytes(), &r); err != nil {
+				d.warnf("%s: %v", f.path, err)
+				continue
+			}
+			records = append(records, r)
+		}
+		io.Copy(io.Discard, out)
+		f.records <- records
+	}()
+	f.w = bufio.NewWriter(f.in)
+	_, err = fmt.Fprintf(f.w, "wavrider %d %.0f\n", ExternalProtocol, d.rate)
+	return err
+}
+
+// finish ends the audio and opens and closes each record the decoder
+// found, as the bit decoder's own framers do
+func (f *externalFramer) finish(d *bitDecoder, at int) {
+	if f.cmd == nil || f.records == nil {
+		return
+	}
+	f.w.Flush()
+	f.in.Close()
+	records := <-f.records
+	if err := f.cmd.Wait(); err != nil {
+		d.warnf("%s: %v", f.path, err)
+	}
+	f.stderr.flush()
+	for _, r := range records {
+		if r.Start < 0 || r.End < r.Start || r.End > at {
+			d.warnf("%s: dropped a record at samples %d to %d, not within the %d of the audio", f.path, r.Start, r.End, at)
+			continue
+		}
+		d.open = &record{
+			system: d.system, headerStart: r.Start, dataStart: r.Start, data: r.Data,
+			cells: len(r.Data), cellErrors: r.Errors,
+		}
+		d.closeRecord(r.End)
+	}
+}
+
+// lineLogger logs what is written to it a line at a time
+type lineLogger struct {
+	log     func(line string)
+	partial []byte
+}
+
+func (l *lineLogger) Write(p []byte) (int, error) {
+	l.partial = append(l.partial, p...)
+	for {
+		i := bytes.IndexByte(l.partial, '\n')
+		if i < 0 {
+			return len(p), nil
+		}
+		l.log(strings.TrimRight(string(l.partial[:i]), "\r"))
+		l.partial = l.partial[i+1:]
+	}
+}
+
+// flush logs the last line, if it did not end with a newline
+func (l *lineLogger) flush() {
+	if len(l.partial) > 0 {
+		l.log(string(l.partial))
+		l.partial = nil
+	}
+}
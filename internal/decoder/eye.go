@@ -0,0 +1,128 @@
+package decoder
+
+import "slices"
+
+// Eye diagram. Every half-cycle read inside a record is counted in a
+// histogram of its length, after any speed correction, so that how far
+// each pulse class keeps from the thresholds between them shows how
+// close a decode came to failing. Laid on its side, the gap between two
+// classes is the opening of an eye diagram.
+const (
+	EyeBins = 100   // bins between zero and twice the Long threshold
+	EyeTail = 0.001 // fraction of each class's half-cycles at its edges ignored, as hiss
+)
+
+// Eye is how the half-cycles of a tape's records spread about the
+// thresholds that classify them
+type Eye struct {
+	BinWidth float64 // seconds
+	Counts   []int   // half-cycles in each bin; the last also holds all longer
+	Openings []EyeOpening
+}
+
+// EyeOpening is the gap between the classes either side of a threshold.
+// Times are in seconds.
+type EyeOpening struct {
+	Threshold float64
+	Below     float64 // the longest half-cycle of the shorter class, less the tail
+	Above     float64 // the shortest of the longer class, less the tail
+
+	// Opening is the gap between Below and Above as a fraction of the gap
+	// between the two classes' nominal lengths: 1 when every half-cycle
+	// is at its nominal length, 0 or less when the classes meet
+	Opening float64
+}
+
+// eyeCounts is a histogram of half-cycle lengths for an Eye
+type eyeCounts []int
+
+// add counts a half-cycle lasting seconds, for timing t
+func (e *eyeCounts) add(seconds float64, t *Timing) {
+	if *e == nil {
+		*e = make(eyeCounts, EyeBins+1)
+	}
+	(*e)[min(EyeBins, max(0, int(seconds/eyeBin(t))))]++
+}
+
+func eyeBin(t *Timing) float64 {
+	return 2 * t.Long / EyeBins
+}
+
+// newEye sums the records' half-cycles into an Eye for timing t. It is
+// nil if the records held none.
+func newEye(records []record, t *Timing) *Eye {
+	counts := make([]int, EyeBins+1)
+	total := 0
+	for _, r := range records {
+		for i, n := range r.eye {
+			counts[i] += n
+			total += n
+		}
+	}
+	if total == 0 {
+		return nil
+	}
+	e := &Eye{BinWidth: eyeBin(t), Counts: counts}
+
+	// Only thresholds with a class on either side have an eye; past the
+	// longest class is silence
+	thresholds := []float64{t.Short, t.Long}
+	for i, threshold := range thresholds {
+		low, high := t.Nominal[i], t.Nominal[i+1]
+		if low == 0 || high == 0 {
+			continue
+		}
+		split := min(EyeBins, int(threshold/e.BinWidth))
+		end := len(counts)
+		if i+1 < len(thresholds) {
+			end = min(EyeBins, int(thresholds[i+1]/e.BinWidth))
+		}
+		start := 0
+		if i > 0 {
+			start = min(EyeBins, int(thresholds[i-1]/e.BinWidth))
+		}
+		below, ok := e.tail(start, split, true)
+		if !ok {
+			continue
+		}
+		above, ok := e.tail(split, end, false)
+		if !ok {
+			continue
+		}
+		e.Openings = append(e.Openings, EyeOpening{
+			Threshold: threshold,
+			Below:     below,
+			Above:     above,
+			Opening:   (above - below) / (high - low),
+		})
+	}
+	return e
+}
+
+// tail returns the edge of the half-cycles in bins [from, to) nearest
+// the other class: the top of the longest bin past the tail if upper,
+// else the bottom of the shortest
+func (e *Eye) tail(from, to int, upper bool) (float64, bool) {
+	bins := e.Counts[from:to]
+	total := 0
+	for _, n := range bins {
+		total += n
+	}
+	if total == 0 {
+		return 0, false
+	}
+	if upper {
+		bins = slices.Clone(bins)
+		slices.Reverse(bins)
+	}
+	skip := int(EyeTail * float64(total))
+	for i, n := range bins {
+		if skip -= n; skip < 0 {
+			if upper {
+				return float64(to-i) * e.BinWidth, true
+			}
+			return float64(from+i) * e.BinWidth, true
+		}
+	}
+	return 0, false
+}
@@ -0,0 +1,28 @@
+//go:build !js
+
+package decoder
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// fetch downloads a capture from an http or https URL, returning it to
+// read as it arrives, the download stopping once ctx is done
+func fetch(ctx context.Context, url string) (io.ReadCloser, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("fetching %s: %s", url, resp.Status)
+	}
+	return resp.Body, nil
+}
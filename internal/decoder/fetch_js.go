@@ -0,0 +1,15 @@
+//go:build js
+
+package decoder
+
+import (
+	"context"
+	"errors"
+	"io"
+)
+
+// fetch cannot download captures in the browser, where the page hands
+// the decoder the bytes it has fetched
+func fetch(ctx context.Context, url string) (io.ReadCloser, error) {
+	return nil, errors.ErrUnsupported
+}
@@ -0,0 +1,184 @@
+package decoder
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"strings"
+)
+
+// IsURL reports whether a capture's name is an http or https URL rather
+// than a file
+func IsURL(name string) bool {
+	return strings.HasPrefix(name, "http://") || strings.HasPrefix(name, "https://")
+}
+
+// Open opens a capture by name: a file, "-" for standard input, an http
+// or https URL, which is read as it downloads, or a capture in an archive
+// as SplitArchive splits it, or an archive holding one. Captures
+// compressed with gzip or zstd are decompressed.
+func Open(name string) (io.ReadCloser, error) {
+	return openContext(context.Background(), name)
+}
+
+// openContext opens a capture as Open does, a download stopping once ctx
+// is done
+func openContext(ctx context.Context, name string) (io.ReadCloser, error) {
+	if archive, member, ok := SplitArchive(name); ok || IsArchive(name) {
+		return openArchive(ctx, archive, member)
+	}
+	return openDecompressed(ctx, name)
+}
+
+// OpenMapped opens a capture as Open does, except that a local file that
+// is neither compressed nor in an archive is mapped into memory rather
+// than read, so that the samples of a large one are converted where they
+// lie instead of being copied in through reads. Where a file cannot be
+// mapped it is read as Open reads it.
+func OpenMapped(name string) (io.ReadCloser, error) {
+	return openMapped(context.Background(), name)
+}
+
+// openMapped opens a capture as OpenMapped does, a download stopping once
+// ctx is done
+func openMapped(ctx context.Context, name string) (io.ReadCloser, error) {
+	if _, _, ok := SplitArchive(name); ok || IsArchive(name) || IsURL(name) || name == Stdin {
+		return openContext(ctx, name)
+	}
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	info, err := f.Stat()
+	if err != nil || !info.Mode().IsRegular() || info.Size() == 0 {
+		f.Close()
+		return openContext(ctx, name)
+	}
+	data, unmap, err := mapFile(f, info.Size())
+	f.Close()
+	if err != nil {
+		return openContext(ctx, name)
+	}
+	if bytes.HasPrefix(data, gzipMagic) || bytes.HasPrefix(data, zstdMagic) {
+		unmap()
+		return openContext(ctx, name)
+	}
+	return &mappedFile{Reader: bytes.NewReader(data), data: data, unmap: unmap}, nil
+}
+
+// mappedFile reads a file mapped into memory
+type mappedFile struct {
+	*bytes.Reader
+	data  []byte
+	unmap func() error
+}
+
+func (m *mappedFile) Close() error {
+	return m.unmap()
+}
+
+// unread returns the bytes not yet read, where they are mapped
+func (m *mappedFile) unread() []byte {
+	return m.data[len(m.data)-m.Len():]
+}
+
+// open opens a capture as the options ask, mapped or read, a download
+// stopping once the Context is done
+func (o Options) open(name string) (io.ReadCloser, error) {
+	ctx := o.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	open := openContext
+	if o.Mmap {
+		open = openMapped
+	}
+	f, err := open(ctx, name)
+	if err != nil || o.Source == nil {
+		return f, err
+	}
+	if m, ok := f.(*mappedFile); ok {
+		// Mapped, it is all there to be copied at once
+		if _, err := o.Source.Write(m.data); err != nil {
+			m.Close()
+			return nil, err
+		}
+		return m, nil
+	}
+	return &sourceFile{Reader: io.TeeReader(f, o.Source), file: f}, nil
+}
+
+// sourceFile is a capture whose bytes are copied to Options.Source as
+// they are read
+type sourceFile struct {
+	io.Reader
+	file io.ReadCloser
+}
+
+func (s *sourceFile) Close() error {
+	return s.file.Close()
+}
+
+// copySource copies to o.Source what the decode left unread of f, opened
+// by o.open
+func (o Options) copySource(f io.Reader) error {
+	if _, ok := f.(*sourceFile); !ok || o.stopping() {
+		return nil
+	}
+	_, err := io.Copy(io.Discard, f)
+	return err
+}
+
+// Stdin is the name Open takes for standard input
+const Stdin = "-"
+
+// openStream opens a file, standard input or a URL, a download stopping
+// once ctx is done
+func openStream(ctx context.Context, name string) (io.ReadCloser, error) {
+	switch {
+	case name == Stdin:
+		return io.NopCloser(os.Stdin), nil
+	case IsURL(name):
+		return fetch(ctx, name)
+	}
+	return os.Open(name)
+}
+
+// Decode reads a WAV file and attempts to decode the tape data on it
+func Decode(filename string, opts Options) ([]byte, error) {
+	data, _, err := DecodeWithCatalog(filename, opts)
+	return data, err
+}
+
+// DecodeWithCatalog decodes a WAV file like Decode and also returns a
+// catalog of the silences, header tones and programs found on the tape.
+// The file is named as Open takes it, and mapped into memory instead if
+// opts.Mmap is set.
+func DecodeWithCatalog(filename string, opts Options) ([]byte, *Catalog, error) {
+	f, err := opts.open(filename)
+	if err != nil {
+		return nil, opts.interrupted(), opts.stopped(err)
+	}
+	defer f.Close()
+	data, catalog, err := DecodeReader(f, opts)
+	if err == nil {
+		err = opts.copySource(f)
+	}
+	return data, catalog, err
+}
+
+// DecodeFileRecords decodes a WAV file into its records, as DecodeRecords
+// does a stream. The file is opened as DecodeWithCatalog opens it.
+func DecodeFileRecords(filename string, opts Options) ([]Record, *Catalog, error) {
+	f, err := opts.open(filename)
+	if err != nil {
+		return nil, opts.interrupted(), opts.stopped(err)
+	}
+	defer f.Close()
+	records, catalog, err := DecodeRecords(f, opts)
+	if err == nil {
+		err = opts.copySource(f)
+	}
+	return records, catalog, err
+}
@@ -0,0 +1,263 @@
+package decoder
+
+import (
+	"fmt"
+	"math/bits"
+)
+
+// How a byte's bits are framed on tape. Most computers send a byte as a
+// bare run of eight data bits, and decode it by shifting them in as they
+// come; asynchronous serial wraps fewer or more in a start bit, a parity
+// bit and stop bits. Which bit comes first differs either way, the Apple
+// ][ monitor's RDBYTE rotating them in MSB first with ROL and a UART LSB
+// first. Systems give their framing rather than the shift logic assuming
+// one. Where a framing has a start bit, 1 bits between bytes are the line
+// idling and the first 0 starts the next byte; a wrong parity bit or a
+// missing stop bit marks the byte, and a 0 where a stop bit should be is
+// taken as the next start bit, as a UART would.
+
+// Framing describes how each byte's bits are sent
+type Framing struct {
+	Order    BitOrder // the order the data bits are sent in
+	DataBits int      // 5 to 8; 0 is taken as 8
+	Parity   Parity   // the parity bit after the data bits
+	StopBits float64  // 1, 1.5 or 2 after each byte, which then starts with a start bit; 0 for none
+}
+
+// Bare8 is eight data bits MSB first and nothing else, the framing of
+// systems that give none
+var Bare8 = Framing{Order: MSBFirst, DataBits: 8}
+
+// Serial8N1 is the usual framing of asynchronous serial: a start bit,
+// eight data bits LSB first, no parity and a stop bit
+var Serial8N1 = Framing{Order: LSBFirst, DataBits: 8, Parity: ParityNone, StopBits: 1}
+
+// check returns an error if the framing cannot be decoded
+func (f Framing) check() error {
+	switch {
+	case f.DataBits < 5 || f.DataBits > 8:
+		return fmt.Errorf("%d data bits is not between 5 and 8", f.DataBits)
+	case f.StopBits != 0 && f.StopBits != 1 && f.StopBits != 1.5 && f.StopBits != 2:
+		return fmt.Errorf("%v stop bits is not 0, 1, 1.5 or 2", f.StopBits)
+	}
+	return nil
+}
+
+// whole returns an error unless the framing has whole stop bits, as
+// codings of bit cells need
+func (f Framing) whole(coding string) error {
+	if f.StopBits != float64(int(f.StopBits)) {
+		return fmt.Errorf("%s bytes cannot have %v stop bits, only whole ones", coding, f.StopBits)
+	}
+	return nil
+}
+
+// dataBits returns how many data bits each byte has
+func (f Framing) dataBits() int {
+	if f.DataBits == 0 {
+		return 8
+	}
+	return f.DataBits
+}
+
+// bits returns the length of a frame in bits
+func (f Framing) bits() float64 {
+	n := float64(f.dataBits()) + f.StopBits
+	if f.StopBits > 0 {
+		n++ // the start bit
+	}
+	if f.Parity != ParityNone {
+		n++
+	}
+	return n
+}
+
+// framePart is what a bit of a frame is
+type framePart int
+
+const (
+	partStart framePart = iota
+	partData
+	partParity
+	partStop
+)
+
+// part returns what the ith bit of a frame is, counting whole stop bits
+func (f Framing) part(i int) framePart {
+	if f.StopBits > 0 {
+		if i == 0 {
+			return partStart
+		}
+		i--
+	}
+	if i < f.dataBits() {
+		return partData
+	}
+	if f.Parity != ParityNone && i == f.dataBits() {
+		return partParity
+	}
+	return partStop
+}
+
+// parityBit returns the parity bit that ones 1 data bits call for
+func (f Framing) parityBit(ones int) bool {
+	switch f.Parity {
+	case ParityEven:
+		return ones%2 == 1
+	case ParityOdd:
+		return ones%2 == 0
+	case ParityMark:
+		return true
+	}
+	return false
+}
+
+// FrameError is a byte whose framing bits were wrong
+type FrameError struct {
+	Offset int  // of the byte in the record's data
+	Parity bool // its parity bit was wrong
+	Stop   bool // a stop bit was missing
+}
+
+// frameErrorAt returns the error of the byte at offset, if errs has one
+func frameErrorAt(errs []FrameError, offset int) (FrameError, bool) {
+	for _, e := range errs {
+		if e.Offset == offset {
+			return e, true
+		}
+	}
+	return FrameError{}, false
+}
+
+// frame returns the bits that send v, framing bits and all, counting
+// whole stop bits
+func (f Framing) frame(v byte) []int {
+	var bits []int
+	if f.StopBits > 0 {
+		bits = append(bits, 0)
+	}
+	ones := 0
+	for i := range f.dataBits() {
+		bit := f.bit(v, i)
+		ones += bit
+		bits = append(bits, bit)
+	}
+	if f.Parity != ParityNone {
+		bit := 0
+		if f.parityBit(ones) {
+			bit = 1
+		}
+		bits = append(bits, bit)
+	}
+	for range int(f.StopBits) {
+		bits = append(bits, 1)
+	}
+	return bits
+}
+
+// bit returns the ith data bit of v to be sent
+func (f Framing) bit(v byte, i int) int {
+	if f.Order == LSBFirst {
+		return int(v >> i & 1)
+	}
+	return int(v >> (f.dataBits() - 1 - i) & 1)
+}
+
+// value returns the byte whose data bits were shifted in as received,
+// the last lowest
+func (f Framing) value(shifted byte) byte {
+	n := f.dataBits()
+	if f.Order == LSBFirst {
+		return bits.Reverse8(shifted) >> (8 - n)
+	}
+	return shifted & byte(1<<n-1)
+}
+
+// BitOrder is the order a byte's bits are sent in
+type BitOrder int
+
+const (
+	MSBFirst BitOrder = iota // the most significant bit first
+	LSBFirst                 // the least significant bit first
+)
+
+func (o BitOrder) String() string {
+	if o == LSBFirst {
+		return "lsb"
+	}
+	return "msb"
+}
+
+// ParseBitOrder parses a bit order as printed by BitOrder.String
+func ParseBitOrder(s string) (BitOrder, error) {
+	switch s {
+	case "msb":
+		return MSBFirst, nil
+	case "lsb":
+		return LSBFirst, nil
+	}
+	return 0, fmt.Errorf("unknown bit order %q, not msb or lsb", s)
+}
+
+func (o BitOrder) MarshalText() ([]byte, error) {
+	return []byte(o.String()), nil
+}
+
+func (o *BitOrder) UnmarshalText(b []byte) error {
+	v, err := ParseBitOrder(string(b))
+	if err != nil {
+		return err
+	}
+	*o = v
+	return nil
+}
+
+// Parity selects the parity bit of an asynchronous serial byte
+type Parity int
+
+const (
+	ParityNone  Parity = iota // no parity bit
+	ParityEven                // the data and parity bits hold an even number of 1s
+	ParityOdd                 // an odd number of 1s
+	ParityMark                // the parity bit is always 1
+	ParitySpace               // the parity bit is always 0
+)
+
+func (p Parity) String() string {
+	switch p {
+	case ParityNone:
+		return "none"
+	case ParityEven:
+		return "even"
+	case ParityOdd:
+		return "odd"
+	case ParityMark:
+		return "mark"
+	case ParitySpace:
+		return "space"
+	}
+	return "unknown"
+}
+
+// ParseParity parses a parity name as printed by Parity.String
+func ParseParity(s string) (Parity, error) {
+	for _, p := range []Parity{ParityNone, ParityEven, ParityOdd, ParityMark, ParitySpace} {
+		if s == p.String() {
+			return p, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown parity %q", s)
+}
+
+func (p Parity) MarshalText() ([]byte, error) {
+	return []byte(p.String()), nil
+}
+
+func (p *Parity) UnmarshalText(b []byte) error {
+	v, err := ParseParity(string(b))
+	if err != nil {
+		return err
+	}
+	*p = v
+	return nil
+}
@@ -0,0 +1,35 @@
+package decoder
+
+import (
+	"math"
+	"math/cmplx"
+)
+
+// goertzel returns the single-bin DFT of x at omega radians per sample,
+// with phase measured from the first sample
+func goertzel(x []float64, omega float64) complex128 {
+	coeff := 2 * math.Cos(omega)
+	var s1, s2 float64
+	for _, v := range x {
+		s1, s2 = v+coeff*s1-s2, s1
+	}
+	y := complex(s1, 0) - cmplx.Exp(complex(0, -omega))*complex(s2, 0)
+	return y * cmplx.Exp(complex(0, -omega*float64(len(x)-1)))
+}
+
+// level is the amplitude of the tone at omega in x
+func level(x []float64, omega float64) float64 {
+	return 2 * cmplx.Abs(goertzel(x, omega)) / float64(len(x))
+}
+
+// goertzelDetector measures a cell's energy at each tone's frequency and
+// reads the timing error from the tone's phase
+type goertzelDetector struct{}
+
+func (goertzelDetector) match(samples func(at, n int) []float64, at, n int, omega float64) (float64, float64) {
+	x := goertzel(samples(at, n), omega)
+	// A cell starting exactly at at is a sine, phase -π/2 (or π/2 if the
+	// recording is inverted); any difference is how far off the cell is
+	drift := -math.Remainder(cmplx.Phase(x)+math.Pi/2, math.Pi) / omega
+	return 2 * cmplx.Abs(x) / float64(n), drift
+}
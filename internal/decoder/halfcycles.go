@@ -0,0 +1,65 @@
+package decoder
+
+import (
+	"fmt"
+	"math"
+)
+
+// Half-cycles fed straight to the bit decoder, skipping the audio and
+// the demodulators, so that its state machine can be driven with exact
+// sequences: a header tone a half-cycle short, a sync bit a little off, a
+// cell whose halves disagree, a record cut off mid-byte. Lengths are in
+// seconds, timed on a clock of HalfCycleRate, fine enough that rounding
+// them to it never matters. Quiet is a half-cycle as long as it lasts, as
+// the crossing detector would measure it.
+const HalfCycleRate = 1_000_000 // Hz; the clock half-cycles are timed on
+
+// DecodeHalfCycles feeds half-cycles of the given lengths through the
+// system's bit decoder, as though a demodulator had found them, and
+// returns the records decoded, identified as far as the system allows,
+// and how many bit cells could not be read. Only the options the bit
+// decoder heeds apply: the system and timing, TrackSpeed, the speed the
+// timing is scaled by, Trace and Log.
+func DecodeHalfCycles(halves []float64, opts Options) ([]Record, int) {
+	d := newBitDecoder(opts.system(), opts.timing(), HalfCycleRate)
+	d.trackSpeed = opts.TrackSpeed
+	d.headerSpeed = opts.headerSpeed()
+	d.log = opts.Log
+	if opts.Trace != nil {
+		d.trace = &tracer{w: opts.Trace, rate: HalfCycleRate}
+	}
+	at := 0
+	for _, h := range halves {
+		n := max(1, int(math.Round(h*HalfCycleRate)))
+		d.halfCycle(at, n)
+		at += n
+	}
+	d.finish(at)
+
+	records := make([]Record, len(d.records))
+	for i, r := range d.records {
+		records[i] = r.export(HalfCycleRate)
+	}
+	opts.system().Identify(records)
+	return records, d.totalErrors
+}
+
+// EncodeHalfCycles returns the half-cycles of records written out as the
+// system saves them, one after another with RelaminateGap of quiet
+// between, for DecodeHalfCycles to read back or for a caller to alter
+// first
+func EncodeHalfCycles(records []Record, opts Options) ([]float64, error) {
+	s := opts.system()
+	if s.encode == nil {
+		return nil, fmt.Errorf("%s tapes cannot be written back", s.Name)
+	}
+	t := &tape{rate: HalfCycleRate, sign: 1, lengths: []float64{}}
+	for i, r := range records {
+		if i > 0 {
+			t.silence(RelaminateGap)
+		}
+		t.sign = 1
+		s.encode(t, opts.timing(), r)
+	}
+	return t.lengths, nil
+}
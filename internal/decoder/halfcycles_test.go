@@ -0,0 +1,83 @@
+package decoder
+
+import (
+	"bytes"
+	"math/rand/v2"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// TestFramersRoundTrip writes a record out as each system saves it,
+// reads it back through the system's framer, and writes and reads what
+// it read again, which must come back the same; then reads it cut off
+// three quarters of the way through, which must not check out
+func TestFramersRoundTrip(t *testing.T) {
+	random := rand.New(rand.NewPCG(3, 4))
+	data := make([]byte, 256)
+	for i := range data {
+		data[i] = byte(random.Uint32())
+	}
+	for name, s := range Systems {
+		if s.encode == nil {
+			continue
+		}
+		t.Run(name, func(t *testing.T) {
+			opts := Options{System: s}
+			rec := Record{LoadAddress: 0x800, Data: slices.Clone(data), ChecksumOK: true}
+			if s.checksum != nil {
+				rec.Data = append(rec.Data, s.checksum.Sum(data)...)
+			}
+			halves, err := EncodeHalfCycles([]Record{rec}, opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			first, _ := DecodeHalfCycles(halves, opts)
+			if len(first) == 0 {
+				t.Fatal("no records read back")
+			}
+			again, err := EncodeHalfCycles(first, opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			second, errors := DecodeHalfCycles(again, opts)
+			if errors != 0 {
+				t.Errorf("got %d cell errors reading it back", errors)
+			}
+			if len(second) != len(first) {
+				t.Fatalf("read back %d records, then %d", len(first), len(second))
+			}
+			for i := range first {
+				if !bytes.Equal(first[i].Data, second[i].Data) || first[i].ChecksumOK != second[i].ChecksumOK {
+					t.Errorf("record %d read back differently the second time", i+1)
+				}
+			}
+
+			cut, _ := DecodeHalfCycles(again[:len(again)*3/4], opts)
+			if len(cut) == len(first) && cut[len(cut)-1].ChecksumOK && bytes.Equal(cut[len(cut)-1].Data, first[len(first)-1].Data) {
+				t.Errorf("cut off, the last record still read back whole")
+			}
+		})
+	}
+}
+
+// TestDecodeHalfCyclesDeterministic reads the same half-cycles twice,
+// tracing both, which must agree to the last line
+func TestDecodeHalfCyclesDeterministic(t *testing.T) {
+	halves := appleHalves(100, true, 0x12, 0x34, 0xFF^0x12^0x34)
+	halves[len(halves)/2] *= 1.3
+	var traces [2]strings.Builder
+	var results [2][]Record
+	for i := range traces {
+		results[i], _ = DecodeHalfCycles(halves, Options{System: &appleIISystem, TrackSpeed: true, Trace: &traces[i]})
+	}
+	if traces[0].Len() == 0 {
+		t.Fatal("nothing traced")
+	}
+	if traces[0].String() != traces[1].String() {
+		t.Error("the two traces differ")
+	}
+	if len(results[0]) != 1 || !bytes.Equal(results[0][0].Data, results[1][0].Data) {
+		t.Errorf("read %d and %d records, differing", len(results[0]), len(results[1]))
+	}
+}
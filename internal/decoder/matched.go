@@ -0,0 +1,33 @@
+package decoder
+
+import "math"
+
+// matchedDetector correlates a cell against an ideal cycle of each tone,
+// sliding the template up to a quarter cycle either way and keeping the
+// best fit. The offset of the best fit is the cell's timing error.
+type matchedDetector struct {
+	template []float64
+}
+
+func (m *matchedDetector) match(samples func(at, n int) []float64, at, n int, omega float64) (float64, float64) {
+	t := m.template[:0]
+	for k := range n {
+		t = append(t, math.Sin(omega*float64(k)))
+	}
+	m.template = t
+
+	shift := n / 4
+	x := samples(at-shift, n+2*shift)
+	best, drift := 0.0, 0
+	for d := -shift; d <= shift; d++ {
+		var sum float64
+		for k, v := range x[d+shift : d+shift+n] {
+			sum += v * t[k]
+		}
+		// Either polarity is a match; recordings are often inverted
+		if sum = math.Abs(sum); sum > best {
+			best, drift = sum, d
+		}
+	}
+	return 2 * best / float64(n), float64(drift)
+}
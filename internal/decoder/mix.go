@@ -0,0 +1,137 @@
+package decoder
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Mix weights the channels of a capture to mix into the one decoded, the
+// first channel's weight first. Written as a sum such as "0.7L+0.3R",
+// each term is a weight and a channel, L or R for the first two and C1,
+// C2 and so on for any, the weight 1 if left out and negative to invert a
+// channel wired backwards. Weights are used as given, not scaled to sum
+// to 1, so "R" alone decodes the right channel.
+type Mix []float64
+
+func (m Mix) String() string {
+	var b strings.Builder
+	for i, w := range m {
+		if w == 0 {
+			continue
+		}
+		if w > 0 && b.Len() > 0 {
+			b.WriteByte('+')
+		}
+		switch w {
+		case 1:
+		case -1:
+			b.WriteByte('-')
+		default:
+			b.WriteString(strconv.FormatFloat(w, 'g', -1, 64))
+		}
+		b.WriteString(channelName(i))
+	}
+	return b.String()
+}
+
+// channelName is how Mix writes the channel at index i
+func channelName(i int) string {
+	switch i {
+	case 0:
+		return "L"
+	case 1:
+		return "R"
+	}
+	return "C" + strconv.Itoa(i+1)
+}
+
+// ParseMix parses a mix as written by Mix.String
+func ParseMix(s string) (Mix, error) {
+	var m Mix
+	s = strings.ReplaceAll(s, " ", "")
+	if s == "" {
+		return nil, nil
+	}
+	// Split before each sign that is not an exponent's
+	var terms []string
+	start := 0
+	for i := 1; i < len(s); i++ {
+		if (s[i] == '+' || s[i] == '-') && s[i-1] != 'e' && s[i-1] != 'E' {
+			terms = append(terms, s[start:i])
+			start = i
+		}
+	}
+	terms = append(terms, s[start:])
+
+	for _, term := range terms {
+		weight, channel, err := parseMixTerm(term)
+		if err != nil {
+			return nil, fmt.Errorf("invalid mix %q: %v", s, err)
+		}
+		for len(m) <= channel {
+			m = append(m, 0)
+		}
+		m[channel] += weight
+	}
+	return m, nil
+}
+
+// parseMixTerm parses one term of a mix, such as "0.7L", "-R" or "C3"
+func parseMixTerm(term string) (float64, int, error) {
+	i := strings.LastIndexAny(term, "LRClrc")
+	if i < 0 {
+		return 0, 0, fmt.Errorf("%q names no channel", term)
+	}
+	var channel int
+	switch name := strings.ToUpper(term[i:]); {
+	case name == "L":
+		channel = 0
+	case name == "R":
+		channel = 1
+	default:
+		n, err := strconv.Atoi(name[1:])
+		if name[0] != 'C' || err != nil || n < 1 || n > MaxChannels {
+			return 0, 0, fmt.Errorf("unknown channel %q", term[i:])
+		}
+		channel = n - 1
+	}
+	weight := 1.0
+	switch w := strings.TrimSuffix(term[:i], "*"); w {
+	case "", "+":
+	case "-":
+		weight = -1
+	default:
+		var err error
+		if weight, err = strconv.ParseFloat(w, 64); err != nil {
+			return 0, 0, fmt.Errorf("invalid weight %q", w)
+		}
+	}
+	return weight, channel, nil
+}
+
+func (m Mix) MarshalText() ([]byte, error) {
+	return []byte(m.String()), nil
+}
+
+func (m *Mix) UnmarshalText(b []byte) error {
+	v, err := ParseMix(string(b))
+	if err != nil {
+		return err
+	}
+	*m = v
+	return nil
+}
+
+// mix returns the weighted sum of channels, one window of each, into dst
+func (m Mix) mix(dst []float64, channels [][]float64) []float64 {
+	dst = dst[:0]
+	for i := range channels[0] {
+		sum := 0.0
+		for ch, w := range m {
+			sum += w * channels[ch][i]
+		}
+		dst = append(dst, sum)
+	}
+	return dst
+}
@@ -0,0 +1,13 @@
+//go:build !unix
+
+package decoder
+
+import (
+	"errors"
+	"os"
+)
+
+// mapFile cannot map files here, so they are read instead
+func mapFile(f *os.File, size int64) ([]byte, func() error, error) {
+	return nil, nil, errors.ErrUnsupported
+}
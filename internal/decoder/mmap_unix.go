@@ -0,0 +1,18 @@
+//go:build unix
+
+package decoder
+
+import (
+	"os"
+	"syscall"
+)
+
+// mapFile maps size bytes of f into memory, read only, returning them
+// and how to unmap them. The mapping outlives f being closed.
+func mapFile(f *os.File, size int64) ([]byte, func() error, error) {
+	data, err := syscall.Mmap(int(f.Fd()), 0, int(size), syscall.PROT_READ, syscall.MAP_SHARED)
+	if err != nil {
+		return nil, nil, err
+	}
+	return data, func() error { return syscall.Munmap(data) }, nil
+}
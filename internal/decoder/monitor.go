@@ -0,0 +1,90 @@
+package decoder
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// The Apple ][ monitor saves memory with START.ENDW and reads it back
+// with START.ENDR, both in hex, and several commands may share a line.
+// The tape records neither address, so the range a binary was saved from
+// is known only if whoever saved it wrote it down.
+
+// MonitorRange is the memory a monitor command wrote to or read from
+// tape, End included
+type MonitorRange struct {
+	Start, End int
+}
+
+func (m MonitorRange) String() string {
+	return fmt.Sprintf("%04X.%04X", m.Start, m.End)
+}
+
+// Len returns the bytes the range covers
+func (m MonitorRange) Len() int {
+	return m.End - m.Start + 1
+}
+
+// ParseMonitorRanges parses ranges as the monitor's W or R commands give
+// them, such as "0800.0BFFW 6000.6FFFW", the command letter optional and
+// the ranges separated by spaces or commas
+func ParseMonitorRanges(s string) ([]MonitorRange, error) {
+	var ranges []MonitorRange
+	for _, f := range strings.FieldsFunc(s, func(r rune) bool { return r == ' ' || r == ',' }) {
+		m, err := parseMonitorRange(f)
+		if err != nil {
+			return nil, fmt.Errorf("invalid monitor range %q: %v", f, err)
+		}
+		ranges = append(ranges, m)
+	}
+	if len(ranges) == 0 {
+		return nil, errors.New("no monitor ranges given")
+	}
+	return ranges, nil
+}
+
+// parseMonitorRange parses one range, such as "800.BFFW"
+func parseMonitorRange(s string) (MonitorRange, error) {
+	s = strings.TrimRight(strings.ToUpper(s), "WR")
+	start, end, ok := strings.Cut(s, ".")
+	if !ok {
+		return MonitorRange{}, errors.New("not START.END")
+	}
+	a, err := strconv.ParseUint(start, 16, 16)
+	if err != nil {
+		return MonitorRange{}, fmt.Errorf("start %q is not an address between 0 and FFFF", start)
+	}
+	b, err := strconv.ParseUint(end, 16, 16)
+	if err != nil {
+		return MonitorRange{}, fmt.Errorf("end %q is not an address between 0 and FFFF", end)
+	}
+	if b < a {
+		return MonitorRange{}, errors.New("ends before it starts")
+	}
+	return MonitorRange{int(a), int(b)}, nil
+}
+
+// MonitorNote is how the catalog notes a binary saved from range m
+func MonitorNote(m MonitorRange) string {
+	return fmt.Sprintf("saved with %sW, read back with %sR", m, m)
+}
+
+// appleRanges gives how each record reads back: BASIC programs with LOAD,
+// as identifyAppleII finds them by their length records, and anything
+// else with the monitor, from wherever it was saved
+func appleRanges(records []record) []string {
+	lines := make([]string, len(records))
+	for i := 0; i < len(records); i++ {
+		n := records[i].payload()
+		if (n == IntegerLength || n == ApplesoftLength) && i+1 < len(records) {
+			lines[i] = "length of the BASIC program after it"
+			lines[i+1] = "BASIC program, read back with LOAD"
+			i++
+			continue
+		}
+		lines[i] = fmt.Sprintf("read back with START.ENDR where END is START+%04X", max(0, n-1))
+	}
+	return lines
+}
@@ -0,0 +1,268 @@
+package decoder
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+)
+
+// MSX tapes are asynchronous serial at 1200 or 2400 baud. A 0 bit is one
+// cycle at the baud rate and a 1 bit is two cycles at twice the rate;
+// each byte is a 0 start bit, eight data bits LSB first and two 1 stop
+// bits. Every block follows a header tone of 1 bits, which the framer
+// measures half-cycles against, so either baud rate decodes alike.
+const (
+	MSXHeaderTolerance = 0.5 // fraction a header half-cycle may differ from the running average
+	MSXMaxIdle         = 16  // 1 bits between bytes after which the block is taken to have ended
+
+	// A file's header block is ten of one of these bytes, naming its
+	// type, then a six-character name. A binary file's first data block
+	// starts with its start, end and run addresses.
+	MSXBinary = 0xD0
+	MSXBasic  = 0xD3
+	MSXASCII  = 0xEA
+	MSXHeader = 16 // bytes in a header block
+)
+
+// msxTiming classifies 1200 baud half-cycles. The framer itself goes by
+// the header tone, so the thresholds only steer speed tracking.
+var msxTiming = Timing{
+	Short:      0.000312,
+	Long:       0.000625,
+	MinHeader:  400,
+	HeaderTone: 0.000208, // 2400Hz, at 1200 baud
+	Nominal: [numPulses]float64{
+		pulseShort: 0.000208, // 2400Hz
+		pulseLong:  0.000417, // 1200Hz
+	},
+}
+
+var msxSystem = System{
+	Name:      "msx",
+	Timing:    &msxTiming,
+	Demods:    []Demod{DemodZeroCrossing, DemodPeak},
+	newFramer: func() framer { return &msxFramer{bits: -1} },
+	check:     cleanlyFramed,
+	payload:   func(data []byte) int { return len(data) },
+	pack:      packCAS,
+	ext:       ".cas",
+	selfTimed: true,
+	identify:  identifyMSX,
+	encode:    encodeMSX,
+}
+
+// msxFramer assembles MSX serial bytes from half-cycles
+type msxFramer struct {
+	unit float64 // running average length in seconds of a 1 bit's half-cycle
+
+	long     bool // the bit in progress is made of long half-cycles
+	halves   int  // half-cycles of the bit in progress
+	bitStart int
+
+	bits      int // data bits of the byte read so far, -1 waiting for a start bit, 8 for the stop bit
+	current   byte
+	idle      int // 1 bits since the last byte
+	idleStart int
+
+	// errors are the bad bits since the last byte. They only count once
+	// another byte follows; otherwise they are noise after the block.
+	errors int
+}
+
+func (f *msxFramer) halfCycle(d *bitDecoder, _ pulse) {
+	if d.state == stateHeader {
+		f.header(d)
+		return
+	}
+
+	h := d.length
+	var long bool
+	switch {
+	case h < 1.5*f.unit:
+		f.unit += (h - f.unit) / 32
+	case h < 3*f.unit:
+		long = true
+		f.unit += (h/2 - f.unit) / 32
+	default:
+		// A gap: the block is over
+		f.endBlock(d, d.at)
+		return
+	}
+
+	if f.halves > 0 && long != f.long {
+		// The bit in progress was cut short
+		f.cellError()
+		f.halves = 0
+	}
+	if f.halves == 0 {
+		f.long = long
+		f.bitStart = d.at
+	}
+	f.halves++
+	if long && f.halves == 2 || !long && f.halves == 4 {
+		f.halves = 0
+		f.bit(d, !long)
+	}
+}
+
+// header counts header tone, starting data at the first long half-cycle
+// after enough of it
+func (f *msxFramer) header(d *bitDecoder) {
+	h := d.length
+	if d.header > d.timing.MinHeader && h > 1.5*f.unit && h < 3*f.unit {
+		d.startData(pulseLong)
+		f.long, f.halves, f.bitStart = true, 1, d.at
+		f.bits, f.idle = -1, 0
+		return
+	}
+	if d.header == 0 || math.Abs(h-f.unit) > MSXHeaderTolerance*f.unit {
+		// Not the tone so far; it may start here
+		f.unit = h
+		d.header = 0
+		d.countHeader(pulseShort)
+		return
+	}
+	f.unit += (h - f.unit) / 16
+	d.countHeader(pulseShort)
+}
+
+func (f *msxFramer) bit(d *bitDecoder, one bool) {
+	d.open.cells++
+	switch {
+	case f.bits < 0:
+		if one {
+			// Idle between bytes, or the next header tone
+			if f.idle == 0 {
+				f.idleStart = f.bitStart
+			}
+			f.idle++
+			if f.idle > MSXMaxIdle {
+				f.endBlock(d, f.idleStart)
+				d.headerStart = f.idleStart
+				d.header = 4 * f.idle
+			}
+			return
+		}
+		f.bits, f.current, f.idle = 0, 0, 0
+		d.erasing = d.inDropout(f.bitStart, d.end)
+	case f.bits < 8:
+		if one {
+			f.current |= 1 << f.bits
+		}
+		if d.inDropout(f.bitStart, d.end) {
+			d.erasing = true
+		}
+		f.bits++
+	default:
+		// The byte only counts once its stop bit arrives; one cut off by
+		// the end of the block was noise
+		if !one {
+			f.cellError()
+		}
+		d.addByte(f.current)
+		d.open.cellErrors += f.errors
+		d.totalErrors += f.errors
+		f.errors = 0
+		f.bits = -1
+		if !one {
+			// No stop bit; take this as the next start bit
+			f.bits, f.current = 0, 0
+			d.erasing = d.inDropout(f.bitStart, d.end)
+		}
+	}
+}
+
+func (f *msxFramer) cellError() {
+	f.errors++
+}
+
+// endBlock closes the block at sample offset at and looks for the next
+// header tone
+func (f *msxFramer) endBlock(d *bitDecoder, at int) {
+	d.closeRecord(at)
+	d.state = stateHeader
+	d.header = 0
+	f.halves = 0
+	f.errors = 0
+}
+
+// cleanlyFramed reports whether every bit of a record read cleanly, for
+// systems whose records carry no checksum
+func cleanlyFramed(r *record) bool {
+	return len(r.data) > 0 && r.cellErrors == 0 && len(r.erased) == 0
+}
+
+// casHeader starts every block in a .CAS file, at an offset that is a
+// multiple of eight
+var casHeader = []byte{0x1F, 0xA6, 0xDE, 0xBA, 0xCC, 0x13, 0x7D, 0x74}
+
+// packCAS writes blocks in the .CAS container MSX emulators load
+func packCAS(blocks []Record) []byte {
+	var out []byte
+	for _, b := range blocks {
+		for len(out)%len(casHeader) != 0 {
+			out = append(out, 0)
+		}
+		out = append(out, casHeader...)
+		out = append(out, b.Data...)
+	}
+	return out
+}
+
+// identifyMSX types the blocks after each header block by its marker,
+// and loads a binary file at the start address in its first data block
+func identifyMSX(records []Record) {
+	kind, first := "", false
+	for i := range records {
+		r := &records[i]
+		if len(r.Data) == MSXHeader && bytes.Count(r.Data[:10], r.Data[:1]) == 10 {
+			switch r.Data[0] {
+			case MSXBinary:
+				kind = RecordMachineCode
+			case MSXBasic:
+				kind = RecordBasic
+			case MSXASCII:
+				kind = RecordASCII
+			default:
+				kind = ""
+				continue
+			}
+			r.Type, first = RecordHeader, true
+			continue
+		}
+		r.Type = kind
+		if kind == RecordMachineCode && first && len(r.Data) >= 6 {
+			start := int(binary.LittleEndian.Uint16(r.Data))
+			end := int(binary.LittleEndian.Uint16(r.Data[2:]))
+			r.LoadAddress = start
+			r.setBody(r.Data[6:max(6, min(len(r.Data), 6+end-start+1))])
+		}
+		first = false
+	}
+}
+
+// encodeMSX writes a block at the speed its header tone played at: the
+// tone, then each byte as a 0 start bit, its bits LSB first and two 1
+// stop bits, a 0 as one cycle and a 1 as two of the header tone's
+func encodeMSX(t *tape, timing *Timing, r Record) {
+	unit := r.Pulse
+	if unit == 0 {
+		unit = timing.HeaderTone
+	}
+	bit := func(one bool) {
+		if one {
+			t.halves(4, unit)
+		} else {
+			t.halves(2, 2*unit)
+		}
+	}
+	t.halves(headerHalves(timing, r), unit)
+	for _, b := range r.Data {
+		bit(false)
+		for i := range 8 {
+			bit(b>>i&1 == 1)
+		}
+		bit(true)
+		bit(true)
+	}
+}
@@ -0,0 +1,298 @@
+package decoder
+
+import (
+	"encoding/binary"
+	"math/bits"
+)
+
+// Sharp MZ-series tapes give every bit one cycle, a long pulse for 1 and
+// a short one for 0, and start every byte with a 1 bit before its eight
+// bits MSB first. A file is a header block and a data block, each after
+// a gap of 0 bits, a tape mark of 1s then 0s, and a single 1, and each
+// followed by its checksum, the number of 1 bits in it. Both blocks are
+// then written again after a short gap; the copies are decoded as records
+// of their own, and packing keeps whichever of the two checks out.
+const (
+	MZMarkBits = 10   // 1 bits in a row that make a tape mark rather than data
+	MZCopyGap  = 2000 // gap half-cycles below which a block is the copy of the one before
+	MZHeader   = 128  // bytes in a header block
+	MZLoad     = 0x14 // offset in the header of the address the data loads at
+
+	mzHeaderMark = 40 // 1s, then 0s, in the tape mark before a header block
+	mzDataMark   = 20 // and before a data block
+)
+
+// mzTiming classifies MZ-700 pulses: 0 bits are 240us high and 264us
+// low, 1 bits 464us high and 494us low
+var mzTiming = Timing{
+	Short:      0.000365,
+	Long:       0.000700,
+	MinHeader:  200,
+	HeaderTone: 0.000252,
+	Nominal: [numPulses]float64{
+		pulseShort: 0.000252,
+		pulseLong:  0.000479,
+	},
+}
+
+var mzSystem = System{
+	Name:      "mz",
+	Timing:    &mzTiming,
+	Demods:    []Demod{DemodZeroCrossing, DemodPeak},
+	newFramer: func() framer { return &mzFramer{} },
+	check:     mzChecksumOK,
+	payload:   func(data []byte) int { return max(0, len(data)-2) },
+	pack:      packMZF,
+	ext:       ".mzf",
+	trailer:   2,
+	lookahead: 1,
+	identify:  identifyMZ,
+	encode:    encodeMZ,
+}
+
+// mzFramer reads MZ bit cells, tape marks and start bits
+type mzFramer struct {
+	half      bool  // the first half of a cell has been seen
+	first     pulse // and was this
+	cellStart int
+
+	// Tape mark, once past the gap
+	ones, zeros int
+	markStart   int
+
+	bits    int // data bits of the byte in progress, -1 waiting for a start bit
+	current byte
+	erase   bool // the byte in progress overlaps a dropout
+
+	// A whole byte is held until the next start bit shows it was not the
+	// block's closing 1 bit followed by the gap
+	held      bool
+	heldByte  byte
+	heldErase bool
+}
+
+func (f *mzFramer) halfCycle(d *bitDecoder, p pulse) {
+	if d.state == stateHeader {
+		switch {
+		case p == pulseShort:
+			d.countHeader(p)
+		case p == pulseLong && d.header > d.timing.MinHeader:
+			// The first 1 bit after the gap
+			d.state = stateSync
+			f.ones, f.zeros, f.markStart = 0, 0, d.at
+			f.half, f.first, f.cellStart = true, p, d.at
+		default:
+			d.header = 0
+		}
+		return
+	}
+
+	if p == pulseHeader {
+		// Silence: whatever was in progress is over
+		f.end(d)
+		return
+	}
+	if !f.half {
+		f.half, f.first, f.cellStart = true, p, d.at
+		return
+	}
+	f.half = false
+	if p != f.first {
+		// Out of step; this half may start the next cell
+		if d.open != nil {
+			d.open.cells++
+			d.open.cellErrors++
+			d.totalErrors++
+		}
+		f.half, f.first, f.cellStart = true, p, d.at
+		return
+	}
+	if d.state == stateSync {
+		f.mark(d, p == pulseLong)
+		return
+	}
+	f.erase = f.erase || d.inDropout(f.cellStart, d.end)
+	d.open.cells++
+	f.bit(d, p == pulseLong)
+}
+
+// mark follows the tape mark after a gap. A few 1 bits followed by a 0
+// are instead the start of a copy block's first byte.
+func (f *mzFramer) mark(d *bitDecoder, one bool) {
+	switch {
+	case one && f.zeros == 0:
+		f.ones++
+	case !one && f.ones == 0:
+		// Still the gap
+		d.state = stateHeader
+	case !one && f.ones < MZMarkBits:
+		// No tape mark: the 1s were a start bit and data
+		d.startData(pulseLong)
+		d.open.dataStart = f.markStart
+		d.open.cells += f.ones + 1
+		f.bits, f.held, f.erase = -1, false, false
+		for range f.ones {
+			f.bit(d, true)
+		}
+		f.bit(d, false)
+	case !one:
+		f.zeros++
+	default:
+		// The single 1 that separates the tape mark from the block
+		d.startData(pulseLong)
+		f.bits, f.held, f.erase = -1, false, false
+	}
+}
+
+func (f *mzFramer) bit(d *bitDecoder, one bool) {
+	if f.bits < 0 {
+		if !one {
+			// A 0 where a start bit belongs: the block is over, and a
+			// byte still held was its closing 1 bit and the gap
+			f.end(d)
+			return
+		}
+		f.commit(d)
+		f.bits, f.current = 0, 0
+		return
+	}
+	f.current <<= 1
+	if one {
+		f.current |= 1
+	}
+	f.bits++
+	if f.bits == 8 {
+		f.held, f.heldByte, f.heldErase = true, f.current, f.erase
+		f.bits, f.erase = -1, false
+	}
+}
+
+// commit adds the held byte to the record
+func (f *mzFramer) commit(d *bitDecoder) {
+	if !f.held {
+		return
+	}
+	d.erasing = f.heldErase
+	d.addByte(f.heldByte)
+	f.held = false
+}
+
+// end closes the block, if one is open, and counts the gap after it
+func (f *mzFramer) end(d *bitDecoder) {
+	if d.state != stateSync {
+		d.closeRecord(d.at)
+	}
+	d.state = stateHeader
+	d.header = 0
+	f.half = false
+	f.held = false
+}
+
+// mzChecksumOK reports whether a block's trailing checksum, high byte
+// first, matches the number of 1 bits before it
+func mzChecksumOK(r *record) bool {
+	if len(r.data) < 3 {
+		return false
+	}
+	body := r.data[:len(r.data)-2]
+	n := 0
+	for _, b := range body {
+		n += bits.OnesCount8(b)
+	}
+	return uint16(n) == binary.BigEndian.Uint16(r.data[len(body):])
+}
+
+// packMZF writes each file as the .MZF emulators load: the 128-byte
+// header then the data, both without their checksums. Of a block and its
+// copy, the first that checks out is kept.
+func packMZF(blocks []Record) []byte {
+	var out, header []byte
+	for i := 0; i < len(blocks); i++ {
+		b := blocks[i]
+		if i+1 < len(blocks) && blocks[i+1].Header < MZCopyGap {
+			if !b.ChecksumOK && blocks[i+1].ChecksumOK {
+				b = blocks[i+1]
+			}
+			i++
+		}
+		body := b.Data[:max(0, len(b.Data)-2)]
+		if header == nil {
+			if len(body) == MZHeader {
+				header = body
+			}
+			continue
+		}
+		out = append(out, header...)
+		out = append(out, body...)
+		header = nil
+	}
+	// A header whose data never came
+	return append(out, header...)
+}
+
+// identifyMZ types each data block by the attribute its header starts
+// with and loads it where the header says. A copy is what it copies.
+func identifyMZ(records []Record) {
+	var header []byte
+	for i := range records {
+		r := &records[i]
+		if i > 0 && r.Header < MZCopyGap {
+			r.Type, r.LoadAddress, r.Copy = records[i-1].Type, records[i-1].LoadAddress, true
+			continue
+		}
+		if header == nil && r.Length == MZHeader {
+			r.Type = RecordHeader
+			header = r.Data
+			continue
+		}
+		if header != nil {
+			switch header[0] {
+			case 1:
+				r.Type = RecordMachineCode
+			case 2:
+				r.Type = RecordBasic
+			default:
+				r.Type = RecordData
+			}
+			r.LoadAddress = int(binary.LittleEndian.Uint16(header[MZLoad:]))
+		}
+		header = nil
+	}
+}
+
+// encodeMZ writes a block as the ROM does: a gap of 0 bits, the tape mark
+// and its single 1, then each byte after a 1 start bit and a closing 1
+// after the checksum. A copy follows its short gap alone.
+func encodeMZ(t *tape, timing *Timing, r Record) {
+	bit := func(one bool) {
+		p := timing.Nominal[pulseShort]
+		if one {
+			p = timing.Nominal[pulseLong]
+		}
+		t.halves(2, p)
+	}
+	gap := headerHalves(timing, r)
+	if !r.Copy {
+		gap = max(gap, 2*MZCopyGap)
+	}
+	for range gap / 2 {
+		bit(false)
+	}
+	if !r.Copy {
+		mark := mzDataMark
+		if len(r.Data) == MZHeader+2 {
+			mark = mzHeaderMark
+		}
+		for i := range 2 * mark {
+			bit(i < mark)
+		}
+		bit(true)
+	}
+	for _, b := range r.Data {
+		bit(true)
+		for i := 7; i >= 0; i-- {
+			bit(b>>i&1 == 1)
+		}
+	}
+	bit(true)
+}
@@ -0,0 +1,240 @@
+package decoder
+
+import "math/bits"
+
+// Oric-1 and Atmos tapes, at the ROM's fast speed, start every bit with
+// a short half-cycle and end it with a short one for 1 or a long one for
+// 0. Bytes are asynchronous serial: a 0 start bit, eight data bits LSB
+// first, an odd parity bit and 1 stop bits. A file is a run of 0x16 sync
+// bytes, a 0x24 marker, a nine-byte header giving the load addresses, the
+// name ending in a zero byte, then the data.
+const (
+	OricSync   = 0x16 // leader byte
+	OricMarker = 0x24 // byte that ends the leader
+	OricHeader = 9    // header bytes after the marker
+	OricLeader = 3    // sync bytes needed before the marker
+
+	oricStopBits  = 3  // stop bits the ROM writes after each byte
+	oricByteHalfs = 26 // half-cycles in a byte: start, data, parity and stop bits
+)
+
+// oricTiming classifies fast-speed half-cycles: short ones are 208us,
+// long ones 416us
+var oricTiming = Timing{
+	Short:     0.000312,
+	Long:      0.000624,
+	MinHeader: 2 * 12 * OricLeader, // half-cycles in OricLeader bytes of ones and zeros
+	Nominal: [numPulses]float64{
+		pulseShort: 0.000208, // 2400Hz
+		pulseLong:  0.000416, // 1200Hz
+	},
+}
+
+var oricSystem = System{
+	Name:      "oric",
+	Timing:    &oricTiming,
+	Demods:    []Demod{DemodZeroCrossing}, // bits' halves differ, which the peak engine cannot time
+	newFramer: func() framer { return &oricFramer{bits: -1} },
+	check:     oricComplete,
+	payload:   func(data []byte) int { return len(data) - oricPreamble(data) },
+	pack:      packOricTAP,
+	ext:       ".tap",
+	identify:  identifyOric,
+	encode:    encodeOric,
+}
+
+// oricFramer assembles Oric serial bytes from half-cycles
+type oricFramer struct {
+	short     bool // a bit's first, short, half-cycle has been seen
+	cellStart int
+
+	bits    int // bits of the byte read so far, -1 waiting for a start bit, 8 for parity
+	current byte
+	parity  bool // the parity bit read matched
+	erase   bool
+
+	leader int // sync bytes in a row before the record
+	length int // bytes the record will hold once its header is read, or 0
+}
+
+func (f *oricFramer) halfCycle(d *bitDecoder, p pulse) {
+	if d.state == stateHeader {
+		d.countHeader(p)
+	}
+	switch {
+	case p == pulseHeader:
+		// Silence: whatever was in progress is over
+		f.end(d)
+	case !f.short && p == pulseShort:
+		f.short, f.cellStart = true, d.at
+	case !f.short:
+		// A long half-cycle with no short one before it; what went
+		// before was out of step
+		f.error(d)
+	default:
+		f.short = false
+		if d.open != nil {
+			d.open.cells++
+			f.erase = f.erase || d.inDropout(f.cellStart, d.end)
+		}
+		f.bit(d, p == pulseShort)
+	}
+}
+
+func (f *oricFramer) bit(d *bitDecoder, one bool) {
+	switch {
+	case f.bits < 0:
+		if !one {
+			f.bits, f.current, f.parity, f.erase = 0, 0, false, false
+		}
+	case f.bits < 8:
+		if one {
+			f.current |= 1 << f.bits
+		}
+		f.bits++
+	default:
+		// Odd parity across the data and parity bits
+		f.parity = (bits.OnesCount8(f.current)%2 == 1) != one
+		f.bits = -1
+		f.byteDone(d)
+	}
+}
+
+// byteDone takes a whole byte: part of the leader while looking for a
+// record, or the record's next byte
+func (f *oricFramer) byteDone(d *bitDecoder) {
+	b := f.current
+	if d.open == nil {
+		switch {
+		case b == OricSync && f.parity:
+			f.leader++
+		case b == OricMarker && f.leader >= OricLeader && d.header > d.timing.MinHeader:
+			d.startData(pulseShort)
+			f.length = 0
+		default:
+			f.leader = 0
+			d.header = 0
+		}
+		return
+	}
+
+	if !f.parity {
+		d.open.cellErrors++
+		d.totalErrors++
+	}
+	d.erasing = f.erase
+	d.addByte(b)
+	data := d.open.data
+	if f.length == 0 && len(data) > OricHeader && b == 0 {
+		// The name is complete, so the length is known
+		f.length = len(data) + oricSize(data)
+	}
+	if f.length > 0 && len(data) >= f.length {
+		f.end(d)
+	}
+}
+
+func (f *oricFramer) error(d *bitDecoder) {
+	f.short = false
+	if d.open != nil {
+		d.open.cells++
+		d.open.cellErrors++
+		d.totalErrors++
+	}
+}
+
+// end closes the record, if one is open, and looks for the next leader
+func (f *oricFramer) end(d *bitDecoder) {
+	d.closeRecord(d.at)
+	d.state = stateHeader
+	d.header = 0
+	f.short, f.bits, f.leader = false, -1, 0
+}
+
+// oricSize returns the number of data bytes a header says follow the
+// name: the end address less the start, inclusive
+func oricSize(header []byte) int {
+	start := int(header[6])<<8 | int(header[7])
+	end := int(header[4])<<8 | int(header[5])
+	return max(0, end-start+1)
+}
+
+// identifyOric types each file by its header, which also gives where it
+// loads
+func identifyOric(records []Record) {
+	for i := range records {
+		r := &records[i]
+		if len(r.Data) < OricHeader {
+			continue
+		}
+		switch r.Data[2] {
+		case 0x00:
+			r.Type = RecordBasic
+		case 0x80:
+			r.Type = RecordMachineCode
+		default:
+			r.Type = RecordData
+		}
+		r.LoadAddress = int(r.Data[6])<<8 | int(r.Data[7])
+		r.setBody(r.Data[oricPreamble(r.Data):])
+	}
+}
+
+// oricPreamble returns the bytes of header and name at the start of a
+// record, or all of it if the name never ended
+func oricPreamble(data []byte) int {
+	for i := OricHeader; i < len(data); i++ {
+		if data[i] == 0 {
+			return i + 1
+		}
+	}
+	return len(data)
+}
+
+// oricComplete reports whether a record holds all the data its header
+// promises and every byte's parity held. Oric files carry no checksum.
+func oricComplete(r *record) bool {
+	n := oricPreamble(r.data)
+	return n < len(r.data) && len(r.data)-n == oricSize(r.data) && cleanlyFramed(r)
+}
+
+// packOricTAP writes records as the .TAP files Oric emulators load, each
+// behind a short leader and the marker
+func packOricTAP(blocks []Record) []byte {
+	var out []byte
+	for _, b := range blocks {
+		out = append(out, OricSync, OricSync, OricSync, OricMarker)
+		out = append(out, b.Data...)
+	}
+	return out
+}
+
+// encodeOric writes a record behind a leader of sync bytes as long as
+// the header tone read, and the marker
+func encodeOric(t *tape, timing *Timing, r Record) {
+	bit := func(one bool) {
+		t.half(timing.Nominal[pulseShort])
+		if one {
+			t.half(timing.Nominal[pulseShort])
+		} else {
+			t.half(timing.Nominal[pulseLong])
+		}
+	}
+	write := func(b byte) {
+		bit(false)
+		for i := range 8 {
+			bit(b>>i&1 == 1)
+		}
+		bit(bits.OnesCount8(b)%2 == 0)
+		for range oricStopBits {
+			bit(true)
+		}
+	}
+	for range (headerHalves(timing, r) + oricByteHalfs - 1) / oricByteHalfs {
+		write(OricSync)
+	}
+	write(OricMarker)
+	for _, b := range r.Data {
+		write(b)
+	}
+}
@@ -0,0 +1,143 @@
+package decoder
+
+import "math"
+
+// Peak timing. On tapes whose waveform has gone lopsided, from a DC offset
+// or a worn head, the zero crossings drift toward one side of each cycle
+// while the peaks stay put at the middle of each half-cycle. This mode
+// finds the peaks and places the edge between two half-cycles by
+// reflecting the previous edge about the peak between them, pulled toward
+// the midpoint of the peaks so that timing errors die away. Each peak is
+// taken as the middle of the span where the signal stays near its
+// extreme, which noise moves far less than the single highest sample.
+const (
+	PeakHysteresis = 0.25  // fraction of the last swing the signal must fall back from a peak
+	PeakDecay      = 0.005 // seconds for the remembered swing to fade, so quieter audio is followed
+	PeakTimeout    = 0.002 // seconds without a peak before the signal is taken to have stopped
+	PeakReflection = 0.25  // weight of the reflected edge against the midpoint of the peaks
+	PeakWidth      = 0.2   // fraction of the swing below its extreme that still counts as the peak
+)
+
+// peakTracker finds alternating maxima and minima across consecutive
+// windows of samples
+type peakTracker struct {
+	decay   float64 // fraction of the swing lost per sample
+	timeout int     // PeakTimeout in samples
+
+	pos     int     // absolute offset of the next sample
+	rising  bool    // looking for a maximum rather than a minimum
+	extreme float64 // highest (or lowest) value since the last peak
+	peak    float64 // value of the last peak
+	swing   float64 // recent peak-to-peak amplitude
+	last    float64 // offset of the last peak, -1 before the first
+
+	since []float64 // samples since the last peak was found
+	base  int       // absolute offset of since[0]
+
+	edge   float64 // where the last half-cycle reported ended, -1 before the first
+	closed bool    // the half-cycle around the last peak has been reported
+}
+
+func newPeakTracker(sampleRate uint32) *peakTracker {
+	return &peakTracker{
+		decay:   1 / max(1, PeakDecay*float64(sampleRate)),
+		timeout: int(PeakTimeout * float64(sampleRate)),
+		rising:  true,
+		last:    -1,
+		edge:    -1,
+	}
+}
+
+// feed scans a window and reports every half-cycle that ends before the
+// last peak found
+func (p *peakTracker) feed(window []float64, sink bitSink) {
+	for i, sample := range window {
+		at := p.pos + i
+		if at == 0 {
+			p.extreme = sample
+			continue
+		}
+		if len(p.since) > 2*p.timeout {
+			// Nothing that long is a peak; forget the older half
+			drop := len(p.since) / 2
+			p.since = append(p.since[:0], p.since[drop:]...)
+			p.base += drop
+		}
+		p.since = append(p.since, sample)
+		p.swing -= p.swing * p.decay
+		if p.edge >= 0 && !p.closed && float64(at)-p.last > float64(p.timeout) {
+			// Nothing follows the last peak; end its half-cycle as far
+			// past the peak as it started before it
+			p.report(sink, 2*p.last-p.edge)
+			p.closed = true
+		}
+
+		switch {
+		case p.rising && sample > p.extreme || !p.rising && sample < p.extreme:
+			p.extreme = sample
+		case math.Abs(sample-p.extreme) > max(SilenceLevel, PeakHysteresis*p.swing):
+			// The signal has turned back far enough to be past a peak
+			p.foundPeak(sink, p.center())
+			p.rising = !p.rising
+			p.extreme = sample
+			p.since = append(p.since[:0], sample)
+			p.base = at
+		}
+	}
+	p.pos += len(window)
+}
+
+// center returns the middle of the span of samples near the extreme just
+// passed
+func (p *peakTracker) center() float64 {
+	level := p.extreme - PeakWidth*(p.extreme-p.peak)
+	if p.last < 0 {
+		level = p.extreme * (1 - PeakWidth)
+	}
+	first, last := -1, -1
+	for i, v := range p.since {
+		if p.rising && v >= level || !p.rising && v <= level {
+			if first < 0 {
+				first = i
+			}
+			last = i
+		}
+	}
+	return float64(p.base) + float64(first+last)/2
+}
+
+// foundPeak places the edge between the last peak and the one at offset
+// peak, reporting the half-cycle that ends there
+func (p *peakTracker) foundPeak(sink bitSink, peak float64) {
+	if p.last >= 0 {
+		edge := (p.last + peak) / 2
+		if !p.closed {
+			if p.edge >= 0 {
+				reflected := 2*p.last - p.edge
+				edge = PeakReflection*reflected + (1-PeakReflection)*edge
+				edge = min(max(edge, p.last+1), peak)
+			}
+			p.swing = math.Abs(p.extreme - p.peak)
+		}
+		p.report(sink, edge)
+	}
+	p.last, p.peak = peak, p.extreme
+	p.closed = false
+}
+
+// report ends the current half-cycle at edge
+func (p *peakTracker) report(sink bitSink, edge float64) {
+	if p.edge >= 0 {
+		at := int(math.Round(p.edge))
+		sink.halfCycle(at, int(math.Round(edge))-at)
+	}
+	p.edge = edge
+}
+
+// flush ends the stream at the last half-cycle reported; the peak in
+// progress may not be a peak at all
+func (p *peakTracker) flush(sink bitSink) {
+	if p.edge >= 0 {
+		sink.finish(int(math.Round(p.edge)))
+	}
+}
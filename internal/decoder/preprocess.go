@@ -0,0 +1,87 @@
+package decoder
+
+import "slices"
+
+// filter is a stage that cleans up or converts the audio before any
+// demodulation engine sees it
+type filter interface {
+	// feed returns the output that the input so far determines. The
+	// returned slice is reused by the next call.
+	feed(window []float64) []float64
+
+	// flush returns the output still held back at the end of the input
+	flush() []float64
+}
+
+// preprocessor passes the audio through the filters the options ask for:
+// click removal, clipping repair and resampling, in that order. Clipping
+// is always measured even when not repaired.
+type preprocessor struct {
+	declicker *declicker
+	clipper   *clipper
+	rate      uint32 // rate of the output
+	stages    []filter
+}
+
+func newPreprocessor(opts Options, sampleRate uint32) *preprocessor {
+	p := &preprocessor{
+		clipper: newClipper(sampleRate, opts.Unclip),
+		rate:    opts.workingRate(sampleRate),
+	}
+	if opts.Declick {
+		p.declicker = newDeclicker(sampleRate)
+		p.stages = append(p.stages, p.declicker)
+	}
+	p.stages = append(p.stages, p.clipper)
+	if p.rate != sampleRate {
+		p.stages = append(p.stages, newResampler(sampleRate, p.rate))
+	}
+	return p
+}
+
+func (p *preprocessor) feed(window []float64) []float64 {
+	for _, f := range p.stages {
+		window = f.feed(window)
+	}
+	return window
+}
+
+// flush passes what each stage held back through the stages after it,
+// calling fn with each window of output
+func (p *preprocessor) flush(fn func(window []float64)) {
+	for i, f := range p.stages {
+		window := f.flush()
+		for _, next := range p.stages[i+1:] {
+			window = next.feed(window)
+		}
+		fn(window)
+	}
+}
+
+// all preprocesses a whole capture one stage at a time, logging what each
+// stage changed
+func (p *preprocessor) all(samples []float64, opts Options) []float64 {
+	for _, f := range p.stages {
+		out := slices.Clone(f.feed(samples))
+		out = append(out, f.flush()...)
+		switch f := f.(type) {
+		case *declicker:
+			opts.logf("Removed %d clicks (%d samples); zero crossings %d before, %d after",
+				f.clicks, f.repaired, len(findCrossings(samples)), len(findCrossings(out)))
+		case *clipper:
+			f.log(opts)
+		case *resampler:
+			opts.logf("Resampled to %d Hz", p.rate)
+		}
+		samples = out
+	}
+	return samples
+}
+
+// log reports what a streamed capture's stages changed
+func (p *preprocessor) log(opts Options) {
+	if p.declicker != nil {
+		opts.logf("Removed %d clicks (%d samples)", p.declicker.clicks, p.declicker.repaired)
+	}
+	p.clipper.log(opts)
+}
@@ -0,0 +1,58 @@
+package decoder
+
+// Pulse timing. The ZX80 and ZX81 write bursts of pulses separated by
+// silence rather than a continuous tone, and in the silence hiss crosses
+// zero as often as the signal does. This mode places each edge where the
+// signal swings past a threshold set by the height of recent pulses
+// instead, so a gap reads as one long half-cycle however much hiss is in
+// it. The remembered height fades slowly enough to last from one file to
+// the next.
+const (
+	PulseThreshold = 0.5 // fraction of the recent pulse height the signal must swing past
+	PulseDecay     = 5.0 // seconds for the remembered pulse height to fade
+)
+
+// pulseTracker finds swings past the threshold across consecutive
+// windows of samples
+type pulseTracker struct {
+	decay  float64 // fraction of the height lost per sample
+	pos    int     // absolute offset of the next sample
+	height float64 // recent pulse height
+	side   int     // which threshold the signal last passed, 1 above, -1 below
+	last   int     // absolute offset of the last edge, -1 before the first
+}
+
+func newPulseTracker(sampleRate uint32) *pulseTracker {
+	return &pulseTracker{decay: 1 / max(1, PulseDecay*float64(sampleRate)), last: -1}
+}
+
+// feed scans a window and reports every half-cycle between edges
+func (p *pulseTracker) feed(window []float64, sink bitSink) {
+	for i, sample := range window {
+		at := p.pos + i
+		p.height = max(p.height-p.height*p.decay, sample, -sample)
+		threshold := max(SilenceLevel, PulseThreshold*p.height)
+		side := 0
+		switch {
+		case sample > threshold:
+			side = 1
+		case sample < -threshold:
+			side = -1
+		}
+		if side == 0 || side == p.side {
+			continue
+		}
+		if p.last >= 0 {
+			sink.halfCycle(p.last, at-p.last)
+		}
+		p.last, p.side = at, side
+	}
+	p.pos += len(window)
+}
+
+// flush ends the stream at the last edge
+func (p *pulseTracker) flush(sink bitSink) {
+	if p.last >= 0 {
+		sink.finish(p.last)
+	}
+}
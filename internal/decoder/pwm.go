@@ -0,0 +1,364 @@
+package decoder
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Pulse-width and pulse-count coding, for tapes whose bits are told by
+// how wide their cycles are, by how many there are, or both: the
+// Supercharger style of one cycle a bit, a narrow one for 0 and a wide
+// one for 1, or bursts of a fixed width whose count is the bit, with a
+// gap of quiet after each. Records start as in biphase coding, after a
+// leader of repeated bits and a sync byte, and end in quiet, or in a few
+// bits in a row that cannot be read, as when the signal gives way to
+// hiss.
+//
+// Without gaps a bit ends once it has all its cycles, and a cycle of the
+// other width or hiss in the middle of it breaks it. With them it ends
+// at the gap. The crossing detectors fold a burst's last half-cycle or
+// two into the quiet after it, and hiss can add some either side, so a
+// count a cycle out still reads, and counts must differ by two cycles to
+// be told apart. Half-cycles too short for either width are hiss, as is
+// anything early in a gap, and add to the quiet. Hiss loud enough to
+// pass for cycles, and gaps too short for the crossing detectors to see
+// apart from the cycles, need the pulse engine.
+const (
+	PWMGlitch    = 0.5  // fraction of the narrow half-cycle below which a half-cycle is hiss
+	PWMEnd       = 8    // bits' time of quiet that ends a record
+	PWMMinLeader = 16   // leader bits that must precede a record
+	PWMLost      = 4    // bits that cannot be read, with no byte's worth in a row that can between, that end a record
+	PWMHiss      = 0.75 // fraction of the gap after a bit in which half-cycles are hiss
+)
+
+// PWM describes a pulse-width or pulse-count signal
+type PWM struct {
+	Zero, One             float64 // seconds each cycle of a 0 bit and of a 1 bit lasts
+	ZeroCycles, OneCycles int     // cycles in a 0 bit and in a 1 bit
+	Gap                   float64 // seconds of quiet after every bit, 0 if bits follow on
+	Leader                int     // the bit the leader repeats, 0 or 1
+	Sync                  byte    // the byte that ends the leader, eight bits in the framing's order
+	Framing
+}
+
+// PulseWidth is the settings the pwm system decodes unless told
+// otherwise: a cycle a bit, of 3kHz for 0 and 1.5kHz for 1, with a leader
+// of 0 bits and an ASCII SYN, then bare bytes MSB first
+var PulseWidth = PWM{Zero: 1.0 / 3000, One: 1.0 / 1500, ZeroCycles: 1, OneCycles: 1, Leader: 0, Sync: 0x16, Framing: Bare8}
+
+// check returns an error if the settings cannot be decoded
+func (c PWM) check() error {
+	switch {
+	case c.Zero <= 0 || c.One <= 0:
+		return errors.New("cycles must be longer than zero")
+	case c.ZeroCycles < 1 || c.OneCycles < 1:
+		return errors.New("bits must have a cycle at least")
+	case c.Zero == c.One && c.ZeroCycles == c.OneCycles:
+		return errors.New("0 and 1 bits must differ in their cycles' length or number")
+	case c.Zero == c.One && c.Gap == 0:
+		return errors.New("bits told apart by their cycles' number need a gap after each")
+	case c.Zero == c.One && abs(c.ZeroCycles-c.OneCycles) < 2:
+		return errors.New("bits told apart by their cycles' number must differ by two cycles at least")
+	case c.Gap < 0:
+		return errors.New("the gap cannot be negative")
+	case c.Leader != 0 && c.Leader != 1:
+		return fmt.Errorf("leader bit %d is not 0 or 1", c.Leader)
+	}
+	if err := c.Framing.check(); err != nil {
+		return err
+	}
+	return c.whole("pwm")
+}
+
+// PWM returns the settings of a system that decodes pulse-width or
+// pulse-count coding
+func (s *System) PWM() (PWM, bool) {
+	if s.pwm == nil {
+		return PWM{}, false
+	}
+	return *s.pwm, true
+}
+
+// WithPWM returns a pulse-width system decoding with settings c instead
+// of its own
+func (s *System) WithPWM(c PWM) (*System, error) {
+	if s.pwm == nil {
+		return nil, fmt.Errorf("%s tapes are not pulse-width coded", s.Name)
+	}
+	if err := c.check(); err != nil {
+		return nil, err
+	}
+	return s.withPWM(c), nil
+}
+
+// withPWM returns a copy of the system set up for settings already
+// checked
+func (s System) withPWM(c PWM) *System {
+	narrow, wide := min(c.Zero, c.One)/2, max(c.Zero, c.One)/2
+	short := 1.5 * narrow
+	if narrow < wide {
+		short = (narrow + wide) / 2
+	}
+	leader := c.cycles(c.Leader)
+	s.Timing = &Timing{
+		Short:      short,
+		Long:       1.5 * wide, // longer is quiet
+		MinHeader:  2 * PWMMinLeader * leader,
+		HeaderTone: c.width(c.Leader) / 2,
+		Nominal: [numPulses]float64{
+			pulseShort: narrow,
+			pulseLong:  wide,
+		},
+	}
+	s.pwm = &c
+	s.framing = c.Framing
+	s.newFramer = func() framer { return &pwmFramer{pwm: c} }
+	s.encode = func(t *tape, timing *Timing, r Record) { encodePWM(c, t, timing, r) }
+	return &s
+}
+
+// width returns how long each cycle of bit lasts
+func (c PWM) width(bit int) float64 {
+	if bit == 1 {
+		return c.One
+	}
+	return c.Zero
+}
+
+// cycles returns how many cycles bit has
+func (c PWM) cycles(bit int) int {
+	if bit == 1 {
+		return c.OneCycles
+	}
+	return c.ZeroCycles
+}
+
+// bitOf returns the bit whose cycles are of pulse class p, or -1 if both
+// bits' are
+func (c PWM) bitOf(p pulse) int {
+	switch {
+	case c.Zero == c.One:
+		return -1
+	case (p == pulseShort) == (c.Zero < c.One):
+		return 0
+	}
+	return 1
+}
+
+var pwmSystem = System{
+	Name:    "pwm",
+	Demods:  []Demod{DemodZeroCrossing, DemodPeak, DemodPulse}, // peak only where bits follow on
+	check:   cleanlyFramed,
+	payload: func(data []byte) int { return len(data) },
+	pack:    concatBlocks,
+}.withPWM(PulseWidth)
+
+// pwmFramer counts the cycles of each bit
+type pwmFramer struct {
+	pwm PWM
+
+	halves   [2]int  // half-cycles in the bit so far of the narrow and wide widths
+	bitStart int     // where the bit began
+	quiet    float64 // seconds since the last half-cycle of a bit
+	ended    int     // where the last bit ended
+	leader   int     // leader bits in a row
+	slipped  bool    // the last of them could not be read
+	sync     syncSearch
+
+	// bad counts the bits that could not be read, from badAt, since the
+	// last byte's worth in a row that could; good counts those since. Bad
+	// bits count as errors only once a byte's worth of good ones follows,
+	// as a signal dying into hiss that reads as a bit now and then has
+	// none.
+	bad   int
+	badAt int
+	good  int
+}
+
+func (f *pwmFramer) halfCycle(d *bitDecoder, p pulse) {
+	hiss := p == pulseHeader || d.length < PWMGlitch*d.timing.Nominal[pulseShort]
+	if f.pwm.Gap > 0 && f.halves == [2]int{} && float64(d.at-f.ended)/d.rate < PWMHiss*f.pwm.Gap {
+		// Early in the gap after a bit, anything is hiss
+		hiss = true
+	}
+	if hiss {
+		f.quiet += d.length
+		switch {
+		case f.halves == [2]int{}:
+		case f.pwm.Gap == 0:
+			// Hiss inside a bit with no gap after it breaks it, but quiet
+			// can be the last half-cycle running on at a record's end
+			if p == pulseHeader {
+				f.runOn()
+			}
+			f.bitEnd(d)
+		case p == pulseHeader || f.quiet >= f.pwm.Gap/2:
+			f.bitEnd(d)
+		}
+		bit := max(f.pwm.Zero, f.pwm.One)*float64(max(f.pwm.ZeroCycles, f.pwm.OneCycles)) + f.pwm.Gap
+		if f.quiet >= PWMEnd*bit {
+			f.end(d)
+		}
+		return
+	}
+	if f.pwm.Gap == 0 && f.halves[1-p] > 0 && f.pwm.bitOf(p) >= 0 {
+		// A bit's cycles are all of one width, so one of the other breaks
+		// it and starts the next
+		f.bitEnd(d)
+	}
+	if f.halves == [2]int{} {
+		f.bitStart = d.at
+	}
+	f.quiet = 0
+	f.halves[p]++
+	if d.open == nil {
+		d.countHeader(p)
+	}
+	if f.pwm.Gap == 0 {
+		if bit := f.pwm.bitOf(p); f.halves[p] == 2*f.pwm.cycles(bit) {
+			f.bitEnd(d)
+		}
+	}
+}
+
+// bitEnd reads the bit whose cycles have all come
+func (f *pwmFramer) bitEnd(d *bitDecoder) {
+	halves := f.halves
+	f.halves = [2]int{}
+	f.ended = d.at
+	if f.pwm.Gap > 0 && halves[0]+halves[1] < 2*min(f.pwm.ZeroCycles, f.pwm.OneCycles)-2 {
+		// Too few to be a bit: hiss in the gap
+		return
+	}
+	bit, ok := f.bit(halves)
+	if d.open == nil {
+		f.leaderBit(d, bit, ok)
+		return
+	}
+	if !ok {
+		d.tracef("bit of %d narrow and %d wide half-cycles, dropped", halves[0], halves[1])
+		if f.bad == 0 {
+			f.badAt = f.bitStart
+		}
+		f.good = 0
+		if f.bad++; f.bad == PWMLost {
+			d.at = f.badAt
+			f.end(d)
+		}
+		return
+	}
+	if f.bad > 0 {
+		if f.good++; f.good == 8 {
+			d.open.cells += f.bad
+			d.open.cellErrors += f.bad
+			d.totalErrors += f.bad
+			f.bad, f.good = 0, 0
+		}
+	}
+	d.erasing = d.erasing || d.inDropout(f.bitStart, d.at)
+	if !f.sync.add(d, bit) {
+		f.end(d)
+	}
+}
+
+// bit returns the bit of halves half-cycles of each width, and whether
+// they make one
+func (f *pwmFramer) bit(halves [2]int) (int, bool) {
+	total := halves[0] + halves[1]
+	var bit int
+	if f.pwm.Zero == f.pwm.One {
+		// Counted: the nearer count
+		if abs(total-2*f.pwm.OneCycles) < abs(total-2*f.pwm.ZeroCycles) {
+			bit = 1
+		}
+	} else {
+		p := pulseShort
+		if halves[pulseLong] > halves[pulseShort] {
+			p = pulseLong
+		}
+		if halves[p] != total {
+			return 0, false
+		}
+		bit = f.pwm.bitOf(p)
+	}
+	want := 2 * f.pwm.cycles(bit)
+	if f.pwm.Gap > 0 {
+		// Up to a cycle folded into the gap after, or hiss either side
+		return bit, total >= want-2 && total <= want+2
+	}
+	return bit, total == want
+}
+
+// leaderBit follows the leader, opening a record once enough of it has
+// been read and a bit unlike it comes
+func (f *pwmFramer) leaderBit(d *bitDecoder, bit int, ok bool) {
+	slipped := f.slipped
+	f.slipped = !ok
+	switch {
+	case !ok && !slipped && f.leader > 0:
+		// One bit of the leader misread, as where its end meets the sync
+		// byte, is let pass
+		return
+	case ok && bit == f.pwm.Leader:
+		f.leader++
+		return
+	case ok && f.leader >= PWMMinLeader:
+		start := f.bitStart
+		d.startData(pulseShort)
+		d.open.dataStart = start
+		f.sync = newSyncSearch(f.pwm.Leader, f.pwm.Sync, f.pwm.Order)
+		f.leader = 0
+		if !f.sync.add(d, bit) {
+			f.end(d)
+		}
+		return
+	}
+	f.leader = 0
+	d.header = 0
+}
+
+// finish reads the last bit, which the end of the stream may cut short
+func (f *pwmFramer) finish(d *bitDecoder, at int) {
+	if f.halves != [2]int{} && d.open != nil {
+		d.at, d.end = at, at
+		if f.pwm.Gap == 0 {
+			f.runOn()
+		}
+		f.bitEnd(d)
+	}
+}
+
+// runOn counts the last half-cycle of a bit with no gap after it, which
+// runs on into the quiet at a record's end and is lost in it
+func (f *pwmFramer) runOn() {
+	p := pulseShort
+	if f.halves[pulseLong] > f.halves[pulseShort] {
+		p = pulseLong
+	}
+	f.halves[p]++
+}
+
+// end closes the record, if one is open, and looks for the next leader
+func (f *pwmFramer) end(d *bitDecoder) {
+	d.closeRecord(d.at)
+	d.state = stateHeader
+	d.header = 0
+	*f = pwmFramer{pwm: f.pwm}
+}
+
+func abs(n int) int {
+	return max(n, -n)
+}
+
+// encodePWM writes a record as a pulse-width recorder would: a leader,
+// the sync byte and the data, each bit its cycles and any gap
+func encodePWM(c PWM, t *tape, timing *Timing, r Record) {
+	bits := leaderBits(c.Leader, headerHalves(timing, r), 2*c.cycles(c.Leader))
+	bits = append(bits, c.sent(c.Sync, r.Data)...)
+	for _, bit := range bits {
+		t.halves(2*c.cycles(bit), c.width(bit)/2)
+		if c.Gap > 0 {
+			t.silence(c.Gap)
+		}
+	}
+}
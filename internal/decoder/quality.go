@@ -0,0 +1,102 @@
+package decoder
+
+import "math"
+
+// Quality grading. Each measurement of the signal is graded A to F
+// against fixed bounds, and the tape gets the worst of its grades, so a
+// tape graded below B has something specific wrong with it that cleaning
+// the heads, adjusting the azimuth or transferring it again may fix.
+// Bounds are for grades A to D; anything past the last is an F.
+var (
+	GradeSNR      = [4]float64{30, 24, 18, 12}          // dB, at least
+	GradeSpeed    = [4]float64{0.01, 0.02, 0.04, 0.08}  // fraction off nominal, at most
+	GradeJitter   = [4]float64{0.03, 0.05, 0.08, 0.12}  // header tone spread, at most
+	GradeDropouts = [4]float64{0, 1, 3, 10}             // dropouts, at most
+	GradeClipping = [4]float64{0.001, 0.01, 0.03, 0.10} // fraction of the signal clipped, at most
+)
+
+// Quality sums up how well a tape was recorded and played back
+type Quality struct {
+	SNR      float64 // dB; 0 if unknown
+	Speed    float64 // average playback speed relative to nominal, 0 if unknown
+	Jitter   float64 // average spread of the header tones' cycle lengths
+	Dropouts int
+	Clipped  float64 // fraction of the signal clipped
+
+	// Grades has a grade for each measurement, by name, in the order
+	// above; those that could not be made are left out
+	Grades []Grade
+
+	// Grade is the worst of them, 'A' to 'F', or 0 if no header tone
+	// was found to measure the signal by
+	Grade byte
+}
+
+// Grade is one measurement's grade
+type Grade struct {
+	Name  string
+	Grade byte
+}
+
+// Quality measures the tape the catalog describes
+func (c *Catalog) Quality() Quality {
+	q := Quality{SNR: c.SNR, Clipped: c.Clipped}
+	var speeds, jitters []float64
+	for _, r := range c.Regions {
+		switch {
+		case r.Kind == RegionDropout:
+			q.Dropouts++
+		case r.Kind == RegionData && r.Speed > 0:
+			speeds = append(speeds, r.Speed)
+			jitters = append(jitters, r.Jitter)
+		}
+	}
+	q.Speed = mean(speeds)
+	q.Jitter = mean(jitters)
+
+	if q.SNR != 0 {
+		q.grade("signal to noise", -q.SNR, negate(GradeSNR))
+	}
+	if q.Speed != 0 {
+		q.grade("speed", math.Abs(q.Speed-1), GradeSpeed)
+		q.grade("jitter", q.Jitter, GradeJitter)
+	}
+	q.grade("dropouts", float64(q.Dropouts), GradeDropouts)
+	q.grade("clipping", q.Clipped, GradeClipping)
+	if q.SNR == 0 && q.Speed == 0 {
+		q.Grade = 0
+	}
+	return q
+}
+
+// grade adds the grade of a measurement, where lower values are better
+// and bounds are the most each grade allows
+func (q *Quality) grade(name string, value float64, bounds [4]float64) {
+	g := byte('F')
+	for i, bound := range bounds {
+		if value <= bound {
+			g = 'A' + byte(i)
+			break
+		}
+	}
+	q.Grades = append(q.Grades, Grade{name, g})
+	q.Grade = max(q.Grade, g)
+}
+
+func negate(bounds [4]float64) [4]float64 {
+	for i := range bounds {
+		bounds[i] = -bounds[i]
+	}
+	return bounds
+}
+
+func mean(values []float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+	sum := 0.0
+	for _, v := range values {
+		sum += v
+	}
+	return sum / float64(len(values))
+}
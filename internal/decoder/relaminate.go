@@ -0,0 +1,157 @@
+package decoder
+
+import (
+	"fmt"
+	"math"
+)
+
+// A damaged tape is restored by writing what was decoded from it out
+// again the way its system saves it: clean sine half-cycles at the
+// format's own timings, each record where it started on the tape. A
+// record that did not check out cannot be written as it was saved, so
+// its stretch of tape is left silent instead.
+const (
+	RelaminateRate  = 44100 // Hz; the rate restored audio is written at
+	RelaminateLevel = 0.8   // peak amplitude of the half-cycles written
+	RelaminateGap   = 0.02  // seconds of silence kept at least between records
+
+	appleTrailer = 20 // half-cycles of header tone written after an Apple ][ record
+)
+
+// Relaminate writes records decoded from a capture of duration seconds
+// out again as the system saves them, returning the audio at
+// RelaminateRate and the records left silent
+func Relaminate(records []Record, duration float64, opts Options) ([]float64, []Record, error) {
+	s := opts.system()
+	if s.encode == nil {
+		return nil, nil, fmt.Errorf("%s tapes cannot be written back", s.Name)
+	}
+	timing := opts.timing()
+	t := &tape{rate: RelaminateRate, sign: 1}
+	var silent []Record
+	lost := false
+	for _, r := range records {
+		if !r.ChecksumOK {
+			silent = append(silent, r)
+			lost = !r.Copy
+			continue
+		}
+		// A copy of a record left silent is written in its place
+		r.Copy = r.Copy && !lost
+		lost = false
+		if len(t.samples) > 0 {
+			t.seek(max(r.Start, t.clock+RelaminateGap))
+		} else {
+			t.seek(r.Start)
+		}
+		t.sign = 1
+		s.encode(t, timing, r)
+	}
+	t.seek(max(duration, t.clock+RelaminateGap))
+	return t.samples, silent, nil
+}
+
+// EncodeProgram writes data out as one record of the system's tape, a
+// program loading at loadAddress (-1 if the tape does not say), ending in
+// the system's checksum if it has one of Checksums. The audio returned is
+// at RelaminateRate with RelaminateGap of quiet before and after.
+func EncodeProgram(data []byte, loadAddress int, opts Options) ([]float64, error) {
+	s := opts.system()
+	if s.encode == nil {
+		return nil, fmt.Errorf("%s tapes cannot be written", s.Name)
+	}
+	if s.checksum != nil {
+		data = append(data[:len(data):len(data)], s.checksum.Sum(data)...)
+	}
+	t := &tape{rate: RelaminateRate, sign: 1}
+	t.silence(RelaminateGap)
+	s.encode(t, opts.timing(), Record{LoadAddress: loadAddress, Data: data, ChecksumOK: true, Start: t.clock})
+	t.silence(RelaminateGap)
+	return t.samples, nil
+}
+
+// tape is audio being written a half-cycle at a time. The clock keeps
+// exact time, so rounding each half-cycle to whole samples never adds up.
+type tape struct {
+	rate    float64
+	samples []float64
+	clock   float64 // seconds written
+	sign    float64 // of the next half-cycle
+
+	// lengths, if not nil, takes the length of each half-cycle instead of
+	// samples, quiet adding to the one after it
+	lengths []float64
+	quiet   float64
+}
+
+// half writes a half-cycle lasting seconds, the opposite way to the last
+func (t *tape) half(seconds float64) {
+	start := t.clock
+	t.clock += seconds
+	if t.lengths != nil {
+		t.lengths = append(t.lengths, t.quiet+seconds)
+		t.quiet = 0
+		return
+	}
+	for i := len(t.samples); i < int(math.Round(t.clock*t.rate)); i++ {
+		t.samples = append(t.samples, t.sign*RelaminateLevel*math.Sin(math.Pi*(float64(i)/t.rate-start)/seconds))
+	}
+	t.sign = -t.sign
+}
+
+// halves writes n half-cycles each lasting seconds
+func (t *tape) halves(n int, seconds float64) {
+	for range n {
+		t.half(seconds)
+	}
+}
+
+// silence writes seconds of silence
+func (t *tape) silence(seconds float64) {
+	t.clock += seconds
+	if t.lengths != nil {
+		t.quiet += seconds
+		return
+	}
+	for len(t.samples) < int(math.Round(t.clock*t.rate)) {
+		t.samples = append(t.samples, 0)
+	}
+}
+
+// seek writes silence up to at seconds, if the tape is not already past
+// it
+func (t *tape) seek(at float64) {
+	if at > t.clock {
+		t.silence(at - t.clock)
+	}
+}
+
+// headerHalves is how many half-cycles of header tone to write before a
+// record: as many as were read, but never too few to be taken for one,
+// and whole cycles so that the record ends as it started
+func headerHalves(timing *Timing, r Record) int {
+	n := max(r.Header, 2*timing.MinHeader)
+	return n + n%2
+}
+
+// encodeMonitor writes a record as the Apple ][ monitor does: the header
+// tone, the sync bit, then every bit MSB first as a whole cycle, followed
+// by trailer half-cycles of header tone
+func encodeMonitor(trailer int) func(t *tape, timing *Timing, r Record) {
+	return func(t *tape, timing *Timing, r Record) {
+		t.halves(headerHalves(timing, r), timing.HeaderTone)
+		for _, s := range timing.Sync {
+			t.half(s)
+		}
+		for _, b := range r.Data {
+			for i := 7; i >= 0; i-- {
+				p := timing.Nominal[pulseShort]
+				if b>>i&1 == 1 {
+					p = timing.Nominal[pulseLong]
+				}
+				t.halves(2, p)
+			}
+		}
+		t.halves(trailer, timing.HeaderTone)
+	}
+}
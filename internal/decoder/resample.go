@@ -0,0 +1,137 @@
+package decoder
+
+import "math"
+
+// Resampling. At 8kHz a 2kHz half-cycle is two samples long, so crossing
+// times quantized to a sample cannot tell a 0 from a 1. Interpolating the
+// audio up to a working rate first puts the crossings back where the
+// signal actually passes zero.
+const (
+	MinCrossingRate = 22050 // Hz; captures below this are upsampled by default
+	WorkingRate     = 44100 // Hz; the lowest rate automatic upsampling reaches
+	ResampleTaps    = 32    // input samples each output sample is interpolated from when upsampling
+)
+
+// workingRate returns the rate the decoder runs at for a capture at
+// sampleRate
+func (o Options) workingRate(sampleRate uint32) uint32 {
+	switch {
+	case o.Resample > 0:
+		return uint32(o.Resample)
+	case o.Resample < 0 || sampleRate >= MinCrossingRate || sampleRate == 0:
+		return sampleRate
+	}
+	// Whole multiples keep the filter to a handful of phases
+	return sampleRate * ((WorkingRate + sampleRate - 1) / sampleRate)
+}
+
+// resampler converts audio between two rates with a polyphase windowed
+// sinc filter. Windows may be fed in pieces of any size; output sample n
+// lines up with input time n*down/up exactly, so offsets scale by the
+// ratio of the rates.
+type resampler struct {
+	up, down int
+	phases   [][]float64 // filter taps for each output phase
+
+	buf  []float64 // input from base onwards
+	base int
+	next int // next output sample
+	out  []float64
+}
+
+func newResampler(from, to uint32) *resampler {
+	g := gcd(int(from), int(to))
+	r := &resampler{up: int(to) / g, down: int(from) / g}
+
+	// Cut off below the lower of the two Nyquist frequencies, widening
+	// the filter to match when decimating
+	cutoff := min(1, float64(r.up)/float64(r.down))
+	half := int(math.Ceil(ResampleTaps / 2 / cutoff))
+	r.phases = make([][]float64, r.up)
+	for p := range r.phases {
+		frac := float64(p) / float64(r.up)
+		taps := make([]float64, 2*half)
+		var sum float64
+		for k := range taps {
+			x := float64(k-half+1) - frac // input offset from the output time
+			taps[k] = cutoff * sinc(cutoff*x) * blackman(x/float64(half))
+			sum += taps[k]
+		}
+		// Unity gain at DC for every phase
+		for k := range taps {
+			taps[k] /= sum
+		}
+		r.phases[p] = taps
+	}
+	return r
+}
+
+// feed returns the output samples that the input so far determines. The
+// returned slice is reused by the next call.
+func (r *resampler) feed(window []float64) []float64 {
+	r.buf = append(r.buf, window...)
+	return r.produce(r.base+len(r.buf), math.MaxInt)
+}
+
+// flush returns the remaining output, treating the input as silent past
+// its end
+func (r *resampler) flush() []float64 {
+	end := r.base + len(r.buf)
+	taps := len(r.phases[0])
+	r.buf = append(r.buf, make([]float64, taps)...)
+	// As many outputs as cover the input, no more
+	return r.produce(end+taps, (end*r.up+r.down-1)/r.down)
+}
+
+// produce computes output samples before limit while their taps end
+// before input offset avail
+func (r *resampler) produce(avail, limit int) []float64 {
+	r.out = r.out[:0]
+	half := len(r.phases[0]) / 2
+	for r.next < limit {
+		pos := r.next * r.down
+		i, p := pos/r.up, pos%r.up
+		first := i - half + 1
+		if first+2*half > avail {
+			break
+		}
+		var y float64
+		for k, tap := range r.phases[p] {
+			if at := first + k; at >= r.base {
+				y += tap * r.buf[at-r.base]
+			}
+		}
+		r.out = append(r.out, y)
+		r.next++
+	}
+
+	// Keep what the next output's taps reach back to
+	if keep := (r.next*r.down)/r.up - half + 1 - r.base; keep > 0 {
+		keep = min(keep, len(r.buf))
+		r.buf = append(r.buf[:0], r.buf[keep:]...)
+		r.base += keep
+	}
+	return r.out
+}
+
+func sinc(x float64) float64 {
+	if x == 0 {
+		return 1
+	}
+	return math.Sin(math.Pi*x) / (math.Pi * x)
+}
+
+// blackman is the Blackman window over x in [-1, 1]
+func blackman(x float64) float64 {
+	if x <= -1 || x >= 1 {
+		return 0
+	}
+	return 0.42 + 0.5*math.Cos(math.Pi*x) + 0.08*math.Cos(2*math.Pi*x)
+}
+
+func gcd(a, b int) int {
+	for b != 0 {
+		a, b = b, a%b
+	}
+	return a
+}
@@ -0,0 +1,80 @@
+package decoder
+
+import "fmt"
+
+// Retries. A segment whose records do not all check out with the options
+// given is decoded again with each of a ladder of others in turn:
+// following the tape's speed, every other engine the system has, the
+// pulse thresholds moved by each of RetryThresholds, and the speeds in
+// SpeedFactors. The first that reads more of the segment's records whole
+// is kept, and its records say what it was, so that the options a
+// collection of tapes needs can be found and put in a profile.
+var RetryThresholds = []float64{0.92, 1.08}
+
+// retry is one rung of the ladder
+type retry struct {
+	flags string // the options as given on the command line
+	opts  Options
+	rate  uint32 // to decode at
+}
+
+// retries returns the options to retry a segment with, decoded at rate
+func retries(opts Options, rate uint32) []retry {
+	var out []retry
+	add := func(flags string, at Options) {
+		at.Log, at.Trace = nil, nil
+		out = append(out, retry{flags: flags, opts: at, rate: rate})
+	}
+	if !opts.TrackSpeed {
+		at := opts
+		at.TrackSpeed = true
+		add("-track-speed", at)
+	}
+	for _, e := range opts.system().Demods {
+		if e != opts.Demod && e != DemodVote {
+			at := opts
+			at.Demod = e
+			add("-demod "+e.String(), at)
+		}
+	}
+	for _, f := range RetryThresholds {
+		t := *opts.timing()
+		t.Short *= f
+		t.Long *= f
+		at := opts
+		at.Timing = &t
+		add(fmt.Sprintf("-short-us %.0f -long-us %.0f", t.Short*1e6, t.Long*1e6), at)
+	}
+	if opts.SpeedFactor == 0 {
+		for _, f := range SpeedFactors {
+			at := opts
+			at.SpeedFactor = f
+			add(fmt.Sprintf("-speed-factor %g", f), at)
+			out[len(out)-1].rate = at.decodeRate(rate)
+		}
+	}
+	return out
+}
+
+// processRetrying decodes a segment as processSamples does and, with
+// Retry, decodes it again down the ladder if its records did not all
+// check out
+func processRetrying(samples []float64, sampleRate uint32, opts Options) ([]record, [][2]int) {
+	records, dropouts := processSamples(samples, sampleRate, opts)
+	if !opts.Retry || (len(records) > 0 && intact(records) == len(records)) || opts.stopping() {
+		return records, dropouts
+	}
+	for _, r := range retries(opts.uninterrupted(), sampleRate) {
+		found, d := processSamples(samples, r.rate, r.opts)
+		if intact(found) > intact(records) {
+			opts.logf("Read %d programs whole with %s, not %d", intact(found), r.flags, intact(records))
+			for i := range found {
+				if found[i].checksumOK() {
+					found[i].retry = r.flags
+				}
+			}
+			return found, d
+		}
+	}
+	return records, dropouts
+}
@@ -0,0 +1,58 @@
+package decoder
+
+import "strings"
+
+// Amateur radio teletype is asynchronous serial at 45.45 baud, or 50, in
+// five-bit Baudot (ITA2) codes with 1.5 stop bits, keyed as audio tones
+// 170Hz apart. Two of the codes shift between a letters and a figures
+// page; as most amateur software does, a space also shifts back to
+// letters, so a lost FIGS code garbles no more than one word.
+var RTTY = Serial{Baud: 45.45, Framing: Framing{Order: LSBFirst, DataBits: 5, Parity: ParityNone, StopBits: 1.5}, Mark: 2125, Space: 2295}
+
+// ITA2 codes that change page
+const (
+	ita2Figures = 0x1B
+	ita2Letters = 0x1F
+)
+
+var rttySystem = System{
+	Name:            "rtty",
+	Demods:          []Demod{DemodZeroCrossing, DemodPeak},
+	newSerialFramer: newSerialFramer,
+	check:           cleanlyFramed,
+	payload:         func(data []byte) int { return len(data) },
+	pack:            packBaudot,
+	ext:             ".txt",
+}.withSerial(RTTY)
+
+// ita2 holds the letters and figures pages, as US amateur teletypes print
+// them. Carriage returns are dropped, line feeds end lines, and NUL and
+// the shift codes print nothing.
+var ita2 = [2]string{
+	"\x00E\nA SIU\x00DRJNFCKTZLWHYPQOBG\x00MXV\x00",
+	"\x003\n- \a87\x00$4',!:(5\")2#6019?&\x00./;\x00",
+}
+
+// packBaudot prints each transmission as text
+func packBaudot(blocks []Record) []byte {
+	var out strings.Builder
+	for _, b := range blocks {
+		page := 0
+		for _, code := range b.Data {
+			switch code &= 0x1F; code {
+			case ita2Figures:
+				page = 1
+			case ita2Letters:
+				page = 0
+			default:
+				if c := ita2[page][code]; c != 0 {
+					out.WriteByte(c)
+				}
+				if code == 0x04 {
+					page = 0
+				}
+			}
+		}
+	}
+	return []byte(out.String())
+}
@@ -0,0 +1,251 @@
+package decoder
+
+import (
+	"io"
+	"math"
+)
+
+// Scan parameters. A scan reads no bits: it times the swings the pulse
+// engine finds, which hiss does not break up, taking a run of cycles of
+// steady length at the start of a burst of signal as its header tone,
+// the point where the tone gives way as the sync mark, and the next long
+// silence as the end of the record. A long enough tone in the middle of
+// a burst starts a new record.
+const (
+	ScanMinHeader = 200  // half-cycles of steady tone that start a record
+	ScanTolerance = 0.08 // fraction a cycle may differ from its tone's average
+	ScanJitter    = 1.5  // samples a cycle may differ by regardless, for low rates
+	ScanMinSignal = 64   // half-cycles in the shortest burst listed, so clicks are not
+
+	// scanSettle is the half-cycles at the start of a run whose average
+	// the rest are held to, so a tone cannot drift into another
+	scanSettle = 16
+)
+
+// SegmentInfo is a record located by Scan. Times are in seconds from the
+// start of the capture.
+type SegmentInfo struct {
+	Start  float64 // start of the header tone, or of the signal without one
+	Sync   float64 // end of the header tone, where the data begins
+	End    float64 // end of the data
+	Header int     // half-cycles of header tone
+	Tone   float64 // Hz; frequency of the header tone, 0 without one
+}
+
+// Scan quickly lists the records on a tape without decoding them, for a
+// front end to show before committing to a full decode. It works from
+// the timing of the signal alone, so it needs no system and only one
+// window of samples in memory at a time. Serial systems idle on a steady
+// tone, so their records may be split wherever the line idles for long.
+func Scan(r io.Reader) ([]SegmentInfo, error) {
+	header, dataSize, err := readWAVHeader(r, Options{})
+	if err != nil {
+		return nil, err
+	}
+	s := newScanner(header.SampleRate)
+	edges := newPulseTracker(header.SampleRate)
+	err = readFrames(r, header, dataSize, readLimit{}, func(window []float64) {
+		edges.feed(window, s)
+	})
+	if err != nil {
+		return nil, err
+	}
+	edges.flush(s)
+	return s.segments, nil
+}
+
+// scanner finds records in a stream of half-cycles
+type scanner struct {
+	rate       float64
+	minSilence int
+
+	// Whole cycles are timed, which halves the jitter of each crossing
+	// and evens out lopsided waveforms
+	halfAt, halfLength int // first half of the cycle, -1 if none
+
+	open    bool // a burst of signal is being read
+	seg     scanSegment
+	run     int // half-cycles in the current run of steady tone
+	runFrom int
+	runSum  int // samples in the run
+	ref     float64
+	missed  bool // the last cycle did not fit the run
+	missAt  int
+
+	segments []SegmentInfo
+}
+
+// scanSegment is a record being scanned, in samples
+type scanSegment struct {
+	start, sync int
+	header      int
+	tone        float64
+	synced      bool // the header tone is over, or there was none
+	halves      int
+}
+
+func newScanner(sampleRate uint32) *scanner {
+	rate := float64(sampleRate)
+	return &scanner{rate: rate, minSilence: int(MinCatalogSilence * rate), halfAt: -1}
+}
+
+func (s *scanner) halfCycle(at, length int) {
+	if length >= s.minSilence {
+		s.close(at)
+		return
+	}
+	if !s.open {
+		s.open = true
+		s.seg = scanSegment{start: at}
+		s.run, s.runSum, s.missed = 0, 0, false
+	}
+	s.seg.halves++
+	if s.halfAt < 0 {
+		s.halfAt, s.halfLength = at, length
+		return
+	}
+	at, length = s.halfAt, s.halfLength+length
+	s.halfAt = -1
+
+	if s.run == 0 || math.Abs(float64(length)-s.ref) <= max(ScanTolerance*s.ref, ScanJitter) {
+		if s.run == 0 {
+			s.runFrom = at
+		}
+		s.run += 2
+		s.runSum += length
+		if s.run <= scanSettle {
+			s.ref = s.mean()
+		}
+		s.missed = false
+		return
+	}
+	if !s.missed {
+		s.missAt = at
+		// One stray cycle is forgiven; a second ends the run, as does a
+		// gap
+		if float64(length) < 2*s.ref {
+			s.missed = true
+			return
+		}
+	}
+	s.endRun(s.missAt)
+	s.run, s.runFrom, s.runSum, s.ref, s.missed = 2, at, length, float64(length), false
+}
+
+// mean returns the average length in samples of the run's cycles
+func (s *scanner) mean() float64 {
+	return float64(s.runSum) / float64(s.run/2)
+}
+
+// endRun ends the run of steady tone at offset at. A long enough run
+// is the header tone of a new record.
+func (s *scanner) endRun(at int) {
+	needed := HeaderSplitRun
+	if !s.seg.synced {
+		needed = ScanMinHeader
+	}
+	if s.run < needed {
+		return
+	}
+	if s.seg.synced && s.seg.halves-s.run-s.seg.header < ScanMinSignal && math.Abs(s.mean()-s.rate/s.seg.tone) <= ScanTolerance*s.mean() {
+		// The same tone after a glitch
+		s.seg.sync = at
+		s.seg.header = s.seg.halves
+		return
+	}
+	if s.runFrom > s.seg.start {
+		// Whatever came before the tone is a record of its own, if there
+		// is enough of it
+		s.seg.halves -= s.run
+		s.close(s.runFrom)
+	}
+	s.open = true
+	s.seg = scanSegment{start: s.runFrom, sync: at, header: s.run, tone: s.rate / s.mean(), synced: true, halves: s.run}
+}
+
+func (s *scanner) finish(at int) {
+	s.close(at)
+}
+
+// close ends the burst of signal being read at offset end
+func (s *scanner) close(end int) {
+	s.halfAt = -1
+	if !s.open {
+		return
+	}
+	s.open = false
+	seg := s.seg
+	if seg.halves < ScanMinSignal {
+		return
+	}
+	if !seg.synced {
+		seg.sync = seg.start
+		if s.run >= ScanMinHeader && s.runFrom == seg.start {
+			// Nothing but tone
+			seg.sync, seg.header, seg.tone = end, s.run, s.rate/s.mean()
+		}
+	}
+	s.segments = append(s.segments, SegmentInfo{
+		Start:  float64(seg.start) / s.rate,
+		Sync:   float64(seg.sync) / s.rate,
+		End:    float64(end) / s.rate,
+		Header: seg.header,
+		Tone:   seg.tone,
+	})
+}
+
+// SegmentMargin is the audio either side of a segment that DecodeSegment
+// decodes with it, in case the scan cut it short
+const SegmentMargin = 0.1 // seconds
+
+// DecodeSegment decodes only the stretch of a WAV stream that Scan found
+// seg in, into its records. The records' and the catalog's times are from
+// the start of the capture, as Scan's are.
+func DecodeSegment(r io.Reader, seg SegmentInfo, opts Options) ([]Record, *Catalog, error) {
+	if err := opts.system().supports(opts.Demod); err != nil {
+		return nil, nil, err
+	}
+	src, err := NewSource(r, opts)
+	if err != nil {
+		return nil, nil, err
+	}
+	header := src.Header()
+	rate := float64(header.SampleRate)
+	from := max(0, int((seg.Start-SegmentMargin)*rate))
+	to := int((seg.End + SegmentMargin) * rate)
+
+	channels := make([][]float64, opts.channels())
+	if err := src.SeekToSample(from); err != nil {
+		return nil, nil, err
+	}
+	_, err = src.Read(to-from, func(windows [][]float64) {
+		for i, window := range windows {
+			channels[i] = append(channels[i], window...)
+		}
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	// A capture whose length is not known is read past, to learn it
+	frames, ok := src.Frames()
+	if !ok {
+		if _, err := src.Read(-1, func([][]float64) {}); err != nil {
+			return nil, nil, err
+		}
+		frames = src.Position()
+	}
+	opts.logf("Read %d samples from %.3fs to %.3fs", len(channels[0]), float64(from)/rate, float64(from+len(channels[0]))/rate)
+
+	records, _, catalog := decodeSamples(channels, header, opts)
+	offset := float64(from) / rate
+	for i := range records {
+		records[i].Start += offset
+		records[i].End += offset
+	}
+	for i := range catalog.Regions {
+		catalog.Regions[i].Start += offset
+		catalog.Regions[i].End += offset
+	}
+	catalog.Duration = float64(frames) / rate
+	return records, catalog, nil
+}
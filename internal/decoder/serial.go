@@ -0,0 +1,350 @@
+package decoder
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Asynchronous serial over FSK, as modems and many data recorders send
+// it: the line idles at the mark tone, and each byte is a space start
+// bit, its data bits, usually LSB first, an optional parity bit and mark stop
+// bits, at a fixed baud rate. Unlike the computer formats there are no
+// cycles per bit to count, so half-cycles are averaged over up to half a
+// bit to tell the tones apart, and each bit is sampled at its middle,
+// timed from the start bit's leading edge as a UART does. A record is
+// everything sent while the carrier lasts.
+
+const (
+	// SerialGlitch is the fraction of the higher tone's half-cycle below
+	// which a half-cycle is a glitch, and is merged into the one before.
+	// Hiss on a dead line merges into spans too long for either tone, and
+	// so reads as the carrier dropping.
+	SerialGlitch = 0.5
+)
+
+// Serial describes an asynchronous serial FSK signal
+type Serial struct {
+	Baud float64 // bits a second
+	Framing
+	Mark  float64 // Hz of a 1 bit and the idle line
+	Space float64 // Hz of a 0 bit
+}
+
+// Bell103 is 300 baud 8N1 on the originating side of a Bell 103 modem,
+// the settings the uart system decodes unless told otherwise
+var Bell103 = Serial{Baud: 300, Framing: Serial8N1, Mark: 1270, Space: 1070}
+
+// check returns an error if the settings cannot be decoded
+func (s Serial) check() error {
+	switch {
+	case s.Baud <= 0:
+		return errors.New("baud rate must be above zero")
+	case s.StopBits == 0:
+		return errors.New("serial bytes need a stop bit")
+	case s.Mark <= 0 || s.Space <= 0:
+		return errors.New("mark and space frequencies must be above zero")
+	case s.Mark == s.Space:
+		return errors.New("mark and space frequencies must differ")
+	case 2*min(s.Mark, s.Space) < s.Baud:
+		return fmt.Errorf("%v baud is too fast for a %v Hz tone, which needs a half-cycle in every bit", s.Baud, min(s.Mark, s.Space))
+	}
+	return s.Framing.check()
+}
+
+// Serial returns the settings of a system that decodes serial FSK
+func (s *System) Serial() (Serial, bool) {
+	if s.serial == nil {
+		return Serial{}, false
+	}
+	return *s.serial, true
+}
+
+// WithSerial returns a serial FSK system decoding with settings c instead
+// of its own
+func (s *System) WithSerial(c Serial) (*System, error) {
+	if s.serial == nil {
+		return nil, fmt.Errorf("%s tapes are not serial FSK", s.Name)
+	}
+	if err := c.check(); err != nil {
+		return nil, err
+	}
+	return s.withSerial(c), nil
+}
+
+// withSerial returns a copy of the system set up for settings already
+// checked
+func (s System) withSerial(c Serial) *System {
+	high, low := 1/(2*max(c.Mark, c.Space)), 1/(2*min(c.Mark, c.Space))
+	s.Timing = &Timing{
+		Short: (high + low) / 2,
+		// Where the tones change, a half-cycle can fall part way
+		// between them; anything much longer than the low one is the
+		// carrier dropping
+		Long:       3 * low,
+		MinHeader:  int(c.bits() * 2 * c.Mark / c.Baud), // a frame's worth of idle line
+		HeaderTone: 1 / (2 * c.Mark),                    // the idle line
+		Nominal: [numPulses]float64{
+			pulseShort: high,
+			pulseLong:  low,
+		},
+	}
+	s.serial = &c
+	s.framing = c.Framing
+	s.selfTimed = true
+	newFramer := s.newSerialFramer
+	s.newFramer = func() framer { return newFramer(c) }
+	return &s
+}
+
+var uartSystem = System{
+	Name:            "uart",
+	Demods:          []Demod{DemodZeroCrossing, DemodPeak},
+	newSerialFramer: newSerialFramer,
+	check:           cleanlyFramed,
+	payload:         func(data []byte) int { return len(data) },
+	pack:            concatBlocks,
+}.withSerial(Bell103)
+
+// span is a half-cycle's place in the capture, in samples
+type span struct {
+	at, end int
+}
+
+// toneTracker tells which of two tones the line carries at any moment,
+// from half-cycles held back until the audio around them is in
+type toneTracker struct {
+	baud      float64
+	markShort bool    // the mark tone is the higher one
+	bitTime   float64 // samples per bit, set with the first half-cycle
+	reach     float64 // samples either side of a moment averaged to find its tone
+
+	// spans holds the recent half-cycles, the last still open to
+	// glitches
+	spans []span
+}
+
+func newToneTracker(s Serial) toneTracker {
+	return toneTracker{baud: s.Baud, markShort: s.Mark > s.Space}
+}
+
+// add takes in the decoder's current half-cycle. It returns the sample
+// offset up to which the tone can now be told, or, if the carrier has
+// dropped, lost set and where it dropped.
+func (t *toneTracker) add(d *bitDecoder, p pulse) (settled float64, lost bool, at int) {
+	if t.bitTime == 0 {
+		t.bitTime = d.rate / t.baud
+		t.reach = t.bitTime / 4
+	}
+	last := len(t.spans) - 1
+	switch {
+	case d.length < SerialGlitch*d.timing.Nominal[pulseShort] && last >= 0:
+		t.spans[last].end = d.end
+		if float64(d.end-t.spans[last].at)/d.rate <= d.timing.Long {
+			return float64(t.spans[last].at), false, 0
+		}
+		// Hiss, not a glitch: the carrier ended where the span began
+		at = t.spans[last].at
+	case p == pulseHeader:
+		at = d.at
+	default:
+		t.spans = append(t.spans, span{d.at, d.end})
+		// All but the newest span are settled
+		return float64(d.at), false, 0
+	}
+	for len(t.spans) > 0 && t.spans[len(t.spans)-1].end > at {
+		t.spans = t.spans[:len(t.spans)-1]
+	}
+	return float64(at), true, at
+}
+
+// isMark reports whether the line carries the mark tone around sample
+// offset at, judging by how many half-cycles fit in the reach either
+// side of it
+func (t *toneTracker) isMark(d *bitDecoder, at float64) bool {
+	from, to := at-t.reach, at+t.reach
+	halves := 0.0
+	for _, s := range t.spans {
+		overlap := min(to, float64(s.end)) - max(from, float64(s.at))
+		if overlap > 0 {
+			halves += overlap / float64(s.end-s.at)
+		}
+	}
+	if halves == 0 {
+		return true
+	}
+	average := (to - from) / halves / d.rate
+	if d.trackSpeed {
+		average /= d.speed
+	}
+	return (average < d.timing.Short) == t.markShort
+}
+
+// forget drops the spans too old to be averaged for any moment from
+// sample offset from on, returning how many it dropped
+func (t *toneTracker) forget(from float64) int {
+	drop := 0
+	for drop < len(t.spans)-1 && float64(t.spans[drop].end) < from-t.reach {
+		drop++
+	}
+	t.spans = append(t.spans[:0], t.spans[drop:]...)
+	return drop
+}
+
+// middle returns the sample offset halfway through span i
+func (t *toneTracker) middle(i int) float64 {
+	return float64(t.spans[i].at+t.spans[i].end) / 2
+}
+
+// serialFramer is a UART fed with tones
+type serialFramer struct {
+	toneTracker
+	serial Serial
+
+	// Spans from examined on have yet to be looked at for the leading
+	// edge of a start bit
+	examined int
+	mark     bool // the line level of the last span examined
+
+	framing bool    // a frame is being read
+	bit     int     // bit of the frame to be sampled next; 0 is the start bit
+	next    float64 // sample offset at which to sample it
+	frameAt int     // where the frame began
+	current byte    // data bits shifted in, the last lowest
+	ones    int     // 1 data bits in the frame
+	fault   FrameError
+}
+
+func newSerialFramer(s Serial) framer {
+	return &serialFramer{toneTracker: newToneTracker(s), serial: s, mark: true}
+}
+
+func (f *serialFramer) halfCycle(d *bitDecoder, p pulse) {
+	settled, lost, at := f.add(d, p)
+	f.advance(d, settled)
+	if lost {
+		f.drop(d, at)
+	}
+}
+
+// drop ends the record at sample offset at, the carrier having dropped
+func (f *serialFramer) drop(d *bitDecoder, at int) {
+	d.closeRecord(at)
+	d.state = stateHeader
+	d.header = 0
+	f.spans = f.spans[:0]
+	f.examined = 0
+	f.framing = false
+	f.mark = true
+}
+
+// finish reads what is left of the last record at the end of the stream,
+// at sample offset at. Bits are only sampled up to there: a byte the
+// stream ends in before its stop bit is kept, with the stop bit missing,
+// if all its data bits were sent, and dropped if not.
+func (f *serialFramer) finish(d *bitDecoder, at int) {
+	f.advance(d, float64(at)+f.reach)
+	if f.framing && d.open != nil && f.bit > f.serial.DataBits {
+		f.fault.Stop = true
+		f.framing = false
+		d.addFramed(f.serial.value(f.current), f.fault)
+	}
+}
+
+// advance runs the UART over everything that can be judged with the
+// audio up to sample offset settled: a moment's tone is known once the
+// audio reach past it is.
+func (f *serialFramer) advance(d *bitDecoder, settled float64) {
+	for {
+		if f.framing {
+			if f.next+f.reach > settled {
+				break
+			}
+			at := f.next
+			mark := f.isMark(d, at)
+			f.sample(d, mark)
+			f.next += f.bitTime
+			if !f.framing {
+				// Look for the next start bit after the frame's last
+				// sample
+				f.mark = mark
+				for f.examined < len(f.spans) && f.middle(f.examined) <= at {
+					f.examined++
+				}
+			}
+			continue
+		}
+		if f.examined >= len(f.spans) || f.middle(f.examined)+f.reach > settled {
+			break
+		}
+		f.examined++
+		f.edge(d, f.spans[f.examined-1], f.isMark(d, f.middle(f.examined-1)))
+	}
+
+	from := f.next
+	if !f.framing && f.examined < len(f.spans) {
+		from = float64(f.spans[f.examined].at)
+	}
+	f.examined = max(0, f.examined-f.forget(from))
+}
+
+// edge follows the idle line through span s, whose tone is mark or not,
+// and starts a frame at the leading edge of a start bit
+func (f *serialFramer) edge(d *bitDecoder, s span, mark bool) {
+	if d.state == stateHeader {
+		if mark {
+			d.countHeader(pulseShort)
+			f.mark = true
+			return
+		}
+		if d.header <= d.timing.MinHeader {
+			d.header = 0
+			f.mark = false
+			return
+		}
+		d.startData(pulseShort)
+		d.open.dataStart = s.at
+	}
+	if !mark && f.mark {
+		f.framing = true
+		f.bit, f.current, f.ones, f.fault = 0, 0, 0, FrameError{}
+		f.frameAt = s.at
+		f.next = float64(s.at) + f.bitTime/2
+		// Spans already passed belong to the frame
+		for f.examined < len(f.spans) && f.spans[f.examined].at < s.at {
+			f.examined++
+		}
+	}
+	f.mark = mark
+}
+
+// sample takes the line level at the middle of the frame's next bit
+func (f *serialFramer) sample(d *bitDecoder, mark bool) {
+	b := f.bit
+	f.bit++
+	d.open.cells++
+	switch {
+	case b == 0:
+		if mark {
+			// Too short to be a start bit: a glitch on the idle line
+			d.open.cells--
+			f.framing = false
+		}
+		return
+	case b <= f.serial.DataBits:
+		f.current <<= 1
+		if mark {
+			f.current |= 1
+			f.ones++
+		}
+		return
+	case b == f.serial.DataBits+1 && f.serial.Parity != ParityNone:
+		f.fault.Parity = mark != f.serial.parityBit(f.ones)
+		return
+	}
+
+	// The stop bit
+	f.fault.Stop = !mark
+	f.framing = false
+	d.erasing = d.inDropout(f.frameAt, int(f.next))
+	d.addFramed(f.serial.value(f.current), f.fault)
+}
@@ -0,0 +1,127 @@
+package decoder
+
+import (
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Source reads the samples of a WAV capture from any point in it. A
+// capture that can be seeked in, such as a file, is read only where it
+// is asked for; one that cannot, such as a download, is read forward to
+// the point and cannot go back.
+type Source struct {
+	r         io.Reader
+	header    WavHeader
+	dataSize  uint32
+	frameSize int64
+	start     int64 // offset of the data in r, if r can be seeked in
+	seeker    io.Seeker
+	left      int64 // bytes in r after the header, or -1 if unknown
+	pos       int   // frame read next
+	opts      Options
+}
+
+// NewSource reads the header of a WAV stream and returns a source of its
+// samples, at the first of them
+func NewSource(r io.Reader, opts Options) (*Source, error) {
+	header, dataSize, err := readWAVHeader(r, opts)
+	if err != nil {
+		return nil, err
+	}
+	if err := hasChannels(header, opts); err != nil {
+		return nil, err
+	}
+	frameSize := int64(header.BitsPerSample/8) * int64(header.NumChannels)
+	if frameSize == 0 {
+		return nil, formatErrorf("unsupported bits per sample: %d", header.BitsPerSample)
+	}
+	s := &Source{r: r, header: header, dataSize: dataSize, frameSize: frameSize, left: -1, opts: opts}
+	if seeker, ok := r.(io.Seeker); ok {
+		if s.start, err = seeker.Seek(0, io.SeekCurrent); err == nil {
+			s.seeker = seeker
+		}
+	}
+	if left, ok := remaining(r); ok {
+		s.left = left
+	}
+	return s, nil
+}
+
+// Header returns the capture's format
+func (s *Source) Header() WavHeader {
+	return s.header
+}
+
+// Frames returns how many frames the capture holds, if the stream knows
+// its length. A header's word alone is not taken for it.
+func (s *Source) Frames() (int, bool) {
+	if s.left < 0 {
+		return 0, false
+	}
+	size := s.left
+	if s.sized() {
+		size = min(size, int64(s.dataSize))
+	}
+	return int(size / s.frameSize), true
+}
+
+// sized reports whether the header gives the size of the data, which
+// recorders writing a stream often leave at 0 or 0xFFFFFFFF
+func (s *Source) sized() bool {
+	return s.dataSize != 0 && s.dataSize != 0xFFFFFFFF
+}
+
+// Position returns the frame read next
+func (s *Source) Position() int {
+	return s.pos
+}
+
+// SeekToSample moves to the frame n
+func (s *Source) SeekToSample(n int) error {
+	if n < 0 {
+		return fmt.Errorf("cannot seek to sample %d", n)
+	}
+	if s.seeker != nil {
+		if _, err := s.seeker.Seek(s.start+int64(n)*s.frameSize, io.SeekStart); err != nil {
+			return err
+		}
+		s.pos = n
+		return nil
+	}
+	if n < s.pos {
+		return errors.New("cannot seek back in a capture that cannot be rewound")
+	}
+	// Read past what lies between
+	err := skip(s.r, int64(n-s.pos)*s.frameSize)
+	if truncated(err) {
+		err = nil
+	}
+	s.pos = n
+	return err
+}
+
+// SeekToTime moves to the frame at seconds from the start
+func (s *Source) SeekToTime(seconds float64) error {
+	return s.SeekToSample(int(seconds * float64(s.header.SampleRate)))
+}
+
+// Read reads up to frames frames, or to the end if frames is below 0,
+// handing fn a window of each channel decoded as readChannels does, and
+// returns how many it read
+func (s *Source) Read(frames int, fn func(windows [][]float64)) (int, error) {
+	r := s.r
+	if s.sized() {
+		r = io.LimitReader(r, max(0, int64(s.dataSize)-int64(s.pos)*s.frameSize))
+	}
+	if frames >= 0 {
+		r = io.LimitReader(r, int64(frames)*s.frameSize)
+	}
+	read := 0
+	err := readChannels(r, s.header, 0, s.opts.channels(), s.opts.readLimit(s.header, 0), func(windows [][]float64) {
+		read += len(windows[0])
+		fn(windows)
+	})
+	s.pos += read
+	return read, err
+}
@@ -0,0 +1,179 @@
+package decoder
+
+import (
+	"math"
+	"slices"
+	"sync"
+)
+
+// Split detection parameters
+const (
+	SilenceLevel   = 0.02 // peak amplitude below which audio counts as silence
+	MinSilence     = 0.5  // seconds of silence needed before splitting there
+	HeaderSplitRun = 400  // header half-cycles needed before splitting inside a tone
+	MinChunk       = 30.0 // seconds of audio per chunk handed to a worker
+)
+
+// findSilences returns the [start, end) sample ranges where the signal
+// stays below SilenceLevel for at least minLength samples
+func findSilences(samples []float64, minLength int) [][2]int {
+	var silences [][2]int
+	start := -1
+	for i, sample := range samples {
+		if math.Abs(sample) < SilenceLevel {
+			if start < 0 {
+				start = i
+			}
+			continue
+		}
+		if start >= 0 && i-start >= minLength {
+			silences = append(silences, [2]int{start, i})
+		}
+		start = -1
+	}
+	if start >= 0 && len(samples)-start >= minLength {
+		silences = append(silences, [2]int{start, len(samples)})
+	}
+	return silences
+}
+
+// findSplitPoints returns offsets where the stream can be cut without
+// breaking a record: the middle of every long silence, and a point inside
+// every long header tone that still leaves enough of the tone on the
+// right for the sync search to succeed. Only half-cycles too long to be
+// data count towards a header tone, so a system whose header tone is
+// also one of its data pulses is split at silences alone.
+func findSplitPoints(samples []float64, sampleRate uint32, t *Timing) []int {
+	var cuts []int
+	for _, s := range findSilences(samples, int(MinSilence*float64(sampleRate))) {
+		cuts = append(cuts, s[0]+(s[1]-s[0])/2)
+	}
+
+	lastCrossing := -1
+	headerRun := 0
+	headerCut := -1
+	for i := 1; i < len(samples); i++ {
+		if (samples[i-1] < 0) == (samples[i] < 0) {
+			continue
+		}
+		if lastCrossing >= 0 {
+			durationSec := float64(i-lastCrossing) / float64(sampleRate)
+			if t.classify(durationSec) == pulseHeader {
+				headerRun++
+				if headerRun == HeaderSplitRun/2 {
+					headerCut = i
+				}
+				if headerRun == HeaderSplitRun {
+					cuts = append(cuts, headerCut)
+				}
+			} else {
+				headerRun = 0
+			}
+		}
+		lastCrossing = i
+	}
+
+	slices.Sort(cuts)
+	return cuts
+}
+
+// chunkBounds groups split points into [start, end) ranges of at least
+// MinChunk seconds so workers are not swamped with tiny pieces
+func chunkBounds(cuts []int, total int, sampleRate uint32) [][2]int {
+	minChunk := int(MinChunk * float64(sampleRate))
+	var bounds [][2]int
+	start := 0
+	for _, c := range cuts {
+		if c-start >= minChunk && total-c >= minChunk {
+			bounds = append(bounds, [2]int{start, c})
+			start = c
+		}
+	}
+	return append(bounds, [2]int{start, total})
+}
+
+// processParallel splits a long capture at silences and header tones and
+// decodes the pieces concurrently, concatenating the results in tape order
+func processParallel(samples []float64, sampleRate uint32, opts Options) ([]record, [][2]int) {
+	bounds := chunkBounds(findSplitPoints(samples, sampleRate, opts.timing()), len(samples), sampleRate)
+	if len(bounds) == 1 {
+		return processRetrying(samples, sampleRate, opts)
+	}
+
+	workers := max(1, min(opts.Workers, len(bounds)))
+	opts.logf("Split into %d segments, decoding on %d workers", len(bounds), workers)
+
+	// Per-chunk progress would interleave, so chunks decode silently
+	quiet := opts.uninterrupted()
+	quiet.Log = nil
+
+	var saved *checkpoint
+	if opts.Checkpoint != "" {
+		var err error
+		saved, err = openCheckpoint(opts.Checkpoint, opts.Resume, len(samples), sampleRate, bounds, opts)
+		if err != nil {
+			opts.warnf("%v; starting from the beginning", err)
+			saved, _ = openCheckpoint(opts.Checkpoint, false, len(samples), sampleRate, bounds, opts)
+		}
+		if n := len(saved.Segments); n > 0 {
+			opts.logf("Resuming with %d of %d segments decoded", n, len(bounds))
+		}
+	}
+
+	results := make([][]record, len(bounds))
+	dropouts := make([][][2]int, len(bounds))
+	next := make(chan int)
+	var wg sync.WaitGroup
+	for range workers {
+		wg.Go(func() {
+			for i := range next {
+				if saved != nil {
+					var ok bool
+					if results[i], dropouts[i], ok = saved.done(i, opts.system()); ok {
+						continue
+					}
+				}
+				b := bounds[i]
+				results[i], dropouts[i] = processRetrying(samples[b[0]:b[1]], sampleRate, quiet)
+				if saved != nil {
+					if err := saved.save(i, results[i], dropouts[i]); err != nil {
+						opts.warnf("Saving checkpoint: %v", err)
+					}
+				}
+			}
+		})
+	}
+	// Once the decode is to stop no more segments are begun
+	begun := len(bounds)
+	for i := range bounds {
+		if opts.stopping() {
+			begun = i
+			opts.stop(bounds[i][0])
+			break
+		}
+		next <- i
+	}
+	close(next)
+	wg.Wait()
+	if saved != nil && begun == len(bounds) {
+		if err := saved.remove(); err != nil {
+			opts.warnf("Removing checkpoint: %v", err)
+		}
+	}
+
+	var records []record
+	var allDropouts [][2]int
+	for i, rs := range results {
+		offset := bounds[i][0]
+		for _, r := range rs {
+			r.headerStart += offset
+			r.dataStart += offset
+			r.end += offset
+			records = append(records, r)
+		}
+		for _, d := range dropouts[i] {
+			allDropouts = append(allDropouts, [2]int{d[0] + offset, d[1] + offset})
+		}
+	}
+	return records, allDropouts
+}
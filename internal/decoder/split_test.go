@@ -0,0 +1,43 @@
+package decoder
+
+import (
+	"bytes"
+	"math/rand/v2"
+	"testing"
+)
+
+// TestSplitRunOfOnes decodes a program long enough to be split, with a
+// run of 0xFF in the middle as long as a header tone that is split, both
+// serially and in parallel, which must read it the same
+func TestSplitRunOfOnes(t *testing.T) {
+	random := rand.New(rand.NewPCG(5, 6))
+	data := make([]byte, 13000)
+	for i := range data {
+		data[i] = byte(random.Uint32())
+	}
+	for i := range 100 {
+		data[len(data)/2+i] = 0xFF
+	}
+	opts := Options{System: &appleIISystem}
+	samples, err := EncodeProgram(data, 0x800, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The header tone written before it is too short to split in
+	if cuts := findSplitPoints(samples, RelaminateRate, opts.timing()); len(cuts) > 0 {
+		t.Errorf("got split points at samples %v, want none", cuts)
+	}
+
+	header := WavHeader{NumChannels: 1, SampleRate: RelaminateRate, BitsPerSample: 16}
+	var got [2][]Record
+	for i, workers := range []int{1, 4} {
+		opts.Workers = workers
+		got[i], _, _ = decodeSamples([][]float64{samples}, header, opts)
+	}
+	if len(got[0]) != 1 || !got[0][0].ChecksumOK {
+		t.Fatalf("serially, got %d records, want the program whole", len(got[0]))
+	}
+	if len(got[1]) != 1 || !got[1][0].ChecksumOK || !bytes.Equal(got[1][0].Data, got[0][0].Data) {
+		t.Errorf("in parallel, got %d records, not the program read serially", len(got[1]))
+	}
+}
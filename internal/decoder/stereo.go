@@ -0,0 +1,246 @@
+package decoder
+
+import "slices"
+
+// A mono tape captured in stereo is recorded twice over, by heads whose
+// gaps sit at slightly different angles and levels, so a dropout or a
+// crease can spoil a stretch on one channel and leave it on the other.
+// Each channel is decoded on its own and the two readings of each record
+// are merged bit by bit. Where they differ, a dropout may have cost one
+// of them bits and put it out of step, so the merge looks ahead for where
+// they agree again over StereoMatch bits, up to StereoSlip bits on, and
+// takes what lies between from the channel that did not drop out there
+// or, failing that, the one that read the record more cleanly.
+const (
+	StereoMatch = 24  // bits the readings must agree on to be back in step
+	StereoSlip  = 256 // bits either reading may have gained or lost before they are
+)
+
+// mergeChannels merges the records right read into left's, and keeps
+// only the dropouts both channels had
+func mergeChannels(left, right *channel, opts Options) {
+	var all []engineRecord
+	for i, c := range []*channel{left, right} {
+		for _, r := range c.records {
+			all = append(all, engineRecord{engine: opts.Demod, channel: i + 1, record: r})
+		}
+	}
+	opts.logf("Read %d programs from the left channel and %d from the right, %d and %d of them intact",
+		len(left.records), len(right.records), intact(left.records), intact(right.records))
+	left.records = nil
+	for _, group := range groupReadings(all, left.rate) {
+		r := mergeGroup(group)
+		if len(r.disputes) > 0 {
+			opts.logf("Channels disagreed on %d bytes of program %d", len(r.disputes), len(left.records)+1)
+		}
+		left.records = append(left.records, r)
+	}
+	left.dropouts = overlaps(left.dropouts, right.dropouts)
+	left.clipped = max(left.clipped, right.clipped)
+}
+
+// mergeGroup merges the best reading of a record from each channel, or
+// returns the best one if only one channel read it
+func mergeGroup(group []engineRecord) record {
+	var best [2]*engineRecord
+	for i := range group {
+		r := &group[i]
+		if b := best[r.channel-1]; b == nil || r.weight() > b.weight() {
+			best[r.channel-1] = r
+		}
+	}
+	switch {
+	case best[0] == nil:
+		return best[1].record
+	case best[1] == nil:
+		return best[0].record
+	}
+	return mergeReadings(*best[0], *best[1])
+}
+
+// mergeReadings merges two readings of a record bit by bit
+func mergeReadings(a, b engineRecord) record {
+	if b.weight() > a.weight() {
+		a, b = b, a
+	}
+	abits, aerased := unpackBits(a.record)
+	bbits, berased := unpackBits(b.record)
+	agree := func(i, j int) bool {
+		return abits[i] == bbits[j] && !aerased[i] && !berased[j]
+	}
+
+	var bits []bool
+	var erased, from []int // bits erased, and bits taken from b
+	i, j := 0, 0
+	for i < len(abits) && j < len(bbits) {
+		if agree(i, j) {
+			bits = append(bits, abits[i])
+			i, j = i+1, j+1
+			continue
+		}
+		di, dj, ok := realign(i, j, len(abits), len(bbits), agree)
+		if !ok {
+			break
+		}
+		// Take the stretch between from b only if a dropped out there and
+		// b did not
+		if slices.Contains(aerased[i:i+di], true) && !slices.Contains(berased[j:j+dj], true) {
+			for k := range dj {
+				from = append(from, len(bits))
+				bits = append(bits, bbits[j+k])
+			}
+		} else {
+			for k := range di {
+				if aerased[i+k] {
+					erased = append(erased, len(bits))
+				}
+				bits = append(bits, abits[i+k])
+			}
+		}
+		i, j = i+di, j+dj
+	}
+	// Whatever is left, once the readings can no longer be put in step,
+	// is a's; or b's, if a lost bits and ended first
+	if i < len(abits) {
+		for k := i; k < len(abits); k++ {
+			if aerased[k] {
+				erased = append(erased, len(bits))
+			}
+			bits = append(bits, abits[k])
+		}
+	} else {
+		for k := j; k < len(bbits); k++ {
+			if berased[k] {
+				erased = append(erased, len(bits))
+			}
+			from = append(from, len(bits))
+			bits = append(bits, bbits[k])
+		}
+	}
+
+	out := a.record
+	framing := out.system.framing
+	n := framing.dataBits()
+	out.data = make([]byte, len(bits)/n)
+	out.tailBits = len(bits) % n
+	for i := range out.data {
+		out.data[i] = framing.value(shiftIn(bits[n*i : n*(i+1)]))
+	}
+	out.tail = shiftIn(bits[n*len(out.data):])
+	out.erased = byteOffsets(erased, len(out.data), n)
+	taken := byteOffsets(from, len(out.data), n)
+	// Framing bits are not merged, so a's marks stand for the bytes it
+	// supplied
+	out.frameErrors = nil
+	for _, e := range a.frameErrors {
+		if e.Offset < len(out.data) && !slices.Contains(taken, e.Offset) {
+			out.frameErrors = append(out.frameErrors, e)
+		}
+	}
+	out.disputes = nil
+	for _, offset := range taken {
+		out.disputes = append(out.disputes, Dispute{
+			Offset:  offset,
+			Winner:  b.engine,
+			Channel: b.channel,
+			Votes: []Vote{
+				{Engine: a.engine, Channel: a.channel, Value: byteAt(a.data, offset), Weight: a.weight()},
+				{Engine: b.engine, Channel: b.channel, Value: out.data[offset], Weight: b.weight()},
+			},
+		})
+	}
+	return out
+}
+
+// realign finds the fewest bits to skip in each of two readings, at i
+// and j, after which they agree again for StereoMatch bits
+func realign(i, j, na, nb int, agree func(i, j int) bool) (int, int, bool) {
+	for total := 1; total <= 2*StereoSlip; total++ {
+		for di := max(0, total-StereoSlip); di <= min(total, StereoSlip); di++ {
+			dj := total - di
+			if i+di+StereoMatch > na || j+dj+StereoMatch > nb {
+				continue
+			}
+			k := 0
+			for k < StereoMatch && agree(i+di+k, j+dj+k) {
+				k++
+			}
+			if k == StereoMatch {
+				return di, dj, true
+			}
+		}
+	}
+	return 0, 0, false
+}
+
+// shiftIn returns bits shifted into a byte as received, the last lowest
+func shiftIn(bits []bool) byte {
+	var b byte
+	for _, bit := range bits {
+		b <<= 1
+		if bit {
+			b |= 1
+		}
+	}
+	return b
+}
+
+// unpackBits returns a record's data as bits in the order they were
+// read, then those of its unfinished tail, and which of them are of
+// erased bytes
+func unpackBits(r record) ([]bool, []bool) {
+	framing := r.system.framing
+	n := framing.dataBits()
+	bits := make([]bool, n*len(r.data)+r.tailBits)
+	erased := make([]bool, len(bits))
+	for k := range n * len(r.data) {
+		bits[k] = framing.bit(r.data[k/n], k%n) == 1
+	}
+	for k := range r.tailBits {
+		bits[n*len(r.data)+k] = r.tail>>(r.tailBits-1-k)&1 != 0
+	}
+	for _, offset := range r.erased {
+		for k := range n {
+			erased[n*offset+k] = true
+		}
+	}
+	return bits, erased
+}
+
+// byteOffsets returns the bytes, of n of perByte bits, that the bits at
+// the given offsets fall in, each once
+func byteOffsets(bits []int, n, perByte int) []int {
+	var out []int
+	for _, k := range bits {
+		if b := k / perByte; b < n && (len(out) == 0 || out[len(out)-1] != b) {
+			out = append(out, b)
+		}
+	}
+	return out
+}
+
+// byteAt returns data[i], or 0 past its end
+func byteAt(data []byte, i int) byte {
+	if i < len(data) {
+		return data[i]
+	}
+	return 0
+}
+
+// overlaps returns the stretches that both of two ordered lists of
+// stretches cover
+func overlaps(a, b [][2]int) [][2]int {
+	var out [][2]int
+	for i, j := 0, 0; i < len(a) && j < len(b); {
+		from, to := max(a[i][0], b[j][0]), min(a[i][1], b[j][1])
+		if from < to {
+			out = append(out, [2]int{from, to})
+		}
+		if a[i][1] < b[j][1] {
+			i++
+		} else {
+			j++
+		}
+	}
+	return out
+}
@@ -0,0 +1,313 @@
+package decoder
+
+import (
+	"errors"
+	"fmt"
+	"io"
+)
+
+// EventKind says what a streaming Event reports
+type EventKind int
+
+const (
+	EventRecordStart EventKind = iota // sync bit found, data follows
+	EventRecordEnd                    // record complete
+	EventDropout                      // the signal dropped out and recovered
+)
+
+// Event is reported by DecodeStream as soon as the decoder knows it
+type Event struct {
+	Kind    EventKind
+	Program int     // 1-based, in tape order; unset for EventDropout
+	Start   float64 // seconds: header tone start for the record, or dropout start
+	Time    float64 // seconds: sync for EventRecordStart, end of data for EventRecordEnd, end of the dropout for EventDropout
+
+	// EventRecordEnd only
+	Data       []byte  // decoded bytes including any trailing checksum
+	Header     int     // half-cycles of header tone before the record
+	Pulse      float64 // seconds; average header half-cycle
+	ChecksumOK bool
+	Confidence float64
+	Erased     []int        // offsets in Data of bytes zeroed by dropouts
+	Misframed  []FrameError // bytes in Data whose start, parity or stop bits were wrong
+	Written    int          // bytes written to Options.Output so far
+}
+
+// Progress is a snapshot of a running DecodeStream
+type Progress struct {
+	SampleRate uint32
+	Time       float64 // seconds of audio processed
+	State      string  // "header", "sync" or "data"
+	Header     int     // header half-cycles in the current run
+	Programs   int     // records started so far
+	Bytes      int     // bytes decoded so far
+	Errors     int     // bit cells whose halves disagreed so far
+	Dropouts   int     // dropouts found so far
+
+	// Window is the block of samples just processed. It is reused for
+	// the next window, so callers must copy anything they keep.
+	Window []float64
+}
+
+// DecodeStream decodes a WAV stream incrementally, calling emit as each
+// record starts and completes. Only one window of samples is held in
+// memory at a time, so it suits live input and captures too long to load.
+func DecodeStream(r io.Reader, opts Options, emit func(Event)) error {
+	if opts.Demod == DemodVote {
+		return fmt.Errorf("%v decoding needs the whole capture and cannot stream", opts.Demod)
+	}
+	if opts.Reverse {
+		return errors.New("reversed audio needs the whole capture and cannot stream")
+	}
+	if opts.Stereo {
+		return errors.New("merging stereo channels needs the whole capture and cannot stream")
+	}
+	if opts.Azimuth {
+		return errors.New("aligning stereo channels needs the whole capture and cannot stream")
+	}
+	if err := opts.system().supports(opts.Demod); err != nil {
+		return err
+	}
+	header, dataSize, err := readWAVHeader(r, opts)
+	if err != nil {
+		return err
+	}
+	if err := hasChannels(header, opts); err != nil {
+		return err
+	}
+
+	pre := newPreprocessor(opts, header.SampleRate)
+	sampleRate := pre.rate
+
+	rate := float64(sampleRate)
+	program := 0
+	d := newBitDecoder(opts.system(), opts.timing(), opts.decodeRate(sampleRate))
+	d.trackSpeed = opts.TrackSpeed
+	d.headerSpeed = opts.headerSpeed()
+	d.log = opts.Log
+	if opts.Trace != nil {
+		d.trace = &tracer{w: opts.Trace, rate: rate}
+	}
+	d.onStart = func(rec *record) {
+		program++
+		emit(Event{
+			Kind:    EventRecordStart,
+			Program: program,
+			Start:   float64(rec.headerStart) / rate,
+			Time:    float64(rec.dataStart) / rate,
+		})
+	}
+	var out *packWriter
+	if opts.Output != nil {
+		out = &packWriter{w: opts.Output, system: opts.system()}
+		// Reading stops once the output cannot be written
+		r = &stopReader{r: r, err: &out.err}
+	}
+	d.onRecord = func(rec record) {
+		written := 0
+		if out != nil {
+			out.add(rec.export(rate))
+			written = out.written
+		}
+		emit(Event{
+			Kind:       EventRecordEnd,
+			Program:    program,
+			Start:      float64(rec.headerStart) / rate,
+			Time:       float64(rec.end) / rate,
+			Data:       rec.data,
+			Header:     rec.header,
+			Pulse:      rec.pulse,
+			ChecksumOK: rec.checksumOK(),
+			Confidence: rec.confidence(),
+			Erased:     rec.erased,
+			Misframed:  rec.frameErrors,
+			Written:    written,
+		})
+	}
+
+	// Half-cycles are held back until the dropout detector has settled
+	// past them, so the bit decoder always knows about a dropout before
+	// it reaches it
+	var dropouts *dropoutDetector
+	var sink bitSink = d
+	held := &heldSink{next: d}
+	if !opts.IgnoreDropouts {
+		dropouts = newDropoutDetector(opts.decodeRate(sampleRate))
+		sink = held
+	}
+	release := func(until int) {
+		for _, s := range dropouts.found[len(d.dropouts):] {
+			emit(Event{
+				Kind:  EventDropout,
+				Start: float64(s[0]) / rate,
+				Time:  float64(s[1]) / rate,
+			})
+		}
+		d.dropouts = dropouts.found
+		held.release(until)
+	}
+
+	demod := newDemodulator(opts, opts.decodeRate(sampleRate))
+	pos := 0
+	process := func(window []float64) {
+		pos += len(window)
+		if dropouts != nil {
+			dropouts.feed(window)
+		}
+		demod.feed(window, sink)
+		if dropouts != nil {
+			release(dropouts.settled())
+		}
+		if opts.Progress != nil {
+			opts.Progress(Progress{
+				SampleRate: sampleRate,
+				Time:       float64(pos) / rate,
+				State:      d.stateName(),
+				Header:     d.header,
+				Programs:   program,
+				Bytes:      d.totalBytes,
+				Errors:     d.totalErrors,
+				Dropouts:   len(d.dropouts),
+				Window:     window,
+			})
+		}
+	}
+	var mixed []float64
+	err = readChannels(r, header, dataSize, opts.channels(), opts.readLimit(header, 0), func(windows [][]float64) {
+		window := windows[0]
+		if len(opts.Mix) > 0 {
+			mixed = opts.Mix.mix(mixed, windows)
+			window = mixed
+		}
+		process(pre.feed(window))
+	})
+	if out != nil && out.err != nil {
+		return out.err
+	}
+	if err != nil {
+		return err
+	}
+	pre.flush(process)
+	pre.log(opts)
+	demod.flush(sink)
+	if out != nil {
+		out.write(opts.system().Pack(out.blocks))
+		return out.err
+	}
+	return nil
+}
+
+// packWriter writes a system's file format out as records complete,
+// holding back whatever a later record could still change
+type packWriter struct {
+	w       io.Writer
+	system  *System
+	blocks  []Record
+	written int
+	err     error
+}
+
+func (p *packWriter) add(b Record) {
+	p.blocks = append(p.blocks, b)
+	p.system.Identify(p.blocks)
+	out := p.system.Pack(p.blocks)
+	settled := len(out)
+	if p.system.lookahead > 0 {
+		// Only what the records so far would pack to whatever follows
+		before := p.system.Pack(p.blocks[:max(0, len(p.blocks)-p.system.lookahead)])
+		settled = 0
+		for settled < min(len(out), len(before)) && out[settled] == before[settled] {
+			settled++
+		}
+	}
+	p.write(out[:settled])
+}
+
+// write writes the part of the packed file out not yet written
+func (p *packWriter) write(out []byte) {
+	if p.err != nil || len(out) <= p.written {
+		return
+	}
+	if _, p.err = p.w.Write(out[p.written:]); p.err != nil {
+		return
+	}
+	p.written = len(out)
+	if f, ok := p.w.(interface{ Flush() error }); ok {
+		p.err = f.Flush()
+	}
+}
+
+// stopReader reads from r until *err is set
+type stopReader struct {
+	r   io.Reader
+	err *error
+}
+
+func (s *stopReader) Read(b []byte) (int, error) {
+	if *s.err != nil {
+		return 0, *s.err
+	}
+	return s.r.Read(b)
+}
+
+// heldSink holds half-cycles back until they are released, then passes
+// them on in order
+type heldSink struct {
+	next    bitSink
+	pending [][2]int
+}
+
+func (h *heldSink) halfCycle(at, length int) {
+	h.pending = append(h.pending, [2]int{at, length})
+}
+
+// release passes on every half-cycle that ends by until
+func (h *heldSink) release(until int) {
+	n := 0
+	for n < len(h.pending) && h.pending[n][0]+h.pending[n][1] <= until {
+		h.next.halfCycle(h.pending[n][0], h.pending[n][1])
+		n++
+	}
+	h.pending = append(h.pending[:0], h.pending[n:]...)
+}
+
+func (h *heldSink) finish(at int) {
+	h.release(at)
+	h.next.finish(at)
+}
+
+// crossingTracker finds zero crossings across consecutive windows of
+// samples, remembering where the previous window left off
+type crossingTracker struct {
+	pos  int     // absolute offset of the next sample
+	prev float64 // last sample seen
+	last int     // absolute offset of the last crossing, -1 before the first
+}
+
+func newCrossingTracker() *crossingTracker {
+	return &crossingTracker{last: -1}
+}
+
+// feed scans a window and reports the start offset and length in samples
+// of every complete half-cycle
+func (c *crossingTracker) feed(window []float64, sink bitSink) {
+	for i, sample := range window {
+		at := c.pos + i
+		if at > 0 && (c.prev < 0) != (sample < 0) {
+			if c.last >= 0 {
+				sink.halfCycle(c.last, at-c.last)
+			}
+			c.last = at
+		}
+		c.prev = sample
+	}
+	c.pos += len(window)
+}
+
+// flush has no half-cycles left to report since every one ends at a
+// crossing feed has already seen
+func (c *crossingTracker) flush(sink bitSink) {
+	if c.last >= 0 {
+		sink.finish(c.last)
+	}
+}
@@ -0,0 +1,43 @@
+package decoder
+
+import (
+	"fmt"
+	"math/rand/v2"
+)
+
+// A synthetic tape is one written out as the system saves it, for timing
+// the decoder on captures of any length without having one to hand: one
+// record of pseudo-random bytes after another, each ending in the
+// system's checksum if it has one of Checksums, and the same on every
+// call.
+const SyntheticRecord = 1024 // bytes of data in each record written
+
+// SyntheticTape returns duration seconds of tape at RelaminateRate
+func SyntheticTape(duration float64, opts Options) ([]float64, error) {
+	s := opts.system()
+	if s.encode == nil {
+		return nil, fmt.Errorf("%s tapes cannot be written", s.Name)
+	}
+	timing := opts.timing()
+	random := rand.New(rand.NewPCG(1, 2))
+	t := &tape{rate: RelaminateRate, sign: 1}
+	for t.clock < duration {
+		data := make([]byte, SyntheticRecord)
+		for i := range data {
+			data[i] = byte(random.Uint32())
+		}
+		if s.checksum != nil {
+			data = append(data, s.checksum.Sum(data)...)
+		}
+		if len(t.samples) > 0 {
+			t.silence(RelaminateGap)
+		}
+		at := t.clock
+		t.sign = 1
+		s.encode(t, timing, Record{LoadAddress: -1, Data: data, ChecksumOK: true, Start: at})
+		if t.clock == at {
+			return nil, fmt.Errorf("%s records cannot be written without more than their data", s.Name)
+		}
+	}
+	return t.samples, nil
+}
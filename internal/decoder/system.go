@@ -0,0 +1,243 @@
+package decoder
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// System is a computer whose tapes can be decoded: how half-cycles make
+// up its records, and how the records are stored in a file
+type System struct {
+	Name   string
+	Timing *Timing // half-cycle timings used unless overridden
+	Demods []Demod // engines that can read its half-cycles
+
+	newFramer func() framer
+	check     func(r *record) bool  // reports whether a record is intact
+	payload   func(data []byte) int // bytes of a record besides its checksums
+	pack      func(blocks []Record) []byte
+	ext       string    // extension, with its dot, of the files pack writes; "" for a raw binary
+	trailer   int       // checksum bytes that end each record, 0 if they do not end with one
+	checksum  *Checksum // the checksum that ends each record, if it is one of Checksums
+	lookahead int       // records after one that can change how it is packed
+	selfTimed bool      // the framer times half-cycles against the tape, not the thresholds
+	framing   Framing   // how shiftBit makes bytes of bits; the zero value is as Bare8
+
+	// identify, if set, fills in what each record holds and where it
+	// loads, as far as the records show
+	identify func(records []Record)
+
+	// binaries is set if the records are saved from memory, so that those
+	// neither identify nor text detection typed are typed by their content
+	binaries bool
+
+	// describe, if set, says something about each record worth knowing
+	// when loading it, such as where it belongs in memory
+	describe func(records []record) []string
+
+	// encode, if set, writes a record out again as the system saves it
+	encode func(t *tape, timing *Timing, r Record)
+
+	charset *Charset // what its text is written in, if not ASCII
+	dialect *Dialect // what its BASIC programs are written in, if known
+
+	// Serial FSK systems keep their settings, which can be changed, and
+	// make their framer from them
+	serial          *Serial
+	newSerialFramer func(s Serial) framer
+
+	// Biphase-L and pulse-width systems keep their settings likewise
+	biphase *Biphase
+	pwm     *PWM
+}
+
+// Record is one record as decoded: what it holds, where it loads, where
+// it was on the tape and how its header tone was recorded, which some
+// file formats keep. Output formats are packed from records.
+type Record struct {
+	Type        string // what the record holds, e.g. "header" or "basic"; empty if unknown
+	LoadAddress int    // where its data loads in memory, -1 if unknown
+	Length      int    // bytes of data, less checksums and any header or name
+	Data        []byte // the record as read, checksums included
+	Checksum    []byte // the checksum that ends Data, nil if it does not end with one
+	ChecksumOK  bool
+	Verified    Verification // the checksum read and computed, if the system's is one of Checksums
+	Copy        bool         // a second copy of the record before, as some systems write
+
+	Start  float64 // seconds; start of the header tone, or of the record without one
+	End    float64 // seconds
+	Header int     // half-cycles of header tone before the record
+	Pulse  float64 // seconds; average header half-cycle
+
+	body []byte // the Length bytes of data
+}
+
+// Body returns the bytes of data Length counts, those that load at
+// LoadAddress
+func (r Record) Body() []byte {
+	return r.body
+}
+
+// setBody sets the record's data to body, and its Length to match
+func (r *Record) setBody(body []byte) {
+	r.body = body
+	r.Length = len(body)
+}
+
+// Record types, as far as systems tell them apart
+const (
+	RecordHeader      = "header"          // names and describes the file whose data follows
+	RecordBasic       = "basic"           // a tokenized BASIC program
+	RecordVariables   = "basic variables" // the variables saved with a BASIC program
+	RecordMachineCode = "machine code"
+	RecordASCII       = "ascii" // text, such as a BASIC program saved as such
+	RecordData        = "data"
+	RecordShapeTable  = "shape table" // Apple ][ hi-res shapes, as DRAW and XDRAW take them
+)
+
+// Files groups records into the files they make up: a header, or a BASIC
+// program's variables, with the records of one type after it, or else a
+// record on its own, each with any copies of its records
+func Files(records []Record) [][]Record {
+	var files [][]Record
+	headed := false // the file in progress starts with a header
+	kind := ""      // and the type of the data after it so far
+	for _, r := range records {
+		switch {
+		case r.Copy && len(files) > 0:
+		case r.Type == RecordHeader || r.Type == RecordVariables:
+			files = append(files, nil)
+			headed, kind = true, ""
+		case headed && (kind == "" || kind == r.Type):
+			kind = r.Type
+		default:
+			files = append(files, nil)
+			headed = false
+		}
+		files[len(files)-1] = append(files[len(files)-1], r)
+	}
+	return files
+}
+
+// Systems names every system that can be decoded
+var Systems = map[string]*System{
+	"aci":     &aciSystem,
+	"appleii": &appleIISystem,
+	"biphase": biphaseSystem,
+	"cpc":     &cpcSystem,
+	"msx":     &msxSystem,
+	"mz":      &mzSystem,
+	"oric":    &oricSystem,
+	"pwm":     pwmSystem,
+	"ti":      &tiSystem,
+	"uart":    uartSystem,
+	"rtty":    rttySystem,
+	"ax25":    ax25System,
+	"zx80":    &zx80System,
+	"zx81":    &zx81System,
+}
+
+var appleIISystem = System{
+	Name:      "appleii",
+	Timing:    &AppleII,
+	Demods:    []Demod{DemodZeroCrossing, DemodGoertzel, DemodMatched, DemodPeak, DemodVote},
+	newFramer: func() framer { return appleFramer{} },
+	check:     appleChecksum.ok,
+	payload:   func(data []byte) int { return max(0, len(data)-1) },
+	pack:      concatBlocks,
+	trailer:   1,
+	checksum:  &appleChecksum,
+	describe:  appleRanges,
+	identify:  identifyAppleII,
+	binaries:  true,
+	encode:    encodeMonitor(appleTrailer),
+	dialect:   Dialects["applesoft"],
+}
+
+// BASIC programs are saved from the Apple ][ as a length record, the
+// program's length and, for Applesoft, a byte of flags, followed by the
+// program. Applesoft programs load at a fixed address; Integer BASIC ones
+// end at HIMEM, which the tape does not record. Monitor binaries have no
+// length record and load wherever the monitor command says.
+const (
+	ApplesoftProgram = 0x0801 // where Applesoft programs load
+	IntegerLength    = 2      // bytes of an Integer BASIC length record
+	ApplesoftLength  = 3      // bytes of an Applesoft length record
+)
+
+// identifyAppleII finds BASIC programs by their length records
+func identifyAppleII(records []Record) {
+	for i := 0; i+1 < len(records); i++ {
+		r, next := &records[i], &records[i+1]
+		if r.Length != IntegerLength && r.Length != ApplesoftLength {
+			continue
+		}
+		r.Type = RecordHeader
+		next.Type = RecordBasic
+		next.setBody(next.body[:min(next.Length, int(binary.LittleEndian.Uint16(r.Data)))])
+		if r.Length == ApplesoftLength {
+			next.LoadAddress = ApplesoftProgram
+		}
+		i++
+	}
+}
+
+// Pack joins consecutive records into the system's usual file format
+func (s *System) Pack(records []Record) []byte {
+	return s.pack(records)
+}
+
+// Ext returns the extension, with its dot, usual for files in the
+// system's format, such as ".cas", or ".bin" for a raw binary
+func (s *System) Ext() string {
+	if s.ext == "" {
+		return ".bin"
+	}
+	return s.ext
+}
+
+// Identify fills in the type and load address of records, as far as the
+// system can tell them from the records themselves, types as text those
+// that read as text and, for systems saving memory, the rest by content
+func (s *System) Identify(records []Record) {
+	if s.identify != nil {
+		s.identify(records)
+	}
+	detectText(records)
+	if s.binaries {
+		classifyBinaries(records)
+	}
+}
+
+// Charset returns the character set the system's text is written in
+func (s *System) Charset() *Charset {
+	if s.charset == nil {
+		return Charsets["ascii"]
+	}
+	return s.charset
+}
+
+// Dialect returns the BASIC the system's programs are written in, or nil
+// if it has none that can be listed
+func (s *System) Dialect() *Dialect {
+	return s.dialect
+}
+
+// supports returns an error if engine m cannot decode the system's tapes
+func (s *System) supports(m Demod) error {
+	for _, d := range s.Demods {
+		if d == m {
+			return nil
+		}
+	}
+	return fmt.Errorf("%v decoding does not work for %s tapes", m, s.Name)
+}
+
+// concatBlocks packs records as a raw binary, one after another
+func concatBlocks(blocks []Record) []byte {
+	var out []byte
+	for _, b := range blocks {
+		out = append(out, b.Data...)
+	}
+	return out
+}
@@ -0,0 +1,49 @@
+package decoder
+
+// Text detection. A record no system identifies is taken for text when
+// nearly all its bytes are printable characters or line ends, with or
+// without the high bit the Apple ][ sets on the characters it writes.
+const (
+	TextMinLength = 16   // bytes in the shortest record taken for text
+	TextFraction  = 0.95 // fraction of the bytes that must be text
+)
+
+// detectText types as text the records nothing else identified whose
+// bytes are text
+func detectText(records []Record) {
+	for i := range records {
+		if r := &records[i]; r.Type == "" && IsText(r.Body()) {
+			r.Type = RecordASCII
+		}
+	}
+}
+
+// IsText reports whether data reads as text
+func IsText(data []byte) bool {
+	data = trimText(data)
+	if len(data) < TextMinLength {
+		return false
+	}
+	text := 0
+	for _, b := range data {
+		switch c := b & 0x7F; {
+		case c >= 0x20 && c < 0x7F, c == '\r', c == '\n', c == '\t':
+			text++
+		}
+	}
+	return float64(text) >= TextFraction*float64(len(data))
+}
+
+// trimText drops the zero bytes and end of file marks that pad out the
+// end of a text file
+func trimText(data []byte) []byte {
+	for len(data) > 0 {
+		switch data[len(data)-1] & 0x7F {
+		case 0x00, 0x1A:
+			data = data[:len(data)-1]
+		default:
+			return data
+		}
+	}
+	return data
+}
@@ -0,0 +1,412 @@
+package decoder
+
+import (
+	"encoding/binary"
+	"slices"
+)
+
+// TI-99/4A tapes are frequency modulated at 1379 bits a second: every bit
+// cell starts with a transition and a 1 has another halfway through, so
+// a 0 is one long half-cycle and a 1 two short ones, MSB first. A file
+// starts with a lead of 768 zero bytes, a 0xFF data mark and its number
+// of 64-byte blocks, written twice. Each block then follows 8 zero bytes
+// and a data mark, with a checksum byte, the sum of its bytes, and is
+// itself written twice. A file is decoded as one record, each block taken
+// from whichever copy checks out or, failing that, byte by byte from the
+// copy that read cleanly there.
+const (
+	TIBlock   = 64   // data bytes in a block
+	TIMinGap  = 32   // zero bits before a data mark, fewer than the 8 bytes written
+	TICopies  = 2    // times each block is written
+	TINoise   = 0.5  // fraction of a 1's half-cycle below which a half-cycle is noise
+	TISector  = 256  // TIFILES sector size
+	TIProgram = 0x01 // TIFILES flag for a memory image, as SAVE CS1 writes
+)
+
+// tiTiming classifies TI-99/4A half-cycles: 363us halves of a 1 and
+// 725us 0 cells
+var tiTiming = Timing{
+	Short:      0.000544,
+	Long:       0.001088,
+	MinHeader:  200,
+	HeaderTone: 0.000725,
+	Nominal: [numPulses]float64{
+		pulseShort: 0.000363,
+		pulseLong:  0.000725,
+	},
+}
+
+var tiSystem = System{
+	Name:      "ti",
+	Timing:    &tiTiming,
+	Demods:    []Demod{DemodZeroCrossing, DemodPeak},
+	newFramer: func() framer { return &tiFramer{} },
+	check:     tiComplete,
+	payload:   func(data []byte) int { return len(data) },
+	pack:      packTIFILES,
+	ext:       ".tfi",
+	encode:    encodeTI,
+}
+
+// Where the TI framer is in a file
+const (
+	tiMark  = iota // reading a data mark
+	tiCount        // reading the block count
+	tiGap          // counting zero bits before the next data mark
+	tiData         // reading a block and its checksum
+)
+
+// tiFramer reads TI-99/4A bit cells, data marks and blocks
+type tiFramer struct {
+	half      bool // a short half-cycle has been seen
+	cellStart int
+	suspect   bool // the byte in progress had a bad cell or overlapped a dropout
+	dropping  bool // half-cycles are being skipped inside a dropout
+	dropStart int
+
+	phase   int
+	ones    int // 1 bits of the data mark so far
+	zeros   int // zero bits of the gap so far
+	bits    int
+	current byte
+
+	count  []byte // the block count, as written each time
+	blocks int    // blocks the file holds, 0 if the counts disagreed
+	copies int    // blocks read so far, counting each copy
+
+	// The block being read, and the earlier copy of it
+	block, copy    []byte
+	bad, copyBad   []bool // bytes that are suspect
+	haveCopy       bool
+	resolved, lost int // blocks added to the record, and given up on
+}
+
+func (f *tiFramer) halfCycle(d *bitDecoder, p pulse) {
+	if d.state == stateHeader {
+		switch {
+		case p == pulseLong:
+			d.countHeader(p)
+		case p == pulseShort && d.header > d.timing.MinHeader:
+			// The first half of the lead's data mark
+			d.state = stateSync
+			f.phase, f.ones = tiMark, 0
+			f.half, f.cellStart, f.suspect = true, d.at, false
+		default:
+			d.header = 0
+		}
+		return
+	}
+
+	if d.inDropout(d.at, d.end) || d.length < TINoise*d.timing.Nominal[pulseShort] {
+		if !f.dropping {
+			f.dropping, f.dropStart = true, d.at
+			if f.half {
+				f.half, f.dropStart = false, f.cellStart
+			}
+		}
+		return
+	}
+	if f.dropping {
+		f.fillDropout(d)
+	}
+
+	switch {
+	case p == pulseHeader:
+		// Silence: the file is over, whether or not it was all read
+		f.end(d)
+	case p == pulseShort && !f.half:
+		f.half, f.cellStart = true, d.at
+	case p == pulseShort:
+		f.half = false
+		f.bit(d, true)
+	case f.half:
+		// A lone short half before a 0: keep the cell count by taking it
+		// for a damaged 1
+		f.half = false
+		f.suspect = true
+		if d.open != nil {
+			d.open.cellErrors++
+			d.totalErrors++
+		}
+		f.bit(d, true)
+		f.cellStart = d.at
+		f.bit(d, false)
+	default:
+		f.cellStart = d.at
+		f.bit(d, false)
+	}
+}
+
+func (f *tiFramer) bit(d *bitDecoder, one bool) {
+	if d.open != nil {
+		d.open.cells++
+	}
+	f.suspect = f.suspect || d.inDropout(f.cellStart, d.end)
+
+	switch f.phase {
+	case tiMark:
+		if !one {
+			f.markLost(d)
+			return
+		}
+		f.ones++
+		if f.ones < 8 {
+			return
+		}
+		f.startBytes(d)
+	case tiGap:
+		if !one {
+			f.zeros++
+			return
+		}
+		if f.zeros < TIMinGap {
+			f.zeros = 0
+			return
+		}
+		f.phase, f.ones = tiMark, 1
+	default:
+		f.current <<= 1
+		if one {
+			f.current |= 1
+		}
+		f.bits++
+		if f.bits == 8 {
+			f.byteDone(d)
+		}
+	}
+}
+
+// fillDropout stands in for the bit cells lost in a dropout, or in a
+// burst of noise too fast to be signal. Every cell
+// lasts the same time, so their number is known from its length,
+// and a dropout ending halfway through one ends inside a 1.
+func (f *tiFramer) fillDropout(d *bitDecoder) {
+	f.dropping = false
+	cell := d.timing.Nominal[pulseLong] * d.rate
+	if d.trackSpeed {
+		cell *= d.speed
+	}
+	cells := float64(d.at-f.dropStart) / cell
+	lost := int(cells + 0.25)
+	for range lost {
+		f.suspect = true
+		f.cellStart = f.dropStart
+		f.bit(d, false)
+	}
+	if cells-float64(lost) >= 0.25 {
+		// The dropout ended halfway through a cell, which only a 1 has
+		f.suspect = true
+		f.half, f.cellStart = true, f.dropStart
+	}
+}
+
+// markLost handles a 0 bit in what should have been a data mark
+func (f *tiFramer) markLost(d *bitDecoder) {
+	if d.open == nil {
+		// Not the lead's mark after all
+		d.state = stateHeader
+		d.header = 0
+		return
+	}
+	f.phase, f.zeros = tiGap, 1
+}
+
+// startBytes begins reading whatever follows a data mark
+func (f *tiFramer) startBytes(d *bitDecoder) {
+	f.bits, f.current, f.suspect = 0, 0, false
+	if d.open == nil {
+		d.startData(pulseShort)
+		f.phase, f.count = tiCount, nil
+		f.copies, f.resolved, f.lost, f.haveCopy = 0, 0, 0, false
+		return
+	}
+	f.phase = tiData
+	f.block, f.bad = f.block[:0], f.bad[:0]
+}
+
+func (f *tiFramer) byteDone(d *bitDecoder) {
+	b, bad := f.current, f.suspect
+	f.bits, f.current, f.suspect = 0, 0, false
+
+	if f.phase == tiCount {
+		f.count = append(f.count, b)
+		if len(f.count) < TICopies {
+			return
+		}
+		f.blocks = int(f.count[0])
+		if f.count[1] != f.count[0] {
+			f.blocks = 0
+		}
+		f.phase, f.zeros = tiGap, 0
+		return
+	}
+
+	f.block = append(f.block, b)
+	f.bad = append(f.bad, bad)
+	if len(f.block) < TIBlock+1 {
+		return
+	}
+	f.blockDone(d)
+}
+
+// blockDone files a whole block, adding it to the record once both
+// copies are in or the first checks out and the second is not needed
+func (f *tiFramer) blockDone(d *bitDecoder) {
+	f.copies++
+	f.phase, f.zeros = tiGap, 0
+	if !f.haveCopy {
+		f.copy = append(f.copy[:0], f.block...)
+		f.copyBad = append(f.copyBad[:0], f.bad...)
+		f.haveCopy = true
+		return
+	}
+	f.haveCopy = false
+	bad := make([]bool, len(f.bad))
+	for i := range bad {
+		bad[i] = f.copyBad[i] && f.bad[i]
+	}
+	f.add(d, tiResolve(f.copy, f.copyBad, f.block, f.bad), bad)
+	if f.blocks > 0 && f.copies == TICopies*f.blocks {
+		f.end(d)
+	}
+}
+
+// add appends a resolved block to the record or, if the block could not
+// be resolved, the first copy as it was read, erasing the bytes marked
+// bad
+func (f *tiFramer) add(d *bitDecoder, block []byte, bad []bool) {
+	if block == nil {
+		f.lost++
+		d.open.unreadable++
+		for i, b := range f.copy[:TIBlock] {
+			d.erasing = bad[i]
+			d.addByte(b)
+		}
+		return
+	}
+	f.resolved++
+	for _, b := range block {
+		d.addByte(b)
+	}
+}
+
+// end closes the file, counting any blocks that never came as unreadable
+func (f *tiFramer) end(d *bitDecoder) {
+	if d.open != nil {
+		if f.haveCopy {
+			// A block whose second copy was lost
+			var block []byte
+			if tiSumOK(f.copy) {
+				block = f.copy[:TIBlock]
+			}
+			f.add(d, block, f.copyBad)
+		}
+		if missing := f.blocks - f.resolved - f.lost; missing > 0 {
+			d.open.unreadable += missing
+		}
+		if f.blocks == 0 {
+			d.open.unreadable++
+		}
+		d.closeRecord(d.at)
+	}
+	d.state = stateHeader
+	d.header = 0
+	f.half = false
+	f.haveCopy = false
+	f.dropping = false
+}
+
+// tiResolve returns the 64 data bytes of a block from its two copies:
+// the first that checks out, or else each byte from a copy that read it
+// cleanly, if that checks out. It returns nil if nothing does.
+func tiResolve(a []byte, aBad []bool, b []byte, bBad []bool) []byte {
+	switch {
+	case tiSumOK(a):
+		return a[:TIBlock]
+	case tiSumOK(b):
+		return b[:TIBlock]
+	}
+	merged := make([]byte, len(a))
+	for i := range a {
+		merged[i] = a[i]
+		if aBad[i] && !bBad[i] {
+			merged[i] = b[i]
+		}
+	}
+	if tiSumOK(merged) {
+		return merged[:TIBlock]
+	}
+	return nil
+}
+
+// tiSumOK reports whether a block's last byte is the sum of the others
+func tiSumOK(block []byte) bool {
+	var sum byte
+	for _, b := range block[:TIBlock] {
+		sum += b
+	}
+	return sum == block[TIBlock]
+}
+
+// tiComplete reports whether every block of a file was read
+func tiComplete(r *record) bool {
+	return len(r.data) > 0 && r.unreadable == 0
+}
+
+// encodeTI writes a file as the console does: the lead of zero bits,
+// the data mark and block count twice, then each block twice, after its
+// gap and data mark and followed by its checksum
+func encodeTI(t *tape, timing *Timing, r Record) {
+	bit := func(one bool) {
+		if one {
+			t.halves(2, timing.Nominal[pulseShort])
+		} else {
+			t.half(timing.Nominal[pulseLong])
+		}
+	}
+	write := func(data ...byte) {
+		for _, b := range data {
+			for i := 7; i >= 0; i-- {
+				bit(b>>i&1 == 1)
+			}
+		}
+	}
+	for range headerHalves(timing, r) {
+		bit(false)
+	}
+	n := byte(len(r.Data) / TIBlock)
+	write(0xFF, n, n)
+	for block := range slices.Chunk(r.Data, TIBlock) {
+		var sum byte
+		for _, b := range block {
+			sum += b
+		}
+		for range TICopies {
+			write(make([]byte, 8)...)
+			write(0xFF)
+			write(block...)
+			write(sum)
+		}
+	}
+}
+
+// packTIFILES writes each file as a TIFILES image, the header emulators
+// and file transfer tools use for TI files kept on other systems,
+// followed by the data in 256-byte sectors. Cassette files are memory
+// images, so each is a PROGRAM file.
+func packTIFILES(blocks []Record) []byte {
+	var out []byte
+	for _, b := range blocks {
+		sectors := (len(b.Data) + TISector - 1) / TISector
+		header := make([]byte, 128)
+		header[0] = 0x07
+		copy(header[1:], "TIFILES")
+		binary.BigEndian.PutUint16(header[8:], uint16(sectors))
+		header[10] = TIProgram
+		header[12] = byte(len(b.Data) % TISector)
+		out = append(out, header...)
+		out = append(out, b.Data...)
+		out = append(out, make([]byte, sectors*TISector-len(b.Data))...)
+	}
+	return out
+}
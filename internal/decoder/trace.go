@@ -0,0 +1,52 @@
+package decoder
+
+import (
+	"fmt"
+	"io"
+)
+
+// A bit trace follows the bit decoder through a capture a line at a
+// time: each half-cycle as it was timed and classified, each bit and byte
+// it made, the cells dropped for their halves disagreeing, and where
+// records open and close. Every line starts with where on the tape it
+// happened, so that a byte that came out wrong can be found and the
+// half-cycles that made it read off.
+type tracer struct {
+	w    io.Writer
+	rate float64 // samples a second of the capture, for the times
+}
+
+func (p pulse) String() string {
+	switch p {
+	case pulseShort:
+		return "short"
+	case pulseLong:
+		return "long"
+	case pulseHeader:
+		return "header"
+	}
+	return "unknown"
+}
+
+// printf writes a line about what happened at sample offset at
+func (t *tracer) printf(at int, format string, args ...any) {
+	seconds := float64(at) / t.rate
+	minutes := int(seconds / 60)
+	fmt.Fprintf(t.w, "%02d:%09.6f %9d  ", minutes, seconds-float64(60*minutes), at)
+	fmt.Fprintf(t.w, format, args...)
+	fmt.Fprintln(t.w)
+}
+
+// traceHalfCycle traces the decoder's current half-cycle
+func (d *bitDecoder) traceHalfCycle(p pulse) {
+	if d.trace != nil {
+		d.trace.printf(d.at, "half %5d samples %7.1fus %-6s  %s", d.end-d.at, d.length*1e6, p, d.stateName())
+	}
+}
+
+// tracef traces what the decoder made of the current half-cycle
+func (d *bitDecoder) tracef(format string, args ...any) {
+	if d.trace != nil {
+		d.trace.printf(d.at, "  "+format, args...)
+	}
+}
@@ -0,0 +1,94 @@
+package decoder
+
+import (
+	"errors"
+	"io"
+)
+
+// Gap trimming, for remastering a tape as a clean release. Each record's
+// audio is kept as it was captured, header tone and all, with a margin
+// either side for the swings that ring on past its last cell; the gaps
+// between records, however long the capture left them and whatever hum
+// or clatter they hold, become the same stretch of digital silence.
+const (
+	TrimGap    = 2.0  // seconds of silence between records by default
+	TrimLead   = 0.5  // seconds of silence before the first record and after the last
+	TrimMargin = 0.05 // seconds of the capture kept either side of each record
+)
+
+// Gap is the stretch of a capture between two records, or before the
+// first or after the last. Times are in seconds from the start of the
+// capture.
+type Gap struct {
+	Start, End float64
+
+	// Before and After are the 1-based programs the gap follows and
+	// precedes, 0 at either end of the tape
+	Before, After int
+}
+
+// Gaps returns the stretches of the capture outside every program, in
+// tape order, leaving out any of no length
+func (c *Catalog) Gaps() []Gap {
+	var gaps []Gap
+	at := 0.0
+	for n := 1; n <= c.Programs; n++ {
+		start, end, ok := c.ProgramSpan(n)
+		if !ok {
+			continue
+		}
+		if start > at {
+			gaps = append(gaps, Gap{Start: at, End: start, Before: n - 1, After: n})
+		}
+		at = max(at, end)
+	}
+	if c.Duration > at {
+		gaps = append(gaps, Gap{Start: at, End: c.Duration, Before: c.Programs})
+	}
+	return gaps
+}
+
+// TrimGaps reads a WAV stream whose programs c catalogs and returns its
+// first channel with every gap replaced by gap seconds of silence, and
+// the ends by lead seconds, at the capture's rate
+func TrimGaps(r io.Reader, c *Catalog, gap, lead float64) ([]float64, uint32, error) {
+	if c.Programs == 0 {
+		return nil, 0, errors.New("no programs to keep")
+	}
+	src, err := NewSource(r, Options{})
+	if err != nil {
+		return nil, 0, err
+	}
+	rate := float64(src.Header().SampleRate)
+	silence := func(out []float64, seconds float64) []float64 {
+		return append(out, make([]float64, int(seconds*rate))...)
+	}
+
+	var out []float64
+	out = silence(out, lead)
+	prev := 0.0
+	for n := 1; n <= c.Programs; n++ {
+		start, end, ok := c.ProgramSpan(n)
+		if !ok {
+			continue
+		}
+		if n > 1 {
+			out = silence(out, gap)
+		}
+		// Margins never reach back into the program before
+		from := max(prev, start-TrimMargin)
+		to := end + TrimMargin
+		prev = to
+		if err := src.SeekToTime(from); err != nil {
+			return nil, 0, err
+		}
+		_, err := src.Read(int((to-from)*rate), func(windows [][]float64) {
+			out = append(out, windows[0]...)
+		})
+		if err != nil {
+			return nil, 0, err
+		}
+	}
+	out = silence(out, lead)
+	return out, src.Header().SampleRate, nil
+}
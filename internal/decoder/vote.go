@@ -0,0 +1,145 @@
+package decoder
+
+import (
+	"cmp"
+	"slices"
+)
+
+// Engines are the demodulators an ensemble decode runs
+var Engines = []Demod{DemodZeroCrossing, DemodGoertzel, DemodMatched, DemodPeak}
+
+// Dispute records a byte the engines, or the channels of a stereo
+// capture, did not agree on
+type Dispute struct {
+	Offset  int    // in the record's data
+	Winner  Demod  // engine whose value was kept
+	Channel int    // channel whose value was kept, 1 left and 2 right; 0 if channels were not merged
+	Votes   []Vote // every engine that decoded the byte
+}
+
+// Vote is one engine's reading of a disputed byte
+type Vote struct {
+	Engine  Demod
+	Channel int // as in Dispute
+	Value   byte
+	Weight  float64
+}
+
+// VoteWindow is how far apart, in seconds, two engines may place the
+// start of the same record
+const VoteWindow = 0.1
+
+// processVote decodes with every engine and resolves disagreements byte
+// by byte, each engine's vote weighted by how cleanly it read the record
+func processVote(samples []float64, sampleRate uint32, opts Options) ([]record, [][2]int) {
+	quiet := opts
+	quiet.Log, quiet.Trace = nil, nil
+
+	var all []engineRecord
+	var dropouts [][2]int
+	for _, e := range Engines {
+		quiet.Demod = e
+		records, found := processSamples(samples, sampleRate, quiet)
+		for _, r := range records {
+			all = append(all, engineRecord{engine: e, record: r})
+		}
+		dropouts = found
+	}
+	if len(dropouts) > 0 {
+		opts.logf("Detected %d dropouts", len(dropouts))
+	}
+
+	var records []record
+	for _, group := range groupReadings(all, sampleRate) {
+		r := voteRecord(group)
+		if len(r.disputes) > 0 {
+			opts.logf("Engines disagreed on %d bytes of program %d", len(r.disputes), len(records)+1)
+		}
+		records = append(records, r)
+	}
+	return records, dropouts
+}
+
+// groupReadings groups the readings of each record, those starting
+// within VoteWindow of each other, in the order they start
+func groupReadings(all []engineRecord, sampleRate uint32) [][]engineRecord {
+	slices.SortStableFunc(all, func(a, b engineRecord) int {
+		return cmp.Compare(a.dataStart, b.dataStart)
+	})
+	window := int(VoteWindow * float64(sampleRate))
+	var groups [][]engineRecord
+	for len(all) > 0 {
+		n := 1
+		for n < len(all) && all[n].dataStart-all[0].dataStart <= window {
+			n++
+		}
+		groups = append(groups, all[:n])
+		all = all[n:]
+	}
+	return groups
+}
+
+type engineRecord struct {
+	engine  Demod
+	channel int // of a stereo capture, 0 if channels are not merged
+	record
+}
+
+// weight is how much an engine's reading of a record counts for. A
+// record whose checksum holds is far more likely to be right.
+func (r *engineRecord) weight() float64 {
+	w := r.confidence()
+	if r.checksumOK() {
+		w *= 2
+	}
+	return w
+}
+
+// voteRecord combines the same record as read by several engines. The
+// best-weighted reading sets the length and timing.
+func voteRecord(group []engineRecord) record {
+	best := &group[0]
+	for i := range group {
+		if group[i].weight() > best.weight() {
+			best = &group[i]
+		}
+	}
+	out := best.record
+	out.data = slices.Clone(best.data)
+	out.erased = nil
+	out.disputes = nil
+	out.frameErrors = nil
+
+	for i := range out.data {
+		var votes []Vote
+		tally := map[byte]float64{}
+		for _, r := range group {
+			if i >= len(r.data) || slices.Contains(r.erased, i) {
+				continue
+			}
+			w := r.weight()
+			votes = append(votes, Vote{Engine: r.engine, Channel: r.channel, Value: r.data[i], Weight: w})
+			tally[r.data[i]] += w
+		}
+		if len(votes) == 0 {
+			out.data[i] = 0
+			out.erased = append(out.erased, i)
+			continue
+		}
+
+		winner := votes[0]
+		for _, v := range votes {
+			if tally[v.Value] > tally[winner.Value] || tally[v.Value] == tally[winner.Value] && v.Weight > winner.Weight {
+				winner = v
+			}
+		}
+		out.data[i] = winner.Value
+		if e, ok := frameErrorAt(best.frameErrors, i); ok && winner.Value == best.data[i] {
+			out.frameErrors = append(out.frameErrors, e)
+		}
+		if len(tally) > 1 {
+			out.disputes = append(out.disputes, Dispute{Offset: i, Winner: winner.Engine, Channel: winner.Channel, Votes: votes})
+		}
+	}
+	return out
+}
@@ -0,0 +1,524 @@
+package decoder
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"math"
+)
+
+// WavHeader represents the header of a WAV file
+type WavHeader struct {
+	ChunkID       [4]byte
+	ChunkSize     uint32
+	Format        [4]byte
+	Subchunk1ID   [4]byte
+	Subchunk1Size uint32
+	AudioFormat   uint16 // as read, WAVE_FORMAT_EXTENSIBLE's replaced by its subformat's
+	NumChannels   uint16
+	SampleRate    uint32
+	ByteRate      uint32
+	BlockAlign    uint16
+	BitsPerSample uint16
+}
+
+// FormatError reports input that is not a WAV file the decoder can read,
+// as opposed to a failure reading it
+type FormatError struct {
+	Err error
+}
+
+func (e *FormatError) Error() string { return e.Err.Error() }
+func (e *FormatError) Unwrap() error { return e.Err }
+
+func formatErrorf(format string, args ...any) error {
+	return &FormatError{Err: fmt.Errorf(format, args...)}
+}
+
+func truncated(err error) bool {
+	return errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF)
+}
+
+// Limits on what a WAV header may claim. Past them it is corrupt or
+// hostile, and is refused before it can ask for memory it should not get
+// or send the chunk walker reading for ever.
+const (
+	MaxChannels   = 64
+	MaxSampleRate = 1000000 // Hz
+	MaxChunks     = 1024    // chunks before the data chunk
+
+	// maxPrealloc is the most memory, in bytes, made ready for the
+	// samples before they are read when the stream's length is unknown,
+	// as a declared size cannot be trusted
+	maxPrealloc = 64 << 20
+
+	// MemoryPerSample is about how many bytes a decode holds for each
+	// sample of each channel: as read, cleaned up, and the engines'
+	// working copies. Options.MaxMemory is measured in it.
+	MemoryPerSample = 32
+)
+
+// readLimit is the most frames of a capture that may be read, and the
+// error for one that goes on past it, and the context that stops the
+// read early once done; the zero value is no limit
+type readLimit struct {
+	frames int
+	err    error
+	ctx    context.Context
+}
+
+// stopping reports whether the read is to stop where it has got to
+func (l readLimit) stopping() bool {
+	return l.ctx != nil && l.ctx.Err() != nil
+}
+
+// readLimit returns the limit on reading a capture in header, of which
+// held channels are kept in memory
+func (o Options) readLimit(header WavHeader, held int) readLimit {
+	var l readLimit
+	if o.MaxDuration > 0 {
+		l = readLimit{frames: int(o.MaxDuration * float64(header.SampleRate)), err: fmt.Errorf("capture runs longer than the %gs allowed", o.MaxDuration)}
+	}
+	if o.MaxMemory > 0 && held > 0 {
+		frames := int(o.MaxMemory / int64(MemoryPerSample*held))
+		if l.err == nil || frames < l.frames {
+			l = readLimit{frames: frames, err: fmt.Errorf("capture needs more than the %d MB of memory allowed", o.MaxMemory>>20)}
+		}
+	}
+	l.ctx = o.Context
+	return l
+}
+
+// readWAV reads a WAV stream and returns the samples of each channel
+// decoded, and its format
+func readWAV(f io.Reader, opts Options) ([][]float64, WavHeader, error) {
+	header, dataSize, err := readWAVHeader(f, opts)
+	if err != nil {
+		return nil, header, err
+	}
+	if err := hasChannels(header, opts); err != nil {
+		return nil, header, err
+	}
+
+	limit := opts.readLimit(header, opts.channels())
+	expected := expectedFrames(f, header, dataSize, opts.channels())
+	if limit.err != nil && expected > limit.frames {
+		return nil, header, limit.err
+	}
+	channels, err := readSamples(f, header, dataSize, expected, opts.channels(), limit)
+	if err != nil {
+		return nil, header, err
+	}
+
+	opts.debugf("Read %d samples", len(channels[0]))
+
+	return channels, header, nil
+}
+
+// ReadWAV reads a whole WAV stream and returns the samples of its first
+// channel and their rate
+func ReadWAV(r io.Reader, opts Options) ([]float64, uint32, error) {
+	channels, header, err := readWAV(r, opts)
+	if err != nil {
+		return nil, 0, err
+	}
+	return channels[0], header.SampleRate, nil
+}
+
+// hasChannels returns an error if a capture has fewer channels than are
+// to be decoded
+func hasChannels(header WavHeader, opts Options) error {
+	if int(header.NumChannels) < opts.channels() {
+		return fmt.Errorf("decoding %d channels needs a capture with as many, not %d", opts.channels(), header.NumChannels)
+	}
+	return nil
+}
+
+// readWAVHeader reads the RIFF header and walks the chunks up to the start
+// of the sample data, returning the format and the data chunk size
+func readWAVHeader(f io.Reader, opts Options) (WavHeader, uint32, error) {
+	var header WavHeader
+	if err := binary.Read(f, binary.LittleEndian, &header); err != nil {
+		if truncated(err) {
+			return header, 0, formatErrorf("failed to read WAV header: %w", err)
+		}
+		return header, 0, fmt.Errorf("failed to read WAV header: %w", err)
+	}
+
+	opts.debugf("WAV Header: %+v", header)
+
+	if string(header.ChunkID[:]) != "RIFF" || string(header.Format[:]) != "WAVE" {
+		return header, 0, formatErrorf("invalid WAV file")
+	}
+	if err := checkFormat(header); err != nil {
+		return header, 0, err
+	}
+	// A format chunk may run on past the fields every one has, and does
+	// for WAVE_FORMAT_EXTENSIBLE, whose subformat is the format the
+	// samples are in
+	rest := padded(header.Subchunk1Size) - 16
+	if header.AudioFormat == formatExtensible {
+		var ext struct {
+			Size, ValidBits uint16
+			ChannelMask     uint32
+			SubFormat       [16]byte
+		}
+		if rest < int64(binary.Size(ext)) {
+			return header, 0, formatErrorf("WAVE_FORMAT_EXTENSIBLE without its subformat")
+		}
+		if err := binary.Read(f, binary.LittleEndian, &ext); err != nil {
+			if truncated(err) {
+				return header, 0, formatErrorf("failed to read WAV header: %w", err)
+			}
+			return header, 0, fmt.Errorf("failed to read WAV header: %w", err)
+		}
+		rest -= int64(binary.Size(ext))
+		header.AudioFormat = binary.LittleEndian.Uint16(ext.SubFormat[:])
+		if [14]byte(ext.SubFormat[2:]) != subFormatGUID || header.AudioFormat != formatPCM && header.AudioFormat != formatFloat {
+			return header, 0, formatErrorf("unsupported WAVE_FORMAT_EXTENSIBLE subformat % X; only integer PCM and floating point can be read", ext.SubFormat)
+		}
+	}
+	if err := skip(f, rest); err != nil {
+		return header, 0, err
+	}
+
+	// Find the data chunk
+	var dataSize uint32
+	for chunks := 0; ; chunks++ {
+		if chunks == MaxChunks {
+			return header, 0, formatErrorf("no data chunk among the first %d", MaxChunks)
+		}
+		var chunkID [4]byte
+		var chunkSize uint32
+		if err := binary.Read(f, binary.LittleEndian, &chunkID); err != nil {
+			if truncated(err) {
+				return header, 0, formatErrorf("data chunk not found")
+			}
+			return header, 0, err
+		}
+		if err := binary.Read(f, binary.LittleEndian, &chunkSize); err != nil {
+			if truncated(err) {
+				return header, 0, formatErrorf("truncated chunk header: %w", err)
+			}
+			return header, 0, err
+		}
+
+		if string(chunkID[:]) == "data" {
+			dataSize = chunkSize
+			break // Found data chunk
+		}
+
+		// Skip other chunks
+		if err := skip(f, padded(chunkSize)); err != nil {
+			return header, 0, err
+		}
+	}
+
+	return header, dataSize, nil
+}
+
+// Audio formats. WAVE_FORMAT_EXTENSIBLE gives the format its samples are
+// in as a subformat, a GUID starting with the format's code and ending
+// with the rest of subFormatGUID.
+const (
+	formatPCM        = 1
+	formatFloat      = 3
+	formatExtensible = 0xFFFE
+)
+
+var subFormatGUID = [14]byte{0x00, 0x00, 0x00, 0x00, 0x10, 0x00, 0x80, 0x00, 0x00, 0xAA, 0x00, 0x38, 0x9B, 0x71}
+
+// checkFormat returns an error if the format chunk describes audio that
+// cannot be read, or that no real capture could be
+func checkFormat(header WavHeader) error {
+	switch {
+	case string(header.Subchunk1ID[:]) != "fmt " || header.Subchunk1Size < 16:
+		return formatErrorf("no format chunk where one should start")
+	case header.AudioFormat != formatPCM && header.AudioFormat != formatFloat && header.AudioFormat != formatExtensible:
+		return formatErrorf("unsupported audio format %d; only integer PCM and floating point can be read", header.AudioFormat)
+	case header.NumChannels < 1 || header.NumChannels > MaxChannels:
+		return formatErrorf("invalid channel count: %d", header.NumChannels)
+	case header.SampleRate == 0 || header.SampleRate > MaxSampleRate:
+		return formatErrorf("invalid sample rate: %d Hz", header.SampleRate)
+	case header.BitsPerSample%8 != 0 || header.BitsPerSample == 0:
+		return formatErrorf("unsupported bits per sample: %d", header.BitsPerSample)
+	case int(header.BlockAlign) != int(header.BitsPerSample)/8*int(header.NumChannels):
+		return formatErrorf("block align %d does not fit %d channels of %d bits", header.BlockAlign, header.NumChannels, header.BitsPerSample)
+	}
+	return nil
+}
+
+// padded returns the bytes a chunk of size takes up, as chunks of odd size
+// are followed by a byte of padding
+func padded(size uint32) int64 {
+	return int64(size) + int64(size%2)
+}
+
+// readWindow is the number of bytes of sample data read per call
+const readWindow = 64 * 1024
+
+// skip discards n bytes, seeking past them when the reader allows it
+func skip(r io.Reader, n int64) error {
+	if s, ok := r.(io.Seeker); ok {
+		_, err := s.Seek(n, io.SeekCurrent)
+		return err
+	}
+	_, err := io.CopyN(io.Discard, r, n)
+	return err
+}
+
+// remaining reports how many bytes are left in r, for readers that know
+func remaining(r io.Reader) (int64, bool) {
+	switch v := r.(type) {
+	case interface{ Len() int }:
+		return int64(v.Len()), true
+	case interface {
+		Stat() (fs.FileInfo, error)
+		io.Seeker
+	}:
+		info, err := v.Stat()
+		if err != nil {
+			return 0, false
+		}
+		pos, err := v.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return 0, false
+		}
+		return info.Size() - pos, true
+	}
+	return 0, false
+}
+
+// expectedFrames estimates how many frames the data chunk holds, for n
+// channels of them to be kept. The declared size is capped by what is
+// actually left in the stream, since streaming recorders often leave it
+// at 0 or 0xFFFFFFFF; where that is unknown, by maxPrealloc of memory
+// for the samples kept.
+func expectedFrames(r io.Reader, header WavHeader, dataSize uint32, n int) int {
+	if header.BlockAlign == 0 {
+		return 0
+	}
+	size := int64(dataSize)
+	left, known := remaining(r)
+	if known {
+		size = min(size, left)
+	}
+	if size < 0 {
+		return 0
+	}
+	frames := size / int64(header.BlockAlign)
+	if !known {
+		frames = min(frames, maxPrealloc/int64(8*max(1, n)))
+	}
+	return int(frames)
+}
+
+// readSamples reads the whole data chunk and returns the first n
+// channels of every frame as floats in [-1, 1)
+func readSamples(r io.Reader, header WavHeader, dataSize uint32, capacity, n int, limit readLimit) ([][]float64, error) {
+	channels := make([][]float64, n)
+	for i := range channels {
+		channels[i] = make([]float64, 0, capacity)
+	}
+	err := readChannels(r, header, dataSize, n, limit, func(windows [][]float64) {
+		for i, w := range windows {
+			channels[i] = append(channels[i], w...)
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	return channels, nil
+}
+
+// readFrames reads the data chunk frame by frame and hands the first
+// (left) channel to fn one window at a time, up to the limit. The window
+// is reused, so fn must not keep it.
+func readFrames(r io.Reader, header WavHeader, dataSize uint32, limit readLimit, fn func(window []float64)) error {
+	return readChannels(r, header, dataSize, 1, limit, func(windows [][]float64) {
+		fn(windows[0])
+	})
+}
+
+// readChannels reads the data chunk as readFrames does, handing fn a
+// window of each of the first n channels. Reads rarely end on a frame
+// boundary, so any partial frame is carried over to the next window; a
+// partial frame at the very end of the chunk is dropped. Once the limit's
+// context is done the read stops, as if the chunk ended there.
+func readChannels(r io.Reader, header WavHeader, dataSize uint32, n int, limit readLimit, fn func(windows [][]float64)) error {
+	width := int(header.BitsPerSample) / 8
+	convert, err := converter(header.AudioFormat, width)
+	if err != nil {
+		return err
+	}
+	channels := int(header.NumChannels)
+	if channels < 1 {
+		return formatErrorf("invalid channel count: %d", channels)
+	}
+	n = min(n, channels)
+	frameSize := width * channels
+
+	if m, ok := r.(*mappedFile); ok {
+		return readMapped(m, dataSize, width, frameSize, n, limit, convert, fn)
+	}
+	// 0 and 0xFFFFFFFF mean the recorder never filled in the size
+	if dataSize != 0 && dataSize != 0xFFFFFFFF {
+		r = io.LimitReader(r, int64(dataSize))
+	}
+
+	buf := make([]byte, max(frameSize, readWindow-readWindow%frameSize))
+	windows := make([][]float64, n)
+	for c := range windows {
+		windows[c] = make([]float64, 0, len(buf)/frameSize)
+	}
+	pending, frames := 0, 0
+	for {
+		read, err := r.Read(buf[pending:])
+		read += pending
+		whole := read - read%frameSize
+		for c := range windows {
+			windows[c] = convert(windows[c][:0], buf[min(c*width, whole):whole], frameSize)
+		}
+		if frames += len(windows[0]); limit.err != nil && frames > limit.frames {
+			return limit.err
+		}
+		if len(windows[0]) > 0 {
+			fn(windows)
+		}
+		pending = copy(buf, buf[whole:read])
+
+		if err == io.EOF || limit.stopping() {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read samples: %w", err)
+		}
+	}
+}
+
+// readMapped reads the data chunk of a file mapped into memory as
+// readChannels reads any other, converting the samples where they lie
+// rather than reading them into a buffer first
+func readMapped(m *mappedFile, dataSize uint32, width, frameSize, n int, limit readLimit, convert sampleConverter, fn func(windows [][]float64)) error {
+	data := m.unread()
+	if dataSize != 0 && dataSize != 0xFFFFFFFF {
+		data = data[:min(len(data), int(dataSize))]
+	}
+	m.Seek(int64(len(data)), io.SeekCurrent)
+	data = data[:len(data)-len(data)%frameSize]
+
+	step := max(frameSize, readWindow-readWindow%frameSize)
+	windows := make([][]float64, n)
+	for c := range windows {
+		windows[c] = make([]float64, 0, step/frameSize)
+	}
+	frames := 0
+	for at := 0; at < len(data); at += step {
+		chunk := data[at:min(len(data), at+step)]
+		for c := range windows {
+			windows[c] = convert(windows[c][:0], chunk[c*width:], frameSize)
+		}
+		if frames += len(windows[0]); limit.err != nil && frames > limit.frames {
+			return limit.err
+		}
+		fn(windows)
+		if limit.stopping() {
+			break
+		}
+	}
+	return nil
+}
+
+// sampleConverter appends to dst the samples of one channel in b, one
+// every stride bytes, as floats
+type sampleConverter func(dst []float64, b []byte, stride int) []float64
+
+// converter returns the converter for samples width bytes wide in
+// format, integer PCM or floating point
+func converter(format uint16, width int) (sampleConverter, error) {
+	switch {
+	case format == formatFloat && (width == 4 || width == 8):
+		return func(dst []float64, b []byte, stride int) []float64 {
+			return appendFloat(dst, b, width, stride)
+		}, nil
+	case format == formatPCM && width >= 1 && width <= 4:
+		return func(dst []float64, b []byte, stride int) []float64 {
+			return appendPCM(dst, b, width, stride)
+		}, nil
+	}
+	return nil, formatErrorf("unsupported bits per sample: %d", 8*width)
+}
+
+// appendFloat converts every stride bytes of little-endian IEEE floating
+// point samples, each width bytes wide, to floats appended to dst
+func appendFloat(dst []float64, b []byte, width, stride int) []float64 {
+	if width == 4 {
+		for i := 0; i+3 < len(b); i += stride {
+			dst = append(dst, float64(math.Float32frombits(binary.LittleEndian.Uint32(b[i:]))))
+		}
+		return dst
+	}
+	for i := 0; i+7 < len(b); i += stride {
+		dst = append(dst, math.Float64frombits(binary.LittleEndian.Uint64(b[i:])))
+	}
+	return dst
+}
+
+// appendPCM converts every stride bytes of little-endian integer PCM
+// samples, each width bytes wide, to floats appended to dst. 8-bit
+// samples are unsigned 0-255 centered at 128, wider ones are signed. Each
+// width has a loop of its own, so that nothing is decided per sample.
+func appendPCM(dst []float64, b []byte, width, stride int) []float64 {
+	switch width {
+	case 1:
+		for i := 0; i < len(b); i += stride {
+			dst = append(dst, (float64(b[i])-128.0)/128.0)
+		}
+	case 2:
+		for i := 0; i+1 < len(b); i += stride {
+			dst = append(dst, float64(int16(uint16(b[i])|uint16(b[i+1])<<8))/32768.0)
+		}
+	case 3:
+		for i := 0; i+2 < len(b); i += stride {
+			v := int32(uint32(b[i])<<8|uint32(b[i+1])<<16|uint32(b[i+2])<<24) >> 8
+			dst = append(dst, float64(v)/8388608.0)
+		}
+	default:
+		for i := 0; i+3 < len(b); i += stride {
+			dst = append(dst, float64(int32(binary.LittleEndian.Uint32(b[i:])))/2147483648.0)
+		}
+	}
+	return dst
+}
+
+// WriteWAV writes samples in [-1, 1] as a 16-bit mono WAV file, clipping
+// any beyond
+func WriteWAV(w io.Writer, samples []float64, sampleRate uint32) error {
+	const width = 2
+	size := uint32(len(samples) * width)
+	header := WavHeader{
+		ChunkID:       [4]byte{'R', 'I', 'F', 'F'},
+		ChunkSize:     36 + size,
+		Format:        [4]byte{'W', 'A', 'V', 'E'},
+		Subchunk1ID:   [4]byte{'f', 'm', 't', ' '},
+		Subchunk1Size: 16,
+		AudioFormat:   1,
+		NumChannels:   1,
+		SampleRate:    sampleRate,
+		ByteRate:      sampleRate * width,
+		BlockAlign:    width,
+		BitsPerSample: 8 * width,
+	}
+	out := make([]byte, 0, 44+size)
+	out, _ = binary.Append(out, binary.LittleEndian, header)
+	out = append(out, "data"...)
+	out = binary.LittleEndian.AppendUint32(out, size)
+	for _, v := range samples {
+		out = binary.LittleEndian.AppendUint16(out, uint16(int16(math.Round(max(-1, min(1, v))*32767))))
+	}
+	_, err := w.Write(out)
+	return err
+}
@@ -0,0 +1,233 @@
+package decoder
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+	"testing"
+	"testing/iotest"
+)
+
+// wavBytes builds a WAV file of the samples of each channel, all of equal
+// length, in format at bits per sample. Samples are to be multiples of
+// 1/128 in [-1, 1), which every width holds exactly. extra bytes are
+// written at the end of the data chunk and counted in its size.
+func wavBytes(format uint16, bits int, channels [][]float64, extra int) []byte {
+	width := bits / 8
+	var data []byte
+	for i := range channels[0] {
+		for _, ch := range channels {
+			v := ch[i]
+			switch {
+			case format == formatFloat && width == 4:
+				data = binary.LittleEndian.AppendUint32(data, math.Float32bits(float32(v)))
+			case format == formatFloat:
+				data = binary.LittleEndian.AppendUint64(data, math.Float64bits(v))
+			case width == 1:
+				data = append(data, byte(128+v*128))
+			default:
+				n := uint32(int32(v * float64(int64(1)<<(bits-1))))
+				for b := range width {
+					data = append(data, byte(n>>(8*b)))
+				}
+			}
+		}
+	}
+	data = append(data, make([]byte, extra)...)
+
+	align := width * len(channels)
+	var b bytes.Buffer
+	b.WriteString("RIFF")
+	binary.Write(&b, binary.LittleEndian, uint32(36+len(data)))
+	b.WriteString("WAVEfmt ")
+	for _, v := range []any{
+		uint32(16), format, uint16(len(channels)), uint32(44100),
+		uint32(44100 * align), uint16(align), uint16(bits),
+	} {
+		binary.Write(&b, binary.LittleEndian, v)
+	}
+	b.WriteString("data")
+	binary.Write(&b, binary.LittleEndian, uint32(len(data)))
+	b.Write(data)
+	return b.Bytes()
+}
+
+// ramp returns n samples stepping through every multiple of 1/128 that
+// wavBytes can write, from start
+func ramp(n, start int) []float64 {
+	s := make([]float64, n)
+	for i := range s {
+		s[i] = float64((i+start)%255-127) / 128
+	}
+	return s
+}
+
+// wavReaders are the ways a capture reaches readWAV: a stream of known
+// length, one of unknown length that returns a byte per read, so every
+// frame is split across reads, and a file mapped into memory
+var wavReaders = []struct {
+	name string
+	wrap func([]byte) io.Reader
+}{
+	{"buffer", func(b []byte) io.Reader { return bytes.NewReader(b) }},
+	{"one byte", func(b []byte) io.Reader { return iotest.OneByteReader(bytes.NewReader(b)) }},
+	{"mapped", func(b []byte) io.Reader {
+		return &mappedFile{Reader: bytes.NewReader(b), data: b, unmap: func() error { return nil }}
+	}},
+}
+
+func TestReadWAVFormats(t *testing.T) {
+	formats := []struct {
+		name   string
+		format uint16
+		bits   int
+	}{
+		{"8-bit", formatPCM, 8},
+		{"16-bit", formatPCM, 16},
+		{"24-bit", formatPCM, 24},
+		{"32-bit", formatPCM, 32},
+		{"32-bit float", formatFloat, 32},
+		{"64-bit float", formatFloat, 64},
+	}
+	// Frame counts that fill no whole number of read windows, or less
+	// than one
+	lengths := []int{1, 1001, readWindow/3 + 7}
+	for _, f := range formats {
+		for _, stereo := range []bool{false, true} {
+			for _, n := range lengths {
+				channels := [][]float64{ramp(n, 0)}
+				if stereo {
+					channels = append(channels, ramp(n, 100))
+				}
+				// A data chunk that ends partway through a frame: the
+				// partial frame is dropped
+				for _, extra := range []int{0, f.bits/8*len(channels) - 1} {
+					file := wavBytes(f.format, f.bits, channels, extra)
+					for _, r := range wavReaders {
+						got, header, err := readWAV(r.wrap(file), Options{Stereo: stereo})
+						name := f.name
+						if stereo {
+							name += " stereo"
+						}
+						if err != nil {
+							t.Fatalf("%s, %d frames, %d extra, %s: %v", name, n, extra, r.name, err)
+						}
+						if int(header.NumChannels) != len(channels) || len(got) != len(channels) {
+							t.Fatalf("%s, %d frames, %d extra, %s: got %d channels, want %d", name, n, extra, r.name, len(got), len(channels))
+						}
+						for c := range channels {
+							if len(got[c]) != n {
+								t.Fatalf("%s, %d frames, %d extra, %s: channel %d has %d samples, want %d", name, n, extra, r.name, c, len(got[c]), n)
+							}
+							for i, v := range got[c] {
+								if v != channels[c][i] {
+									t.Fatalf("%s, %d frames, %d extra, %s: channel %d sample %d is %v, want %v", name, n, extra, r.name, c, i, v, channels[c][i])
+								}
+							}
+						}
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestReadWAVRejects(t *testing.T) {
+	mono := [][]float64{ramp(100, 0)}
+	tests := []struct {
+		name  string
+		file  []byte
+		patch func(b []byte) // applied to the file before it is read
+	}{
+		{"block align", wavBytes(formatPCM, 16, mono, 0), func(b []byte) { b[32] = 3 }},
+		{"bits per sample", wavBytes(formatPCM, 16, mono, 0), func(b []byte) { b[34] = 12 }},
+		{"audio format", wavBytes(formatPCM, 16, mono, 0), func(b []byte) { b[20] = 2 }},
+		{"float width", wavBytes(formatFloat, 32, mono, 0), func(b []byte) { b[34], b[32] = 16, 2 }},
+		{"no channels", wavBytes(formatPCM, 16, mono, 0), func(b []byte) { b[22] = 0 }},
+		{"header cut short", wavBytes(formatPCM, 16, mono, 0)[:30], func([]byte) {}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.patch(tt.file)
+			_, _, err := readWAV(bytes.NewReader(tt.file), Options{})
+			var fe *FormatError
+			if !errors.As(err, &fe) {
+				t.Errorf("got %v, want a format error", err)
+			}
+		})
+	}
+}
+
+// extensible rewrites a 16-byte format chunk as WAVE_FORMAT_EXTENSIBLE
+// with the given subformat code
+func extensible(file []byte, sub uint16) []byte {
+	var ext bytes.Buffer
+	for _, v := range []any{uint16(22), binary.LittleEndian.Uint16(file[34:]), uint32(0), sub} {
+		binary.Write(&ext, binary.LittleEndian, v)
+	}
+	ext.Write(subFormatGUID[:])
+	out := append([]byte{}, file[:36]...)
+	binary.LittleEndian.PutUint32(out[4:], binary.LittleEndian.Uint32(out[4:])+uint32(ext.Len()))
+	binary.LittleEndian.PutUint32(out[16:], 16+uint32(ext.Len()))
+	binary.LittleEndian.PutUint16(out[20:], formatExtensible)
+	out = append(out, ext.Bytes()...)
+	return append(out, file[36:]...)
+}
+
+func TestReadWAVExtensible(t *testing.T) {
+	samples := ramp(500, 0)
+	for _, tt := range []struct {
+		name   string
+		format uint16
+		bits   int
+	}{
+		{"PCM", formatPCM, 24},
+		{"float", formatFloat, 32},
+	} {
+		got, _, err := readWAV(bytes.NewReader(extensible(wavBytes(tt.format, tt.bits, [][]float64{samples}, 0), tt.format)), Options{})
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		for i, v := range got[0] {
+			if v != samples[i] {
+				t.Fatalf("%s: sample %d is %v, want %v", tt.name, i, v, samples[i])
+			}
+		}
+	}
+	_, _, err := readWAV(bytes.NewReader(extensible(wavBytes(formatPCM, 16, [][]float64{samples}, 0), 2)), Options{})
+	var fe *FormatError
+	if !errors.As(err, &fe) {
+		t.Errorf("ADPCM subformat: got %v, want a format error", err)
+	}
+}
+
+// benchWAV is a minute of 16-bit stereo at 44.1 kHz, as a capture is
+// most often made
+func benchWAV() []byte {
+	n := 60 * 44100
+	return wavBytes(formatPCM, 16, [][]float64{ramp(n, 0), ramp(n, 100)}, 0)
+}
+
+func BenchmarkReadSamples(b *testing.B) {
+	file := benchWAV()
+	b.SetBytes(int64(len(file)))
+	b.ReportAllocs()
+	for b.Loop() {
+		if _, _, err := readWAV(bytes.NewReader(file), Options{}); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkAppendPCM16(b *testing.B) {
+	file := benchWAV()
+	data := file[44:]
+	dst := make([]float64, 0, len(data)/4)
+	b.SetBytes(int64(len(data)))
+	b.ReportAllocs()
+	for b.Loop() {
+		dst = appendPCM(dst[:0], data, 2, 4)
+	}
+}
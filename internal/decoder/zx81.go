@@ -0,0 +1,239 @@
+package decoder
+
+import (
+	"encoding/binary"
+	"strings"
+)
+
+// The ZX80 and ZX81 write no tones. Each bit is a burst of short pulses
+// followed by a gap, four pulses for 0 and nine for 1, and bytes go MSB
+// first with nothing between them. A file is simply the memory from the
+// system variables up to E_LINE, after, on the ZX81, the program's name
+// in the ZX81 character set with its last character inverted. No header
+// tone precedes it, only silence, and there is no checksum: a file is
+// whole when it reaches the length its E_LINE gives.
+//
+// Bursts are detected by counting pulse half-cycles and timing the quiet
+// between them, so hiss in the gaps, too fast to be a pulse, only adds to
+// the gap. Hiss loud enough to pass for pulses needs the pulse engine.
+const (
+	ZX81Noise    = 0.5    // fraction of a pulse half-cycle below which a half-cycle is hiss
+	ZX81BitGap   = 0.0006 // seconds of quiet that end a burst; the ROM leaves 1.3ms
+	ZX81FileGap  = 0.05   // seconds of quiet that end a file
+	ZX81MinHalfs = 5      // pulse half-cycles below which a burst is a click, not a bit
+	ZX81OneHalfs = 13     // pulse half-cycles from which a burst is a 1: 8 for 0, 18 for 1
+	ZX81Quiet    = 0.0013 // seconds of quiet the ROM leaves after each bit
+
+	ZX80Vars  = 0x4000 // where a ZX80 file loads
+	ZX81Vars  = 0x4009 // where a ZX81 file loads, after its name
+	ZX80Eline = 0x400A // the ZX80's E_LINE, the end of what it saves
+	ZX81Eline = 0x4014 // the ZX81's E_LINE
+)
+
+// zx81Timing classifies the ROM's pulses, 150us high and 150us low;
+// anything longer is part of a gap
+var zx81Timing = Timing{
+	Short: 0.000400,
+	Long:  0.002000,
+	Nominal: [numPulses]float64{
+		pulseShort: 0.000150,
+	},
+}
+
+var zx80System = System{
+	Name:      "zx80",
+	Timing:    &zx81Timing,
+	Demods:    []Demod{DemodZeroCrossing, DemodPulse},
+	newFramer: func() framer { return &zx81Framer{} },
+	check:     zx81Complete(false),
+	payload:   func(data []byte) int { return len(data) },
+	pack:      concatBlocks,
+	ext:       ".o",
+	identify:  identifyZX81(ZX80Vars),
+	encode:    encodeZX81,
+}
+
+var zx81System = System{
+	Name:      "zx81",
+	Timing:    &zx81Timing,
+	Demods:    []Demod{DemodZeroCrossing, DemodPulse},
+	newFramer: func() framer { return &zx81Framer{named: true} },
+	check:     zx81Complete(true),
+	payload:   func(data []byte) int { return len(data) - zx81NameLength(data) },
+	pack:      packP,
+	ext:       ".p",
+	describe:  zx81Names,
+	identify:  identifyZX81(ZX81Vars),
+	encode:    encodeZX81,
+	charset:   Charsets["zx81"],
+	dialect:   Dialects["zx81"],
+}
+
+// zx81Framer counts the pulses of each burst
+type zx81Framer struct {
+	named bool // files start with a name, as the ZX81's do
+
+	halves     int     // pulse half-cycles in the burst so far
+	burstStart int     // where the burst began
+	quiet      float64 // seconds since the last pulse half-cycle
+}
+
+func (f *zx81Framer) halfCycle(d *bitDecoder, p pulse) {
+	if p != pulseShort || d.length < ZX81Noise*d.timing.Nominal[pulseShort] {
+		f.quiet += d.length
+		if f.quiet >= ZX81BitGap && f.halves > 0 {
+			f.burst(d)
+		}
+		if f.quiet >= ZX81FileGap {
+			f.end(d)
+		}
+		return
+	}
+	if f.halves == 0 {
+		f.burstStart = d.at
+	}
+	f.halves++
+	f.quiet = 0
+}
+
+// burst reads the bit the burst just ended stands for
+func (f *zx81Framer) burst(d *bitDecoder) {
+	one := f.halves >= ZX81OneHalfs
+	if f.halves < ZX81MinHalfs {
+		f.halves = 0
+		return
+	}
+	f.halves = 0
+	if d.open == nil {
+		d.headerStart = f.burstStart
+		d.startData(pulseShort)
+		d.open.dataStart = f.burstStart
+	}
+	d.open.cells++
+	d.erasing = d.erasing || d.inDropout(f.burstStart, d.at)
+	d.shiftBit(one)
+	if d.bitCount == 0 && f.complete(d.open) {
+		f.end(d)
+	}
+}
+
+// complete reports whether a file has reached the length its E_LINE gives
+func (f *zx81Framer) complete(r *record) bool {
+	want := zx81Length(r.data, f.named)
+	return want > 0 && len(r.data) >= want
+}
+
+// finish reads the last burst, which the end of the stream leaves with
+// no gap after it
+func (f *zx81Framer) finish(d *bitDecoder, at int) {
+	if f.halves > 0 {
+		d.at = at
+		f.burst(d)
+	}
+}
+
+// end closes the file, if one is open
+func (f *zx81Framer) end(d *bitDecoder) {
+	d.closeRecord(d.at)
+	d.state = stateHeader
+	d.header = 0
+}
+
+// zx81Length returns the bytes a file holds, name included, once enough
+// of it is read to know, or 0
+func zx81Length(data []byte, named bool) int {
+	start, eline, name := ZX80Vars, ZX80Eline, 0
+	if named {
+		start, eline = ZX81Vars, ZX81Eline
+		name = zx81NameLength(data)
+		if name == 0 {
+			return 0
+		}
+	}
+	at := name + eline - start
+	if len(data) < at+2 {
+		return 0
+	}
+	end := int(binary.LittleEndian.Uint16(data[at:]))
+	if end <= start {
+		return 0
+	}
+	return name + end - start
+}
+
+// zx81NameLength returns the length of the name at the start of a ZX81
+// file, up to and including its inverted last character, or 0 if none
+// has been read
+func zx81NameLength(data []byte) int {
+	for i, b := range data {
+		if b&0x80 != 0 {
+			return i + 1
+		}
+	}
+	return 0
+}
+
+// identifyZX81 returns an identify for files loading at vars, which all
+// hold a BASIC program and its variables
+func identifyZX81(vars int) func(records []Record) {
+	return func(records []Record) {
+		for i := range records {
+			records[i].Type, records[i].LoadAddress = RecordBasic, vars
+			records[i].setBody(records[i].Data[zx81NameLength(records[i].Data):])
+		}
+	}
+}
+
+// zx81Complete returns a check that a file, named or not, is as long as
+// its E_LINE says and read cleanly
+func zx81Complete(named bool) func(r *record) bool {
+	return func(r *record) bool {
+		want := zx81Length(r.data, named)
+		return want > 0 && len(r.data) == want && cleanlyFramed(r)
+	}
+}
+
+// packP writes ZX81 files as .P files, which are the memory image
+// without the name
+func packP(blocks []Record) []byte {
+	var out []byte
+	for _, b := range blocks {
+		out = append(out, b.Data[zx81NameLength(b.Data):]...)
+	}
+	return out
+}
+
+// zx81Chars is the ZX81 character set from code 0, as far as names use it
+var zx81Chars = []rune(` ▘▝▀▖▌▞▛▒▒▒"£$:?()><=+-*/;,.0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZ`)
+
+// zx81Names gives the name each ZX81 file was saved under
+func zx81Names(records []record) []string {
+	lines := make([]string, len(records))
+	for i, r := range records {
+		var name strings.Builder
+		for _, b := range r.data[:zx81NameLength(r.data)] {
+			if c := int(b & 0x7F); c < len(zx81Chars) {
+				name.WriteRune(zx81Chars[c])
+			} else {
+				name.WriteRune('?')
+			}
+		}
+		lines[i] = `saved as "` + name.String() + `"`
+	}
+	return lines
+}
+
+// encodeZX81 writes a file's bits MSB first, each as its burst of pulses
+// and the quiet after it
+func encodeZX81(t *tape, timing *Timing, r Record) {
+	for _, b := range r.Data {
+		for i := 7; i >= 0; i-- {
+			pulses := 4
+			if b>>i&1 == 1 {
+				pulses = 9
+			}
+			t.halves(2*pulses, timing.Nominal[pulseShort])
+			t.silence(ZX81Quiet)
+		}
+	}
+}
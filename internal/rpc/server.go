@@ -0,0 +1,99 @@
+// Package rpc serves the streaming decoder over gRPC
+package rpc
+
+//go:generate protoc -I wavriderpb --go_out=wavriderpb --go_opt=paths=source_relative --go-grpc_out=wavriderpb --go-grpc_opt=paths=source_relative wavriderpb/decoder.proto
+
+import (
+	"io"
+	"wavrider/internal/decoder"
+	"wavrider/internal/rpc/wavriderpb"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Server implements the Decoder service on top of decoder.DecodeStream
+type Server struct {
+	wavriderpb.UnimplementedDecoderServer
+
+	// Options is used for every call
+	Options decoder.Options
+}
+
+// Decode feeds incoming audio chunks through the streaming decoder and
+// sends each event back as soon as it happens
+func (s *Server) Decode(stream wavriderpb.Decoder_DecodeServer) error {
+	var sendErr error
+	err := decoder.DecodeStream(&chunkReader{stream: stream}, s.Options, func(e decoder.Event) {
+		if sendErr == nil {
+			sendErr = stream.Send(eventToProto(e))
+		}
+	})
+	if sendErr != nil {
+		return sendErr
+	}
+	if err != nil {
+		if _, ok := status.FromError(err); ok {
+			return err
+		}
+		return status.Errorf(codes.InvalidArgument, "decode: %v", err)
+	}
+	return nil
+}
+
+func eventToProto(e decoder.Event) *wavriderpb.DecodeEvent {
+	switch e.Kind {
+	case decoder.EventRecordStart:
+		return &wavriderpb.DecodeEvent{Event: &wavriderpb.DecodeEvent_RecordStarted{
+			RecordStarted: &wavriderpb.RecordStarted{
+				Program:            int32(e.Program),
+				HeaderStartSeconds: e.Start,
+				SyncSeconds:        e.Time,
+			},
+		}}
+	case decoder.EventDropout:
+		return &wavriderpb.DecodeEvent{Event: &wavriderpb.DecodeEvent_Dropout{
+			Dropout: &wavriderpb.Dropout{
+				StartSeconds: e.Start,
+				EndSeconds:   e.Time,
+			},
+		}}
+	default:
+		erased := make([]int32, len(e.Erased))
+		for i, off := range e.Erased {
+			erased[i] = int32(off)
+		}
+		return &wavriderpb.DecodeEvent{Event: &wavriderpb.DecodeEvent_Record{
+			Record: &wavriderpb.Record{
+				Program:      int32(e.Program),
+				StartSeconds: e.Start,
+				EndSeconds:   e.Time,
+				Data:         e.Data,
+				ChecksumOk:   e.ChecksumOK,
+				Confidence:   e.Confidence,
+				Erased:       erased,
+			},
+		}}
+	}
+}
+
+// chunkReader presents the client's chunk stream as an io.Reader
+type chunkReader struct {
+	stream wavriderpb.Decoder_DecodeServer
+	buf    []byte
+}
+
+func (r *chunkReader) Read(p []byte) (int, error) {
+	for len(r.buf) == 0 {
+		chunk, err := r.stream.Recv()
+		if err != nil {
+			return 0, err // io.EOF once the client closes its side
+		}
+		r.buf = chunk.GetData()
+	}
+	n := copy(p, r.buf)
+	r.buf = r.buf[n:]
+	return n, nil
+}
+
+var _ io.Reader = (*chunkReader)(nil)
@@ -0,0 +1,466 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.9
+// 	protoc        v5.28.3
+// source: decoder.proto
+
+package wavriderpb
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type AudioChunk struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Data          []byte                 `protobuf:"bytes,1,opt,name=data,proto3" json:"data,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *AudioChunk) Reset() {
+	*x = AudioChunk{}
+	mi := &file_decoder_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *AudioChunk) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*AudioChunk) ProtoMessage() {}
+
+func (x *AudioChunk) ProtoReflect() protoreflect.Message {
+	mi := &file_decoder_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use AudioChunk.ProtoReflect.Descriptor instead.
+func (*AudioChunk) Descriptor() ([]byte, []int) {
+	return file_decoder_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *AudioChunk) GetData() []byte {
+	if x != nil {
+		return x.Data
+	}
+	return nil
+}
+
+type DecodeEvent struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Types that are valid to be assigned to Event:
+	//
+	//	*DecodeEvent_RecordStarted
+	//	*DecodeEvent_Record
+	//	*DecodeEvent_Dropout
+	Event         isDecodeEvent_Event `protobuf_oneof:"event"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *DecodeEvent) Reset() {
+	*x = DecodeEvent{}
+	mi := &file_decoder_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *DecodeEvent) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DecodeEvent) ProtoMessage() {}
+
+func (x *DecodeEvent) ProtoReflect() protoreflect.Message {
+	mi := &file_decoder_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DecodeEvent.ProtoReflect.Descriptor instead.
+func (*DecodeEvent) Descriptor() ([]byte, []int) {
+	return file_decoder_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *DecodeEvent) GetEvent() isDecodeEvent_Event {
+	if x != nil {
+		return x.Event
+	}
+	return nil
+}
+
+func (x *DecodeEvent) GetRecordStarted() *RecordStarted {
+	if x != nil {
+		if x, ok := x.Event.(*DecodeEvent_RecordStarted); ok {
+			return x.RecordStarted
+		}
+	}
+	return nil
+}
+
+func (x *DecodeEvent) GetRecord() *Record {
+	if x != nil {
+		if x, ok := x.Event.(*DecodeEvent_Record); ok {
+			return x.Record
+		}
+	}
+	return nil
+}
+
+func (x *DecodeEvent) GetDropout() *Dropout {
+	if x != nil {
+		if x, ok := x.Event.(*DecodeEvent_Dropout); ok {
+			return x.Dropout
+		}
+	}
+	return nil
+}
+
+type isDecodeEvent_Event interface {
+	isDecodeEvent_Event()
+}
+
+type DecodeEvent_RecordStarted struct {
+	RecordStarted *RecordStarted `protobuf:"bytes,1,opt,name=record_started,json=recordStarted,proto3,oneof"`
+}
+
+type DecodeEvent_Record struct {
+	Record *Record `protobuf:"bytes,2,opt,name=record,proto3,oneof"`
+}
+
+type DecodeEvent_Dropout struct {
+	Dropout *Dropout `protobuf:"bytes,3,opt,name=dropout,proto3,oneof"`
+}
+
+func (*DecodeEvent_RecordStarted) isDecodeEvent_Event() {}
+
+func (*DecodeEvent_Record) isDecodeEvent_Event() {}
+
+func (*DecodeEvent_Dropout) isDecodeEvent_Event() {}
+
+type RecordStarted struct {
+	state              protoimpl.MessageState `protogen:"open.v1"`
+	Program            int32                  `protobuf:"varint,1,opt,name=program,proto3" json:"program,omitempty"`
+	HeaderStartSeconds float64                `protobuf:"fixed64,2,opt,name=header_start_seconds,json=headerStartSeconds,proto3" json:"header_start_seconds,omitempty"`
+	SyncSeconds        float64                `protobuf:"fixed64,3,opt,name=sync_seconds,json=syncSeconds,proto3" json:"sync_seconds,omitempty"`
+	unknownFields      protoimpl.UnknownFields
+	sizeCache          protoimpl.SizeCache
+}
+
+func (x *RecordStarted) Reset() {
+	*x = RecordStarted{}
+	mi := &file_decoder_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *RecordStarted) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*RecordStarted) ProtoMessage() {}
+
+func (x *RecordStarted) ProtoReflect() protoreflect.Message {
+	mi := &file_decoder_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use RecordStarted.ProtoReflect.Descriptor instead.
+func (*RecordStarted) Descriptor() ([]byte, []int) {
+	return file_decoder_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *RecordStarted) GetProgram() int32 {
+	if x != nil {
+		return x.Program
+	}
+	return 0
+}
+
+func (x *RecordStarted) GetHeaderStartSeconds() float64 {
+	if x != nil {
+		return x.HeaderStartSeconds
+	}
+	return 0
+}
+
+func (x *RecordStarted) GetSyncSeconds() float64 {
+	if x != nil {
+		return x.SyncSeconds
+	}
+	return 0
+}
+
+type Record struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Program       int32                  `protobuf:"varint,1,opt,name=program,proto3" json:"program,omitempty"`
+	StartSeconds  float64                `protobuf:"fixed64,2,opt,name=start_seconds,json=startSeconds,proto3" json:"start_seconds,omitempty"`
+	EndSeconds    float64                `protobuf:"fixed64,3,opt,name=end_seconds,json=endSeconds,proto3" json:"end_seconds,omitempty"`
+	Data          []byte                 `protobuf:"bytes,4,opt,name=data,proto3" json:"data,omitempty"`
+	ChecksumOk    bool                   `protobuf:"varint,5,opt,name=checksum_ok,json=checksumOk,proto3" json:"checksum_ok,omitempty"`
+	Confidence    float64                `protobuf:"fixed64,6,opt,name=confidence,proto3" json:"confidence,omitempty"`
+	Erased        []int32                `protobuf:"varint,7,rep,packed,name=erased,proto3" json:"erased,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Record) Reset() {
+	*x = Record{}
+	mi := &file_decoder_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Record) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Record) ProtoMessage() {}
+
+func (x *Record) ProtoReflect() protoreflect.Message {
+	mi := &file_decoder_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Record.ProtoReflect.Descriptor instead.
+func (*Record) Descriptor() ([]byte, []int) {
+	return file_decoder_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *Record) GetProgram() int32 {
+	if x != nil {
+		return x.Program
+	}
+	return 0
+}
+
+func (x *Record) GetStartSeconds() float64 {
+	if x != nil {
+		return x.StartSeconds
+	}
+	return 0
+}
+
+func (x *Record) GetEndSeconds() float64 {
+	if x != nil {
+		return x.EndSeconds
+	}
+	return 0
+}
+
+func (x *Record) GetData() []byte {
+	if x != nil {
+		return x.Data
+	}
+	return nil
+}
+
+func (x *Record) GetChecksumOk() bool {
+	if x != nil {
+		return x.ChecksumOk
+	}
+	return false
+}
+
+func (x *Record) GetConfidence() float64 {
+	if x != nil {
+		return x.Confidence
+	}
+	return 0
+}
+
+func (x *Record) GetErased() []int32 {
+	if x != nil {
+		return x.Erased
+	}
+	return nil
+}
+
+type Dropout struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	StartSeconds  float64                `protobuf:"fixed64,1,opt,name=start_seconds,json=startSeconds,proto3" json:"start_seconds,omitempty"`
+	EndSeconds    float64                `protobuf:"fixed64,2,opt,name=end_seconds,json=endSeconds,proto3" json:"end_seconds,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Dropout) Reset() {
+	*x = Dropout{}
+	mi := &file_decoder_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Dropout) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Dropout) ProtoMessage() {}
+
+func (x *Dropout) ProtoReflect() protoreflect.Message {
+	mi := &file_decoder_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Dropout.ProtoReflect.Descriptor instead.
+func (*Dropout) Descriptor() ([]byte, []int) {
+	return file_decoder_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *Dropout) GetStartSeconds() float64 {
+	if x != nil {
+		return x.StartSeconds
+	}
+	return 0
+}
+
+func (x *Dropout) GetEndSeconds() float64 {
+	if x != nil {
+		return x.EndSeconds
+	}
+	return 0
+}
+
+var File_decoder_proto protoreflect.FileDescriptor
+
+const file_decoder_proto_rawDesc = "" +
+	"\n" +
+	"\rdecoder.proto\x12\vwavrider.v1\" \n" +
+	"\n" +
+	"AudioChunk\x12\x12\n" +
+	"\x04data\x18\x01 \x01(\fR\x04data\"\xbc\x01\n" +
+	"\vDecodeEvent\x12C\n" +
+	"\x0erecord_started\x18\x01 \x01(\v2\x1a.wavrider.v1.RecordStartedH\x00R\rrecordStarted\x12-\n" +
+	"\x06record\x18\x02 \x01(\v2\x13.wavrider.v1.RecordH\x00R\x06record\x120\n" +
+	"\adropout\x18\x03 \x01(\v2\x14.wavrider.v1.DropoutH\x00R\adropoutB\a\n" +
+	"\x05event\"~\n" +
+	"\rRecordStarted\x12\x18\n" +
+	"\aprogram\x18\x01 \x01(\x05R\aprogram\x120\n" +
+	"\x14header_start_seconds\x18\x02 \x01(\x01R\x12headerStartSeconds\x12!\n" +
+	"\fsync_seconds\x18\x03 \x01(\x01R\vsyncSeconds\"\xd5\x01\n" +
+	"\x06Record\x12\x18\n" +
+	"\aprogram\x18\x01 \x01(\x05R\aprogram\x12#\n" +
+	"\rstart_seconds\x18\x02 \x01(\x01R\fstartSeconds\x12\x1f\n" +
+	"\vend_seconds\x18\x03 \x01(\x01R\n" +
+	"endSeconds\x12\x12\n" +
+	"\x04data\x18\x04 \x01(\fR\x04data\x12\x1f\n" +
+	"\vchecksum_ok\x18\x05 \x01(\bR\n" +
+	"checksumOk\x12\x1e\n" +
+	"\n" +
+	"confidence\x18\x06 \x01(\x01R\n" +
+	"confidence\x12\x16\n" +
+	"\x06erased\x18\a \x03(\x05R\x06erased\"O\n" +
+	"\aDropout\x12#\n" +
+	"\rstart_seconds\x18\x01 \x01(\x01R\fstartSeconds\x12\x1f\n" +
+	"\vend_seconds\x18\x02 \x01(\x01R\n" +
+	"endSeconds2J\n" +
+	"\aDecoder\x12?\n" +
+	"\x06Decode\x12\x17.wavrider.v1.AudioChunk\x1a\x18.wavrider.v1.DecodeEvent(\x010\x01B\"Z wavrider/internal/rpc/wavriderpbb\x06proto3"
+
+var (
+	file_decoder_proto_rawDescOnce sync.Once
+	file_decoder_proto_rawDescData []byte
+)
+
+func file_decoder_proto_rawDescGZIP() []byte {
+	file_decoder_proto_rawDescOnce.Do(func() {
+		file_decoder_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_decoder_proto_rawDesc), len(file_decoder_proto_rawDesc)))
+	})
+	return file_decoder_proto_rawDescData
+}
+
+var file_decoder_proto_msgTypes = make([]protoimpl.MessageInfo, 5)
+var file_decoder_proto_goTypes = []any{
+	(*AudioChunk)(nil),    // 0: wavrider.v1.AudioChunk
+	(*DecodeEvent)(nil),   // 1: wavrider.v1.DecodeEvent
+	(*RecordStarted)(nil), // 2: wavrider.v1.RecordStarted
+	(*Record)(nil),        // 3: wavrider.v1.Record
+	(*Dropout)(nil),       // 4: wavrider.v1.Dropout
+}
+var file_decoder_proto_depIdxs = []int32{
+	2, // 0: wavrider.v1.DecodeEvent.record_started:type_name -> wavrider.v1.RecordStarted
+	3, // 1: wavrider.v1.DecodeEvent.record:type_name -> wavrider.v1.Record
+	4, // 2: wavrider.v1.DecodeEvent.dropout:type_name -> wavrider.v1.Dropout
+	0, // 3: wavrider.v1.Decoder.Decode:input_type -> wavrider.v1.AudioChunk
+	1, // 4: wavrider.v1.Decoder.Decode:output_type -> wavrider.v1.DecodeEvent
+	4, // [4:5] is the sub-list for method output_type
+	3, // [3:4] is the sub-list for method input_type
+	3, // [3:3] is the sub-list for extension type_name
+	3, // [3:3] is the sub-list for extension extendee
+	0, // [0:3] is the sub-list for field type_name
+}
+
+func init() { file_decoder_proto_init() }
+func file_decoder_proto_init() {
+	if File_decoder_proto != nil {
+		return
+	}
+	file_decoder_proto_msgTypes[1].OneofWrappers = []any{
+		(*DecodeEvent_RecordStarted)(nil),
+		(*DecodeEvent_Record)(nil),
+		(*DecodeEvent_Dropout)(nil),
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_decoder_proto_rawDesc), len(file_decoder_proto_rawDesc)),
+			NumEnums:      0,
+			NumMessages:   5,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_decoder_proto_goTypes,
+		DependencyIndexes: file_decoder_proto_depIdxs,
+		MessageInfos:      file_decoder_proto_msgTypes,
+	}.Build()
+	File_decoder_proto = out.File
+	file_decoder_proto_goTypes = nil
+	file_decoder_proto_depIdxs = nil
+}
@@ -0,0 +1,115 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.5.1
+// - protoc             v5.28.3
+// source: decoder.proto
+
+package wavriderpb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	Decoder_Decode_FullMethodName = "/wavrider.v1.Decoder/Decode"
+)
+
+// DecoderClient is the client API for Decoder service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type DecoderClient interface {
+	Decode(ctx context.Context, opts ...grpc.CallOption) (grpc.BidiStreamingClient[AudioChunk, DecodeEvent], error)
+}
+
+type decoderClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewDecoderClient(cc grpc.ClientConnInterface) DecoderClient {
+	return &decoderClient{cc}
+}
+
+func (c *decoderClient) Decode(ctx context.Context, opts ...grpc.CallOption) (grpc.BidiStreamingClient[AudioChunk, DecodeEvent], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &Decoder_ServiceDesc.Streams[0], Decoder_Decode_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[AudioChunk, DecodeEvent]{ClientStream: stream}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Decoder_DecodeClient = grpc.BidiStreamingClient[AudioChunk, DecodeEvent]
+
+// DecoderServer is the server API for Decoder service.
+// All implementations must embed UnimplementedDecoderServer
+// for forward compatibility.
+type DecoderServer interface {
+	Decode(grpc.BidiStreamingServer[AudioChunk, DecodeEvent]) error
+	mustEmbedUnimplementedDecoderServer()
+}
+
+// UnimplementedDecoderServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedDecoderServer struct{}
+
+func (UnimplementedDecoderServer) Decode(grpc.BidiStreamingServer[AudioChunk, DecodeEvent]) error {
+	return status.Errorf(codes.Unimplemented, "method Decode not implemented")
+}
+func (UnimplementedDecoderServer) mustEmbedUnimplementedDecoderServer() {}
+func (UnimplementedDecoderServer) testEmbeddedByValue()                 {}
+
+// UnsafeDecoderServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to DecoderServer will
+// result in compilation errors.
+type UnsafeDecoderServer interface {
+	mustEmbedUnimplementedDecoderServer()
+}
+
+func RegisterDecoderServer(s grpc.ServiceRegistrar, srv DecoderServer) {
+	// If the following call pancis, it indicates UnimplementedDecoderServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&Decoder_ServiceDesc, srv)
+}
+
+func _Decoder_Decode_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(DecoderServer).Decode(&grpc.GenericServerStream[AudioChunk, DecodeEvent]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Decoder_DecodeServer = grpc.BidiStreamingServer[AudioChunk, DecodeEvent]
+
+// Decoder_ServiceDesc is the grpc.ServiceDesc for Decoder service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var Decoder_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "wavrider.v1.Decoder",
+	HandlerType: (*DecoderServer)(nil),
+	Methods:     []grpc.MethodDesc{},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "Decode",
+			Handler:       _Decoder_Decode_Handler,
+			ServerStreams: true,
+			ClientStreams: true,
+		},
+	},
+	Metadata: "decoder.proto",
+}